@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// namespaceHeader selects the namespace of a request, see api.NamespaceHeader
+const namespaceHeader = "X-KV-Namespace"
+
+// tagHeaderPrefix starts the headers carrying the tags of a value, see api.TagHeaderPrefix
+const tagHeaderPrefix = "X-KV-Tag-"
+
+// client calls the go-kv HTTP API
+type client struct {
+	baseURL   string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+func newClient(baseURL, token, namespace string, timeout time.Duration) *client {
+	return &client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		token:     token,
+		namespace: namespace,
+		http:      &http.Client{Timeout: timeout},
+	}
+}
+
+// apiError is a response with a status outside 2xx
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+// do sends a request with body encoded as JSON, when not nil, and decodes the response into out,
+// when not nil. Errors returned by the server are reported as *apiError.
+func (c *client) do(method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// send sends a request like do and returns the response for the caller to read and close
+func (c *client) send(method, path string, query url.Values, body any) (*http.Response, error) {
+	if body == nil {
+		return c.sendBody(method, path, query, nil, nil)
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendBody(method, path, query, bytes.NewReader(raw), http.Header{"Content-Type": {"application/json"}})
+}
+
+// sendBody sends a request with body as it is, with header added to the request headers
+func (c *client) sendBody(method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set(namespaceHeader, c.namespace)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var problem struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(raw))
+		if json.Unmarshal(raw, &problem) == nil {
+			message = problem.Detail
+			if message == "" {
+				message = problem.Title
+			}
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &apiError{Status: resp.StatusCode, Message: message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// defaultBatchSize is the number of keys sent per request by import and restore
+const defaultBatchSize = 500
+
+// streamedValueSize is the size from which import and restore send a value on its own to
+// /v1/keys/{key}, where the server can store it in chunk files instead of memory
+const streamedValueSize = engine.DefaultBlobThreshold
+
+// command is a subcommand of gokv, also available in the interactive shell
+type command struct {
+	name    string
+	args    string // Arguments shown in the usage
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// Assigned in init because help refers to the list
+	commands = []command{
+		{"get", "KEY", "Print the value of a key", (*cli).get},
+		{"set", "KEY VALUE", "Set a key", (*cli).set},
+		{"del", "KEY...", "Delete keys", (*cli).del},
+		{"list", "", "Print every key and value", (*cli).list},
+		{"scan", "[-limit N] [PATTERN]", "Print the keys matching a glob pattern, in order", (*cli).scan},
+		{"import", "[-batch-size N] FILE", "Set the keys of a JSON array or JSON lines file, - for stdin", (*cli).importFile},
+		{"flush", "-y", "Delete every key of the namespace", (*cli).flush},
+		{"compact", "", "Compact the flushed data of the namespace", (*cli).compact},
+		{"stats", "[-top N]", "Print the engine statistics of the namespace", (*cli).stats},
+		{"backup", "FILE", "Write every key to a JSON lines file, - for stdout", (*cli).backup},
+		{"restore", "-y [-batch-size N] FILE", "Replace the namespace with the keys of a backup", (*cli).restore},
+		{"completion", "bash|zsh|fish", "Print a shell completion script", (*cli).completion},
+		{"help", "[COMMAND]", "Show the commands or the usage of one", (*cli).help},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// exec runs the command named by args[0]
+func (c *cli) exec(args []string) error {
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return usagef("unknown command %q, run \"gokv help\" for the list", args[0])
+	}
+	return cmd.run(c, args[1:])
+}
+
+func printCommands(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	tw.Flush()
+}
+
+// parseArgs parses the flags of a command and checks the number of remaining arguments.
+// max is -1 for no limit.
+func parseArgs(name string, args []string, min, max int, setup func(*flag.FlagSet)) ([]string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	if setup != nil {
+		setup(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, usagef("%s: %v", name, err)
+	}
+	rest := flags.Args()
+	if len(rest) < min || (max >= 0 && len(rest) > max) {
+		cmd, _ := findCommand(name)
+		return nil, usagef("usage: gokv %s %s", name, cmd.args)
+	}
+	return rest, nil
+}
+
+func (c *cli) get(args []string) error {
+	args, err := parseArgs("get", args, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		ValueB64 []byte `json:"value_b64,omitempty"` // Values that are not valid UTF-8
+	}
+	if err := c.client.do(http.MethodGet, "/get", url.Values{"key": {args[0]}}, nil, &result); err != nil {
+		return err
+	}
+	if result.ValueB64 != nil {
+		result.Value = string(result.ValueB64)
+	}
+	if c.output == outputRaw {
+		_, err := fmt.Fprintln(c.stdout, result.Value)
+		return err
+	}
+	return c.printPairs([]kvPair{{Key: result.Key, Value: result.Value}}, result)
+}
+
+func (c *cli) set(args []string) error {
+	args, err := parseArgs("set", args, 2, 2, nil)
+	if err != nil {
+		return err
+	}
+	var result map[string]any
+	body := map[string]string{"key": args[0], "value": args[1]}
+	if err := c.client.do(http.MethodPost, "/set", nil, body, &result); err != nil {
+		return err
+	}
+	return c.printMessage(result)
+}
+
+func (c *cli) del(args []string) error {
+	args, err := parseArgs("del", args, 1, -1, nil)
+	if err != nil {
+		return err
+	}
+	var result map[string]any
+	if len(args) == 1 {
+		err = c.client.do(http.MethodDelete, "/delete", url.Values{"key": {args[0]}}, nil, &result)
+	} else {
+		err = c.client.do(http.MethodPost, "/batch/delete", nil, args, &result)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printMessage(result)
+}
+
+// kvPair is a key and its string value, with the fields of the /batch/set records
+type kvPair struct {
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ValueB64    []byte            `json:"value_b64,omitempty"` // Values that are not valid UTF-8
+	ContentType string            `json:"content_type,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// record is a key and its value as written by backup and read by import and restore, see
+// /admin/export. Records without a type are strings, the others have the fields of their
+// /types endpoint.
+type record struct {
+	kvPair
+	Type          string            `json:"type,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+	Values        []string          `json:"values,omitempty"`
+	Members       []string          `json:"members,omitempty"`
+	ScoredMembers []engine.ZMember  `json:"scored_members,omitempty"`
+}
+
+// typePaths are the endpoints that set the value of a typed record, keyed by type
+var typePaths = map[string]string{
+	string(engine.TypeHash): "/types/hash/set",
+	string(engine.TypeList): "/types/list/rpush",
+	string(engine.TypeSet):  "/types/set/add",
+	string(engine.TypeZSet): "/types/zset/add",
+}
+
+// text returns the value as it is stored
+func (p kvPair) text() string {
+	if p.ValueB64 != nil {
+		return string(p.ValueB64)
+	}
+	return p.Value
+}
+
+// fetchAll returns every key and value of the namespace, sorted by key
+func (c *cli) fetchAll() ([]kvPair, error) {
+	// Values are strings, or the body of /get for values that are not valid UTF-8
+	var data map[string]json.RawMessage
+	if err := c.client.do(http.MethodGet, "/list", nil, nil, &data); err != nil {
+		return nil, err
+	}
+	pairs := make([]kvPair, 0, len(data))
+	for key, value := range data {
+		pair := kvPair{Key: key}
+		target := any(&pair)
+		if len(value) > 0 && value[0] == '"' {
+			target = &pair.Value
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return nil, fmt.Errorf("invalid value of %q: %w", key, err)
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs, nil
+}
+
+func (c *cli) list(args []string) error {
+	if _, err := parseArgs("list", args, 0, 0, nil); err != nil {
+		return err
+	}
+	pairs, err := c.fetchAll()
+	if err != nil {
+		return err
+	}
+	return c.printPairs(pairs, pairsObject(pairs))
+}
+
+func (c *cli) scan(args []string) error {
+	limit := 0
+	args, err := parseArgs("scan", args, 0, 1, func(flags *flag.FlagSet) {
+		flags.IntVar(&limit, "limit", 0, "")
+	})
+	if err != nil {
+		return err
+	}
+	pattern := "*"
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return usagef("scan: invalid pattern %q", pattern)
+	}
+
+	pairs, err := c.fetchAll()
+	if err != nil {
+		return err
+	}
+	matched := pairs[:0]
+	for _, pair := range pairs {
+		if ok, _ := path.Match(pattern, pair.Key); ok {
+			matched = append(matched, pair)
+			if limit > 0 && len(matched) == limit {
+				break
+			}
+		}
+	}
+	return c.printPairs(matched, pairsObject(matched))
+}
+
+func (c *cli) importFile(args []string) error {
+	batchSize := defaultBatchSize
+	args, err := parseArgs("import", args, 1, 1, func(flags *flag.FlagSet) {
+		flags.IntVar(&batchSize, "batch-size", defaultBatchSize, "")
+	})
+	if err != nil {
+		return err
+	}
+	count, err := c.importRecords(args[0], batchSize)
+	if err != nil {
+		return err
+	}
+	return c.printMessage(map[string]any{"message": fmt.Sprintf("Imported %d keys", count), "keys_set": count})
+}
+
+// importRecords sets the keys of file: strings through /batch/set, batchSize at a time, or on
+// their own when large, and the other types one key at a time through their /types endpoint
+func (c *cli) importRecords(file string, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, usagef("the batch size must be positive")
+	}
+	reader, closeFile, err := c.open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFile()
+
+	count := 0
+	batch := make([]kvPair, 0, batchSize)
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := c.client.do(http.MethodPost, "/batch/set", nil, batch, nil); err != nil {
+			return fmt.Errorf("import stopped after %d keys: %w", count, err)
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = readRecords(reader, func(rec record) error {
+		if rec.Key == "" {
+			return errors.New("every record needs a key")
+		}
+		if rec.Type == "" || rec.Type == string(engine.TypeString) {
+			if len(rec.text()) < streamedValueSize {
+				batch = append(batch, rec.kvPair)
+				if len(batch) == batchSize {
+					return send()
+				}
+				return nil
+			}
+			if err := c.putValue(rec.kvPair); err != nil {
+				return fmt.Errorf("import stopped after %d keys: %w", count, err)
+			}
+			count++
+			return nil
+		}
+
+		path, ok := typePaths[rec.Type]
+		if !ok {
+			return fmt.Errorf("unknown type %q of key %q", rec.Type, rec.Key)
+		}
+		if err := c.client.do(http.MethodPost, path, nil, rec, nil); err != nil {
+			return fmt.Errorf("import stopped after %d keys: %w", count, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, send()
+}
+
+// putValue sets a string value through /v1/keys/{key}
+func (c *cli) putValue(pair kvPair) error {
+	header := http.Header{}
+	if pair.ContentType != "" {
+		header.Set("Content-Type", pair.ContentType)
+	}
+	for name, tag := range pair.Tags {
+		header.Set(tagHeaderPrefix+name, tag)
+	}
+	path := (&url.URL{Path: "/v1/keys/" + pair.Key}).EscapedPath()
+	resp, err := c.client.sendBody(http.MethodPut, path, nil, strings.NewReader(pair.text()), header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// readRecords calls fn for every record of a JSON array or of JSON lines
+func readRecords(r io.Reader, fn func(record) error) error {
+	buffered := bufio.NewReader(r)
+	decoder := json.NewDecoder(buffered)
+
+	first, err := firstByte(buffered)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	for decoder.More() {
+		var rec record
+		if err := decoder.Decode(&rec); err != nil {
+			return fmt.Errorf("invalid record: %w", err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstByte returns the first byte of r that is not white space without consuming it
+func firstByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// open opens file for reading, or stdin for "-"
+func (c *cli) open(file string) (io.Reader, func(), error) {
+	if file == "-" {
+		return c.stdin, func() {}, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+func (c *cli) flush(args []string) error {
+	confirmed := false
+	if _, err := parseArgs("flush", args, 0, 0, func(flags *flag.FlagSet) {
+		flags.BoolVar(&confirmed, "y", false, "")
+	}); err != nil {
+		return err
+	}
+	if !confirmed {
+		return usagef("flush deletes every key of the namespace, pass -y to confirm")
+	}
+	var result map[string]any
+	if err := c.client.do(http.MethodPost, "/flush", nil, nil, &result); err != nil {
+		return err
+	}
+	return c.printMessage(result)
+}
+
+func (c *cli) compact(args []string) error {
+	if _, err := parseArgs("compact", args, 0, 0, nil); err != nil {
+		return err
+	}
+	var result map[string]any
+	if err := c.client.do(http.MethodPost, "/compact", nil, nil, &result); err != nil {
+		return err
+	}
+	return c.printMessage(result)
+}
+
+// statsResponse is the body of /admin/stats
+type statsResponse struct {
+	Namespace string          `json:"namespace"`
+	Engine    engine.Snapshot `json:"engine"`
+	Runtime   json.RawMessage `json:"runtime"`
+}
+
+func (c *cli) stats(args []string) error {
+	top := engine.DefaultTopKeys
+	if _, err := parseArgs("stats", args, 0, 0, func(flags *flag.FlagSet) {
+		flags.IntVar(&top, "top", engine.DefaultTopKeys, "")
+	}); err != nil {
+		return err
+	}
+	var result statsResponse
+	if err := c.client.do(http.MethodGet, "/admin/stats", url.Values{"top": {strconv.Itoa(top)}}, nil, &result); err != nil {
+		return err
+	}
+	return c.printStats(result)
+}
+
+// backup writes the records of /admin/export, which holds every key of the namespace: the
+// keys evicted to disk, the typed values and the contents of blob values
+func (c *cli) backup(args []string) error {
+	args, err := parseArgs("backup", args, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.send(http.MethodGet, "/admin/export", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out, done := c.stdout, func() error { return nil }
+	if args[0] != "-" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		out, done = file, file.Close
+	}
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	count := 0
+	// The server drops the connection when the export fails, which fails the read of the body
+	err = readRecords(resp.Body, func(rec record) error {
+		count++
+		return encoder.Encode(rec)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		done()
+		return fmt.Errorf("backup stopped after %d keys: %w", count, err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if args[0] == "-" {
+		return nil
+	}
+	return c.printMessage(map[string]any{"message": fmt.Sprintf("Backed up %d keys to %s", count, args[0]), "keys": count})
+}
+
+func (c *cli) restore(args []string) error {
+	confirmed := false
+	batchSize := defaultBatchSize
+	args, err := parseArgs("restore", args, 1, 1, func(flags *flag.FlagSet) {
+		flags.BoolVar(&confirmed, "y", false, "")
+		flags.IntVar(&batchSize, "batch-size", defaultBatchSize, "")
+	})
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return usagef("restore replaces every key of the namespace, pass -y to confirm")
+	}
+	if args[0] != "-" {
+		// Fail before flushing when the backup cannot be read
+		if _, err := os.Stat(args[0]); err != nil {
+			return err
+		}
+	}
+
+	// The flush deletes the keys on disk too, so none of them comes back after a restart. The
+	// reason is recorded with the flush in the server's audit log.
+	if err := c.client.do(http.MethodPost, "/flush", url.Values{"reason": {"restore"}}, nil, nil); err != nil {
+		return err
+	}
+	count, err := c.importRecords(args[0], batchSize)
+	if err != nil {
+		return err
+	}
+	return c.printMessage(map[string]any{"message": fmt.Sprintf("Restored %d keys", count), "keys_set": count})
+}
+
+func (c *cli) completion(args []string) error {
+	args, err := parseArgs("completion", args, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return usagef("completion: unknown shell %q (bash, zsh or fish)", args[0])
+	}
+	return script.Execute(c.stdout, newCompletionData())
+}
+
+func (c *cli) help(args []string) error {
+	args, err := parseArgs("help", args, 0, 1, nil)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		printCommands(c.stdout)
+		return nil
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return usagef("unknown command %q", args[0])
+	}
+	fmt.Fprintf(c.stdout, "usage: gokv %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+	return nil
+}
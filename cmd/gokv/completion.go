@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// completionScripts are the shell completion scripts by shell, executed with completionData
+var completionScripts = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Parse(`# bash completion for gokv. Load it with: source <(gokv completion bash)
+_gokv() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local i command=""
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -url|--url|-token|--token|-namespace|--namespace|-n|-output|--output|-o|-timeout|--timeout) ((i++)) ;;
+            -*) ;;
+            *) command="${COMP_WORDS[i]}"; break ;;
+        esac
+    done
+    case "$prev" in
+        -output|--output|-o) COMPREPLY=($(compgen -W "table json raw" -- "$cur")); return ;;
+    esac
+    case "$command" in
+        "") COMPREPLY=($(compgen -W "{{.Names}}" -- "$cur")) ;;
+        help) COMPREPLY=($(compgen -W "{{.Names}}" -- "$cur")) ;;
+        completion) COMPREPLY=($(compgen -W "{{.Shells}}" -- "$cur")) ;;
+        import|backup|restore) COMPREPLY=($(compgen -f -- "$cur")) ;;
+    esac
+}
+complete -F _gokv gokv
+`)),
+	"zsh": template.Must(template.New("zsh").Parse(`#compdef gokv
+# zsh completion for gokv. Load it with: source <(gokv completion zsh)
+_gokv() {
+    local -a commands
+    commands=({{range .Commands}}
+        '{{.Name}}:{{.Summary}}'{{end}}
+    )
+    local state
+    _arguments -C \
+        '-url[Server URL]:url:' \
+        '-token[Bearer token]:token:' \
+        '(-n -namespace)'{-n,-namespace}'[Namespace]:namespace:' \
+        '(-o -output)'{-o,-output}'[Output format]:format:(table json raw)' \
+        '-timeout[Timeout of each request]:duration:' \
+        '1:command:->command' \
+        '*::argument:->argument'
+    case $state in
+        command) _describe 'command' commands ;;
+        argument)
+            case $words[1] in
+                help) _describe 'command' commands ;;
+                completion) _values 'shell' {{.Shells}} ;;
+                import|backup|restore) _files ;;
+            esac ;;
+    esac
+}
+compdef _gokv gokv
+`)),
+	"fish": template.Must(template.New("fish").Parse(`# fish completion for gokv. Load it with: gokv completion fish | source
+complete -c gokv -f
+complete -c gokv -o url -r -d 'Server URL'
+complete -c gokv -o token -r -d 'Bearer token'
+complete -c gokv -o namespace -o n -r -d 'Namespace'
+complete -c gokv -o output -o o -r -a 'table json raw' -d 'Output format'
+complete -c gokv -o timeout -r -d 'Timeout of each request'
+{{range .Commands}}complete -c gokv -n __fish_use_subcommand -a {{.Name}} -d '{{.Summary}}'
+{{end}}complete -c gokv -n '__fish_seen_subcommand_from help' -a '{{.Names}}'
+complete -c gokv -n '__fish_seen_subcommand_from completion' -a '{{.Shells}}'
+complete -c gokv -n '__fish_seen_subcommand_from import backup restore' -F
+`)),
+}
+
+// completionData is what the completion scripts are generated from
+type completionData struct {
+	Names    string // Command names separated by spaces
+	Shells   string
+	Commands []struct{ Name, Summary string }
+}
+
+func newCompletionData() completionData {
+	data := completionData{Names: strings.Join(commandNames(), " "), Shells: strings.Join(shells(), " ")}
+	for _, cmd := range commands {
+		data.Commands = append(data.Commands, struct{ Name, Summary string }{cmd.name, cmd.summary})
+	}
+	return data
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+func shells() []string {
+	names := make([]string, 0, len(completionScripts))
+	for name := range completionScripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeWord returns the candidates for the word being typed in the interactive shell,
+// given the words before it
+func completeWord(previous []string, word string) []string {
+	var candidates []string
+	switch {
+	case len(previous) == 0:
+		candidates = append(commandNames(), replCommands...)
+	case len(previous) == 1 && previous[0] == "help":
+		candidates = commandNames()
+	case len(previous) == 1 && previous[0] == "completion":
+		candidates = shells()
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// commonPrefix returns the longest prefix shared by every word
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,118 @@
+// Command gokv is a command-line client for the go-kv server.
+//
+//	gokv [flags] <command> [arguments]
+//
+// Without a command it starts an interactive shell. Run "gokv help" for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputRaw   = "raw"
+)
+
+// cli holds the connection settings and streams shared by every command
+type cli struct {
+	client *client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// usageError is returned for invalid arguments, which exit with status 2
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gokv", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var baseURL, token, namespace, output string
+	var timeout time.Duration
+	flags.StringVar(&baseURL, "url", envOr("GOKV_URL", defaultURL), "Server URL (env GOKV_URL)")
+	flags.StringVar(&token, "token", os.Getenv("GOKV_TOKEN"), "Bearer token sent with every request (env GOKV_TOKEN)")
+	flags.StringVar(&namespace, "namespace", os.Getenv("GOKV_NAMESPACE"), "Namespace to use, the server default when empty (env GOKV_NAMESPACE)")
+	flags.StringVar(&namespace, "n", os.Getenv("GOKV_NAMESPACE"), "Shorthand for -namespace")
+	flags.StringVar(&output, "output", envOr("GOKV_OUTPUT", outputTable), "Output format: table, json or raw (env GOKV_OUTPUT)")
+	flags.StringVar(&output, "o", envOr("GOKV_OUTPUT", outputTable), "Shorthand for -output")
+	flags.DurationVar(&timeout, "timeout", 30*time.Second, "Timeout of each request")
+	flags.Usage = func() { printUsage(stderr, flags) }
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if output != outputTable && output != outputJSON && output != outputRaw {
+		fmt.Fprintf(stderr, "gokv: unknown output format %q (table, json or raw)\n", output)
+		return 2
+	}
+
+	c := &cli{
+		client: newClient(baseURL, token, namespace, timeout),
+		output: output,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	var err error
+	if flags.NArg() == 0 {
+		err = c.repl()
+	} else {
+		err = c.exec(flags.Args())
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "gokv:", err)
+		var usage *usageError
+		if errors.As(err, &usage) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: gokv [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nWithout a command, gokv starts an interactive shell.")
+	fmt.Fprintln(w, "\nCommands:")
+	printCommands(w)
+	fmt.Fprintln(w, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
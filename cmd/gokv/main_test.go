@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func setupTestServer(t *testing.T) string {
+	t.Helper()
+	url, _ := setupTestServerWithLimit(t, 1<<20)
+	return url
+}
+
+// setupTestServerWithLimit starts a server whose engine evicts keys above memoryLimit bytes
+// to the flush file, returned with the server URL
+func setupTestServerWithLimit(t *testing.T, memoryLimit int) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	flushPath := filepath.Join(dir, "test_flushed.db")
+	store, err := engine.NewEngine(filepath.Join(dir, "test_data.db"), flushPath, memoryLimit)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(store.Shutdown)
+	server := httptest.NewServer(api.NewRouter(store, false))
+	t.Cleanup(server.Close)
+	return server.URL, flushPath
+}
+
+// runCLI runs gokv against serverURL and returns its exit status, stdout and stderr
+func runCLI(t *testing.T, serverURL, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(append([]string{"-url", serverURL}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func mustRun(t *testing.T, serverURL, stdin string, args ...string) string {
+	t.Helper()
+	status, stdout, stderr := runCLI(t, serverURL, stdin, args...)
+	if status != 0 {
+		t.Fatalf("gokv %s exited with %d: %s", strings.Join(args, " "), status, stderr)
+	}
+	return stdout
+}
+
+func TestSetGetDel(t *testing.T) {
+	url := setupTestServer(t)
+
+	mustRun(t, url, "", "set", "greeting", "hello world")
+	if out := mustRun(t, url, "", "-o", "raw", "get", "greeting"); out != "hello world\n" {
+		t.Errorf("Expected the raw value, got %q", out)
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal([]byte(mustRun(t, url, "", "-o", "json", "get", "greeting")), &result); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if result["key"] != "greeting" || result["value"] != "hello world" {
+		t.Errorf("Unexpected JSON output: %v", result)
+	}
+
+	if out := mustRun(t, url, "", "get", "greeting"); !strings.Contains(out, "KEY") || !strings.Contains(out, "hello world") {
+		t.Errorf("Expected a table, got %q", out)
+	}
+
+	mustRun(t, url, "", "del", "greeting")
+	status, _, stderr := runCLI(t, url, "", "get", "greeting")
+	if status != 1 || !strings.Contains(stderr, "404") {
+		t.Errorf("Expected a not found error, got %d: %s", status, stderr)
+	}
+}
+
+func TestListAndScan(t *testing.T) {
+	url := setupTestServer(t)
+	for _, key := range []string{"user:2", "user:1", "order:1"} {
+		mustRun(t, url, "", "set", key, "v-"+key)
+	}
+
+	if out := mustRun(t, url, "", "-o", "raw", "list"); out != "order:1\tv-order:1\nuser:1\tv-user:1\nuser:2\tv-user:2\n" {
+		t.Errorf("Expected every key in order, got %q", out)
+	}
+	if out := mustRun(t, url, "", "-o", "raw", "scan", "user:*"); out != "user:1\tv-user:1\nuser:2\tv-user:2\n" {
+		t.Errorf("Expected the matching keys, got %q", out)
+	}
+	if out := mustRun(t, url, "", "-o", "raw", "scan", "-limit", "1", "user:*"); out != "user:1\tv-user:1\n" {
+		t.Errorf("Expected the first matching key, got %q", out)
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal([]byte(mustRun(t, url, "", "-o", "json", "list")), &result); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(result) != 3 {
+		t.Errorf("Expected 3 keys, got %v", result)
+	}
+
+	// Values that are not valid UTF-8 keep their bytes
+	mustRun(t, url, `{"key":"user:3","value_b64":"AP8=","content_type":"application/octet-stream"}`, "import", "-")
+	if out := mustRun(t, url, "", "-o", "raw", "scan", "user:3"); out != "user:3\t\x00\xff\n" {
+		t.Errorf("Expected the raw bytes, got %q", out)
+	}
+	out := mustRun(t, url, "", "-o", "json", "scan", "user:3")
+	if !strings.Contains(out, `"value_b64": "AP8="`) || !strings.Contains(out, `"content_type": "application/octet-stream"`) {
+		t.Errorf("Expected value_b64 and the content type, got %s", out)
+	}
+}
+
+func TestImportBackupRestore(t *testing.T) {
+	url := setupTestServer(t)
+
+	mustRun(t, url, `[{"key":"a","value":"1"},{"key":"b","value":"2"}]`, "import", "-")
+	mustRun(t, url, "{\"key\":\"c\",\"value\":\"3\"}\n{\"key\":\"d\",\"value\":\"4\"}\n", "import", "-batch-size", "1", "-")
+
+	backup := filepath.Join(t.TempDir(), "backup.jsonl")
+	mustRun(t, url, "", "backup", backup)
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatalf("Failed to read the backup: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Fatalf("Expected 4 records in the backup, got %d", lines)
+	}
+
+	mustRun(t, url, "", "set", "e", "5")
+	if status, _, _ := runCLI(t, url, "", "restore", backup); status != 2 {
+		t.Errorf("Expected restore without -y to be refused, got %d", status)
+	}
+	mustRun(t, url, "", "restore", "-y", backup)
+	if out := mustRun(t, url, "", "-o", "raw", "list"); out != "a\t1\nb\t2\nc\t3\nd\t4\n" {
+		t.Errorf("Expected the backed up keys, got %q", out)
+	}
+}
+
+func TestBackupEvictedAndTypedKeys(t *testing.T) {
+	url, flushPath := setupTestServerWithLimit(t, 200)
+	var keys strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&keys, "{\"key\":\"key%02d\",\"value\":\"value-%02d\"}\n", i, i)
+	}
+	mustRun(t, url, keys.String(), "import", "-")
+	for path, body := range map[string]string{
+		"/set":            `{"key":"binary","value_b64":"AP8=","content_type":"application/octet-stream","tags":{"env":"test"}}`,
+		"/types/hash/set": `{"key":"hash","fields":{"field":"value"}}`,
+		"/types/zset/add": `{"key":"zset","scored_members":[{"member":"a","score":1.5}]}`,
+	} {
+		resp, err := http.Post(url+path, "application/json", strings.NewReader(body))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s failed: %v %v", path, resp, err)
+		}
+		resp.Body.Close()
+	}
+	// Above the blob threshold, so stored in chunk files
+	req, _ := http.NewRequest(http.MethodPut, url+"/v1/keys/blob", strings.NewReader(strings.Repeat("b", engine.DefaultBlobThreshold+1)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT /v1/keys/blob failed: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	// Wait for keys to be evicted to disk
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err := os.Stat(flushPath); err != nil; _, err = os.Stat(flushPath) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected keys to be evicted to the flush file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	backup := filepath.Join(t.TempDir(), "backup.jsonl")
+	mustRun(t, url, "", "backup", backup)
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatalf("Failed to read the backup: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 24 {
+		t.Fatalf("Expected 24 records in the backup, got %d", lines)
+	}
+	for _, want := range []string{
+		`"key":"binary","value_b64":"AP8=","content_type":"application/octet-stream","tags":{"env":"test"},"type":"string"`,
+		`"type":"hash","fields":{"field":"value"}`,
+		`"type":"zset","scored_members":[{"member":"a","score":1.5}]`,
+		`{"key":"blob","value":"bbbb`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected the backup to hold %s, got %s", want, data)
+		}
+	}
+
+	mustRun(t, url, "", "set", "extra", "value")
+	mustRun(t, url, "", "restore", "-y", backup)
+	restored := filepath.Join(t.TempDir(), "restored.jsonl")
+	mustRun(t, url, "", "backup", restored)
+	if got, _ := os.ReadFile(restored); string(got) != string(data) {
+		t.Errorf("Expected the restored keys to match the backup, got %s", got)
+	}
+}
+
+func TestFlushAndCompact(t *testing.T) {
+	url := setupTestServer(t)
+	mustRun(t, url, "", "set", "key", "value")
+
+	if status, _, _ := runCLI(t, url, "", "flush"); status != 2 {
+		t.Errorf("Expected flush without -y to be refused, got %d", status)
+	}
+	mustRun(t, url, "", "flush", "-y")
+	if out := mustRun(t, url, "", "-o", "raw", "list"); out != "" {
+		t.Errorf("Expected no keys after flush, got %q", out)
+	}
+	mustRun(t, url, "", "compact")
+}
+
+func TestStats(t *testing.T) {
+	url := setupTestServer(t)
+	mustRun(t, url, "", "set", "key", "value")
+
+	var stats statsResponse
+	if err := json.Unmarshal([]byte(mustRun(t, url, "", "-o", "json", "stats")), &stats); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if stats.Engine.KeyCount != 1 {
+		t.Errorf("Expected 1 key, got %d", stats.Engine.KeyCount)
+	}
+	if out := mustRun(t, url, "", "stats"); !strings.Contains(out, "LARGEST KEY") {
+		t.Errorf("Expected the largest keys table, got %q", out)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	url := setupTestServer(t)
+	for _, args := range [][]string{
+		{"unknown"},
+		{"get"},
+		{"set", "key"},
+		{"-o", "yaml", "list"},
+		{"completion", "powershell"},
+	} {
+		if status, _, _ := runCLI(t, url, "", args...); status != 2 {
+			t.Errorf("Expected gokv %s to exit with 2, got %d", strings.Join(args, " "), status)
+		}
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	url := setupTestServer(t)
+	t.Setenv("GOKV_URL", url)
+	t.Setenv("GOKV_OUTPUT", "raw")
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"set", "key", "value"}, strings.NewReader(""), &stdout, &stderr); status != 0 {
+		t.Fatalf("Expected set to succeed, got %d: %s", status, stderr.String())
+	}
+	if status := run([]string{"get", "key"}, strings.NewReader(""), &stdout, &stderr); status != 0 || stdout.String() != "value\n" {
+		t.Errorf("Expected the raw value from the server in GOKV_URL, got %d %q", status, stdout.String())
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	url := setupTestServer(t)
+	for _, shell := range shells() {
+		out := mustRun(t, url, "", "completion", shell)
+		if !strings.Contains(out, "backup") || !strings.Contains(out, "gokv") {
+			t.Errorf("Expected the %s script to complete the commands, got %q", shell, out)
+		}
+	}
+}
+
+func TestREPL(t *testing.T) {
+	url := setupTestServer(t)
+	t.Setenv("GOKV_HISTORY", filepath.Join(t.TempDir(), "history"))
+
+	script := "set 'first key' \"a value\"\nuse missing\nget 'first key'\n# comment\n\nuse\nunknown\nget 'first key'\nexit\nget never\n"
+	status, stdout, stderr := runCLI(t, url, script, "-o", "raw")
+	if status != 1 || !strings.Contains(stderr, "2 commands failed") {
+		t.Errorf("Expected two failed commands, got %d: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "namespace not found") {
+		t.Errorf("Expected use to switch to the missing namespace, got %s", stderr)
+	}
+	if stdout != "a value\n" {
+		t.Errorf("Expected the value of the default namespace once, got %q", stdout)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := map[string][]string{
+		"":                        nil,
+		"  get   key ":            {"get", "key"},
+		`set "a key" 'a "value"'`: {"set", "a key", `a "value"`},
+		`set key a\ b`:            {"set", "key", "a b"},
+		`set key ""`:              {"set", "key", ""},
+	}
+	for line, expected := range tests {
+		words, err := splitWords(line)
+		if err != nil {
+			t.Errorf("splitWords(%q) failed: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, expected) {
+			t.Errorf("splitWords(%q) = %q, expected %q", line, words, expected)
+		}
+	}
+	if _, err := splitWords(`get "key`); err == nil {
+		t.Error("Expected an unterminated quote to fail")
+	}
+}
+
+func TestAutoComplete(t *testing.T) {
+	tests := []struct {
+		line, expected string
+	}{
+		{"ba", "backup "},
+		{"s", "s"}, // scan, set and stats
+		{"sc", "scan "},
+		{"completion z", "completion zsh "},
+		{"help ex", "help ex"},
+		{"get k", "get k"},
+	}
+	for _, test := range tests {
+		line, pos, ok := autoComplete(test.line, len(test.line), '\t')
+		if !ok {
+			line, pos = test.line, len(test.line)
+		}
+		if line != test.expected || pos != len(test.expected) {
+			t.Errorf("Completing %q gave %q at %d, expected %q", test.line, line, pos, test.expected)
+		}
+	}
+
+	h := &history{}
+	for _, entry := range []string{"get a", "get a", " ", "get b"} {
+		h.Add(entry)
+	}
+	if h.Len() != 2 || h.At(0) != "get b" || h.At(1) != "get a" {
+		t.Errorf("Unexpected history %q", h.entries)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// In the raw format, results are printed bare for scripts: values without headers, listings as
+// key and value separated by a tab, and nothing for commands that only report success.
+
+func (c *cli) printJSON(v any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (c *cli) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+}
+
+// printPairs prints keys and their values. asJSON is printed in the json format.
+func (c *cli) printPairs(pairs []kvPair, asJSON any) error {
+	switch c.output {
+	case outputJSON:
+		return c.printJSON(asJSON)
+	case outputRaw:
+		for _, pair := range pairs {
+			fmt.Fprintf(c.stdout, "%s\t%s\n", pair.Key, pair.text())
+		}
+		return nil
+	}
+
+	tw := c.table()
+	fmt.Fprintln(tw, "KEY\tVALUE")
+	for _, pair := range pairs {
+		fmt.Fprintf(tw, "%s\t%s\n", pair.Key, pair.text())
+	}
+	return tw.Flush()
+}
+
+// pairsObject returns pairs as a JSON object of keys to values, like /list: values that are not
+// valid UTF-8 are objects with value_b64 and the metadata of the value
+func pairsObject(pairs []kvPair) map[string]any {
+	object := make(map[string]any, len(pairs))
+	for _, pair := range pairs {
+		if pair.ValueB64 != nil {
+			object[pair.Key] = pair
+		} else {
+			object[pair.Key] = pair.Value
+		}
+	}
+	return object
+}
+
+// printMessage prints the response of a command that changes data
+func (c *cli) printMessage(result map[string]any) error {
+	switch c.output {
+	case outputJSON:
+		return c.printJSON(result)
+	case outputRaw:
+		return nil
+	}
+	if message, ok := result["message"].(string); ok {
+		_, err := fmt.Fprintln(c.stdout, message)
+		return err
+	}
+	return nil
+}
+
+func (c *cli) printStats(stats statsResponse) error {
+	switch c.output {
+	case outputJSON:
+		return c.printJSON(stats)
+	case outputRaw:
+		return json.NewEncoder(c.stdout).Encode(stats)
+	}
+
+	e := stats.Engine
+	tw := c.table()
+	fmt.Fprintf(tw, "Namespace\t%s\n", stats.Namespace)
+	fmt.Fprintf(tw, "Keys\t%d\n", e.KeyCount)
+	fmt.Fprintf(tw, "Memory\t%s of %s\n", formatBytes(int64(e.StoreBytes)), formatBytes(int64(e.MemoryLimit)))
+	fmt.Fprintf(tw, "Eviction\t%s, %d queued\n", e.EvictionPolicy, e.EvictionQueueLength)
+	fmt.Fprintf(tw, "Last save\t%s\n", formatOperation(e.LastSave))
+	fmt.Fprintf(tw, "Last compaction\t%s\n", formatOperation(e.LastCompaction))
+	fmt.Fprintf(tw, "Evictions\t%d (%s)\n", e.Counters.Evictions, formatBytes(int64(e.Counters.EvictedBytes)))
+	fmt.Fprintf(tw, "Saves\t%d, %d failed\n", e.Counters.Saves, e.Counters.SaveFailures)
+	fmt.Fprintf(tw, "Compactions\t%d, %d failed\n", e.Counters.CompactionRuns, e.Counters.CompactionFailures)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout)
+	tw = c.table()
+	fmt.Fprintln(tw, "FILE\tSIZE\tRECORDS")
+	for _, f := range e.Files {
+		if f.Exists {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", f.Path, formatBytes(f.Bytes), f.Records)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(e.LargestKeys) > 0 {
+		fmt.Fprintln(c.stdout)
+		tw = c.table()
+		fmt.Fprintln(tw, "LARGEST KEY\tTYPE\tSIZE")
+		for _, k := range e.LargestKeys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", k.Key, k.Type, formatBytes(int64(k.Bytes)))
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+func formatOperation(op engine.Operation) string {
+	if op.Time.IsZero() {
+		return "never"
+	}
+	s := fmt.Sprintf("%s (took %s)", op.Time.Local().Format(time.DateTime), op.Duration.Round(time.Millisecond))
+	if op.Error != "" {
+		s += ", failed: " + op.Error
+	}
+	return s
+}
+
+// formatBytes formats n with a binary unit, such as 1.5 KiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
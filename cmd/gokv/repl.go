@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// historyLimit is the number of lines kept in the history file
+const historyLimit = 1000
+
+// replCommands are only available in the interactive shell
+var replCommands = []string{"exit", "quit", "use"}
+
+// repl runs commands read from stdin until exit or the end of the input. On a terminal, lines
+// are edited with history, saved to GOKV_HISTORY or ~/.gokv_history, and tab completion.
+func (c *cli) repl() error {
+	file, ok := c.stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return c.replLines(c.stdin)
+	}
+
+	state, err := term.MakeRaw(int(file.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(file.Fd()), state)
+
+	screen := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{file, c.stdout}, c.prompt())
+	screen.AutoCompleteCallback = autoComplete
+	history := loadHistory(historyPath())
+	screen.History = history
+	// The terminal translates line endings while in raw mode
+	c.stdout, c.stderr = screen, screen
+
+	fmt.Fprintf(screen, "Connected to %s. Type help for the commands, exit to quit.\n", c.client.baseURL)
+	for {
+		line, err := screen.ReadLine()
+		if err == io.EOF {
+			return history.save()
+		}
+		if err != nil {
+			return err
+		}
+		quit, err := c.runLine(line)
+		if err != nil {
+			fmt.Fprintln(screen, "error:", err)
+		}
+		if quit {
+			return history.save()
+		}
+		screen.SetPrompt(c.prompt())
+	}
+}
+
+// replLines runs the commands of r, one per line, such as a script piped to gokv
+func (c *cli) replLines(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	failed := 0
+	for scanner.Scan() {
+		quit, err := c.runLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(c.stderr, "gokv:", err)
+			failed++
+		}
+		if quit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d commands failed", failed)
+	}
+	return nil
+}
+
+// runLine runs one line of the shell and reports whether the shell should exit
+func (c *cli) runLine(line string) (bool, error) {
+	words, err := splitWords(line)
+	if err != nil {
+		return false, err
+	}
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return false, nil
+	}
+	switch words[0] {
+	case "exit", "quit":
+		return true, nil
+	case "use":
+		if len(words) > 2 {
+			return false, usagef("usage: use [NAMESPACE]")
+		}
+		c.client.namespace = ""
+		if len(words) == 2 {
+			c.client.namespace = words[1]
+		}
+		return false, nil
+	}
+	return false, c.exec(words)
+}
+
+func (c *cli) prompt() string {
+	if c.client.namespace != "" {
+		return "gokv:" + c.client.namespace + "> "
+	}
+	return "gokv> "
+}
+
+// splitWords splits line on spaces, keeping text in single or double quotes together.
+// A backslash escapes the next character outside single quotes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// autoComplete completes the word before the cursor when tab is pressed
+func autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := strings.LastIndexFunc(line[:pos], unicode.IsSpace) + 1
+	previous := strings.Fields(line[:start])
+	matches := completeWord(previous, line[start:pos])
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completed := commonPrefix(matches)
+	if len(matches) == 1 {
+		completed += " "
+	}
+	return line[:start] + completed + line[pos:], start + len(completed), true
+}
+
+// history is the line history of the shell, kept in a file between sessions
+type history struct {
+	path    string
+	entries []string // Oldest first
+}
+
+func historyPath() string {
+	if path := os.Getenv("GOKV_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gokv_history")
+}
+
+// loadHistory reads the history file at path. A missing or unreadable file starts an empty history.
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+	return h
+}
+
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	h.trim()
+}
+
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+func (h *history) At(i int) string {
+	return h.entries[len(h.entries)-1-i]
+}
+
+func (h *history) trim() {
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+	}
+}
+
+// save writes the history file, which is only readable by the user as values may be secrets
+func (h *history) save() error {
+	if h.path == "" || len(h.entries) == 0 {
+		return nil
+	}
+	return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+}
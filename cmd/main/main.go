@@ -1,26 +1,29 @@
 package main
 
 import (
-	"strconv"
+	"context"
+	"errors"
+	"flag"
+	"os"
 
-	"github.com/bendigiorgio/go-kv/internal/api"
-	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/server"
 	"github.com/bendigiorgio/go-kv/internal/utils"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
 	cfg, err := utils.LoadConfig()
-	log.Debug().Msgf("Loaded config: %+v", cfg)
 	if err != nil {
-		log.Panic().Err(err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
 	utils.SetupLogger(cfg)
-	e, err := engine.NewEngine(cfg.Database.FilePath, cfg.Database.FlushFilePath, cfg.Database.MaxMemory)
-	if err != nil {
-		log.Panic().Err(err)
-	}
-	router := api.NewRouter(e, true)
-	router.Start(strconv.Itoa(cfg.AppPort))
+	log.Debug().Str("configFile", cfg.Path()).Msgf("Loaded config: %+v", cfg.Redacted())
 
+	if err := server.Run(context.Background(), cfg, os.Args[1:]); err != nil {
+		log.Fatal().Err(err).Msg("Server failed")
+	}
+	log.Info().Msg("Server stopped")
 }
@@ -1,20 +1,25 @@
 module github.com/bendigiorgio/go-kv
 
-go 1.23
+go 1.23.0
 
 toolchain go1.23.6
 
-require github.com/a-h/templ v0.3.833
+require (
+	github.com/a-h/templ v0.3.833
+	github.com/go-faker/faker/v4 v4.6.0
+	github.com/nil-go/konf v1.4.0
+	github.com/rs/zerolog v1.33.0
+	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/cristalhq/aconfig v0.18.6 // indirect
-	github.com/go-faker/faker/v4 v4.6.0 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
-	github.com/nil-go/konf v1.4.0 // indirect
-	github.com/rs/zerolog v1.33.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
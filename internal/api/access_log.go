@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// requestInfo is filled in by the router for middlewares that run before authentication,
+// which cannot see the identity in the request context
+type requestInfo struct {
+	client string // Set once the request reaches the router, see identify
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo returns req with a requestInfo, reusing the one of an outer middleware
+func withRequestInfo(req *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := req.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return req, info
+	}
+	info := &requestInfo{}
+	return req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info)), info
+}
+
+// clientOf returns the client of req for logs: the one seen by the router, otherwise the IP
+// address of requests rejected before reaching it
+func (info *requestInfo) clientOf(req *http.Request) string {
+	if info.client != "" {
+		return info.client
+	}
+	return clientID(req)
+}
+
+// identify records the client of requests that reached the router in their requestInfo
+func (r *Router) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if info, ok := req.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+			info.client = clientID(req)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// EnableAccessLog logs every request with its status, latency, sizes and client. Entries have
+// "log":"access" so they can be told apart from the other logs. Call it after the other
+// middlewares so requests rejected by them are logged too.
+func (r *Router) EnableAccessLog() {
+	r.observe(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			req, info := withRequestInfo(req)
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, req)
+
+			event := log.Info()
+			if rec.status >= http.StatusInternalServerError {
+				event = log.Warn()
+			}
+			event.Str("log", "access").
+				Str("method", req.Method).
+				Str("path", req.URL.Path).
+				Str("route", r.routePattern(req)).
+				Int("status", rec.status).
+				Dur("latency", time.Since(start)).
+				Int64("bytes_in", max(req.ContentLength, 0)).
+				Int("bytes_out", rec.bytes).
+				Str("client", info.clientOf(req)).
+				Str("remote_addr", req.RemoteAddr).
+				Msg("HTTP request")
+		})
+	})
+}
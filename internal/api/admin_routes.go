@@ -0,0 +1,251 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/bendigiorgio/go-kv/pkg/kv"
+	"github.com/rs/zerolog/log"
+)
+
+// maxTopKeys bounds the number of largest keys returned by /admin/stats
+const maxTopKeys = 1000
+
+// handleNamespaces lists (GET), creates (POST) and drops (DELETE) namespaces
+func (r *Router) handleNamespaces(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, r.namespaces.List())
+	case http.MethodPost:
+		r.handleCreateNamespace(w, req)
+	case http.MethodDelete:
+		r.handleDropNamespace(w, req)
+	default:
+		methodNotAllowed(w, req)
+	}
+}
+
+// handleCreateNamespace creates a namespace with an optional memory limit
+func (r *Router) handleCreateNamespace(w http.ResponseWriter, req *http.Request) {
+	var requestData struct {
+		Name        string `json:"name"`
+		MemoryLimit int    `json:"memory_limit"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
+		invalidJSON(w, req)
+		return
+	}
+
+	if _, err := r.namespaces.Create(requestData.Name, requestData.MemoryLimit); err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, map[string]string{"message": "Namespace created", "name": requestData.Name})
+}
+
+// handleDropNamespace drops a namespace and deletes its data
+func (r *Router) handleDropNamespace(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		invalidParameter(w, req, "Missing name parameter")
+		return
+	}
+	if name == engine.DefaultNamespace {
+		invalidParameter(w, req, "The default namespace cannot be dropped")
+		return
+	}
+
+	if err := r.namespaces.Drop(name); err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "Namespace dropped", "name": name})
+}
+
+// handleConfig returns the effective configuration with credentials redacted
+func (r *Router) handleConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	cfg := r.config.Load()
+	if cfg == nil {
+		errorResponse(w, req, api_errors.New(api_errors.CodeNotFound, "Configuration not available"))
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"configFile": cfg.Path(),
+		"config":     cfg.Redacted(),
+	})
+}
+
+// runtimeStats are the Go runtime memory statistics included in /admin/stats
+type runtimeStats struct {
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heap_alloc"`
+	HeapInuse    uint64    `json:"heap_inuse"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	TotalAlloc   uint64    `json:"total_alloc"`
+	Sys          uint64    `json:"sys"`
+	NumGC        uint32    `json:"num_gc"`
+	PauseTotalNs uint64    `json:"pause_total_ns"`
+	LastGC       time.Time `json:"last_gc"`
+}
+
+func readRuntimeStats() runtimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return runtimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapObjects:  m.HeapObjects,
+		TotalAlloc:   m.TotalAlloc,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+		LastGC:       time.Unix(0, int64(m.LastGC)),
+	}
+}
+
+// handleStats returns a detailed snapshot of a namespace and the Go runtime.
+// The top query parameter sets how many of the largest keys are listed.
+func (r *Router) handleStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	top := utils.StringToInt(req.URL.Query().Get("top"), engine.DefaultTopKeys)
+	if top < 0 || top > maxTopKeys {
+		invalidParameter(w, req, fmt.Sprintf("top must be between 0 and %d", maxTopKeys))
+		return
+	}
+
+	snapshot, err := store.Snapshot(req.Context(), top)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"namespace": namespaceName(req),
+		"engine":    snapshot,
+		"runtime":   readRuntimeStats(),
+	})
+}
+
+// handleCompaction shows the compaction scheduler status (GET) and pauses or resumes it (POST
+// with {"action": "pause"} or {"action": "resume"})
+func (r *Router) handleCompaction(w http.ResponseWriter, req *http.Request) {
+	if r.compaction == nil {
+		errorResponse(w, req, api_errors.New(api_errors.CodeNotFound, "Compaction scheduler not enabled"))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData struct {
+			Action string `json:"action"`
+		}
+		if err := decodeJSON(req, &requestData); err != nil {
+			invalidJSON(w, req)
+			return
+		}
+		switch requestData.Action {
+		case "pause":
+			r.compaction.Pause()
+		case "resume":
+			r.compaction.Resume()
+		default:
+			invalidParameter(w, req, "Action must be pause or resume")
+			return
+		}
+	default:
+		methodNotAllowed(w, req)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, r.compaction.Status())
+}
+
+// exportRecord is a line of /admin/export. Strings have the fields of valueRequest, with
+// value_b64 for values that are not valid UTF-8, and the other types those of typeRequest.
+type exportRecord struct {
+	Key           string            `json:"key"`
+	Type          kv.ValueType      `json:"type"`
+	Value         string            `json:"value,omitempty"`
+	ValueB64      []byte            `json:"value_b64,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+	Values        []string          `json:"values,omitempty"`
+	Members       []string          `json:"members,omitempty"`
+	ScoredMembers []kv.ZMember      `json:"scored_members,omitempty"`
+}
+
+func newExportRecord(rec kv.Record) exportRecord {
+	out := exportRecord{
+		Key:           rec.Key,
+		Type:          rec.Type,
+		ContentType:   rec.Meta.ContentType,
+		Tags:          rec.Meta.Tags,
+		Fields:        rec.Hash,
+		Values:        rec.List,
+		Members:       rec.Set,
+		ScoredMembers: rec.ZSet,
+	}
+	if utf8.Valid(rec.Value) {
+		out.Value = string(rec.Value)
+	} else {
+		out.ValueB64 = rec.Value
+	}
+	return out
+}
+
+// handleExport streams every key of a namespace as JSON lines in key order, including the keys
+// evicted to disk, with blob values read from their chunk files.
+func (r *Router) handleExport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	written := false
+	err := store.Export(req.Context(), func(rec kv.Record) error {
+		written = true
+		return encoder.Encode(newExportRecord(rec))
+	})
+	if err != nil && !written {
+		errorResponse(w, req, err)
+	} else if err != nil {
+		// The status is sent, so the connection is dropped rather than ending the stream early
+		log.Error().Err(err).Str("namespace", namespaceName(req)).Msg("Export failed")
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -2,18 +2,15 @@ package api_errors
 
 import "net/http"
 
+// ClientErr is an error reported to the client. It is written as a Problem by Write.
 type ClientErr struct {
-	HttpCode int               `json:"code"`
+	HttpCode int               `json:"status"`
+	Code     Code              `json:"code"`
 	Message  string            `json:"message"`
 	LogMess  string            `json:"-"`
 	Errors   map[string]string `json:"errors,omitempty"`
 }
 
-type InternalErr struct {
-	HttpCode int    `json:"code"`
-	Message  string `json:"message"`
-}
-
 func (err *ClientErr) Error() string {
 	if err.LogMess != "" {
 		return err.LogMess
@@ -21,7 +18,31 @@ func (err *ClientErr) Error() string {
 	return err.Message
 }
 
+// New returns a ClientErr with the status of code and message as the detail
+func New(code Code, message string) *ClientErr {
+	return &ClientErr{HttpCode: code.Status(), Code: code, Message: message}
+}
+
 var UnauthErr = ClientErr{
 	HttpCode: http.StatusUnauthorized,
+	Code:     CodeUnauthorized,
 	Message:  "Unauthorized",
 }
+
+var ForbiddenErr = ClientErr{
+	HttpCode: http.StatusForbidden,
+	Code:     CodeForbidden,
+	Message:  "Forbidden",
+}
+
+var MethodErr = ClientErr{
+	HttpCode: http.StatusMethodNotAllowed,
+	Code:     CodeInvalidMethod,
+	Message:  "Invalid Method",
+}
+
+var InvalidJSONErr = ClientErr{
+	HttpCode: http.StatusBadRequest,
+	Code:     CodeInvalidJSON,
+	Message:  "Invalid JSON",
+}
@@ -0,0 +1,212 @@
+package api_errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/rs/zerolog/log"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix is followed by the code in the type URI of a problem
+const problemTypePrefix = "urn:go-kv:error:"
+
+// Code identifies the kind of an error. Codes are stable and documented in docs/openapi.yaml,
+// so clients can rely on them rather than on messages.
+type Code string
+
+const (
+	CodeInvalidMethod        Code = "invalid_method"
+	CodeInvalidJSON          Code = "invalid_json"
+	CodeInvalidParameter     Code = "invalid_parameter"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeKeyNotFound          Code = "key_not_found"
+	CodeFieldNotFound        Code = "field_not_found"
+	CodeNamespaceNotFound    Code = "namespace_not_found"
+	CodeNamespaceExists      Code = "namespace_exists"
+	CodeWrongType            Code = "wrong_type"
+	CodeNotNumeric           Code = "not_numeric"
+	CodeOverflow             Code = "overflow"
+	CodeCompactionInProgress Code = "compaction_in_progress"
+	CodeMemoryLimit          Code = "memory_limit"
+	CodeKeyTooLong           Code = "key_too_long"
+	CodeInvalidKey           Code = "invalid_key"
+	CodeValueTooLarge        Code = "value_too_large"
+	CodeBodyTooLarge         Code = "body_too_large"
+	CodeBatchTooLarge        Code = "batch_too_large"
+	CodeQuotaExceeded        Code = "quota_exceeded"
+	CodeRateLimited          Code = "rate_limited"
+	CodeOverloaded           Code = "overloaded"
+	CodeReadOnly             Code = "read_only"
+	CodeCorrupted            Code = "corrupted"
+	CodeInternal             Code = "internal"
+)
+
+// codeInfo is the status and title of the problems with a code
+type codeInfo struct {
+	status int
+	title  string
+}
+
+var codes = map[Code]codeInfo{
+	CodeInvalidMethod:        {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeInvalidJSON:          {http.StatusBadRequest, "Invalid JSON body"},
+	CodeInvalidParameter:     {http.StatusBadRequest, "Invalid parameter"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeNotFound:             {http.StatusNotFound, "Not found"},
+	CodeKeyNotFound:          {http.StatusNotFound, "Key not found"},
+	CodeFieldNotFound:        {http.StatusNotFound, "Field not found"},
+	CodeNamespaceNotFound:    {http.StatusNotFound, "Namespace not found"},
+	CodeNamespaceExists:      {http.StatusConflict, "Namespace already exists"},
+	CodeWrongType:            {http.StatusConflict, "Wrong type"},
+	CodeNotNumeric:           {http.StatusBadRequest, "Value is not a number"},
+	CodeOverflow:             {http.StatusBadRequest, "Counter overflow"},
+	CodeCompactionInProgress: {http.StatusConflict, "Compaction already running"},
+	CodeMemoryLimit:          {http.StatusRequestEntityTooLarge, "Memory limit exceeded"},
+	CodeKeyTooLong:           {http.StatusBadRequest, "Key too long"},
+	CodeInvalidKey:           {http.StatusBadRequest, "Invalid key"},
+	CodeValueTooLarge:        {http.StatusRequestEntityTooLarge, "Value too large"},
+	CodeBodyTooLarge:         {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeBatchTooLarge:        {http.StatusRequestEntityTooLarge, "Too many keys in batch"},
+	CodeQuotaExceeded:        {http.StatusTooManyRequests, "Quota exceeded"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Rate limit exceeded"},
+	CodeOverloaded:           {http.StatusServiceUnavailable, "Server overloaded"},
+	CodeReadOnly:             {http.StatusServiceUnavailable, "Read-only"},
+	CodeCorrupted:            {http.StatusInternalServerError, "Data corrupted"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Status returns the HTTP status of the problems with code
+func (c Code) Status() int {
+	if info, ok := codes[c]; ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Problem is the body of an error response, an RFC 7807 problem details object
+// extended with the stable code and the errors of individual fields
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     Code              `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// engineErrors maps the engine's errors to their codes, checked in order with errors.Is
+var engineErrors = []struct {
+	err  error
+	code Code
+}{
+	{engine.ErrNotFound, CodeKeyNotFound},
+	{engine.ErrFieldNotFound, CodeFieldNotFound},
+	{engine.ErrWrongType, CodeWrongType},
+	{engine.ErrInvalidScore, CodeInvalidParameter},
+	{engine.ErrNotNumeric, CodeNotNumeric},
+	{engine.ErrOverflow, CodeOverflow},
+	{engine.ErrCompactionInProgress, CodeCompactionInProgress},
+	{engine.ErrMemoryLimit, CodeMemoryLimit},
+	{engine.ErrKeyTooLong, CodeKeyTooLong},
+	{engine.ErrInvalidKey, CodeInvalidKey},
+	{engine.ErrValueTooLarge, CodeValueTooLarge},
+	{engine.ErrReadOnly, CodeReadOnly},
+	{engine.ErrCorrupted, CodeCorrupted},
+	{engine.ErrNamespaceNotFound, CodeNamespaceNotFound},
+	{engine.ErrNamespaceExists, CodeNamespaceExists},
+	{engine.ErrInvalidNamespace, CodeInvalidParameter},
+	{engine.ErrInvalidMemoryLimit, CodeInvalidParameter},
+}
+
+// From maps err to the ClientErr reported for it. Errors of the engine get their code and
+// message, and any other error is an internal error whose message is not shown to clients.
+func From(err error) *ClientErr {
+	var clientErr *ClientErr
+	if errors.As(err, &clientErr) {
+		return clientErr
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return New(CodeBodyTooLarge, fmt.Sprintf("The request body exceeds %d bytes", maxBytesErr.Limit))
+	}
+	for _, mapping := range engineErrors {
+		if errors.Is(err, mapping.err) {
+			message := err.Error()
+			if mapping.code == CodeCorrupted {
+				// The error names files of the server
+				message = mapping.err.Error()
+			}
+			return &ClientErr{HttpCode: mapping.code.Status(), Code: mapping.code, Message: message, LogMess: err.Error()}
+		}
+	}
+	return &ClientErr{
+		HttpCode: http.StatusInternalServerError,
+		Code:     CodeInternal,
+		Message:  codes[CodeInternal].title,
+		LogMess:  err.Error(),
+	}
+}
+
+// Write writes err as a problem+json response for req. Server errors are logged.
+func Write(w http.ResponseWriter, req *http.Request, err error) {
+	clientErr := From(err)
+	code := clientErr.Code
+	if code == "" {
+		code = codeForStatus(clientErr.HttpCode)
+	}
+	status := clientErr.HttpCode
+	if status == 0 {
+		status = code.Status()
+	}
+	// Shed requests are counted in metrics, logging each one would add to the load
+	if status >= http.StatusInternalServerError && code != CodeOverloaded {
+		log.Error().Err(err).Str("path", req.URL.Path).Str("code", string(code)).Msg("Request failed")
+	}
+
+	title := http.StatusText(status)
+	if info, ok := codes[code]; ok {
+		title = info.title
+	}
+	problem := Problem{
+		Type:     problemTypePrefix + string(code),
+		Title:    title,
+		Status:   status,
+		Detail:   clientErr.Message,
+		Instance: req.URL.Path,
+		Code:     code,
+		Errors:   clientErr.Errors,
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Error().Stack().Err(err).Msg("Failed to encode problem response")
+	}
+}
+
+// codeForStatus returns the generic code of a ClientErr created without one
+func codeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidParameter
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeInvalidMethod
+	}
+	return CodeInternal
+}
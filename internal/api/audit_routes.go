@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// Bounds of the events returned by /admin/audit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// maxAuditBody bounds the bytes of a request body read to describe it in the audit trail
+const maxAuditBody = 64 << 10
+
+// auditAction returns the audit action of req, and false for requests that are not audited
+func auditAction(req *http.Request) (string, bool) {
+	switch {
+	case req.URL.Path == "/flush" && req.Method == http.MethodPost:
+		return audit.ActionNamespaceFlush, true
+	case req.URL.Path == "/compact" && req.Method == http.MethodPost:
+		return audit.ActionNamespaceCompact, true
+	case req.URL.Path == "/admin/namespaces" && req.Method == http.MethodPost:
+		return audit.ActionNamespaceCreate, true
+	case req.URL.Path == "/admin/namespaces" && req.Method == http.MethodDelete:
+		return audit.ActionNamespaceDrop, true
+	case req.URL.Path == "/admin/compaction" && req.Method == http.MethodPost:
+		return "compaction.", true // Completed with the action of the body
+	}
+	return "", false
+}
+
+// EnableAudit records admin and destructive requests in trail, with their actor and outcome.
+// Requests rejected by authentication are recorded too, so call it after AuthMiddleware is added.
+func (r *Router) EnableAudit(trail *audit.Trail) {
+	r.audit = trail
+	r.observe(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			action, audited := auditAction(req)
+			if !audited {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			req, info := withRequestInfo(req)
+			details := map[string]any{"method": req.Method, "path": req.URL.Path}
+			switch action {
+			case audit.ActionNamespaceDrop:
+				details["namespace"] = req.URL.Query().Get("name")
+			case audit.ActionNamespaceCreate:
+				body := peekJSON(req)
+				details["namespace"] = body["name"]
+				if limit, ok := body["memory_limit"]; ok {
+					details["memory_limit"] = limit
+				}
+			case "compaction.":
+				if name, ok := peekJSON(req)["action"].(string); ok && (name == "pause" || name == "resume") {
+					action += name
+				} else {
+					action += "unknown"
+				}
+			default:
+				details["namespace"] = namespaceName(req)
+				// Given by the client, so it describes the request but never changes its action
+				if reason := req.URL.Query().Get("reason"); reason != "" {
+					details["reason"] = reason
+				}
+			}
+
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, req)
+
+			details["status"] = rec.status
+			event := audit.Event{Actor: info.clientOf(req), Action: action, Outcome: audit.OutcomeSuccess, Details: details}
+			switch {
+			case rec.status >= http.StatusInternalServerError:
+				event.Outcome = audit.OutcomeFailure
+			case rec.status >= http.StatusBadRequest:
+				event.Outcome = audit.OutcomeRejected
+			}
+			if err := trail.Record(event); err != nil {
+				log.Error().Err(err).Str("action", action).Msg("Failed to record request in the audit log")
+			}
+		})
+	})
+}
+
+// peekJSON decodes the JSON object of a request body of up to maxAuditBody bytes, and restores
+// the body for the handler. It returns nil when the body is larger or not an object.
+func peekJSON(req *http.Request) map[string]any {
+	if req.Body == nil {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(req.Body, maxAuditBody+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), req.Body), req.Body}
+	if err != nil || len(head) > maxAuditBody {
+		return nil
+	}
+	var body map[string]any
+	if json.Unmarshal(head, &body) != nil {
+		return nil
+	}
+	return body
+}
+
+// handleAudit returns the events of the audit trail, filtered by the since and until times,
+// the actor and the action
+func (r *Router) handleAudit(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return
+	}
+	if r.audit == nil {
+		errorResponse(w, req, api_errors.New(api_errors.CodeNotFound, "Audit log not enabled"))
+		return
+	}
+
+	query := req.URL.Query()
+	filter := audit.Filter{Actor: query.Get("actor"), Action: query.Get("action"), Limit: defaultAuditLimit}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				invalidParameter(w, req, "Parameter "+name+" must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			invalidParameter(w, req, "Parameter limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := r.audit.Query(filter)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"events": events})
+}
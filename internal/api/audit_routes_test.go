@@ -0,0 +1,149 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/audit"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestAuditTrail(t *testing.T) {
+	authenticator, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users: []utils.AuthUser{
+			{Name: "admin", TokenHash: auth.HashSecret("admin-token"), Rules: []utils.AuthRule{{Keys: "*", Access: "admin"}, {Endpoints: []string{"*"}, Access: "admin"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	trail, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer trail.Close()
+
+	router := setupTestRouter(t)
+	router.Use(api.AuthMiddleware(authenticator))
+	router.EnableAudit(trail)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	start := time.Now().UTC().Add(-time.Second)
+	requests := []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{http.MethodPost, "/admin/namespaces", "admin-token", `{"name":"orders","memory_limit":4096}`, http.StatusCreated},
+		{http.MethodPost, "/flush?ns=orders", "admin-token", "", http.StatusOK},
+		{http.MethodPost, "/flush?reason=restore", "admin-token", "", http.StatusOK},
+		{http.MethodPost, "/compact", "", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/admin/namespaces?name=orders", "admin-token", "", http.StatusOK},
+		{http.MethodGet, "/admin/namespaces", "admin-token", "", http.StatusOK}, // Reads are not audited
+	}
+	for _, r := range requests {
+		if status := authRequest(t, r.method, server.URL+r.path, r.token, r.body); status != r.status {
+			t.Fatalf("%s %s: expected status %d, got %d", r.method, r.path, r.status, status)
+		}
+	}
+
+	query := func(params url.Values) []audit.Event {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/audit?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body struct {
+			Events []audit.Event `json:"events"`
+		}
+		parseJSONResponse(t, resp, &body)
+		return body.Events
+	}
+
+	events := query(url.Values{"since": {start.Format(time.RFC3339)}})
+	actions := make([]string, len(events))
+	for i, event := range events {
+		actions[i] = event.Action + "/" + event.Outcome
+	}
+	expected := "namespace.create/success namespace.flush/success namespace.flush/success namespace.compact/rejected namespace.drop/success"
+	if got := strings.Join(actions, " "); got != expected {
+		t.Fatalf("Expected events %q, got %q", expected, got)
+	}
+	if events[0].Actor != "admin" || events[0].Details["namespace"] != "orders" || events[0].Details["memory_limit"] != float64(4096) {
+		t.Errorf("Unexpected create event %+v", events[0])
+	}
+	if events[1].Details["reason"] != nil || events[2].Details["reason"] != "restore" {
+		t.Errorf("Expected the reason of the second flush only, got %+v and %+v", events[1].Details, events[2].Details)
+	}
+	if events[3].Actor != "127.0.0.1" {
+		t.Errorf("Expected the IP address as the actor of an unauthenticated request, got %q", events[3].Actor)
+	}
+
+	if events := query(url.Values{"actor": {"admin"}, "action": {"namespace."}, "limit": {"2"}}); len(events) != 2 || events[1].Action != audit.ActionNamespaceDrop {
+		t.Errorf("Expected the last 2 namespace events of admin, got %+v", events)
+	}
+	if events := query(url.Values{"until": {start.Format(time.RFC3339)}}); len(events) != 0 {
+		t.Errorf("Expected no events before the test, got %+v", events)
+	}
+	if status := authRequest(t, http.MethodGet, server.URL+"/admin/audit?since=yesterday", "admin-token", ""); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid time, got %d", status)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = previous }()
+
+	router := setupTestRouter(t)
+	router.EnableAccessLog()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp := assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(`{"key":"k","value":"v"}`), http.StatusOK)
+	resp.Body.Close()
+
+	var entry struct {
+		Log      string  `json:"log"`
+		Method   string  `json:"method"`
+		Path     string  `json:"path"`
+		Route    string  `json:"route"`
+		Status   int     `json:"status"`
+		Latency  float64 `json:"latency"`
+		BytesIn  int     `json:"bytes_in"`
+		BytesOut int     `json:"bytes_out"`
+		Client   string  `json:"client"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"log":"access"`) {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("Malformed access log entry %q: %v", line, err)
+			}
+		}
+	}
+	if entry.Method != http.MethodPost || entry.Path != "/set" || entry.Route != "/set" || entry.Status != http.StatusOK {
+		t.Errorf("Unexpected access log entry %+v", entry)
+	}
+	if entry.BytesIn != 23 || entry.BytesOut == 0 || entry.Client != "127.0.0.1" {
+		t.Errorf("Expected the sizes and client in the access log, got %+v", entry)
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// routeScope describes what a route's access check applies to
+type routeScope int
+
+const (
+	scopePublic   routeScope = iota // No credentials required
+	scopeKeys                       // The keys named in the query or body
+	scopeStore                      // Every key of the namespace
+	scopeEndpoint                   // The endpoint path itself
+)
+
+type routePolicy struct {
+	scope  routeScope
+	access auth.Access
+}
+
+// routePolicies maps paths to the access they require. Paths ending in "*" match by prefix.
+var routePolicies = map[string]routePolicy{
+	"/v1/keys/*":    {scopeKeys, auth.AccessWrite}, // GET and HEAD requests only need read
+	"/v1/keys":      {scopeStore, auth.AccessRead},
+	"/get":          {scopeKeys, auth.AccessRead},
+	"/set":          {scopeKeys, auth.AccessWrite},
+	"/delete":       {scopeKeys, auth.AccessWrite},
+	"/incr":         {scopeKeys, auth.AccessWrite},
+	"/batch/*":      {scopeKeys, auth.AccessWrite},
+	"/types/*":      {scopeKeys, auth.AccessWrite}, // GET requests only need read
+	"/list":         {scopeStore, auth.AccessRead},
+	"/count":        {scopeStore, auth.AccessRead},
+	"/memory-usage": {scopeStore, auth.AccessRead},
+	"/flush":        {scopeEndpoint, auth.AccessAdmin},
+	"/compact":      {scopeEndpoint, auth.AccessAdmin},
+	"/admin/*":      {scopeEndpoint, auth.AccessAdmin},
+	"/metrics":      {scopeEndpoint, auth.AccessRead},
+	"/healthz":      {scopePublic, auth.AccessNone},
+	"/readyz":       {scopePublic, auth.AccessNone},
+	"/web/static/*": {scopePublic, auth.AccessNone},
+	"/web/logs":     {scopeEndpoint, auth.AccessAdmin},
+	"/web/api/logs": {scopeEndpoint, auth.AccessAdmin},
+	"/web*":         {scopeStore, auth.AccessRead},
+}
+
+// policyFor returns the policy of a path. Unknown paths require admin access on the endpoint.
+func policyFor(req *http.Request) routePolicy {
+	path := req.URL.Path
+	policy, ok := routePolicies[path]
+	if !ok {
+		longest := -1
+		for pattern, p := range routePolicies {
+			if prefix, isPrefix := strings.CutSuffix(pattern, "*"); isPrefix && strings.HasPrefix(path, prefix) && len(prefix) > longest {
+				policy, ok, longest = p, true, len(prefix)
+			}
+		}
+	}
+	if !ok {
+		return routePolicy{scopeEndpoint, auth.AccessAdmin}
+	}
+	if policy.scope == scopeKeys && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		policy.access = auth.AccessRead
+	}
+	return policy
+}
+
+// AuthMiddleware authenticates every request and enforces the ACL rules of the caller.
+// Missing or invalid credentials are rejected with 401, insufficient access with 403.
+func AuthMiddleware(authenticator *auth.Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			policy := policyFor(req)
+			if policy.scope == scopePublic {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			identity, err := authenticator.Authenticate(req)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="go-kv"`)
+				errorResponse(w, req, &api_errors.UnauthErr)
+				return
+			}
+
+			allowed, err := authorize(identity, policy, req)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				errorResponse(w, req, err)
+				return
+			}
+			if err != nil {
+				invalidJSON(w, req)
+				return
+			}
+			if !allowed {
+				log.Warn().Str("identity", identity.Name).Str("path", req.URL.Path).Str("access", policy.access.String()).Msg("Request denied")
+				errorResponse(w, req, &api_errors.ForbiddenErr)
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+		})
+	}
+}
+
+// authorize checks the identity's rules against the policy of the request
+func authorize(identity *auth.Identity, policy routePolicy, req *http.Request) (bool, error) {
+	namespace := namespaceName(req)
+
+	switch policy.scope {
+	case scopeStore:
+		return identity.CanAccessAllKeys(namespace, policy.access), nil
+	case scopeEndpoint:
+		return identity.CanAccessEndpoint(namespace, req.URL.Path, policy.access), nil
+	}
+
+	keys, err := requestKeys(req)
+	if err != nil {
+		return false, err
+	}
+	if len(keys) == 0 {
+		// Nothing to check against key rules, let the handler reject the request
+		return identity.CanAccessAllKeys(namespace, policy.access), nil
+	}
+	for _, key := range keys {
+		if !identity.CanAccessKey(namespace, key, policy.access) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// keyBodies decode the body of the routes taking their keys from it into the request types of
+// their handlers, so the keys checked are the ones the handlers use
+var keyBodies = map[string]func(body []byte) ([]string, error){
+	"/set":  decodeKeys(func(v valueRequest) []string { return singleKey(v.Key) }),
+	"/incr": decodeKeys(func(v incrRequest) []string { return singleKey(v.Key) }),
+	"/batch/set": decodeKeys(func(items []valueRequest) []string {
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		return keys
+	}),
+	"/batch/delete": decodeKeys(func(keys []string) []string { return keys }),
+	"/batch/incr": decodeKeys(func(items []incrRequest) []string {
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		return keys
+	}),
+}
+
+// typeKeyBody decodes the body of the /types/* writes
+var typeKeyBody = decodeKeys(func(v typeRequest) []string { return singleKey(v.Key) })
+
+// decodeKeys returns a function decoding a body into T, the way decodeJSON does, and returning
+// the keys of T
+func decodeKeys[T any](keys func(T) []string) func(body []byte) ([]string, error) {
+	return func(body []byte) ([]string, error) {
+		var v T
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&v); err != nil {
+			return nil, err
+		}
+		return keys(v), nil
+	}
+}
+
+// singleKey returns key, or no key when it is missing so the handler rejects the request
+func singleKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
+
+// requestKeys returns the keys named by a request: from the /v1/keys/{key} path, the JSON body of
+// the routes reading their keys from it, otherwise the key query parameter. The body is restored
+// so handlers can read it again.
+func requestKeys(req *http.Request) ([]string, error) {
+	if key, ok := strings.CutPrefix(req.URL.Path, "/v1/keys/"); ok {
+		if key == "" {
+			return nil, nil
+		}
+		return []string{key}, nil
+	}
+
+	decode, fromBody := keyBodies[req.URL.Path]
+	if strings.HasPrefix(req.URL.Path, "/types/") && req.Method == http.MethodPost {
+		decode, fromBody = typeKeyBody, true
+	}
+	if !fromBody {
+		return singleKey(req.URL.Query().Get("key")), nil
+	}
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	return decode(body)
+}
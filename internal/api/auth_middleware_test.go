@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+func setupAuthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	authenticator, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users: []utils.AuthUser{
+			{Name: "writer", TokenHash: auth.HashSecret("writer-token"), Rules: []utils.AuthRule{{Keys: "app/*", Access: "write"}}},
+			{Name: "admin", TokenHash: auth.HashSecret("admin-token"), Rules: []utils.AuthRule{{Keys: "*", Access: "admin"}, {Endpoints: []string{"*"}, Access: "admin"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	router := setupTestRouter(t)
+	router.Use(api.AuthMiddleware(authenticator))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func authRequest(t *testing.T, method, url, token, body string) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	server := setupAuthServer(t)
+
+	cases := []struct {
+		name, method, path, token, body string
+		expected                        int
+	}{
+		{"missing credentials", http.MethodGet, "/get?key=app/a", "", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/get?key=app/a", "bad", "", http.StatusUnauthorized},
+		{"write inside prefix", http.MethodPost, "/set", "writer-token", `{"key":"app/a","value":"v"}`, http.StatusOK},
+		{"write outside prefix", http.MethodPost, "/set", "writer-token", `{"key":"other","value":"v"}`, http.StatusForbidden},
+		{"query key ignored for body keys", http.MethodPost, "/set?key=app/x", "writer-token", `{"key":"secret","value":"v"}`, http.StatusForbidden},
+		{"case-insensitive body key", http.MethodPost, "/set", "writer-token", `{"key":"app/x","Key":"secret","value":"v"}`, http.StatusForbidden},
+		{"case-insensitive type key", http.MethodPost, "/types/set/add", "writer-token", `{"key":"app/s","KEY":"secret","members":["m"]}`, http.StatusForbidden},
+		{"query key ignored for type writes", http.MethodPost, "/types/list/rpush?key=app/l", "writer-token", `{"key":"secret","values":["v"]}`, http.StatusForbidden},
+		{"type write inside prefix", http.MethodPost, "/types/list/rpush", "writer-token", `{"key":"app/l","values":["v"]}`, http.StatusOK},
+		{"batch delete outside prefix", http.MethodPost, "/batch/delete?key=app/x", "writer-token", `["secret"]`, http.StatusForbidden},
+		{"counter outside prefix", http.MethodPost, "/incr?key=app/x", "writer-token", `{"Key":"secret"}`, http.StatusForbidden},
+		{"batch with one forbidden key", http.MethodPost, "/batch/set", "writer-token", `[{"key":"app/b","value":"v"},{"key":"x","value":"v"}]`, http.StatusForbidden},
+		{"read inside prefix", http.MethodGet, "/get?key=app/a", "writer-token", "", http.StatusOK},
+		{"list needs access to every key", http.MethodGet, "/list", "writer-token", "", http.StatusForbidden},
+		{"v1 write inside prefix", http.MethodPut, "/v1/keys/app/raw", "writer-token", "not json", http.StatusNoContent},
+		{"v1 write outside prefix", http.MethodPut, "/v1/keys/other", "writer-token", "not json", http.StatusForbidden},
+		{"v1 list needs access to every key", http.MethodGet, "/v1/keys", "writer-token", "", http.StatusForbidden},
+		{"flush needs admin", http.MethodPost, "/flush", "writer-token", "", http.StatusForbidden},
+		{"admin can flush", http.MethodPost, "/flush", "admin-token", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status := authRequest(t, c.method, server.URL+c.path, c.token, c.body); status != c.expected {
+				t.Errorf("Expected status code %d, got %d", c.expected, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+)
+
+// errorResponse writes err as an RFC 7807 problem, with the code and status api_errors.From maps it to
+func errorResponse(w http.ResponseWriter, req *http.Request, err error) {
+	recordProblem(req, api_errors.From(err).Code)
+	api_errors.Write(w, req, err)
+}
+
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	errorResponse(w, req, &api_errors.MethodErr)
+}
+
+func invalidJSON(w http.ResponseWriter, req *http.Request) {
+	errorResponse(w, req, &api_errors.InvalidJSONErr)
+}
+
+// invalidParameter reports a missing or invalid query parameter or body field
+func invalidParameter(w http.ResponseWriter, req *http.Request, message string) {
+	errorResponse(w, req, api_errors.New(api_errors.CodeInvalidParameter, message))
+}
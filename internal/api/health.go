@@ -0,0 +1,164 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+// longCompaction is how long a compaction may run before the server reports itself not ready
+const longCompaction = 10 * time.Second
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// componentHealth is the status of one component with details about it
+type componentHealth map[string]any
+
+func (c componentHealth) ok() bool {
+	return c["status"] == statusOK
+}
+
+// healthReport is the body of /healthz and /readyz
+type healthReport struct {
+	Status     string                     `json:"status"`
+	Time       time.Time                  `json:"time"`
+	Components map[string]componentHealth `json:"components"`
+}
+
+// handleHealthz reports whether the process is alive. It fails when background workers exited,
+// which only a restart fixes.
+func (r *Router) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	r.writeHealth(w, req, "workers")
+}
+
+// handleReadyz reports whether the server can take traffic: every namespace is loaded and not
+// being restored, no compaction has run for longer than longCompaction, the data directories
+// are writable, the last saves succeeded and the background workers are running.
+func (r *Router) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	r.writeHealth(w, req, "engine", "lastSave", "disk", "workers")
+}
+
+// writeHealth reports every component and fails with 503 when one of the required ones failed
+func (r *Router) writeHealth(w http.ResponseWriter, req *http.Request, required ...string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	report := r.healthReport()
+	status := http.StatusOK
+	for _, name := range required {
+		if !report.Components[name].ok() {
+			report.Status = statusFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	jsonResponse(w, status, report)
+}
+
+// healthReport checks every component across all namespaces
+func (r *Router) healthReport() healthReport {
+	now := time.Now()
+	health := r.namespaces.Health()
+	names := make([]string, 0, len(health))
+	for name := range health {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	engineStatus := componentHealth{"status": statusOK}
+	saveStatus := componentHealth{"status": statusOK}
+	workerStatus := componentHealth{"status": statusOK}
+	var notLoaded, restoring, compacting, saveFailed, workersDown []string
+	var lastSave time.Time
+	alive, expected := 0, 0
+	dirs := make(map[string]bool)
+
+	for _, name := range names {
+		h := health[name]
+		if !h.Loaded {
+			notLoaded = append(notLoaded, name)
+		}
+		if h.Restoring {
+			restoring = append(restoring, name)
+		}
+		if h.Compacting && now.Sub(h.CompactionStarted) > longCompaction {
+			compacting = append(compacting, name)
+		}
+		if h.LastSaveError != "" {
+			saveFailed = append(saveFailed, name)
+		}
+		if !h.LastSave.IsZero() && (lastSave.IsZero() || h.LastSave.Before(lastSave)) {
+			lastSave = h.LastSave
+		}
+		if h.WorkersAlive < h.WorkersExpected {
+			workersDown = append(workersDown, name)
+		}
+		alive += h.WorkersAlive
+		expected += h.WorkersExpected
+		dirs[filepath.Dir(h.FilePath)] = true
+		dirs[filepath.Dir(h.FlushPath)] = true
+	}
+
+	engineStatus["namespaces"] = len(names)
+	for key, failed := range map[string][]string{"notLoaded": notLoaded, "restoring": restoring, "longCompaction": compacting} {
+		if len(failed) > 0 {
+			engineStatus["status"] = statusFail
+			engineStatus[key] = failed
+		}
+	}
+
+	// The oldest save across namespaces, so a namespace that stopped saving shows up
+	if !lastSave.IsZero() {
+		saveStatus["lastSave"] = lastSave
+		saveStatus["ageSeconds"] = now.Sub(lastSave).Seconds()
+	}
+	if len(saveFailed) > 0 {
+		saveStatus["status"] = statusFail
+		saveStatus["failed"] = saveFailed
+	}
+
+	workerStatus["alive"] = alive
+	workerStatus["expected"] = expected
+	if len(workersDown) > 0 {
+		workerStatus["status"] = statusFail
+		workerStatus["stopped"] = workersDown
+	}
+
+	return healthReport{
+		Status: statusOK,
+		Time:   now,
+		Components: map[string]componentHealth{
+			"engine":   engineStatus,
+			"lastSave": saveStatus,
+			"disk":     diskHealth(dirs),
+			"workers":  workerStatus,
+		},
+	}
+}
+
+// diskHealth checks that every data directory is writable and reports its free space
+func diskHealth(dirs map[string]bool) componentHealth {
+	status := componentHealth{"status": statusOK}
+	details := make(map[string]componentHealth, len(dirs))
+	for dir := range dirs {
+		d := componentHealth{"writable": true}
+		if err := utils.DirWritable(dir); err != nil {
+			d["writable"] = false
+			d["error"] = err.Error()
+			status["status"] = statusFail
+		}
+		if free, err := utils.DiskFree(dir); err == nil {
+			d["freeBytes"] = free
+		}
+		details[dir] = d
+	}
+	status["directories"] = details
+	return status
+}
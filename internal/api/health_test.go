@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+type healthBody struct {
+	Status     string                    `json:"status"`
+	Components map[string]map[string]any `json:"components"`
+}
+
+func getHealth(t *testing.T, url string, expectedStatus int) healthBody {
+	t.Helper()
+	resp := assertHTTPResponse(t, http.MethodGet, url, nil, expectedStatus)
+	defer resp.Body.Close()
+
+	var body healthBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	return body
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		body := getHealth(t, server.URL+path, http.StatusOK)
+		if body.Status != "ok" {
+			t.Errorf("Expected %s to be ok, got %q", path, body.Status)
+		}
+		for _, component := range []string{"engine", "lastSave", "disk", "workers"} {
+			if body.Components[component]["status"] != "ok" {
+				t.Errorf("Expected component %s of %s to be ok, got %v", component, path, body.Components[component])
+			}
+		}
+	}
+
+	// Workers stop on shutdown, which only a restart fixes
+	router.Namespaces().Shutdown()
+	body := getHealth(t, server.URL+"/healthz", http.StatusServiceUnavailable)
+	if body.Status != "fail" || body.Components["workers"]["status"] != "fail" {
+		t.Errorf("Expected the stopped workers to fail liveness, got %+v", body)
+	}
+	getHealth(t, server.URL+"/readyz", http.StatusServiceUnavailable)
+}
+
+func TestReadinessFailsWhenDataDirectoryIsGone(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := engine.NewEngine(filepath.Join(dir, "data.db"), filepath.Join(dir, "flush.db"), 1024)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(store.Shutdown)
+	server := httptest.NewServer(api.NewRouter(store, false))
+	defer server.Close()
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Save()
+
+	body := getHealth(t, server.URL+"/readyz", http.StatusServiceUnavailable)
+	if body.Components["disk"]["status"] != "fail" || body.Components["lastSave"]["status"] != "fail" {
+		t.Errorf("Expected the disk and last save to fail, got %+v", body.Components)
+	}
+
+	// The process itself is still alive
+	getHealth(t, server.URL+"/healthz", http.StatusOK)
+}
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+// rejectionCodes are the problem codes counted by gokv_rejected_requests_total
+var rejectionCodes = map[api_errors.Code]bool{
+	api_errors.CodeKeyTooLong:    true,
+	api_errors.CodeInvalidKey:    true,
+	api_errors.CodeValueTooLarge: true,
+	api_errors.CodeBodyTooLarge:  true,
+	api_errors.CodeBatchTooLarge: true,
+	api_errors.CodeQuotaExceeded: true,
+	api_errors.CodeRateLimited:   true,
+	api_errors.CodeOverloaded:    true,
+	api_errors.CodeMemoryLimit:   true,
+}
+
+// rejections counts rejected requests by problem code
+type rejections struct {
+	mu     sync.Mutex
+	counts map[api_errors.Code]int64
+}
+
+func (r *rejections) add(code api_errors.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[api_errors.Code]int64)
+	}
+	r.counts[code]++
+}
+
+func (r *rejections) samples() []metrics.Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	samples := make([]metrics.Sample, 0, len(r.counts))
+	for code, count := range r.counts {
+		samples = append(samples, metrics.Sample{Labels: []string{string(code)}, Value: float64(count)})
+	}
+	return samples
+}
+
+// rejectionsKey holds the rejections of the router serving a request, see recordProblem
+type rejectionsKey struct{}
+
+// recordProblem counts the problem written for req when it is a rejection, so rejections
+// reported by handlers and the engine are counted like the ones of the middlewares
+func recordProblem(req *http.Request, code api_errors.Code) {
+	if r, ok := req.Context().Value(rejectionsKey{}).(*rejections); ok && rejectionCodes[code] {
+		r.add(code)
+	}
+}
+
+// quotaLimits are the quotas of a client, 0 for no limit
+type quotaLimits struct {
+	bytes int64
+	keys  int
+}
+
+// requestLimits are the limits enforced by the limits middleware
+type requestLimits struct {
+	maxBodyBytes int64
+	maxBatchKeys int
+	keys         engine.Limits // Checked here for every route, and by the engine on every write
+	quotas       quotaLimits
+	clients      map[string]quotaLimits
+}
+
+// quotaFor returns the quotas of client
+func (l *requestLimits) quotaFor(client string) quotaLimits {
+	if quota, ok := l.clients[client]; ok {
+		return quota
+	}
+	return l.quotas
+}
+
+// quotasEnabled reports whether any client has a quota
+func (l *requestLimits) quotasEnabled() bool {
+	return l.quotas != quotaLimits{} || len(l.clients) > 0
+}
+
+// SetLimits applies the request limits and quotas of cfg. The key and value limits are set on
+// every namespace too, so they also hold for engines used without the API.
+func (r *Router) SetLimits(cfg utils.LimitsConfig) error {
+	policy, err := engine.ParseKeyPolicy(cfg.KeyPolicy)
+	if err != nil {
+		return err
+	}
+	limits := &requestLimits{
+		maxBodyBytes: int64(cfg.MaxBodyBytes),
+		maxBatchKeys: cfg.MaxBatchKeys,
+		keys:         engine.Limits{MaxKeyLength: cfg.MaxKeyLength, MaxValueSize: int64(cfg.MaxValueBytes), KeyPolicy: policy},
+		quotas:       quotaLimits{bytes: int64(cfg.QuotaBytes), keys: cfg.QuotaKeys},
+		clients:      make(map[string]quotaLimits, len(cfg.Clients)),
+	}
+	for _, client := range cfg.Clients {
+		limits.clients[client.Client] = quotaLimits{bytes: int64(client.QuotaBytes), keys: client.QuotaKeys}
+	}
+	r.limits.Store(limits)
+	r.namespaces.SetLimits(limits.keys)
+	return nil
+}
+
+// limitRequests rejects requests over the configured limits and quotas before they reach the
+// handlers. It runs after authentication.
+func (r *Router) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limits := r.limits.Load()
+		upload := isUpload(req)
+		if err := limits.checkBody(w, req, upload); err != nil {
+			errorResponse(w, req, err)
+			return
+		}
+
+		policy := policyFor(req)
+		write := policy.scope == scopeKeys && policy.access == auth.AccessWrite
+		var keys []string
+		if write || strings.HasPrefix(req.URL.Path, "/batch/") {
+			// Malformed bodies are reported by the handlers
+			keys, _ = requestKeys(req)
+			if err := limits.checkKeys(req, keys, write); err != nil {
+				errorResponse(w, req, err)
+				return
+			}
+		}
+
+		if !limits.quotasEnabled() {
+			next.ServeHTTP(w, req)
+			return
+		}
+		r.serveWithQuotas(w, req, next, limits, keys, write)
+	})
+}
+
+// isUpload reports whether req streams a value to /v1/keys
+func isUpload(req *http.Request) bool {
+	return req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "/v1/keys/")
+}
+
+// capBody limits the body of req to the configured size, so no middleware reading it, such as
+// authentication, buffers more. Uploads are left to checkBody.
+func (l *requestLimits) capBody(w http.ResponseWriter, req *http.Request) {
+	if l.maxBodyBytes <= 0 || req.Body == nil || req.Body == http.NoBody || isUpload(req) {
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, l.maxBodyBytes)
+}
+
+// checkBody rejects bodies over the limits. JSON bodies are read here, so the limit is enforced
+// whatever the handler does with them; values uploaded to /v1/keys are streamed and limited by
+// the engine as it reads them.
+func (l *requestLimits) checkBody(w http.ResponseWriter, req *http.Request, upload bool) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if upload {
+		if err := l.keys.CheckValue(req.ContentLength); err != nil {
+			return err
+		}
+		return nil
+	}
+	if l.maxBodyBytes <= 0 {
+		return nil
+	}
+	if req.ContentLength > l.maxBodyBytes {
+		return &http.MaxBytesError{Limit: l.maxBodyBytes}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, l.maxBodyBytes))
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return nil
+}
+
+// checkKeys rejects batches with too many keys and writes of keys the key limits do not allow
+func (l *requestLimits) checkKeys(req *http.Request, keys []string, write bool) error {
+	if strings.HasPrefix(req.URL.Path, "/batch/") && l.maxBatchKeys > 0 && len(keys) > l.maxBatchKeys {
+		return api_errors.New(api_errors.CodeBatchTooLarge, fmt.Sprintf("The batch has %d keys, the limit is %d", len(keys), l.maxBatchKeys))
+	}
+	if !write {
+		return nil
+	}
+	for _, key := range keys {
+		if err := l.keys.CheckKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeKind is how a write changes what its keys store
+type writeKind int
+
+const (
+	writeAdd     writeKind = iota // The body adds to the keys, such as list pushes
+	writeReplace                  // The body replaces the values of the keys
+	writeDelete                   // The keys are deleted
+	writeRemove                   // The body removes from the keys, such as list pops
+)
+
+func writeKindOf(req *http.Request) writeKind {
+	path := req.URL.Path
+	switch {
+	case path == "/delete" || path == "/batch/delete" || req.Method == http.MethodDelete:
+		return writeDelete
+	case strings.HasPrefix(path, "/types/") && (strings.HasSuffix(path, "/delete") || strings.HasSuffix(path, "/remove") || strings.HasSuffix(path, "pop")):
+		return writeRemove
+	case path == "/set" || path == "/batch/set" || req.Method == http.MethodPut:
+		return writeReplace
+	}
+	return writeAdd
+}
+
+// serveWithQuotas serves a request of a client with quotas. Writes that would take the client
+// over its quotas are rejected. The engine counts what each client stores: the keys of a write are
+// claimed by its client while it is served, and its estimated size is reserved until it is stored.
+func (r *Router) serveWithQuotas(w http.ResponseWriter, req *http.Request, next http.Handler, limits *requestLimits, keys []string, write bool) {
+	kind := writeKindOf(req)
+	if !write || len(keys) == 0 || (kind != writeAdd && kind != writeReplace) {
+		next.ServeHTTP(w, req)
+		return
+	}
+	store, err := r.namespaces.Get(namespaceName(req))
+	if err != nil {
+		// Reported by the handlers
+		next.ServeHTTP(w, req)
+		return
+	}
+
+	client := clientID(req)
+	remaining, release, err := r.reserveQuota(store, client, keys, req.ContentLength, kind == writeReplace, limits.quotaFor(client))
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	defer release()
+	defer store.Claim(client, keys)()
+
+	if req.Body != nil && remaining >= 0 {
+		// The length of chunked bodies is unknown until they are read
+		req.Body = &countingReader{r: req.Body, limit: remaining}
+	}
+	next.ServeHTTP(w, req)
+}
+
+// countingReader counts the bytes read from r and fails once they exceed limit, unless it is negative
+type countingReader struct {
+	r     io.ReadCloser
+	read  int64
+	limit int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.limit >= 0 && c.read > c.limit {
+		return n, api_errors.New(api_errors.CodeQuotaExceeded, "The value exceeds the bytes quota of the client")
+	}
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// clientID identifies the client of a request for quotas and rate limits: the name of its
+// identity when it authenticated, otherwise its IP address
+func clientID(req *http.Request) string {
+	if identity, ok := auth.FromContext(req.Context()); ok && identity != nil {
+		return identity.Name
+	}
+	return remoteIP(req)
+}
+
+// remoteIP returns the IP address req was sent from
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// quotaReservations are the keys and bytes of the writes of each client that are being served
+// and not yet counted by the engines.
+type quotaReservations struct {
+	mu       sync.Mutex
+	reserved map[string]engine.OwnerUsage
+}
+
+func newQuotaReservations() *quotaReservations {
+	return &quotaReservations{reserved: make(map[string]engine.OwnerUsage)}
+}
+
+// reserveQuota checks that writing size bytes to keys of store keeps client within quota, and
+// reserves them until release is called, so that concurrent writes cannot go over it together. It
+// returns the bytes the client may still write, or -1 when its bytes are not limited. A size of -1
+// is unknown and reserves every byte the client has left.
+func (r *Router) reserveQuota(store *engine.Engine, client string, keys []string, size int64, replace bool, quota quotaLimits) (remaining int64, release func(), err error) {
+	t := r.quotas
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Stored usage is read under the lock: a write is counted by its engine before its
+	// reservation is released, so it is never missed, at worst counted twice for a moment.
+	usage := r.namespaces.OwnerUsage(client)
+	reserved := t.reserved[client]
+	usage.Keys += reserved.Keys
+	usage.Bytes += reserved.Bytes
+
+	keys = uniqueKeys(keys)
+	owned := store.Owned(client, keys)
+	newKeys := len(keys) - owned.Keys
+	if quota.keys > 0 && usage.Keys+newKeys > quota.keys {
+		return 0, nil, api_errors.New(api_errors.CodeQuotaExceeded, fmt.Sprintf("The client stores %d keys, its quota is %d", usage.Keys, quota.keys))
+	}
+
+	remaining = -1
+	var bytes int64
+	if quota.bytes > 0 {
+		remaining = quota.bytes - usage.Bytes
+		if replace {
+			remaining += owned.Bytes
+		}
+		bytes = size
+		for _, key := range keys {
+			bytes += int64(len(key))
+		}
+		if size < 0 {
+			bytes = max(remaining, 0)
+		}
+		if bytes > remaining {
+			return 0, nil, api_errors.New(api_errors.CodeQuotaExceeded, fmt.Sprintf("The client stores %d bytes, its quota is %d", usage.Bytes, quota.bytes))
+		}
+	}
+
+	reserved.Keys += newKeys
+	reserved.Bytes += bytes
+	t.reserved[client] = reserved
+	return remaining, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		reserved := t.reserved[client]
+		reserved.Keys -= newKeys
+		reserved.Bytes -= bytes
+		if reserved.Keys <= 0 && reserved.Bytes <= 0 {
+			delete(t.reserved, client)
+		} else {
+			t.reserved[client] = reserved
+		}
+	}, nil
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := keys[:0:0]
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// handleQuotas returns the usage and quotas of every client that stores keys or has its own quotas
+func (r *Router) handleQuotas(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	type clientQuota struct {
+		Client     string `json:"client"`
+		Keys       int    `json:"keys"`
+		Bytes      int64  `json:"bytes"`
+		QuotaKeys  int    `json:"quota_keys"`
+		QuotaBytes int64  `json:"quota_bytes"`
+	}
+
+	limits := r.limits.Load()
+	usage := r.namespaces.Owners()
+	for client := range limits.clients {
+		if _, ok := usage[client]; !ok {
+			usage[client] = engine.OwnerUsage{}
+		}
+	}
+	clients := make([]clientQuota, 0, len(usage))
+	for client, u := range usage {
+		quota := limits.quotaFor(client)
+		clients = append(clients, clientQuota{Client: client, Keys: u.Keys, Bytes: u.Bytes, QuotaKeys: quota.keys, QuotaBytes: quota.bytes})
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Client < clients[j].Client })
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"clients": clients})
+}
@@ -0,0 +1,253 @@
+package api_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+func TestRequestLimits(t *testing.T) {
+	router := setupTestRouter(t)
+	router.EnableMetrics(metrics.NewRegistry())
+	err := router.SetLimits(utils.LimitsConfig{
+		MaxBodyBytes:  256,
+		MaxBatchKeys:  2,
+		MaxKeyLength:  8,
+		MaxValueBytes: 32,
+		KeyPolicy:     "ascii",
+	})
+	if err != nil {
+		t.Fatalf("SetLimits() failed: %v", err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   api_errors.Code
+	}{
+		{"body too large", http.MethodPost, "/set", `{"key":"k","value":"` + strings.Repeat("x", 256) + `"}`, http.StatusRequestEntityTooLarge, api_errors.CodeBodyTooLarge},
+		{"batch too large", http.MethodPost, "/batch/set", `[{"key":"a","value":"1"},{"key":"b","value":"2"},{"key":"c","value":"3"}]`, http.StatusRequestEntityTooLarge, api_errors.CodeBatchTooLarge},
+		{"key too long", http.MethodPost, "/set", `{"key":"123456789","value":"v"}`, http.StatusBadRequest, api_errors.CodeKeyTooLong},
+		{"key too long with key parameter", http.MethodPost, "/set?key=k", `{"key":"123456789","value":"v"}`, http.StatusBadRequest, api_errors.CodeKeyTooLong},
+		{"invalid key", http.MethodPut, "/v1/keys/a%20b", "v", http.StatusBadRequest, api_errors.CodeInvalidKey},
+		{"value too large", http.MethodPut, "/v1/keys/big", strings.Repeat("x", 33), http.StatusRequestEntityTooLarge, api_errors.CodeValueTooLarge},
+		{"typed key too long", http.MethodPost, "/types/list/rpush", `{"key":"123456789","values":["v"]}`, http.StatusBadRequest, api_errors.CodeKeyTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := assertHTTPResponse(t, tt.method, server.URL+tt.path, strings.NewReader(tt.body), tt.status)
+			defer resp.Body.Close()
+			var problem api_errors.Problem
+			parseJSONResponse(t, resp, &problem)
+			if problem.Code != tt.code {
+				t.Errorf("Expected code %s, got %+v", tt.code, problem)
+			}
+		})
+	}
+
+	// Reads of keys the limits do not allow are not rejected
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=123456789", nil, http.StatusNotFound)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/batch/set", bytes.NewBufferString(`[{"key":"a","value":"1"},{"key":"b","value":"2"}]`), http.StatusOK)
+	resp.Body.Close()
+
+	values := scrapeMetrics(t, server.URL)
+	for _, code := range []string{"body_too_large", "batch_too_large", "invalid_key", "value_too_large"} {
+		if got := values[`gokv_rejected_requests_total{reason="`+code+`"}`]; got != 1 {
+			t.Errorf("Expected 1 rejection for %s, got %v", code, got)
+		}
+	}
+	if got := values[`gokv_rejected_requests_total{reason="key_too_long"}`]; got != 3 {
+		t.Errorf("Expected 3 rejections for key_too_long, got %v", got)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	router := setupTestRouter(t)
+	err := router.SetLimits(utils.LimitsConfig{
+		QuotaKeys:  2,
+		QuotaBytes: 1 << 20,
+		Clients:    []utils.ClientQuota{{Client: "other", QuotaKeys: 10}},
+	})
+	if err != nil {
+		t.Fatalf("SetLimits() failed: %v", err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	set := func(key string, status int) {
+		t.Helper()
+		resp := assertHTTPResponse(t, http.MethodPut, server.URL+"/v1/keys/"+key, strings.NewReader("value"), status)
+		defer resp.Body.Close()
+		if status == http.StatusTooManyRequests {
+			var problem api_errors.Problem
+			parseJSONResponse(t, resp, &problem)
+			if problem.Code != api_errors.CodeQuotaExceeded {
+				t.Errorf("Expected code %s, got %+v", api_errors.CodeQuotaExceeded, problem)
+			}
+		}
+	}
+
+	set("a", http.StatusNoContent)
+	set("b", http.StatusNoContent)
+	set("a", http.StatusNoContent) // Replacing a key of the client does not count again
+	set("c", http.StatusTooManyRequests)
+
+	resp := assertHTTPResponse(t, http.MethodDelete, server.URL+"/v1/keys/a", nil, http.StatusNoContent)
+	resp.Body.Close()
+	set("c", http.StatusNoContent)
+
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/quotas", nil, http.StatusOK)
+	defer resp.Body.Close()
+	var quotas struct {
+		Clients []struct {
+			Client     string `json:"client"`
+			Keys       int    `json:"keys"`
+			Bytes      int64  `json:"bytes"`
+			QuotaKeys  int    `json:"quota_keys"`
+			QuotaBytes int64  `json:"quota_bytes"`
+		} `json:"clients"`
+	}
+	parseJSONResponse(t, resp, &quotas)
+	if len(quotas.Clients) != 2 || quotas.Clients[0].Client != "127.0.0.1" || quotas.Clients[1].Client != "other" {
+		t.Fatalf("Expected the local client and the configured one, got %+v", quotas.Clients)
+	}
+	// The stored keys, values and content types: "b" and "c", with "value" and "application/json"
+	want := int64(2 * len("b"+"value"+"application/json"))
+	if local := quotas.Clients[0]; local.Keys != 2 || local.Bytes != want || local.QuotaKeys != 2 || local.QuotaBytes != 1<<20 {
+		t.Errorf("Unexpected usage %+v", local)
+	}
+	if other := quotas.Clients[1]; other.Keys != 0 || other.QuotaKeys != 10 || other.QuotaBytes != 0 {
+		t.Errorf("Unexpected usage %+v", other)
+	}
+}
+
+func TestStreamedQuota(t *testing.T) {
+	router := setupTestRouter(t)
+	if err := router.SetLimits(utils.LimitsConfig{QuotaBytes: 64}); err != nil {
+		t.Fatalf("SetLimits() failed: %v", err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Without a length, the quota is enforced as the body is read
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1/keys/big", io.NopCloser(strings.NewReader(strings.Repeat("x", 65))))
+	req.ContentLength = -1
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys/big", nil, http.StatusNotFound)
+	resp.Body.Close()
+
+	// JSON bodies are limited as they are read, whether or not they have a length, and count the
+	// stored key and value
+	chunked := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/set", io.NopCloser(strings.NewReader(body)))
+		req.ContentLength = -1
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := chunked(`{"key":"small","value":"v"}`); status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := chunked(`{"key":"large","value":"` + strings.Repeat("x", 64) + `"}`); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, status)
+	}
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/quotas", nil, http.StatusOK)
+	defer resp.Body.Close()
+	var quotas struct {
+		Clients []struct {
+			Bytes int64 `json:"bytes"`
+		} `json:"clients"`
+	}
+	parseJSONResponse(t, resp, &quotas)
+	if want := int64(len("small") + len("v")); len(quotas.Clients) != 1 || quotas.Clients[0].Bytes != want {
+		t.Errorf("Expected %d bytes counted, got %+v", want, quotas.Clients)
+	}
+}
+
+func TestConcurrentQuota(t *testing.T) {
+	router := setupTestRouter(t)
+	if err := router.SetLimits(utils.LimitsConfig{QuotaKeys: 5}); err != nil {
+		t.Fatalf("SetLimits() failed: %v", err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Writes served at the same time cannot together go over the quota
+	var wg sync.WaitGroup
+	var stored atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/v1/keys/key-%d", server.URL, i), strings.NewReader("value"))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("Failed to send request: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNoContent {
+				stored.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := stored.Load(); got != 5 {
+		t.Errorf("Expected 5 writes to be stored, got %d", got)
+	}
+}
+
+func TestBodyLimitWithAuth(t *testing.T) {
+	authenticator, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users:   []utils.AuthUser{{Name: "writer", TokenHash: auth.HashSecret("writer-token"), Rules: []utils.AuthRule{{Keys: "*", Access: "write"}}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	router := setupTestRouter(t)
+	router.Use(api.AuthMiddleware(authenticator))
+	if err := router.SetLimits(utils.LimitsConfig{MaxBodyBytes: 256}); err != nil {
+		t.Fatalf("SetLimits() failed: %v", err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Authentication reads the keys of the body, within the limit
+	body := `{"key":"k","value":"` + strings.Repeat("x", 256) + `"}`
+	if status := authRequest(t, http.MethodPost, server.URL+"/set", "writer-token", body); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+	if status := authRequest(t, http.MethodPost, server.URL+"/set", "writer-token", `{"key":"k","value":"v"}`); status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+}
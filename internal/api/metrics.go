@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+)
+
+// EnableMetrics serves reg on /metrics, records request counts and latencies per endpoint
+// and exports the engine statistics of every namespace. Call it after the other middlewares
+// so rejected requests are counted too.
+func (r *Router) EnableMetrics(reg *metrics.Registry) {
+	requests := reg.NewCounterVec("gokv_http_requests_total", "HTTP requests by endpoint, method and status code.", "endpoint", "method", "status")
+	latency := reg.NewHistogramVec("gokv_http_request_duration_seconds", "HTTP request latency by endpoint and method.", metrics.DefaultBuckets, "endpoint", "method")
+	r.registerEngineMetrics(reg)
+	reg.NewCounterFunc("gokv_rejected_requests_total", "Requests rejected by limits, quotas and rate limits, by problem code.", r.rejections.samples, "reason")
+	reg.NewCounterFunc("gokv_rate_limited_requests_total", "Requests rejected because the client exceeded its budget, by budget.", r.rates.samples, "class")
+	reg.NewGaugeFunc("gokv_http_requests_in_flight", "Requests being handled.", func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(r.inFlight.Load())}}
+	})
+	reg.NewGaugeFunc("gokv_http_max_concurrent_requests", "Requests handled at once before new ones are shed, 0 when not limited.", func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(r.maxConcurrent())}}
+	})
+
+	r.mux.Handle("/metrics", reg.Handler())
+	r.observe(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, req)
+
+			endpoint, method := r.routePattern(req), methodLabel(req.Method)
+			requests.Inc(endpoint, method, strconv.Itoa(rec.status))
+			latency.Observe(time.Since(start).Seconds(), endpoint, method)
+		})
+	})
+}
+
+// methodLabel returns the method label of a request, "other" for methods outside the standard
+// ones so clients cannot create series at will
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// registerEngineMetrics exports the statistics of every namespace, labelled by namespace
+func (r *Router) registerEngineMetrics(reg *metrics.Registry) {
+	perNamespace := func(value func(engine.Stats) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			stats := r.namespaces.Stats()
+			samples := make([]metrics.Sample, 0, len(stats))
+			for name, s := range stats {
+				samples = append(samples, metrics.Sample{Labels: []string{name}, Value: value(s)})
+			}
+			return samples
+		}
+	}
+
+	reg.NewGaugeFunc("gokv_keys", "Keys held in memory.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.KeyCount) }), "namespace")
+	reg.NewGaugeFunc("gokv_store_bytes", "Bytes of keys and values held in memory.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.MemoryUsage) }), "namespace")
+	reg.NewGaugeFunc("gokv_memory_limit_bytes", "Memory limit before keys are flushed to disk.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.MemoryLimit) }), "namespace")
+	reg.NewGaugeFunc("gokv_flush_file_bytes", "Size of the flushed data files on disk that were not compacted yet.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.FlushFileBytes) }), "namespace")
+	reg.NewGaugeFunc("gokv_compacted_file_bytes", "Size of the compacted flushed data files on disk.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.CompactedFileBytes) }), "namespace")
+	reg.NewCounterFunc("gokv_evictions_total", "Keys moved from memory to the flushed tier.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.Evictions) }), "namespace")
+	reg.NewCounterFunc("gokv_evicted_bytes_total", "Bytes moved from memory to the flushed tier.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.EvictedBytes) }), "namespace")
+	reg.NewCounterFunc("gokv_saves_total", "Saves of the in-memory data to disk.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.Saves) }), "namespace")
+	reg.NewCounterFunc("gokv_save_failures_total", "Saves that failed.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.SaveFailures) }), "namespace")
+	reg.NewCounterFunc("gokv_save_duration_seconds_total", "Total time spent saving.",
+		perNamespace(func(s engine.Stats) float64 { return s.SaveDuration.Seconds() }), "namespace")
+	reg.NewCounterFunc("gokv_compaction_runs_total", "Compactions of the flushed data.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.CompactionRuns) }), "namespace")
+	reg.NewCounterFunc("gokv_compaction_failures_total", "Compactions that failed.",
+		perNamespace(func(s engine.Stats) float64 { return float64(s.CompactionFailures) }), "namespace")
+}
@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+)
+
+// scrapeMetrics fetches /metrics and returns the value of every series
+func scrapeMetrics(t *testing.T, url string) map[string]float64 {
+	t.Helper()
+	resp := assertHTTPResponse(t, http.MethodGet, url+"/metrics", nil, http.StatusOK)
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != metrics.ContentType {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cut := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[cut+1:], 64)
+		if cut < 0 || err != nil {
+			t.Fatalf("Malformed sample line: %q", line)
+		}
+		values[line[:cut]] = value
+	}
+	return values
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	router := setupTestRouter(t)
+	router.EnableMetrics(metrics.NewRegistry())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, key := range []string{"a", "b"} {
+		resp := assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"`+key+`","value":"v"}`), http.StatusOK)
+		resp.Body.Close()
+	}
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=missing", nil, http.StatusNotFound)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, "FOOBAR", server.URL+"/get?key=missing", nil, http.StatusMethodNotAllowed)
+	resp.Body.Close()
+
+	values := scrapeMetrics(t, server.URL)
+	expected := map[string]float64{
+		`gokv_http_requests_total{endpoint="/set",method="POST",status="200"}`:               2,
+		`gokv_http_requests_total{endpoint="/get",method="GET",status="404"}`:                1,
+		`gokv_http_requests_total{endpoint="/get",method="other",status="405"}`:              1,
+		`gokv_http_request_duration_seconds_count{endpoint="/set",method="POST"}`:            2,
+		`gokv_http_request_duration_seconds_bucket{endpoint="/set",method="POST",le="+Inf"}`: 2,
+		`gokv_keys{namespace="default"}`:                                                     2,
+		`gokv_store_bytes{namespace="default"}`:                                              4,
+		`gokv_memory_limit_bytes{namespace="default"}`:                                       1024,
+		`gokv_evictions_total{namespace="default"}`:                                          0,
+	}
+	for series, want := range expected {
+		if got, ok := values[series]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", series, want, got, ok)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+// rateClass is the budget a request draws from
+type rateClass int
+
+const (
+	classRead rateClass = iota
+	classWrite
+	classAdmin
+	classAddress // Every request of an IP address, before authentication
+)
+
+var rateClassNames = [...]string{"read", "write", "admin", "ip"}
+
+// classOf returns the budget of req, from the access its route needs. Public routes, such as
+// health checks, are not limited.
+func classOf(req *http.Request) (rateClass, bool) {
+	policy := policyFor(req)
+	switch {
+	case policy.scope == scopePublic:
+		return 0, false
+	case policy.access == auth.AccessAdmin:
+		return classAdmin, true
+	case policy.access == auth.AccessWrite:
+		return classWrite, true
+	}
+	return classRead, true
+}
+
+// budget is the rate a token bucket refills at, in requests per second, and its size.
+// A rate of 0 disables the budget.
+type budget struct {
+	rate  float64
+	burst float64
+}
+
+// tokenBucket holds the requests a client may still send in one class
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type bucketKey struct {
+	client string
+	class  rateClass
+}
+
+// bucketSweepInterval is how often buckets that refilled are dropped
+const bucketSweepInterval = time.Minute
+
+// rateLimiter keeps a token bucket per client and class. Buckets start full and are dropped
+// once they refill, so idle clients cost nothing.
+type rateLimiter struct {
+	mu      sync.Mutex
+	budgets [len(rateClassNames)]budget
+	buckets map[bucketKey]*tokenBucket
+	limited [len(rateClassNames)]int64 // Requests rejected by class
+	swept   time.Time
+	now     func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[bucketKey]*tokenBucket), now: time.Now}
+}
+
+// setBudgets changes the budgets. Buckets keep their tokens, up to the new burst.
+func (l *rateLimiter) setBudgets(cfg utils.RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.budgets[classRead] = budget{cfg.ReadRate, float64(cfg.ReadBurst)}
+	l.budgets[classWrite] = budget{cfg.WriteRate, float64(cfg.WriteBurst)}
+	l.budgets[classAdmin] = budget{cfg.AdminRate, float64(cfg.AdminBurst)}
+	l.budgets[classAddress] = budget{cfg.IPRate, float64(cfg.IPBurst)}
+}
+
+// allow takes a token from the bucket of client for class. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *rateLimiter) allow(client string, class rateClass) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.budgets[class]
+	if b.rate <= 0 {
+		return true, 0
+	}
+	now := l.now()
+	l.sweep(now)
+
+	key := bucketKey{client, class}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: b.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(b.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*b.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	l.limited[class]++
+	return false, time.Duration((1 - bucket.tokens) / b.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that refilled, since a new bucket is the same. It must be called with l.mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < bucketSweepInterval {
+		return
+	}
+	l.swept = now
+	for key, bucket := range l.buckets {
+		b := l.budgets[key.class]
+		if b.rate <= 0 || bucket.tokens+now.Sub(bucket.updated).Seconds()*b.rate >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// samples returns the requests rejected by class, for gokv_rate_limited_requests_total
+func (l *rateLimiter) samples() []metrics.Sample {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	samples := make([]metrics.Sample, 0, len(rateClassNames))
+	for class, name := range rateClassNames {
+		samples = append(samples, metrics.Sample{Labels: []string{name}, Value: float64(l.limited[class])})
+	}
+	return samples
+}
+
+// concurrencyLimiter bounds the requests handled at once. Requests over the limit wait up to
+// wait for a slot.
+type concurrencyLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// acquire takes a slot, and reports false when none was free in time
+func (c *concurrencyLimiter) acquire(ctx context.Context) bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if c.wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(c.wait)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+func (c *concurrencyLimiter) release() {
+	<-c.slots
+}
+
+// rateLimitSettings are the rate limiting settings in effect
+type rateLimitSettings struct {
+	enabled     bool
+	retryAfter  time.Duration       // Sent with requests shed by the concurrency limiter
+	concurrency *concurrencyLimiter // nil when the number of requests is not limited
+}
+
+// SetRateLimit applies the rate limiting settings of cfg. Clients keep their remaining budgets
+// and requests being handled keep their slots.
+func (r *Router) SetRateLimit(cfg utils.RateLimitConfig) {
+	r.rates.setBudgets(cfg)
+	settings := &rateLimitSettings{
+		enabled:    cfg.Enabled,
+		retryAfter: time.Duration(cfg.RetryAfter) * time.Second,
+	}
+	if cfg.Enabled && cfg.MaxConcurrent > 0 {
+		wait := time.Duration(cfg.QueueTimeout) * time.Millisecond
+		if current := r.rateLimit.Load(); current.concurrency != nil && cap(current.concurrency.slots) == cfg.MaxConcurrent {
+			settings.concurrency = &concurrencyLimiter{slots: current.concurrency.slots, wait: wait}
+		} else {
+			settings.concurrency = &concurrencyLimiter{slots: make(chan struct{}, cfg.MaxConcurrent), wait: wait}
+		}
+	}
+	r.rateLimit.Store(settings)
+}
+
+// limitAddress rejects requests of IP addresses over their budget with 429, and sheds requests
+// with 503 while the server handles as many as it may. It runs before the middlewares, so requests
+// with invalid credentials are limited before they are checked, and inside the observers, so its
+// rejections are logged, counted and traced.
+func (r *Router) limitAddress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.inFlight.Add(1)
+		defer r.inFlight.Add(-1)
+
+		settings := r.rateLimit.Load()
+		if _, limited := classOf(req); !settings.enabled || !limited {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if ok, wait := r.rates.allow(remoteIP(req), classAddress); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			errorResponse(w, req, api_errors.New(api_errors.CodeRateLimited, "The IP address exceeded its request rate"))
+			return
+		}
+		if c := settings.concurrency; c != nil {
+			if !c.acquire(req.Context()) {
+				w.Header().Set("Retry-After", retryAfterSeconds(settings.retryAfter))
+				errorResponse(w, req, api_errors.New(api_errors.CodeOverloaded, "The server is handling too many requests"))
+				return
+			}
+			defer c.release()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// limitRate rejects requests of clients over the budget of their class with 429. It runs after
+// authentication, so authenticated clients are limited by identity rather than by IP address.
+func (r *Router) limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		settings := r.rateLimit.Load()
+		class, limited := classOf(req)
+		if !settings.enabled || !limited {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if ok, wait := r.rates.allow(clientID(req), class); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			errorResponse(w, req, api_errors.New(api_errors.CodeRateLimited, fmt.Sprintf("The client exceeded its %s request rate", rateClassNames[class])))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// retryAfterSeconds formats wait for a Retry-After header, rounded up to at least a second
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// maxConcurrent returns the number of requests handled at once, 0 when not limited
+func (r *Router) maxConcurrent() int {
+	if c := r.rateLimit.Load().concurrency; c != nil {
+		return cap(c.slots)
+	}
+	return 0
+}
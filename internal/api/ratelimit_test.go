@@ -0,0 +1,210 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRateLimit(t *testing.T) {
+	router := setupTestRouter(t)
+	router.EnableMetrics(metrics.NewRegistry())
+	router.SetRateLimit(utils.RateLimitConfig{
+		Enabled:    true,
+		WriteRate:  0.01,
+		WriteBurst: 2,
+		AdminRate:  0.01,
+		AdminBurst: 1,
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	set := func(status int) *http.Response {
+		t.Helper()
+		resp := assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"k","value":"v"}`), status)
+		resp.Body.Close()
+		return resp
+	}
+	set(http.StatusOK)
+	set(http.StatusOK)
+	resp := set(http.StatusTooManyRequests)
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 100 {
+		t.Errorf("Expected the seconds until the next token in Retry-After, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	// Reads have their own budget, disabled here, and health checks are never limited
+	for i := 0; i < 5; i++ {
+		resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=k", nil, http.StatusOK)
+		resp.Body.Close()
+	}
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/healthz", nil, http.StatusOK)
+	resp.Body.Close()
+
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/config", nil, http.StatusNotFound)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/config", nil, http.StatusTooManyRequests)
+	defer resp.Body.Close()
+	var problem api_errors.Problem
+	parseJSONResponse(t, resp, &problem)
+	if problem.Code != api_errors.CodeRateLimited {
+		t.Errorf("Expected code %s, got %+v", api_errors.CodeRateLimited, problem)
+	}
+
+	values := scrapeMetrics(t, server.URL)
+	expected := map[string]float64{
+		`gokv_rejected_requests_total{reason="rate_limited"}`: 2,
+		`gokv_rate_limited_requests_total{class="write"}`:     1,
+		`gokv_rate_limited_requests_total{class="admin"}`:     1,
+		`gokv_rate_limited_requests_total{class="read"}`:      0,
+	}
+	for series, want := range expected {
+		if got, ok := values[series]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", series, want, got, ok)
+		}
+	}
+}
+
+func TestAddressRateLimit(t *testing.T) {
+	authenticator, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users:   []utils.AuthUser{{Name: "reader", TokenHash: auth.HashSecret("reader-token"), Rules: []utils.AuthRule{{Keys: "*", Access: "read"}}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	router := setupTestRouter(t)
+	router.Use(api.AuthMiddleware(authenticator))
+	router.SetRateLimit(utils.RateLimitConfig{Enabled: true, IPRate: 0.01, IPBurst: 2})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Invalid credentials use up the budget of the address before they are checked
+	for _, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if status := authRequest(t, http.MethodGet, server.URL+"/get?key=k", "wrong-token", ""); status != want {
+			t.Errorf("Expected status code %d, got %d", want, status)
+		}
+	}
+	if status := authRequest(t, http.MethodGet, server.URL+"/get?key=k", "reader-token", ""); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d for the same address, got %d", http.StatusTooManyRequests, status)
+	}
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/healthz", nil, http.StatusOK)
+	resp.Body.Close()
+}
+
+func TestAddressRateLimitObserved(t *testing.T) {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = previous }()
+
+	router := setupTestRouter(t)
+	reg := metrics.NewRegistry()
+	router.EnableMetrics(reg)
+	router.EnableAccessLog()
+	router.SetRateLimit(utils.RateLimitConfig{Enabled: true, IPRate: 0.01, IPBurst: 1})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	// The metrics of the router are scraped apart, since /metrics is rate limited too
+	metricsServer := httptest.NewServer(reg.Handler())
+	defer metricsServer.Close()
+
+	for _, want := range []int{http.StatusNotFound, http.StatusTooManyRequests} {
+		resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=k", nil, want)
+		resp.Body.Close()
+	}
+
+	// Requests rejected by the address limit are logged and counted like any other
+	var statuses []int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Log    string `json:"log"`
+			Status int    `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry.Log == "access" {
+			statuses = append(statuses, entry.Status)
+		}
+	}
+	if len(statuses) != 2 || statuses[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected the limited request in the access log, got statuses %v", statuses)
+	}
+	values := scrapeMetrics(t, metricsServer.URL)
+	if got := values[`gokv_http_requests_total{endpoint="/get",method="GET",status="429"}`]; got != 1 {
+		t.Errorf("Expected 1 limited request counted, got %v", got)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	router := setupTestRouter(t)
+	router.EnableMetrics(metrics.NewRegistry())
+	router.SetRateLimit(utils.RateLimitConfig{Enabled: true, MaxConcurrent: 1, RetryAfter: 3})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// An upload holds the only slot until its body is closed
+	body, writer := io.Pipe()
+	done := make(chan int)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1/keys/slow", body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	if _, err := writer.Write([]byte("started")); err != nil {
+		t.Fatalf("Failed to start the upload: %v", err)
+	}
+
+	// The upload may not have reached the handler yet
+	var resp *http.Response
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		resp, err = http.Get(server.URL + "/count")
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusServiceUnavailable || time.Now().After(deadline) {
+			break
+		}
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code %d while the upload runs, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", resp.Header.Get("Retry-After"))
+	}
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/readyz", nil, http.StatusOK)
+	resp.Body.Close()
+
+	writer.Close()
+	if status := <-done; status != http.StatusNoContent {
+		t.Fatalf("Expected the upload to succeed, got %d", status)
+	}
+
+	// The slot is free again
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys/slow", nil, http.StatusOK)
+	defer resp.Body.Close()
+	if value, _ := io.ReadAll(resp.Body); string(value) != "started" {
+		t.Errorf("Expected the uploaded value, got %q", value)
+	}
+	if got := scrapeMetrics(t, server.URL)[`gokv_rejected_requests_total{reason="overloaded"}`]; got != 1 {
+		t.Errorf("Expected 1 overloaded rejection, got %v", got)
+	}
+}
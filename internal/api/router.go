@@ -2,55 +2,206 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bendigiorgio/go-kv/internal/audit"
 	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/utils"
 	"github.com/bendigiorgio/go-kv/internal/web/routes"
+	"github.com/bendigiorgio/go-kv/pkg/kv"
 	"github.com/rs/zerolog/log"
 
 	internal "github.com/bendigiorgio/go-kv/internal/web"
 )
 
+// NamespaceHeader selects the namespace of a request when the ns query parameter is not set
+const NamespaceHeader = "X-KV-Namespace"
+
 // Router is a simple HTTP router with graceful shutdown and an Engine reference
 type Router struct {
-	mux    *http.ServeMux
-	server *http.Server
-	store  *engine.Engine
+	mux         *http.ServeMux
+	handler     http.Handler // mux wrapped by middlewares, the address limiter and observers
+	base        http.Handler // mux wrapped by the limits, which run after the middlewares
+	middlewares []Middleware // Added with Use
+	observers   []Middleware // Added with observe
+	serverMu    sync.Mutex
+	server      *http.Server
+	stopped     bool
+	tlsConfig   *tls.Config
+	config      atomic.Pointer[utils.ConfigStructure]
+	store       *engine.Engine
+	namespaces  *engine.Namespaces
+	compaction  *engine.CompactionScheduler
+	limits      atomic.Pointer[requestLimits]
+	quotas      *quotaReservations
+	rejections  rejections
+	rateLimit   atomic.Pointer[rateLimitSettings]
+	rates       *rateLimiter
+	inFlight    atomic.Int64
+	audit       *audit.Trail
 }
 
-// NewRouter initializes a new Router with a key-value store
+// NewRouter initializes a new Router with a key-value store.
+// The store serves the default namespace, additional namespaces are loaded alongside it.
 func NewRouter(store *engine.Engine, useWebUI bool) *Router {
 	r := &Router{
-		mux:   http.NewServeMux(),
-		store: store,
+		mux:        http.NewServeMux(),
+		store:      store,
+		namespaces: engine.NewNamespaces(store),
+		quotas:     newQuotaReservations(),
+		rates:      newRateLimiter(),
 	}
+	// Nothing is limited until SetLimits and SetRateLimit are called
+	r.limits.Store(&requestLimits{})
+	r.rateLimit.Store(&rateLimitSettings{})
+	r.base = r.identify(r.limitRate(r.limitRequests(r.mux)))
+	r.build()
 	r.registerRoutes(useWebUI)
 	return r
 }
 
-// ServeHTTP makes Router satisfy the http.Handler interface
+// Middleware wraps an http.Handler with additional behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Use wraps the router with middlewares. The last middleware added runs first. Middlewares run
+// after the IP address rate limit and inside the access log, metrics, tracing and audit.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.build()
+}
+
+// observe wraps the router with a middleware that sees every request, including those rejected
+// by the IP address rate limit. The last observer added runs first.
+func (r *Router) observe(observer Middleware) {
+	r.observers = append(r.observers, observer)
+	r.build()
+}
+
+// build chains the observers, the address limiter, the middlewares and the limits
+func (r *Router) build() {
+	handler := r.base
+	for _, middleware := range r.middlewares {
+		handler = middleware(handler)
+	}
+	handler = r.limitAddress(handler)
+	for _, observer := range r.observers {
+		handler = observer(handler)
+	}
+	r.handler = handler
+}
+
+// SetTLSConfig makes the server accept TLS connections only. It must be called before Start.
+func (r *Router) SetTLSConfig(cfg *tls.Config) {
+	r.tlsConfig = cfg
+}
+
+// SetConfig sets the effective configuration shown by /admin/config
+func (r *Router) SetConfig(cfg *utils.ConfigStructure) {
+	r.config.Store(cfg)
+}
+
+// SetCompactionScheduler exposes the scheduler on /admin/compaction
+func (r *Router) SetCompactionScheduler(s *engine.CompactionScheduler) {
+	r.compaction = s
+}
+
+// CompactionScheduler returns the scheduler set with SetCompactionScheduler, or nil
+func (r *Router) CompactionScheduler() *engine.CompactionScheduler {
+	return r.compaction
+}
+
+// Namespaces returns the namespaces served by the router
+func (r *Router) Namespaces() *engine.Namespaces {
+	return r.namespaces
+}
+
+// resolveStore returns the engine for the namespace selected by the ns query parameter or
+// the NamespaceHeader, defaulting to the default namespace. It writes a 404 when the namespace does not exist.
+// Handlers use the engine through pkg/kv, the API of embedded engines.
+func (r *Router) resolveStore(w http.ResponseWriter, req *http.Request) (*kv.Engine, bool) {
+	store, err := r.namespaces.Get(namespaceName(req))
+	if err != nil {
+		errorResponse(w, req, err)
+		return nil, false
+	}
+	return kv.FromInternal(store), true
+}
+
+// ServeHTTP makes Router satisfy the http.Handler interface. Request bodies are capped and
+// rejections counted before any middleware runs, since authentication reads bodies.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.mux.ServeHTTP(w, req)
+	req = req.WithContext(context.WithValue(req.Context(), rejectionsKey{}, &r.rejections))
+	r.limits.Load().capBody(w, req)
+	r.handler.ServeHTTP(w, req)
 }
 
 // registerRoutes sets up API endpoints
 func (r *Router) registerRoutes(useWebUI bool) {
 	// API Routes
 	apiRoutes := map[string]http.HandlerFunc{
-		"/set":               r.handleSet,
-		"/get":               r.handleGet,
-		"/delete":            r.handleDelete,
-		"/list":              r.handleList,
-		"/flush":             r.handleFlush,
-		"/compact":           r.handleCompact,
-		"/memory-usage":      r.handleGetMemoryUsage,
-		"/count":             r.handleGetKeyCount,
-		"/batch/set":         r.handleBatchSet,
-		"/batch/delete":      r.handleBatchDelete,
-		"/web/api/list":      r.wrapWebApiRouteHandler(r.handleRefreshList),
-		"/web/api/dashboard": r.wrapWebApiRouteHandler(r.handleDashboardStats),
+		// Versioned routes, with Go 1.22 method patterns
+		"GET /v1/keys":             r.handleV1ListKeys,
+		"/v1/keys":                 methodsAllowed(http.MethodGet, http.MethodHead),
+		"GET /v1/keys/{key...}":    r.handleV1GetKey,
+		"HEAD /v1/keys/{key...}":   r.handleV1GetKey,
+		"PUT /v1/keys/{key...}":    r.handleV1PutKey,
+		"DELETE /v1/keys/{key...}": r.handleV1DeleteKey,
+		"/v1/keys/{key...}":        methodsAllowed(v1KeysMethods...),
+
+		// Legacy routes, replaced by /v1/keys
+		"/set":    deprecated("/v1/keys/{key}", r.handleSet),
+		"/get":    deprecated("/v1/keys/{key}", r.handleGet),
+		"/delete": deprecated("/v1/keys/{key}", r.handleDelete),
+		"/list":   deprecated("/v1/keys", r.handleList),
+
+		"/flush":        r.handleFlush,
+		"/compact":      r.handleCompact,
+		"/memory-usage": r.handleGetMemoryUsage,
+		"/count":        r.handleGetKeyCount,
+		"/batch/set":    r.handleBatchSet,
+		"/batch/delete": r.handleBatchDelete,
+		"/incr":         r.handleIncr,
+		"/batch/incr":   r.handleBatchIncr,
+
+		"/healthz": r.handleHealthz,
+		"/readyz":  r.handleReadyz,
+
+		"/admin/namespaces": r.handleNamespaces,
+		"/admin/config":     r.handleConfig,
+		"/admin/stats":      r.handleStats,
+		"/admin/compaction": r.handleCompaction,
+		"/admin/quotas":     r.handleQuotas,
+		"/admin/audit":      r.handleAudit,
+		"/admin/export":     r.handleExport,
+
+		// Typed value routes
+		"/types/hash/set":          r.handleHashSet,
+		"/types/hash/get":          r.handleHashGet,
+		"/types/hash/delete":       r.handleHashDelete,
+		"/types/hash/getall":       r.handleHashGetAll,
+		"/types/list/lpush":        r.handleListPush(true),
+		"/types/list/rpush":        r.handleListPush(false),
+		"/types/list/lpop":         r.handleListPop(true),
+		"/types/list/rpop":         r.handleListPop(false),
+		"/types/list/range":        r.handleListRange,
+		"/types/set/add":           r.handleSetAdd,
+		"/types/set/remove":        r.handleSetRemove,
+		"/types/set/members":       r.handleSetMembers,
+		"/types/set/ismember":      r.handleSetIsMember,
+		"/types/zset/add":          r.handleZSetAdd,
+		"/types/zset/range":        r.handleZSetRange,
+		"/types/zset/rangebyscore": r.handleZSetRangeByScore,
+
+		"/web/api/list":       r.wrapWebApiRouteHandler(r.handleRefreshList),
+		"/web/api/dashboard":  r.wrapWebApiRouteHandler(r.handleDashboardStats),
+		"/web/api/namespaces": r.wrapWebApiRouteHandler(r.handleNamespaceStats),
+		"/web/api/logs":       r.wrapWebApiRouteHandler(r.handleLogs),
 	}
 
 	for path, handler := range apiRoutes {
@@ -74,13 +225,37 @@ func (r *Router) registerRoutes(useWebUI bool) {
 
 // Start runs the HTTP server on the specified port
 func (r *Router) Start(port string) error {
-	r.server = &http.Server{
-		Addr:    ":" + port,
-		Handler: r.mux,
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
 	}
 
-	log.Info().Msgf("Server starting on port %s\n", port)
-	err := r.server.ListenAndServe()
+	log.Info().Bool("tls", r.tlsConfig != nil).Msgf("Server starting on port %s", port)
+	return r.Serve(listener)
+}
+
+// Serve accepts connections on the listener until the server is stopped.
+// Connections use TLS when a TLS configuration was set.
+func (r *Router) Serve(listener net.Listener) error {
+	server := &http.Server{
+		Handler:   r,
+		TLSConfig: r.tlsConfig,
+	}
+	r.serverMu.Lock()
+	if r.stopped {
+		// Stop was called before the server started
+		r.serverMu.Unlock()
+		return listener.Close()
+	}
+	r.server = server
+	r.serverMu.Unlock()
+
+	var err error
+	if r.tlsConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
 	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
@@ -89,7 +264,11 @@ func (r *Router) Start(port string) error {
 
 // Stop gracefully shuts down the server
 func (r *Router) Stop() error {
-	if r.server == nil {
+	r.serverMu.Lock()
+	server := r.server
+	r.stopped = true
+	r.serverMu.Unlock()
+	if server == nil {
 		return nil
 	}
 
@@ -97,7 +276,19 @@ func (r *Router) Stop() error {
 	defer cancel()
 
 	log.Info().Msg("Shutting down server...")
-	return r.server.Shutdown(ctx)
+	return server.Shutdown(ctx)
+}
+
+// namespaceName returns the namespace selected by the request
+func namespaceName(req *http.Request) string {
+	name := req.URL.Query().Get("ns")
+	if name == "" {
+		name = req.Header.Get(NamespaceHeader)
+	}
+	if name == "" {
+		name = engine.DefaultNamespace
+	}
+	return name
 }
 
 // Respond with JSON helper
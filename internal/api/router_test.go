@@ -6,15 +6,27 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/internal/auth"
 	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/utils"
 )
 
-// Helper function to create a test router
-func setupTestRouter() *api.Router {
-	store, _ := engine.NewEngine("test_data.db", "test_flushed.db", 1024)
+// Helper function to create a test router backed by a fresh store
+func setupTestRouter(t *testing.T) *api.Router {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := engine.NewEngine(filepath.Join(dir, "test_data.db"), filepath.Join(dir, "test_flushed.db"), 1024)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(store.Shutdown)
 	return api.NewRouter(store, false)
 }
 
@@ -33,7 +45,6 @@ func assertHTTPResponse(t *testing.T, method, url string, body io.Reader, expect
 	if err != nil {
 		t.Fatalf("Failed to send request: %v", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != expectedStatusCode {
 		t.Errorf("Expected status code %d, got %d", expectedStatusCode, resp.StatusCode)
@@ -55,7 +66,7 @@ func parseJSONResponse(t *testing.T, resp *http.Response, target interface{}) {
 }
 
 func TestSetKey(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -65,7 +76,7 @@ func TestSetKey(t *testing.T) {
 }
 
 func TestGetKey(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -86,7 +97,7 @@ func TestGetKey(t *testing.T) {
 }
 
 func TestGetNonExistentKey(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -95,8 +106,54 @@ func TestGetNonExistentKey(t *testing.T) {
 	defer resp.Body.Close()
 }
 
+func TestProblemResponses(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/types/hash/set", bytes.NewBufferString(`{"key":"hash","fields":{"f":"v"}}`), http.StatusOK)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing key", http.MethodGet, "/get?key=missing", "", http.StatusNotFound, "key_not_found"},
+		{"wrong method", http.MethodPut, "/get?key=missing", "", http.StatusMethodNotAllowed, "invalid_method"},
+		{"invalid JSON", http.MethodPost, "/set", "{", http.StatusBadRequest, "invalid_json"},
+		{"wrong type", http.MethodGet, "/get?key=hash", "", http.StatusConflict, "wrong_type"},
+		{"memory limit", http.MethodPost, "/set", `{"key":"big","value":"` + strings.Repeat("x", 2048) + `"}`, http.StatusRequestEntityTooLarge, "memory_limit"},
+		{"missing namespace", http.MethodGet, "/get?key=k&ns=missing", "", http.StatusNotFound, "namespace_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			resp := assertHTTPResponse(t, tt.method, server.URL+tt.path, body, tt.status)
+			defer resp.Body.Close()
+
+			if contentType := resp.Header.Get("Content-Type"); contentType != api_errors.ProblemContentType {
+				t.Errorf("Expected content type %s, got %s", api_errors.ProblemContentType, contentType)
+			}
+			var problem api_errors.Problem
+			parseJSONResponse(t, resp, &problem)
+			if string(problem.Code) != tt.code || problem.Status != tt.status || problem.Type != "urn:go-kv:error:"+tt.code {
+				t.Errorf("Expected code %s and status %d, got %+v", tt.code, tt.status, problem)
+			}
+			if problem.Title == "" || problem.Instance == "" {
+				t.Errorf("Expected a title and instance, got %+v", problem)
+			}
+		})
+	}
+}
+
 func TestDeleteKey(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -114,7 +171,7 @@ func TestDeleteKey(t *testing.T) {
 }
 
 func TestListKeys(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -135,7 +192,7 @@ func TestListKeys(t *testing.T) {
 }
 
 func TestFlushDatabase(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -159,7 +216,7 @@ func TestFlushDatabase(t *testing.T) {
 }
 
 func TestCompactDatabase(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -181,3 +238,403 @@ func TestCompactDatabase(t *testing.T) {
 		t.Errorf("Expected 'compactValue', got '%s'", result["value"])
 	}
 }
+
+func TestTypedValues(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Push to a list and read it back
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/types/list/rpush", bytes.NewBuffer([]byte(`{"key":"queue", "values":["a","b"]}`)), http.StatusOK)
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/types/list/range?key=queue", nil, http.StatusOK)
+	defer resp.Body.Close()
+
+	var result struct {
+		Values []string `json:"values"`
+	}
+	parseJSONResponse(t, resp, &result)
+
+	if len(result.Values) != 2 || result.Values[0] != "a" {
+		t.Errorf("Expected [a b], got %v", result.Values)
+	}
+
+	// Hash operations against a list should conflict
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/types/hash/get?key=queue&field=f", nil, http.StatusConflict)
+	defer resp.Body.Close()
+
+	// So should reading it as a string, while missing keys and fields are not found
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=queue", nil, http.StatusConflict)
+	defer resp.Body.Close()
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/types/hash/set", bytes.NewBuffer([]byte(`{"key":"user", "fields":{"name":"Ada"}}`)), http.StatusOK)
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/types/hash/get?key=user&field=email", nil, http.StatusNotFound)
+	defer resp.Body.Close()
+}
+
+func TestV1Keys(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	url := server.URL + "/v1/keys/app/greeting"
+	resp := assertHTTPResponse(t, http.MethodPut, url, strings.NewReader(`raw "value"`), http.StatusNoContent)
+	resp.Body.Close()
+
+	resp = assertHTTPResponse(t, http.MethodGet, url, nil, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `raw "value"` {
+		t.Errorf("Expected the raw value, got %q", body)
+	}
+
+	resp = assertHTTPResponse(t, http.MethodHead, url, nil, http.StatusOK)
+	resp.Body.Close()
+	if resp.ContentLength != int64(len(`raw "value"`)) {
+		t.Errorf("Expected the length of the value from HEAD, got %d", resp.ContentLength)
+	}
+
+	// Legacy endpoints share the data and are marked as deprecated
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=app/greeting", nil, http.StatusOK)
+	resp.Body.Close()
+	if resp.Header.Get("Deprecation") != "true" || !strings.Contains(resp.Header.Get("Link"), "successor-version") {
+		t.Errorf("Expected deprecation headers on /get, got %v", resp.Header)
+	}
+
+	resp = assertHTTPResponse(t, http.MethodPost, url, nil, http.StatusMethodNotAllowed)
+	resp.Body.Close()
+	if resp.Header.Get("Allow") != "GET, HEAD, PUT, DELETE" {
+		t.Errorf("Expected the allowed methods, got %q", resp.Header.Get("Allow"))
+	}
+
+	resp = assertHTTPResponse(t, http.MethodDelete, url, nil, http.StatusNoContent)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodGet, url, nil, http.StatusNotFound)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodPut, server.URL+"/v1/keys/", strings.NewReader("v"), http.StatusBadRequest)
+	resp.Body.Close()
+}
+
+func TestBinaryValues(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	value := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0xff}
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1/keys/logo", bytes.NewReader(value))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set(api.TagHeaderPrefix+"Owner", "design")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the value to be stored, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys/logo", nil, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, value) || resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get(api.TagHeaderPrefix+"owner") != "design" {
+		t.Errorf("Expected the bytes, content type and tags back, got %q with %v", body, resp.Header)
+	}
+
+	// The JSON API returns values that are not valid UTF-8 base64 encoded
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=logo", nil, http.StatusOK)
+	var result struct {
+		Value       *string           `json:"value"`
+		ValueB64    []byte            `json:"value_b64"`
+		ContentType string            `json:"content_type"`
+		Tags        map[string]string `json:"tags"`
+	}
+	parseJSONResponse(t, resp, &result)
+	resp.Body.Close()
+	if result.Value != nil || !bytes.Equal(result.ValueB64, value) || result.ContentType != "image/png" || result.Tags["owner"] != "design" {
+		t.Errorf("Expected the value in value_b64 with its metadata, got %+v", result)
+	}
+
+	data := `{"key":"blob","value_b64":"AAEC/w==","content_type":"application/octet-stream"}`
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(data), http.StatusOK)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys/blob", nil, http.StatusOK)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, []byte{0, 1, 2, 0xff}) {
+		t.Errorf("Expected the decoded value_b64, got %q", body)
+	}
+
+	// So does /list, where other values stay strings
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(`{"key":"text","value":"plain"}`), http.StatusOK)
+	resp.Body.Close()
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/list", nil, http.StatusOK)
+	var list map[string]json.RawMessage
+	parseJSONResponse(t, resp, &list)
+	resp.Body.Close()
+	if string(list["text"]) != `"plain"` {
+		t.Errorf("Expected text to be a string, got %s", list["text"])
+	}
+	if string(list["logo"]) != `{"key":"logo","value_b64":"iVBORw0KGgoA/w==","content_type":"image/png","tags":{"owner":"design"}}` {
+		t.Errorf("Expected logo in value_b64 with its metadata, got %s", list["logo"])
+	}
+
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(`{"key":"k","value":"a","value_b64":"YQ=="}`), http.StatusBadRequest)
+	resp.Body.Close()
+}
+
+func TestV1LargeValueRanges(t *testing.T) {
+	router := setupTestRouter(t)
+	router.Namespaces().SetBlobThreshold(16) // Store the value in chunk files
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	value := []byte(strings.Repeat("0123456789", 10))
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1/keys/video", bytes.NewReader(value))
+	req.Header.Set("Content-Type", "video/mp4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the value to be stored, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/v1/keys/video", nil)
+	req.Header.Set("Range", "bytes=15-24")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Range request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "5678901234" {
+		t.Errorf("Expected 206 with the range, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Range") != "bytes 15-24/100" || resp.Header.Get("Content-Type") != "video/mp4" {
+		t.Errorf("Expected the range and content type headers, got %v", resp.Header)
+	}
+
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys/video", nil, http.StatusOK)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, value) || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected the whole value with Accept-Ranges, got %q with %v", body, resp.Header)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/v1/keys/video", nil)
+	req.Header.Set("Range", "bytes=200-")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected 416 for a range past the end, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestV1ListKeys(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, key := range []string{"app/c", "app/a", "other", "app/b"} {
+		resp := assertHTTPResponse(t, http.MethodPut, server.URL+"/v1/keys/"+key, strings.NewReader("v"), http.StatusNoContent)
+		resp.Body.Close()
+	}
+
+	var keys []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys?prefix=app/&limit=2&cursor="+cursor, nil, http.StatusOK)
+		var page struct {
+			Keys       []string `json:"keys"`
+			NextCursor string   `json:"next_cursor"`
+		}
+		parseJSONResponse(t, resp, &page)
+		resp.Body.Close()
+
+		keys = append(keys, page.Keys...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if strings.Join(keys, ",") != "app/a,app/b,app/c" {
+		t.Errorf("Expected the keys of the prefix in order, got %v", keys)
+	}
+
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/v1/keys?limit=0", nil, http.StatusBadRequest)
+	resp.Body.Close()
+}
+
+func TestIncrKey(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/incr", bytes.NewBuffer([]byte(`{"key":"hits", "delta":2}`)), http.StatusOK)
+	resp := assertHTTPResponse(t, http.MethodPost, server.URL+"/incr", bytes.NewBuffer([]byte(`{"key":"hits"}`)), http.StatusOK)
+	defer resp.Body.Close()
+
+	var result map[string]string
+	parseJSONResponse(t, resp, &result)
+
+	if result["value"] != "3" {
+		t.Errorf("Expected '3', got '%s'", result["value"])
+	}
+
+	// Incrementing a non-numeric value is rejected
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBuffer([]byte(`{"key":"name", "value":"Alice"}`)), http.StatusOK)
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/batch/incr", bytes.NewBuffer([]byte(`[{"key":"hits"}, {"key":"name"}]`)), http.StatusBadRequest)
+	defer resp.Body.Close()
+}
+
+func TestNamespaces(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Create a namespace and write the same key into it and the default namespace
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/namespaces", bytes.NewBuffer([]byte(`{"name":"team-a"}`)), http.StatusCreated)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/namespaces", bytes.NewBuffer([]byte(`{"name":"team-b","memory_limit":-1}`)), http.StatusBadRequest)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBuffer([]byte(`{"key":"k", "value":"default"}`)), http.StatusOK)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set?ns=team-a", bytes.NewBuffer([]byte(`{"key":"k", "value":"team"}`)), http.StatusOK)
+
+	// The namespace can also be selected with a header
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/get?key=k", nil)
+	req.Header.Set(api.NamespaceHeader, "team-a")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]string
+	parseJSONResponse(t, resp, &result)
+	if result["value"] != "team" {
+		t.Errorf("Expected 'team', got '%s'", result["value"])
+	}
+
+	// Unknown namespaces are rejected
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=k&ns=missing", nil, http.StatusNotFound)
+	defer resp.Body.Close()
+
+	assertHTTPResponse(t, http.MethodDelete, server.URL+"/admin/namespaces?name=team-a", nil, http.StatusOK)
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/get?key=k&ns=team-a", nil, http.StatusNotFound)
+	defer resp.Body.Close()
+}
+
+func TestAdminConfig(t *testing.T) {
+	router := setupTestRouter(t)
+	cfg := utils.DefaultConfig()
+	cfg.Auth.Users = []utils.AuthUser{{Name: "ci", TokenHash: auth.HashSecret("secret-token")}}
+	router.SetConfig(&cfg)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/config", nil, http.StatusOK)
+	defer resp.Body.Close()
+
+	var result struct {
+		Config utils.ConfigStructure `json:"config"`
+	}
+	parseJSONResponse(t, resp, &result)
+	if result.Config.AppPort != cfg.AppPort || len(result.Config.Auth.Users) != 1 {
+		t.Errorf("Unexpected config in response: %+v", result.Config)
+	}
+	if result.Config.Auth.Users[0].TokenHash == cfg.Auth.Users[0].TokenHash {
+		t.Error("Expected the token hash to be redacted")
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"a","value":"1"}`), http.StatusOK)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"bb","value":"22222"}`), http.StatusOK)
+
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/stats?top=1", nil, http.StatusOK)
+	defer resp.Body.Close()
+
+	var result struct {
+		Namespace string          `json:"namespace"`
+		Engine    engine.Snapshot `json:"engine"`
+		Runtime   struct {
+			HeapAlloc  uint64 `json:"heap_alloc"`
+			Goroutines int    `json:"goroutines"`
+		} `json:"runtime"`
+	}
+	parseJSONResponse(t, resp, &result)
+
+	if result.Namespace != engine.DefaultNamespace || result.Engine.KeyCount != 2 {
+		t.Errorf("Unexpected snapshot of %q with %d keys", result.Namespace, result.Engine.KeyCount)
+	}
+	if len(result.Engine.LargestKeys) != 1 || result.Engine.LargestKeys[0].Key != "bb" {
+		t.Errorf("Expected bb to be the largest key, got %+v", result.Engine.LargestKeys)
+	}
+	if len(result.Engine.Files) == 0 || len(result.Engine.KeySizes) == 0 {
+		t.Errorf("Expected file stats and histograms, got %+v", result.Engine)
+	}
+	if result.Runtime.HeapAlloc == 0 || result.Runtime.Goroutines == 0 {
+		t.Errorf("Expected runtime memory stats, got %+v", result.Runtime)
+	}
+
+	assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/stats?top=-1", nil, http.StatusBadRequest)
+	assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/stats?ns=missing", nil, http.StatusNotFound)
+}
+
+func TestAdminExport(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"b","value_b64":"AP8=","content_type":"application/octet-stream"}`), http.StatusOK)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"c","value":"text","tags":{"env":"test"}}`), http.StatusOK)
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/types/list/rpush", bytes.NewBufferString(`{"key":"a","values":["x","y"]}`), http.StatusOK)
+
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/export", nil, http.StatusOK)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected JSON lines, got %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	expected := `{"key":"a","type":"list","values":["x","y"]}
+{"key":"b","type":"string","value_b64":"AP8=","content_type":"application/octet-stream"}
+{"key":"c","type":"string","value":"text","tags":{"env":"test"}}
+`
+	if string(body) != expected {
+		t.Errorf("Expected every key in order, got %s", body)
+	}
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/export", nil, http.StatusMethodNotAllowed)
+	assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/export?ns=missing", nil, http.StatusNotFound)
+}
+
+func TestAdminCompaction(t *testing.T) {
+	router := setupTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/compaction", nil, http.StatusNotFound)
+
+	scheduler := engine.NewCompactionScheduler(router.Namespaces(), engine.CompactionPolicy{MaxFlushFileBytes: 1 << 20, CheckInterval: time.Hour})
+	router.SetCompactionScheduler(scheduler)
+
+	var status engine.SchedulerStatus
+	resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/admin/compaction", nil, http.StatusOK)
+	parseJSONResponse(t, resp, &status)
+	resp.Body.Close()
+	if status.Paused || status.Policy.MaxFlushFileBytes != 1<<20 || status.Policy.CheckInterval != "1h0m0s" {
+		t.Errorf("Unexpected scheduler status %+v", status)
+	}
+
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/compaction", bytes.NewBufferString(`{"action":"pause"}`), http.StatusOK)
+	parseJSONResponse(t, resp, &status)
+	resp.Body.Close()
+	if !status.Paused {
+		t.Error("Expected the scheduler to be paused")
+	}
+
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/compaction", bytes.NewBufferString(`{"action":"resume"}`), http.StatusOK)
+	parseJSONResponse(t, resp, &status)
+	resp.Body.Close()
+	if status.Paused {
+		t.Error("Expected the scheduler to be resumed")
+	}
+
+	assertHTTPResponse(t, http.MethodPost, server.URL+"/admin/compaction", bytes.NewBufferString(`{"action":"stop"}`), http.StatusBadRequest)
+	assertHTTPResponse(t, http.MethodDelete, server.URL+"/admin/compaction", nil, http.StatusMethodNotAllowed)
+}
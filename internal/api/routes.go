@@ -2,33 +2,93 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"unicode/utf8"
+
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
+	"github.com/bendigiorgio/go-kv/pkg/kv"
 )
 
+// valueRequest is a string value in a JSON body. Binary values are sent base64 encoded in
+// value_b64 instead of value.
+type valueRequest struct {
+	Key         string            `json:"key"`
+	Value       string            `json:"value"`
+	ValueB64    []byte            `json:"value_b64"`
+	ContentType string            `json:"content_type"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// errBothValues is returned for requests setting both value and value_b64
+var errBothValues = api_errors.New(api_errors.CodeInvalidParameter, "Only one of value and value_b64 can be set")
+
+// value returns the bytes of the value
+func (v valueRequest) value() ([]byte, error) {
+	if v.Value != "" && len(v.ValueB64) > 0 {
+		return nil, errBothValues
+	}
+	if len(v.ValueB64) > 0 {
+		return v.ValueB64, nil
+	}
+	return []byte(v.Value), nil
+}
+
+func (v valueRequest) metadata() kv.Metadata {
+	return kv.Metadata{ContentType: v.ContentType, Tags: v.Tags}
+}
+
+// valueResponse is a string value in a JSON response. Values that are not valid UTF-8 are
+// returned base64 encoded in value_b64, since JSON strings cannot hold them.
+type valueResponse struct {
+	Key         string            `json:"key"`
+	Value       *string           `json:"value,omitempty"`
+	ValueB64    []byte            `json:"value_b64,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func newValueResponse(key string, value []byte, meta kv.Metadata) valueResponse {
+	response := valueResponse{Key: key, ContentType: meta.ContentType, Tags: meta.Tags}
+	if utf8.Valid(value) {
+		text := string(value)
+		response.Value = &text
+	} else {
+		response.ValueB64 = value
+	}
+	return response
+}
+
 // handleSet handles setting a key
 func (r *Router) handleSet(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
-	var requestData struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+	var requestData valueRequest
+	if err := decodeJSON(req, &requestData); err != nil {
+		invalidJSON(w, req)
+		return
 	}
 
-	if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	value, err := requestData.value()
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	if requestData.Key == "" || len(value) == 0 {
+		invalidParameter(w, req, "Missing key or value")
 		return
 	}
 
-	if requestData.Key == "" || requestData.Value == "" {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Missing key or value"})
+	store, ok := r.resolveStore(w, req)
+	if !ok {
 		return
 	}
 
-	if err := r.store.Set(requestData.Key, requestData.Value); err != nil {
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to set value"})
+	if err := store.SetValue(req.Context(), requestData.Key, value, requestData.metadata()); err != nil {
+		errorResponse(w, req, err)
 		return
 	}
 
@@ -38,77 +98,126 @@ func (r *Router) handleSet(w http.ResponseWriter, req *http.Request) {
 // handleGet retrieves a key's value
 func (r *Router) handleGet(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
 	key := req.URL.Query().Get("key")
 	if key == "" {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Missing key parameter"})
+		invalidParameter(w, req, "Missing key parameter")
 		return
 	}
 
-	value, err := r.store.Get(key)
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	value, meta, err := store.GetValue(req.Context(), key)
 	if err != nil {
-		jsonResponse(w, http.StatusNotFound, map[string]string{"error": "Key not found"})
+		errorResponse(w, req, err)
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, map[string]string{"key": key, "value": value})
+	jsonResponse(w, http.StatusOK, newValueResponse(key, value, meta))
 }
 
 // handleDelete removes a key
 func (r *Router) handleDelete(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodDelete {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
 	key := req.URL.Query().Get("key")
 	if key == "" {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Missing key parameter"})
+		invalidParameter(w, req, "Missing key parameter")
 		return
 	}
 
-	if err := r.store.Delete(key); err != nil {
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete key"})
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	if err := store.Delete(req.Context(), key); err != nil {
+		errorResponse(w, req, err)
 		return
 	}
 
 	jsonResponse(w, http.StatusOK, map[string]string{"message": "Key deleted successfully"})
 }
 
-// handleList returns all key-value pairs
+// handleList returns all key-value pairs. Values that are not valid UTF-8 are returned as /get
+// returns them, with their metadata, since JSON strings cannot hold them.
 func (r *Router) handleList(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
-	data := r.store.List()
-	jsonResponse(w, http.StatusOK, data)
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	data, err := store.List(req.Context())
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	result := make(map[string]any, len(data))
+	for key, value := range data {
+		if utf8.ValidString(value) {
+			result[key] = value
+			continue
+		}
+		raw, meta, err := store.GetValue(req.Context(), key)
+		if errors.Is(err, kv.ErrNotFound) {
+			continue // Deleted since it was listed
+		}
+		if err != nil {
+			errorResponse(w, req, err)
+			return
+		}
+		result[key] = newValueResponse(key, raw, meta)
+	}
+	jsonResponse(w, http.StatusOK, result)
 }
 
 // handleFlush clears all data
 func (r *Router) handleFlush(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
-	r.store.Flush()
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	if err := store.Flush(req.Context()); err != nil {
+		errorResponse(w, req, err)
+		return
+	}
 	jsonResponse(w, http.StatusOK, map[string]string{"message": "Database flushed"})
 }
 
 // handleCompact triggers data compaction
 func (r *Router) handleCompact(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
-	if err := r.store.CompactFlushedData(); err != nil {
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "Compaction failed"})
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	if err := store.Compact(req.Context()); err != nil {
+		errorResponse(w, req, err)
 		return
 	}
 
@@ -118,46 +227,70 @@ func (r *Router) handleCompact(w http.ResponseWriter, req *http.Request) {
 // handleGetMemoryUsage returns the memory usage of the store
 func (r *Router) handleGetMemoryUsage(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
 		return
 	}
 
-	mem := r.store.MemoryUsage()
+	mem, err := store.MemoryUsage(req.Context())
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
 	jsonResponse(w, http.StatusOK, map[string]int{"memory": mem})
 }
 
 // handleGetKeyCount returns the number of keys in the store
 func (r *Router) handleGetKeyCount(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
 		return
 	}
 
-	count := r.store.KeyCount()
+	count, err := store.KeyCount(req.Context())
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
 	jsonResponse(w, http.StatusOK, map[string]int{"count": count})
 }
 
 // handleBatchSet handles setting multiple keys in a batch
 func (r *Router) handleBatchSet(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Only POST allowed"})
+		methodNotAllowed(w, req)
 		return
 	}
 
-	var requestData []struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+	var requestData []valueRequest
+	if err := decodeJSON(req, &requestData); err != nil {
+		invalidJSON(w, req)
+		return
 	}
 
-	if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+	store, ok := r.resolveStore(w, req)
+	if !ok {
 		return
 	}
 
 	count := 0
 	for _, item := range requestData {
-		if err := r.store.Set(item.Key, item.Value); err != nil {
-			jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to set value"})
+		value, err := item.value()
+		if err != nil {
+			errorResponse(w, req, err)
+			return
+		}
+		if err := store.SetValue(req.Context(), item.Key, value, item.metadata()); err != nil {
+			errorResponse(w, req, err)
 			return
 		}
 		count++
@@ -172,20 +305,25 @@ func (r *Router) handleBatchSet(w http.ResponseWriter, req *http.Request) {
 // handleBatchDelete handles deleting multiple keys in a batch
 func (r *Router) handleBatchDelete(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "Invalid Method"})
+		methodNotAllowed(w, req)
 		return
 	}
 
 	var requestData []string
-	if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+	if err := decodeJSON(req, &requestData); err != nil {
+		invalidJSON(w, req)
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
 		return
 	}
 
 	count := 0
 	for _, key := range requestData {
-		if err := r.store.Delete(key); err != nil {
-			jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete key"})
+		if err := store.Delete(req.Context(), key); err != nil {
+			errorResponse(w, req, err)
 			return
 		}
 		count++
@@ -196,3 +334,116 @@ func (r *Router) handleBatchDelete(w http.ResponseWriter, req *http.Request) {
 		"keys_deleted": count,
 	})
 }
+
+// incrRequest is the JSON body accepted by the increment endpoints.
+// An integer delta increments an integer counter, any other number a float counter.
+type incrRequest struct {
+	Key   string      `json:"key"`
+	Delta json.Number `json:"delta"`
+}
+
+// toIncrOp converts the request into an kv.IncrOp, defaulting the delta to 1.
+func (i incrRequest) toIncrOp() (kv.IncrOp, error) {
+	op := kv.IncrOp{Key: i.Key, Delta: 1}
+	if i.Delta == "" {
+		return op, nil
+	}
+	if delta, err := i.Delta.Int64(); err == nil {
+		op.Delta = delta
+		return op, nil
+	}
+	delta, err := i.Delta.Float64()
+	if err != nil {
+		return op, err
+	}
+	op.Float = true
+	op.FloatDelta = delta
+	return op, nil
+}
+
+// handleIncr atomically increments a counter
+func (r *Router) handleIncr(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	var requestData incrRequest
+	if err := decodeJSON(req, &requestData); err != nil {
+		invalidJSON(w, req)
+		return
+	}
+
+	if requestData.Key == "" {
+		invalidParameter(w, req, "Missing key")
+		return
+	}
+
+	op, err := requestData.toIncrOp()
+	if err != nil {
+		invalidParameter(w, req, "Invalid delta")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	results, err := store.IncrBatch(req.Context(), []kv.IncrOp{op})
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]string{"key": requestData.Key, "value": results[0]})
+}
+
+// handleBatchIncr atomically increments multiple counters, applying either all or none of them
+func (r *Router) handleBatchIncr(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		methodNotAllowed(w, req)
+		return
+	}
+
+	var requestData []incrRequest
+	if err := decodeJSON(req, &requestData); err != nil {
+		invalidJSON(w, req)
+		return
+	}
+
+	ops := make([]kv.IncrOp, 0, len(requestData))
+	for _, item := range requestData {
+		if item.Key == "" {
+			invalidParameter(w, req, "Missing key")
+			return
+		}
+		op, err := item.toIncrOp()
+		if err != nil {
+			invalidParameter(w, req, "Invalid delta for key "+item.Key)
+			return
+		}
+		ops = append(ops, op)
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	results, err := store.IncrBatch(req.Context(), ops)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	values := make([]map[string]string, 0, len(results))
+	for i, value := range results {
+		values = append(values, map[string]string{"key": ops[i].Key, "value": value})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message": "Keys incremented successfully",
+		"results": values,
+	})
+}
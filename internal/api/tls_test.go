@@ -0,0 +1,236 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/tlsutil"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+// testCA signs certificates generated for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-kv test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// startTLSRouter serves the router over TLS on a random local port and returns its base URL
+func startTLSRouter(t *testing.T, router *api.Router, tlsConfig *tls.Config) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	router.SetTLSConfig(tlsConfig)
+	go router.Serve(listener)
+	t.Cleanup(func() { router.Stop() })
+	return "https://" + listener.Addr().String()
+}
+
+func tlsClient(ca *testCA, clientCert []tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: clientCert},
+		DisableKeepAlives: true,
+	}}
+}
+
+func TestTLSClientCertificateIdentity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "localhost", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "reader-service", 3, x509.ExtKeyUsageClientAuth)
+	writeFile(t, filepath.Join(dir, "server.crt"), serverCert)
+	writeFile(t, filepath.Join(dir, "server.key"), serverKey)
+	writeFile(t, filepath.Join(dir, "ca.crt"), ca.pem)
+
+	_, tlsConfig, err := tlsutil.FromConfig(utils.TLSConfig{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   "require",
+	})
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %v", err)
+	}
+
+	authenticator, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users: []utils.AuthUser{
+			{Name: "reader", ClientCN: "reader-service", Rules: []utils.AuthRule{{Keys: "*", Access: "read"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	router := setupTestRouter(t)
+	router.Use(api.AuthMiddleware(authenticator))
+	baseURL := startTLSRouter(t, router, tlsConfig)
+
+	// The handshake fails without a client certificate
+	if _, err := tlsClient(ca, nil).Get(baseURL + "/count"); err == nil {
+		t.Error("Expected the request without a client certificate to fail")
+	}
+
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	client := tlsClient(ca, []tls.Certificate{pair})
+
+	resp, err := client.Get(baseURL + "/count")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d for a read by the mapped identity, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// HTTP/2 is negotiated with client certificates too
+	h2Client := tlsClient(ca, []tls.Certificate{pair})
+	h2Client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	resp, err = h2Client.Get(baseURL + "/count")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+
+	resp, err = client.Post(baseURL+"/set", "application/json", bytes.NewBufferString(`{"key":"a","value":"b"}`))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d for a write by a read-only identity, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestTLSCertificateHotReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, "localhost", 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certPath, cert)
+	writeFile(t, keyPath, key)
+
+	reloader, tlsConfig, err := tlsutil.FromConfig(utils.TLSConfig{Enabled: true, CertFile: certPath, KeyFile: keyPath})
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %v", err)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go reloader.Watch(10*time.Millisecond, stop)
+
+	baseURL := startTLSRouter(t, setupTestRouter(t), tlsConfig)
+	client := tlsClient(ca, nil)
+
+	servedSerial := func() int64 {
+		t.Helper()
+		resp, err := client.Get(baseURL + "/count")
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if serial := servedSerial(); serial != 10 {
+		t.Fatalf("Expected certificate serial 10, got %d", serial)
+	}
+
+	// Rotate the certificate on disk; new connections should pick it up without a restart
+	cert, key = ca.issue(t, "localhost", 11, x509.ExtKeyUsageServerAuth)
+	writeFile(t, keyPath, key)
+	writeFile(t, certPath, cert)
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(certPath, future, future)
+	_ = os.Chtimes(keyPath, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for servedSerial() != 11 {
+		if time.Now().After(deadline) {
+			t.Fatal("Rotated certificate was not served after reload")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bendigiorgio/go-kv/internal/tracing"
+)
+
+// EnableTracing records a server span for every request, continuing the trace of an
+// incoming traceparent header. Call it after EnableMetrics so the span covers the whole request.
+func (r *Router) EnableTracing() {
+	r.observe(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			route := r.routePattern(req)
+			ctx := tracing.Extract(req.Context(), req.Header)
+			ctx, span := tracing.Start(ctx, "HTTP "+req.Method+" "+route, tracing.WithKind(tracing.SpanKindServer))
+			defer span.End()
+
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, req.WithContext(ctx))
+
+			span.SetAttribute("http.method", req.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.status_code", rec.status)
+			span.SetAttribute("http.response_size", rec.bytes)
+			if rec.status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status)))
+			}
+		})
+	})
+}
+
+// decodeJSON decodes the request body into target, recording the time spent in a span
+func decodeJSON(req *http.Request, target any) error {
+	_, span := tracing.Start(req.Context(), "json.decode")
+	defer span.End()
+
+	err := json.NewDecoder(req.Body).Decode(target)
+	span.RecordError(err)
+	return err
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/tracing"
+)
+
+// spanRecorder keeps exported spans for inspection
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *spanRecorder) Shutdown(context.Context) error { return nil }
+
+func TestTracingPropagatesTraceparent(t *testing.T) {
+	exporter := &spanRecorder{}
+	provider := tracing.NewProvider(exporter, tracing.Options{SampleRatio: 1})
+	tracing.SetProvider(provider)
+	t.Cleanup(func() { tracing.SetProvider(nil) })
+
+	router := setupTestRouter(t)
+	router.EnableTracing()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	const traceID, remoteParent = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/set", bytes.NewBufferString(`{"key":"a","value":"b"}`))
+	req.Header.Set(tracing.TraceparentHeader, "00-"+traceID+"-"+remoteParent+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to flush spans: %v", err)
+	}
+
+	byName := make(map[string]tracing.SpanData)
+	for _, span := range exporter.spans {
+		if span.TraceID.String() != traceID {
+			t.Errorf("Expected span %s in trace %s, got %s", span.Name, traceID, span.TraceID)
+		}
+		byName[span.Name] = span
+	}
+
+	serverSpan, ok := byName["HTTP POST /set"]
+	if !ok {
+		t.Fatalf("Expected a server span, got %+v", exporter.spans)
+	}
+	if serverSpan.ParentSpanID.String() != remoteParent || serverSpan.Kind != tracing.SpanKindServer {
+		t.Errorf("Expected the server span to continue the caller's span, got %+v", serverSpan)
+	}
+	if serverSpan.Attributes["http.status_code"] != http.StatusOK || serverSpan.Attributes["http.route"] != "/set" {
+		t.Errorf("Unexpected server span attributes %v", serverSpan.Attributes)
+	}
+
+	set, ok := byName["engine.Set"]
+	if !ok || set.ParentSpanID != serverSpan.SpanID {
+		t.Fatalf("Expected an engine.Set span under the server span, got %+v", exporter.spans)
+	}
+	if decode, ok := byName["json.decode"]; !ok || decode.ParentSpanID != serverSpan.SpanID {
+		t.Error("Expected a json.decode span under the server span")
+	}
+	if wait, ok := byName["engine.lock.wait"]; !ok || wait.ParentSpanID != set.SpanID || wait.Attributes["mode"] != "write" {
+		t.Errorf("Expected a write lock wait span under engine.Set, got %+v", wait)
+	}
+}
+
+func TestTracingDisabledRecordsNothing(t *testing.T) {
+	tracing.SetProvider(nil)
+	router := setupTestRouter(t)
+	router.EnableTracing()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	assertHTTPResponse(t, http.MethodGet, server.URL+"/count", nil, http.StatusOK).Body.Close()
+}
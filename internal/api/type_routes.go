@@ -0,0 +1,430 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bendigiorgio/go-kv/pkg/kv"
+)
+
+// typeRequest is the JSON body accepted by the typed value write endpoints.
+// Only the fields relevant to the endpoint are read.
+type typeRequest struct {
+	Key           string            `json:"key"`
+	Fields        map[string]string `json:"fields"`
+	FieldNames    []string          `json:"field_names"`
+	Values        []string          `json:"values"`
+	Members       []string          `json:"members"`
+	ScoredMembers []kv.ZMember      `json:"scored_members"`
+}
+
+// decodeTypeRequest validates the method and decodes a typeRequest, writing an error response on failure.
+func decodeTypeRequest(w http.ResponseWriter, req *http.Request) (*typeRequest, bool) {
+	if req.Method != http.MethodPost {
+		methodNotAllowed(w, req)
+		return nil, false
+	}
+
+	var requestData typeRequest
+	if err := json.NewDecoder(req.Body).Decode(&requestData); err != nil {
+		invalidJSON(w, req)
+		return nil, false
+	}
+
+	if requestData.Key == "" {
+		invalidParameter(w, req, "Missing key")
+		return nil, false
+	}
+	return &requestData, true
+}
+
+// queryKey validates the method and reads the key query parameter, writing an error response on failure.
+func queryKey(w http.ResponseWriter, req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet {
+		methodNotAllowed(w, req)
+		return "", false
+	}
+
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		invalidParameter(w, req, "Missing key parameter")
+		return "", false
+	}
+	return key, true
+}
+
+// handleHashSet sets fields in a hash
+func (r *Router) handleHashSet(w http.ResponseWriter, req *http.Request) {
+	requestData, ok := decodeTypeRequest(w, req)
+	if !ok {
+		return
+	}
+	if len(requestData.Fields) == 0 {
+		invalidParameter(w, req, "Missing fields")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	added, err := store.HSet(req.Context(), requestData.Key, requestData.Fields)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Fields set successfully", "added": added})
+}
+
+// handleHashGet retrieves a field from a hash
+func (r *Router) handleHashGet(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+	field := req.URL.Query().Get("field")
+	if field == "" {
+		invalidParameter(w, req, "Missing field parameter")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	value, err := store.HGet(req.Context(), key, field)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]string{"key": key, "field": field, "value": value})
+}
+
+// handleHashDelete removes fields from a hash
+func (r *Router) handleHashDelete(w http.ResponseWriter, req *http.Request) {
+	requestData, ok := decodeTypeRequest(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	removed, err := store.HDel(req.Context(), requestData.Key, requestData.FieldNames...)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Fields deleted successfully", "removed": removed})
+}
+
+// handleHashGetAll returns all fields of a hash
+func (r *Router) handleHashGetAll(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	fields, err := store.HGetAll(req.Context(), key)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "fields": fields})
+}
+
+// handleListPush returns a handler that pushes values to the head or tail of a list
+func (r *Router) handleListPush(head bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestData, ok := decodeTypeRequest(w, req)
+		if !ok {
+			return
+		}
+		if len(requestData.Values) == 0 {
+			invalidParameter(w, req, "Missing values")
+			return
+		}
+
+		store, ok := r.resolveStore(w, req)
+		if !ok {
+			return
+		}
+
+		push := store.RPush
+		if head {
+			push = store.LPush
+		}
+		length, err := push(req.Context(), requestData.Key, requestData.Values...)
+		if err != nil {
+			errorResponse(w, req, err)
+			return
+		}
+
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Values pushed successfully", "length": length})
+	}
+}
+
+// handleListPop returns a handler that pops a value from the head or tail of a list
+func (r *Router) handleListPop(head bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestData, ok := decodeTypeRequest(w, req)
+		if !ok {
+			return
+		}
+
+		store, ok := r.resolveStore(w, req)
+		if !ok {
+			return
+		}
+
+		pop := store.RPop
+		if head {
+			pop = store.LPop
+		}
+		value, err := pop(req.Context(), requestData.Key)
+		if err != nil {
+			errorResponse(w, req, err)
+			return
+		}
+
+		jsonResponse(w, http.StatusOK, map[string]string{"key": requestData.Key, "value": value})
+	}
+}
+
+// handleListRange returns a range of elements from a list
+func (r *Router) handleListRange(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+	start, stop, ok := queryRange(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	values, err := store.LRange(req.Context(), key, start, stop)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "values": values})
+}
+
+// handleSetAdd adds members to a set
+func (r *Router) handleSetAdd(w http.ResponseWriter, req *http.Request) {
+	requestData, ok := decodeTypeRequest(w, req)
+	if !ok {
+		return
+	}
+	if len(requestData.Members) == 0 {
+		invalidParameter(w, req, "Missing members")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	added, err := store.SAdd(req.Context(), requestData.Key, requestData.Members...)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Members added successfully", "added": added})
+}
+
+// handleSetRemove removes members from a set
+func (r *Router) handleSetRemove(w http.ResponseWriter, req *http.Request) {
+	requestData, ok := decodeTypeRequest(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	removed, err := store.SRem(req.Context(), requestData.Key, requestData.Members...)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Members removed successfully", "removed": removed})
+}
+
+// handleSetMembers returns all members of a set
+func (r *Router) handleSetMembers(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	members, err := store.SMembers(req.Context(), key)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "members": members})
+}
+
+// handleSetIsMember checks whether a member belongs to a set
+func (r *Router) handleSetIsMember(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+	member := req.URL.Query().Get("member")
+	if member == "" {
+		invalidParameter(w, req, "Missing member parameter")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	isMember, err := store.SIsMember(req.Context(), key, member)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "member": member, "is_member": isMember})
+}
+
+// handleZSetAdd adds scored members to a sorted set
+func (r *Router) handleZSetAdd(w http.ResponseWriter, req *http.Request) {
+	requestData, ok := decodeTypeRequest(w, req)
+	if !ok {
+		return
+	}
+	if len(requestData.ScoredMembers) == 0 {
+		invalidParameter(w, req, "Missing scored_members")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	added, err := store.ZAdd(req.Context(), requestData.Key, requestData.ScoredMembers...)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"message": "Members added successfully", "added": added})
+}
+
+// handleZSetRange returns members of a sorted set by rank
+func (r *Router) handleZSetRange(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+	start, stop, ok := queryRange(w, req)
+	if !ok {
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	members, err := store.ZRange(req.Context(), key, start, stop)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "members": members})
+}
+
+// handleZSetRangeByScore returns members of a sorted set within a score range
+func (r *Router) handleZSetRangeByScore(w http.ResponseWriter, req *http.Request) {
+	key, ok := queryKey(w, req)
+	if !ok {
+		return
+	}
+
+	min, err := strconv.ParseFloat(req.URL.Query().Get("min"), 64)
+	if err != nil {
+		invalidParameter(w, req, "Invalid min parameter")
+		return
+	}
+	max, err := strconv.ParseFloat(req.URL.Query().Get("max"), 64)
+	if err != nil {
+		invalidParameter(w, req, "Invalid max parameter")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	members, err := store.ZRangeByScore(req.Context(), key, min, max)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"key": key, "members": members})
+}
+
+// queryRange reads the start and stop query parameters, defaulting to the whole collection.
+func queryRange(w http.ResponseWriter, req *http.Request) (int, int, bool) {
+	query := req.URL.Query()
+	start, stop := 0, -1
+
+	if raw := query.Get("start"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			invalidParameter(w, req, "Invalid start parameter")
+			return 0, 0, false
+		}
+		start = v
+	}
+	if raw := query.Get("stop"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			invalidParameter(w, req, "Invalid stop parameter")
+			return 0, 0, false
+		}
+		stop = v
+	}
+	return start, stop, true
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/pkg/kv"
+)
+
+// Page sizes of /v1/keys
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// TagHeaderPrefix is followed by the name of a tag in the headers of /v1/keys/{key}.
+// Header names are case-insensitive, so tags set with headers have lower case names.
+const TagHeaderPrefix = "X-KV-Tag-"
+
+// defaultContentType is the content type of values stored without one
+const defaultContentType = "application/octet-stream"
+
+// v1KeysMethods are the methods allowed on /v1/keys/{key}
+var v1KeysMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete}
+
+// handleV1GetKey writes the raw value of a key with its content type and tags. Range requests
+// get the parts of the value they ask for, read from its chunk files when it is large.
+// HEAD requests only get the headers.
+func (r *Router) handleV1GetKey(w http.ResponseWriter, req *http.Request) {
+	key, ok := pathKey(w, req)
+	if !ok {
+		return
+	}
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	value, meta, err := store.Open(req.Context(), key)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	defer value.Close()
+
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	for name, tag := range meta.Tags {
+		w.Header().Set(TagHeaderPrefix+name, tag)
+	}
+	// Sets Content-Length and Accept-Ranges, and answers Range and HEAD requests
+	http.ServeContent(w, req, "", time.Time{}, value)
+}
+
+// handleV1PutKey stores the request body as the value of a key. The Content-Type header and the
+// TagHeaderPrefix headers are stored as its metadata. Bodies larger than the blob threshold are
+// streamed to chunk files.
+func (r *Router) handleV1PutKey(w http.ResponseWriter, req *http.Request) {
+	key, ok := pathKey(w, req)
+	if !ok {
+		return
+	}
+
+	body := bufio.NewReader(req.Body)
+	if _, err := body.Peek(1); err == io.EOF {
+		invalidParameter(w, req, "Missing value")
+		return
+	} else if err != nil {
+		invalidParameter(w, req, "Failed to read the request body")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+	if _, err := store.SetStream(req.Context(), key, body, requestMetadata(req)); err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleV1DeleteKey deletes a key. Deleting a missing key succeeds.
+func (r *Router) handleV1DeleteKey(w http.ResponseWriter, req *http.Request) {
+	key, ok := pathKey(w, req)
+	if !ok {
+		return
+	}
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	if err := store.Delete(req.Context(), key); err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleV1ListKeys lists keys in lexicographic order. The prefix query parameter filters them,
+// limit sets the page size and cursor continues from the next_cursor of the previous page.
+func (r *Router) handleV1ListKeys(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	limit := defaultScanLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxScanLimit {
+			invalidParameter(w, req, "limit must be between 1 and "+strconv.Itoa(maxScanLimit))
+			return
+		}
+		limit = n
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+	if err != nil {
+		invalidParameter(w, req, "Invalid cursor")
+		return
+	}
+
+	store, ok := r.resolveStore(w, req)
+	if !ok {
+		return
+	}
+
+	keys, next, err := store.Scan(req.Context(), query.Get("prefix"), string(cursor), limit)
+	if err != nil {
+		errorResponse(w, req, err)
+		return
+	}
+
+	response := map[string]interface{}{"keys": keys}
+	if next != "" {
+		response["next_cursor"] = base64.RawURLEncoding.EncodeToString([]byte(next))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// requestMetadata returns the metadata sent in the headers of a request
+func requestMetadata(req *http.Request) kv.Metadata {
+	meta := kv.Metadata{ContentType: req.Header.Get("Content-Type")}
+	for name, values := range req.Header {
+		tag, ok := strings.CutPrefix(strings.ToLower(name), strings.ToLower(TagHeaderPrefix))
+		if !ok || tag == "" || len(values) == 0 {
+			continue
+		}
+		if meta.Tags == nil {
+			meta.Tags = make(map[string]string)
+		}
+		meta.Tags[tag] = values[0]
+	}
+	return meta
+}
+
+// methodsAllowed returns a handler for the requests to a resource whose method has no route.
+// It answers 405 with the allowed methods.
+func methodsAllowed(methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", allow)
+		methodNotAllowed(w, req)
+	}
+}
+
+// pathKey returns the key of a /v1/keys/{key} request. It writes a 400 when the key is empty.
+func pathKey(w http.ResponseWriter, req *http.Request) (string, bool) {
+	key := req.PathValue("key")
+	if key == "" {
+		invalidParameter(w, req, "Missing key")
+		return "", false
+	}
+	return key, true
+}
+
+// deprecated marks the responses of a legacy endpoint as deprecated in favour of successor
+func deprecated(successor string, handler http.HandlerFunc) http.HandlerFunc {
+	link := "<" + successor + `>; rel="successor-version"`
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Link", link)
+		handler(w, req)
+	}
+}
@@ -3,7 +3,9 @@ package api
 import (
 	"net/http"
 
+	"github.com/bendigiorgio/go-kv/internal/api/api_errors"
 	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/bendigiorgio/go-kv/internal/web/views"
 	"github.com/bendigiorgio/go-kv/internal/web/views/components"
 )
 
@@ -17,8 +19,22 @@ func (r *Router) handleRefreshList(w http.ResponseWriter, req *http.Request) err
 }
 
 func (r *Router) handleDashboardStats(w http.ResponseWriter, req *http.Request) error {
-	keyCount := r.store.KeyCount()
-	bytesUsage := r.store.MemoryUsage()
-	bytesMemoryLimit := r.store.GetMemoryLimit()
-	return components.DashboardTitleInner(keyCount, bytesUsage, bytesMemoryLimit).Render(req.Context(), w)
+	return components.DashboardTitleInner(r.store.Snapshot(0)).Render(req.Context(), w)
+}
+
+func (r *Router) handleNamespaceStats(w http.ResponseWriter, req *http.Request) error {
+	return components.NamespaceList(r.namespaces.List()).Render(req.Context(), w)
+}
+
+func (r *Router) handleLogs(w http.ResponseWriter, req *http.Request) error {
+	params := views.LogQueryParams{
+		Level: req.URL.Query().Get("level"),
+		Text:  req.URL.Query().Get("q"),
+		Limit: utils.StringToInt(req.URL.Query().Get("limit"), 0),
+	}
+	filter, err := params.Filter()
+	if err != nil {
+		return api_errors.New(api_errors.CodeInvalidParameter, "Unknown log level "+params.Level)
+	}
+	return components.LogEntries(utils.GetLogs(filter)).Render(req.Context(), w)
 }
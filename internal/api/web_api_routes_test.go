@@ -0,0 +1,61 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestLogsView(t *testing.T) {
+	previous, level := log.Logger, zerolog.GlobalLevel()
+	utils.SetupLogger(&utils.ConfigStructure{
+		LogOutput: "file",
+		LogFile:   filepath.Join(t.TempDir(), "kv.log"),
+		LogLevel:  int8(zerolog.InfoLevel),
+	})
+	defer func() {
+		log.Logger = previous
+		zerolog.SetGlobalLevel(level)
+	}()
+
+	router := setupTestRouter(t)
+	router.EnableAccessLog()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp := assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(`{"key":"k","value":"v"}`), http.StatusOK)
+	resp.Body.Close()
+
+	entries := func(query string) string {
+		t.Helper()
+		resp := assertHTTPResponse(t, http.MethodGet, server.URL+"/web/api/logs?"+query, nil, http.StatusOK)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if body := entries("q=path%3D%2Fset"); !strings.Contains(body, "HTTP request") || !strings.Contains(body, "log-level-info") {
+		t.Errorf("Expected the access log entry of /set, got %s", body)
+	}
+	if body := entries("level=error&q=path%3D%2Fset"); !strings.Contains(body, "No log entries") {
+		t.Errorf("Expected no error entries, got %s", body)
+	}
+
+	// The polled page is limited to the most recent entries
+	resp = assertHTTPResponse(t, http.MethodPost, server.URL+"/set", strings.NewReader(`{"key":"k","value":"v"}`), http.StatusOK)
+	resp.Body.Close()
+	if body := entries("q=path%3D%2Fset"); strings.Count(body, "HTTP request") < 2 {
+		t.Errorf("Expected every access log entry of /set, got %s", body)
+	}
+	if body := entries("q=path%3D%2Fset&limit=1"); strings.Count(body, "HTTP request") != 1 {
+		t.Errorf("Expected a single entry, got %s", body)
+	}
+	resp = assertHTTPResponse(t, http.MethodGet, server.URL+"/web/api/logs?level=loud", nil, http.StatusBadRequest)
+	resp.Body.Close()
+}
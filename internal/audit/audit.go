@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single entry of the audit trail
+type Event struct {
+	Time    time.Time      `json:"time"`
+	Actor   string         `json:"actor"`
+	Action  string         `json:"action"`
+	Outcome string         `json:"outcome"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+const (
+	OutcomeSuccess  = "success"
+	OutcomeRejected = "rejected"
+	OutcomeFailure  = "failure"
+)
+
+// Actions recorded in the trail
+const (
+	ActionConfigReload     = "config.reload"
+	ActionNamespaceFlush   = "namespace.flush"
+	ActionNamespaceCompact = "namespace.compact"
+	ActionNamespaceCreate  = "namespace.create"
+	ActionNamespaceDrop    = "namespace.drop"
+	ActionCompactionPause  = "compaction.pause"
+	ActionCompactionResume = "compaction.resume"
+)
+
+// Trail is an append-only log of administrative operations, stored as JSON lines
+type Trail struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open opens the audit log at path for appending, creating it and its directory when missing
+func Open(path string) (*Trail, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Trail{path: path, file: file}, nil
+}
+
+// Record appends an event and syncs it to disk. A zero Time is set to the current time.
+func (t *Trail) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return t.file.Sync()
+}
+
+// Filter selects events of the trail. Zero fields match every event.
+type Filter struct {
+	Since  time.Time // Events at or after this time
+	Until  time.Time // Events before this time
+	Actor  string
+	Action string // An action, or a prefix ending in "." such as "namespace."
+	Limit  int    // Most recent events returned, all when 0
+}
+
+// Match reports whether event is selected by the filter
+func (f Filter) Match(event Event) bool {
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !event.Time.Before(f.Until) {
+		return false
+	}
+	if f.Actor != "" && event.Actor != f.Actor {
+		return false
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		return strings.HasPrefix(event.Action, f.Action)
+	}
+	return f.Action == "" || event.Action == f.Action
+}
+
+// Query returns the events matching filter, oldest first. The file is read without blocking
+// Record; an event being written while it is read is left out.
+func (t *Trail) Query(filter Filter) ([]Event, error) {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without a newline is still being written
+			break
+		}
+		var event Event
+		if json.Unmarshal(line, &event) != nil || !filter.Match(event) {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) >= 2*filter.Limit {
+			events = append(events[:0], events[len(events)-filter.Limit:]...)
+		}
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+// Close closes the audit log file
+func (t *Trail) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
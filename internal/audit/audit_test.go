@@ -0,0 +1,65 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/audit"
+)
+
+func TestQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	trail, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer trail.Close()
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []audit.Event{
+		{Time: base, Actor: "alice", Action: audit.ActionNamespaceFlush, Outcome: audit.OutcomeSuccess},
+		{Time: base.Add(time.Minute), Actor: "bob", Action: audit.ActionNamespaceDrop, Outcome: audit.OutcomeSuccess},
+		{Time: base.Add(2 * time.Minute), Actor: "alice", Action: audit.ActionConfigReload, Outcome: audit.OutcomeFailure},
+		{Time: base.Add(3 * time.Minute), Actor: "alice", Action: audit.ActionNamespaceCompact, Outcome: audit.OutcomeSuccess},
+	}
+	for _, event := range events {
+		if err := trail.Record(event); err != nil {
+			t.Fatalf("Record() failed: %v", err)
+		}
+	}
+	// An event being written is left out
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString(`{"time":"2024-05-01T12:10:00Z","actor":"alice"`)
+	file.Close()
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   []string
+	}{
+		{"all", audit.Filter{}, []string{"namespace.flush", "namespace.drop", "config.reload", "namespace.compact"}},
+		{"actor", audit.Filter{Actor: "bob"}, []string{"namespace.drop"}},
+		{"action prefix", audit.Filter{Action: "namespace."}, []string{"namespace.flush", "namespace.drop", "namespace.compact"}},
+		{"exact action", audit.Filter{Action: "config.reload"}, []string{"config.reload"}},
+		{"time range", audit.Filter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, []string{"namespace.drop", "config.reload"}},
+		{"most recent", audit.Filter{Actor: "alice", Limit: 2}, []string{"config.reload", "namespace.compact"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trail.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d events, got %+v", len(tt.want), got)
+			}
+			for i, event := range got {
+				if event.Action != tt.want[i] {
+					t.Errorf("Expected event %d to be %s, got %s", i, tt.want[i], event.Action)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Access is a level of access granted by a rule. Higher levels include the lower ones.
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+	AccessAdmin
+)
+
+const sha256Prefix = "sha256:"
+
+// ErrUnauthenticated is returned when a request has missing or invalid credentials.
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// ParseAccess parses an access level name (read, write or admin).
+func ParseAccess(name string) (Access, error) {
+	switch strings.ToLower(name) {
+	case "read":
+		return AccessRead, nil
+	case "write":
+		return AccessWrite, nil
+	case "admin":
+		return AccessAdmin, nil
+	}
+	return AccessNone, fmt.Errorf("unknown access level %q", name)
+}
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// Rule grants an access level on keys or endpoints matching its patterns.
+type Rule struct {
+	Keys      string
+	Endpoints []string
+	Namespace string
+	Access    Access
+}
+
+// Identity is an authenticated caller and the rules that apply to it.
+type Identity struct {
+	Name  string
+	Rules []Rule
+}
+
+// CanAccessKey reports whether the identity holds at least access on key in namespace.
+func (id *Identity) CanAccessKey(namespace, key string, access Access) bool {
+	for _, rule := range id.Rules {
+		if rule.Access >= access && rule.Keys != "" && matchNamespace(rule.Namespace, namespace) && matchPattern(rule.Keys, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessAllKeys reports whether the identity holds at least access on every key in namespace.
+func (id *Identity) CanAccessAllKeys(namespace string, access Access) bool {
+	for _, rule := range id.Rules {
+		if rule.Access >= access && rule.Keys == "*" && matchNamespace(rule.Namespace, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessEndpoint reports whether the identity holds at least access on the endpoint path.
+func (id *Identity) CanAccessEndpoint(namespace, path string, access Access) bool {
+	for _, rule := range id.Rules {
+		if rule.Access < access || !matchNamespace(rule.Namespace, namespace) {
+			continue
+		}
+		for _, pattern := range rule.Endpoints {
+			if matchPattern(pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPattern matches an exact value or a prefix pattern ending in "*".
+func matchPattern(pattern, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
+
+func matchNamespace(ruleNamespace, namespace string) bool {
+	return ruleNamespace == "" || ruleNamespace == namespace
+}
+
+type user struct {
+	identity     *Identity
+	tokenHash    string
+	passwordHash string
+}
+
+// Authenticator verifies request credentials against the configured users.
+type Authenticator struct {
+	users    []*user
+	byName   map[string]*user
+	byCertCN map[string]*user
+}
+
+// New creates an Authenticator from the auth configuration, validating hashes and rules.
+func New(cfg utils.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{byName: make(map[string]*user), byCertCN: make(map[string]*user)}
+
+	for i, u := range cfg.Users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("auth.users[%d].name: must not be empty", i)
+		}
+		if _, exists := a.byName[u.Name]; exists {
+			return nil, fmt.Errorf("auth.users[%d].name: duplicate user %q", i, u.Name)
+		}
+		if err := validateHash(u.TokenHash); err != nil {
+			return nil, fmt.Errorf("auth.users[%d].tokenHash: %w", i, err)
+		}
+		if err := validateHash(u.PasswordHash); err != nil {
+			return nil, fmt.Errorf("auth.users[%d].passwordHash: %w", i, err)
+		}
+
+		identity := &Identity{Name: u.Name}
+		for j, r := range u.Rules {
+			access, err := ParseAccess(r.Access)
+			if err != nil {
+				return nil, fmt.Errorf("auth.users[%d].rules[%d].access: %w", i, j, err)
+			}
+			if r.Keys == "" && len(r.Endpoints) == 0 {
+				return nil, fmt.Errorf("auth.users[%d].rules[%d]: keys or endpoints must be set", i, j)
+			}
+			identity.Rules = append(identity.Rules, Rule{
+				Keys:      r.Keys,
+				Endpoints: r.Endpoints,
+				Namespace: r.Namespace,
+				Access:    access,
+			})
+		}
+
+		entry := &user{identity: identity, tokenHash: u.TokenHash, passwordHash: u.PasswordHash}
+		a.users = append(a.users, entry)
+		a.byName[u.Name] = entry
+		if u.ClientCN != "" {
+			if _, exists := a.byCertCN[u.ClientCN]; exists {
+				return nil, fmt.Errorf("auth.users[%d].clientCN: duplicate common name %q", i, u.ClientCN)
+			}
+			a.byCertCN[u.ClientCN] = entry
+		}
+	}
+	return a, nil
+}
+
+// Authenticate returns the identity for the request's verified TLS client certificate,
+// bearer token or basic auth credentials, in that order.
+func (a *Authenticator) Authenticate(req *http.Request) (*Identity, error) {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		if u, ok := a.byCertCN[req.TLS.VerifiedChains[0][0].Subject.CommonName]; ok {
+			return u.identity, nil
+		}
+	}
+
+	if name, password, ok := req.BasicAuth(); ok {
+		u, exists := a.byName[name]
+		if !exists || u.passwordHash == "" || !verifySecret(u.passwordHash, password) {
+			return nil, ErrUnauthenticated
+		}
+		return u.identity, nil
+	}
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrUnauthenticated
+	}
+	for _, u := range a.users {
+		if u.tokenHash != "" && verifySecret(u.tokenHash, token) {
+			return u.identity, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// Identity returns the identity of a configured user by name.
+func (a *Authenticator) Identity(name string) (*Identity, bool) {
+	u, ok := a.byName[name]
+	if !ok {
+		return nil, false
+	}
+	return u.identity, true
+}
+
+// HashSecret returns the "sha256:<hex>" hash of a secret, suitable for tokenHash and passwordHash.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return sha256Prefix + hex.EncodeToString(sum[:])
+}
+
+func validateHash(hash string) error {
+	switch {
+	case hash == "":
+		return nil
+	case strings.HasPrefix(hash, sha256Prefix):
+		if raw, err := hex.DecodeString(strings.TrimPrefix(hash, sha256Prefix)); err != nil || len(raw) != sha256.Size {
+			return errors.New("invalid sha256 hash")
+		}
+		return nil
+	case strings.HasPrefix(hash, "$2"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return nil
+	}
+	return errors.New(`hash must start with "sha256:" or be a bcrypt hash`)
+}
+
+func verifySecret(hash, secret string) bool {
+	if strings.HasPrefix(hash, sha256Prefix) {
+		return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
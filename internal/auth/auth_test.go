@@ -0,0 +1,107 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newAuthenticator(t *testing.T) *auth.Authenticator {
+	t.Helper()
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	a, err := auth.New(utils.AuthConfig{
+		Enabled: true,
+		Users: []utils.AuthUser{
+			{
+				Name:      "ci",
+				TokenHash: auth.HashSecret("ci-token"),
+				Rules: []utils.AuthRule{
+					{Keys: "app/*", Access: "write"},
+					{Keys: "*", Namespace: "reports", Access: "read"},
+				},
+			},
+			{
+				Name:         "ops",
+				PasswordHash: string(passwordHash),
+				Rules:        []utils.AuthRule{{Endpoints: []string{"/flush", "/admin/*"}, Access: "admin"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return a
+}
+
+func Test_AuthenticateBearerToken(t *testing.T) {
+	a := newAuthenticator(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Authorization", "Bearer ci-token")
+	identity, err := a.Authenticate(req)
+	if err != nil || identity.Name != "ci" {
+		t.Fatalf("Authenticate() = %v, %v; expected ci", identity, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("Expected an invalid token to be rejected")
+	}
+}
+
+func Test_AuthenticateBasicAuth(t *testing.T) {
+	a := newAuthenticator(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/flush", nil)
+	req.SetBasicAuth("ops", "secret")
+	identity, err := a.Authenticate(req)
+	if err != nil || identity.Name != "ops" {
+		t.Fatalf("Authenticate() = %v, %v; expected ops", identity, err)
+	}
+
+	req.SetBasicAuth("ops", "wrong")
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("Expected an invalid password to be rejected")
+	}
+}
+
+func Test_IdentityRules(t *testing.T) {
+	a := newAuthenticator(t)
+	ci, _ := a.Identity("ci")
+	ops, _ := a.Identity("ops")
+
+	if !ci.CanAccessKey("default", "app/config", auth.AccessWrite) {
+		t.Error("Expected write access on app/ keys")
+	}
+	if ci.CanAccessKey("default", "other", auth.AccessRead) {
+		t.Error("Expected no access outside of app/ keys")
+	}
+	if !ci.CanAccessAllKeys("reports", auth.AccessRead) || ci.CanAccessAllKeys("reports", auth.AccessWrite) {
+		t.Error("Expected read-only access on the reports namespace")
+	}
+	if ci.CanAccessEndpoint("default", "/flush", auth.AccessAdmin) {
+		t.Error("Expected no admin access for ci")
+	}
+	if !ops.CanAccessEndpoint("default", "/admin/namespaces", auth.AccessAdmin) {
+		t.Error("Expected admin access on /admin/ endpoints for ops")
+	}
+}
+
+func Test_NewRejectsInvalidConfig(t *testing.T) {
+	invalid := []utils.AuthConfig{
+		{Users: []utils.AuthUser{{Name: "", TokenHash: auth.HashSecret("x")}}},
+		{Users: []utils.AuthUser{{Name: "a", TokenHash: "plaintext"}}},
+		{Users: []utils.AuthUser{{Name: "a", Rules: []utils.AuthRule{{Keys: "*", Access: "owner"}}}}},
+		{Users: []utils.AuthUser{{Name: "a", Rules: []utils.AuthRule{{Access: "read"}}}}},
+	}
+
+	for i, cfg := range invalid {
+		if _, err := auth.New(cfg); err == nil {
+			t.Errorf("Expected config %d to be rejected", i)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Values written with SetStream that are larger than the blob threshold are stored out of line:
+// split into chunks of blobChunkSize bytes, each in a file of the blob directory next to the data
+// file, named by the SHA-256 of its contents. Memory only holds the BlobRef, in the value's
+// metadata. Chunks no longer referenced are removed by compaction.
+const (
+	DefaultBlobThreshold = 1 << 20
+	blobChunkSize        = 4 << 20
+	blobDirSuffix        = ".blobs"
+)
+
+// BlobRef locates a value stored in chunk files. It is set by the engine and never modified.
+type BlobRef struct {
+	Size      int64    `json:"size"`
+	ChunkSize int64    `json:"chunk_size"`
+	Chunks    []string `json:"chunks"` // SHA-256 of each chunk, in order
+}
+
+// size is the memory accounted for the reference
+func (b *BlobRef) size() int {
+	return 16 + len(b.Chunks)*sha256.Size*2
+}
+
+// blobStore writes and reads the chunk files of an engine
+type blobStore struct {
+	dir       string
+	threshold atomic.Int64
+	mu        sync.Mutex     // Orders removals of chunks with pending
+	pending   map[string]int // Chunks of values being written or evicted, which GC keeps
+}
+
+func newBlobStore(dir string) *blobStore {
+	b := &blobStore{dir: dir, pending: make(map[string]int)}
+	b.threshold.Store(DefaultBlobThreshold)
+	return b
+}
+
+func (b *blobStore) path(chunk string) string {
+	return filepath.Join(b.dir, chunk)
+}
+
+// hold keeps chunks from being collected until the returned function is called
+func (b *blobStore) hold(chunks []string) func() {
+	b.mu.Lock()
+	for _, chunk := range chunks {
+		b.pending[chunk]++
+	}
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, chunk := range chunks {
+			if b.pending[chunk]--; b.pending[chunk] <= 0 {
+				delete(b.pending, chunk)
+			}
+		}
+	}
+}
+
+// write stores r in chunk files. The chunks are held until release is called, which the caller
+// does once the reference is in memory. Chunks with the same contents are written once.
+func (b *blobStore) write(ctx context.Context, r io.Reader) (ref *BlobRef, release func(), err error) {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, func() {}, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	ref = &BlobRef{ChunkSize: blobChunkSize}
+	var releases []func()
+	release = func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	buf := make([]byte, blobChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, release, err
+		}
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			chunk := hex.EncodeToString(sum[:])
+			releases = append(releases, b.hold([]string{chunk}))
+			if err := b.writeChunk(chunk, buf[:n]); err != nil {
+				return nil, release, err
+			}
+			ref.Chunks = append(ref.Chunks, chunk)
+			ref.Size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return ref, release, nil
+		}
+		if readErr != nil {
+			return nil, release, readErr
+		}
+	}
+}
+
+// writeChunk writes a chunk file unless it exists. The chunk must be held.
+func (b *blobStore) writeChunk(chunk string, data []byte) error {
+	if _, err := os.Stat(b.path(chunk)); err == nil {
+		return nil
+	}
+	file, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create chunk file: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), b.path(chunk))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to write chunk file: %w", err)
+	}
+	return nil
+}
+
+// readAll returns the whole value of ref
+func (b *blobStore) readAll(ref *BlobRef) ([]byte, error) {
+	reader := newValueReader("", ref, b)
+	defer reader.Close()
+	value := make([]byte, ref.Size)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// collect removes the chunk files that are neither referenced nor held and returns how many
+func (b *blobStore) collect(referenced map[string]bool) (int, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	removed := 0
+	for _, entry := range entries {
+		chunk := entry.Name()
+		if strings.HasPrefix(chunk, ".tmp-") || referenced[chunk] || b.pending[chunk] > 0 {
+			continue
+		}
+		if err := os.Remove(b.path(chunk)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ValueReader reads a value from memory or from its chunk files. It supports seeking, so values
+// can be served in ranges, and must be closed.
+type ValueReader struct {
+	inline  *strings.Reader
+	ref     *BlobRef
+	blobs   *blobStore
+	offset  int64
+	chunk   *os.File // Chunk file of index current, opened on demand
+	index   int
+	release func() // Releases the hold on the chunks, set by Open
+}
+
+func newValueReader(value string, ref *BlobRef, blobs *blobStore) *ValueReader {
+	if ref == nil {
+		return &ValueReader{inline: strings.NewReader(value)}
+	}
+	return &ValueReader{ref: ref, blobs: blobs, index: -1}
+}
+
+// Size returns the length of the value
+func (r *ValueReader) Size() int64 {
+	if r.inline != nil {
+		return r.inline.Size()
+	}
+	return r.ref.Size
+}
+
+func (r *ValueReader) Read(p []byte) (int, error) {
+	if r.inline != nil {
+		return r.inline.Read(p)
+	}
+	if r.offset >= r.ref.Size {
+		return 0, io.EOF
+	}
+
+	index := int(r.offset / r.ref.ChunkSize)
+	if index != r.index {
+		if r.chunk != nil {
+			r.chunk.Close()
+			r.chunk = nil
+		}
+		file, err := os.Open(r.blobs.path(r.ref.Chunks[index]))
+		if err != nil {
+			return 0, &CorruptedError{Path: r.blobs.path(r.ref.Chunks[index]), Err: err}
+		}
+		r.chunk, r.index = file, index
+	}
+
+	within := r.offset % r.ref.ChunkSize
+	limit := min(int64(len(p)), r.ref.ChunkSize-within, r.ref.Size-r.offset)
+	n, err := r.chunk.ReadAt(p[:limit], within)
+	r.offset += int64(n)
+	if err == io.EOF && int64(n) == limit {
+		err = nil
+	}
+	if err == io.EOF {
+		err = &CorruptedError{Path: r.chunk.Name(), Err: io.ErrUnexpectedEOF}
+	}
+	return n, err
+}
+
+func (r *ValueReader) Seek(offset int64, whence int) (int64, error) {
+	if r.inline != nil {
+		return r.inline.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.ref.Size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the open chunk file and lets compaction remove the chunks
+func (r *ValueReader) Close() error {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+	if r.chunk != nil {
+		err := r.chunk.Close()
+		r.chunk = nil
+		return err
+	}
+	return nil
+}
+
+// SetBlobThreshold sets the size above which SetStream stores values in chunk files
+func (e *Engine) SetBlobThreshold(bytes int64) {
+	e.blobs.threshold.Store(bytes)
+}
+
+// BlobThreshold returns the size above which SetStream stores values in chunk files
+func (e *Engine) BlobThreshold() int64 {
+	return e.blobs.threshold.Load()
+}
+
+// SetStream stores the contents of r under key with its metadata and returns their length.
+// Values up to the blob threshold are kept in memory like SetValue; larger ones are written to
+// chunk files as they are read, so they never need to fit in memory.
+func (e *Engine) SetStream(ctx context.Context, key string, r io.Reader, meta Metadata) (int64, error) {
+	limits := e.Limits()
+	if err := limits.CheckKey(key); err != nil {
+		return 0, err
+	}
+	r = &limitedReader{r: r, limits: limits}
+
+	threshold := e.blobs.threshold.Load()
+	head, err := io.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(head)) <= threshold {
+		return int64(len(head)), e.SetValue(ctx, key, head, meta)
+	}
+
+	e.mu.RLock()
+	readOnly := e.readOnly
+	e.mu.RUnlock()
+	if readOnly {
+		return 0, ErrReadOnly
+	}
+
+	ref, release, err := e.blobs.write(ctx, io.MultiReader(bytes.NewReader(head), r))
+	defer release()
+	if err != nil {
+		return 0, err
+	}
+	meta = meta.clone()
+	meta.Blob = ref
+	return ref.Size, e.setValue(ctx, key, "", meta)
+}
+
+// Open returns a reader of the value of key, with its metadata. It fails like GetValue.
+func (e *Engine) Open(ctx context.Context, key string) (*ValueReader, Metadata, error) {
+	value, meta, release, err := e.lookup(ctx, key)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	reader := newValueReader(value, meta.Blob, e.blobs)
+	reader.release = release // The chunks stay until the reader is closed
+	return reader, meta, nil
+}
+
+// collectBlobs removes the chunk files no value in memory or on disk refers to
+func (e *Engine) collectBlobs() (int, error) {
+	referenced := make(map[string]bool)
+	add := func(meta Metadata) {
+		if meta.Blob != nil {
+			for _, chunk := range meta.Blob.Chunks {
+				referenced[chunk] = true
+			}
+		}
+	}
+
+	// Evictions hold the chunks they move from memory to the flush file, and files are read
+	// under fileMu, so a reference is always seen in one place or the other
+	e.mu.RLock()
+	for _, meta := range e.meta {
+		add(meta)
+	}
+	e.mu.RUnlock()
+
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+	for _, path := range []string{e.filePath, e.flushPath, e.flushPath + compactingFileSuffix, e.flushPath + compactedFileSuffix} {
+		err := readRecords(path, func(_, _ string, meta Metadata) {
+			add(meta)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return e.blobs.collect(referenced)
+}
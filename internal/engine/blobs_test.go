@@ -0,0 +1,161 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// largeValue spans three chunk files, the last one partial
+var largeValue = func() []byte {
+	value := make([]byte, 9<<20+123)
+	for i := range value {
+		value[i] = byte(i * 7)
+	}
+	return value
+}()
+
+func Test_StreamedBlobs(t *testing.T) {
+	db := setupEngine(t, 1024)
+	ctx := context.Background()
+	db.SetBlobThreshold(64)
+
+	meta := engine.Metadata{ContentType: "video/mp4"}
+	n, err := db.SetStream(ctx, "big", bytes.NewReader(largeValue), meta)
+	if err != nil || n != int64(len(largeValue)) {
+		t.Fatalf("SetStream() = %d, %v, expected %d", n, err, len(largeValue))
+	}
+	if n, err := db.SetStream(ctx, "small", bytes.NewReader([]byte("inline")), meta); err != nil || n != 6 {
+		t.Fatalf("SetStream() = %d, %v for a small value", n, err)
+	}
+	if db.MemoryUsage() > 1024 {
+		t.Errorf("Expected only references in memory, got %d bytes", db.MemoryUsage())
+	}
+	if _, err := db.Incr("big", 1); !errors.Is(err, engine.ErrNotNumeric) {
+		t.Errorf("Expected ErrNotNumeric incrementing a blob, got %v", err)
+	}
+	if list := db.List(); len(list) != 1 || list["small"] != "inline" {
+		t.Errorf("Expected List() to leave out the blob, got %q", list)
+	}
+
+	value, got, err := db.GetValue(ctx, "big")
+	if err != nil || !bytes.Equal(value, largeValue) {
+		t.Fatalf("Expected GetValue() to read the chunks, got %d bytes, %v", len(value), err)
+	}
+	if got.ContentType != "video/mp4" || got.Blob == nil || len(got.Blob.Chunks) != 3 {
+		t.Errorf("Expected a blob of three chunks, got %+v", got)
+	}
+
+	// A range across the first chunk boundary
+	reader, _, err := db.Open(ctx, "big")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer reader.Close()
+	if reader.Size() != int64(len(largeValue)) {
+		t.Errorf("Expected Size() %d, got %d", len(largeValue), reader.Size())
+	}
+	start := int64(4<<20 - 10)
+	if _, err := reader.Seek(start, io.SeekStart); err != nil {
+		t.Fatalf("Seek() failed: %v", err)
+	}
+	part := make([]byte, 20)
+	if _, err := io.ReadFull(reader, part); err != nil || !bytes.Equal(part, largeValue[start:start+20]) {
+		t.Errorf("Expected the range to match, got %v, %v", part, err)
+	}
+
+	// The reference persists and the chunks stay readable after a restart
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	db, err = engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db.Shutdown()
+	if value, err := db.Get("big"); err != nil || value != string(largeValue) {
+		t.Errorf("Expected the blob after a restart, got %d bytes, %v", len(value), err)
+	}
+}
+
+func Test_CompactionCollectsBlobs(t *testing.T) {
+	db := setupEngine(t, 1024)
+	ctx := context.Background()
+	db.SetBlobThreshold(64)
+
+	if _, err := db.SetStream(ctx, "big", bytes.NewReader(largeValue), engine.Metadata{}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	replacement := bytes.Repeat([]byte("r"), 5<<20)
+	if _, err := db.SetStream(ctx, "big", bytes.NewReader(replacement), engine.Metadata{}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	if _, err := db.SetStream(ctx, "deleted", bytes.NewReader(largeValue[:1000]), engine.Metadata{}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	// The first two chunks of largeValue are equal and share a file
+	if chunks := countChunks(t); chunks != 5 {
+		t.Fatalf("Expected 5 chunk files before compaction, got %d", chunks)
+	}
+
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("CompactFlushedData() failed: %v", err)
+	}
+	if chunks := countChunks(t); chunks != 2 {
+		t.Errorf("Expected only the 2 chunks of the current value, got %d", chunks)
+	}
+	if value, _, err := db.GetValue(ctx, "big"); err != nil || !bytes.Equal(value, replacement) {
+		t.Errorf("Expected the current value to survive compaction, got %d bytes, %v", len(value), err)
+	}
+}
+
+func Test_OpenHoldsBlobs(t *testing.T) {
+	db := setupEngine(t, 1024)
+	ctx := context.Background()
+	db.SetBlobThreshold(64)
+
+	if _, err := db.SetStream(ctx, "big", bytes.NewReader(largeValue), engine.Metadata{}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	reader, _, err := db.Open(ctx, "big")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+
+	// The value is replaced and compacted away while it is being read
+	if err := db.Set("big", "small"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("CompactFlushedData() failed: %v", err)
+	}
+	value, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(value, largeValue) {
+		t.Errorf("Expected the whole value, got %d bytes, %v", len(value), err)
+	}
+	reader.Close()
+
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("CompactFlushedData() failed: %v", err)
+	}
+	if chunks := countChunks(t); chunks != 0 {
+		t.Errorf("Expected the chunks to be removed once the reader is closed, got %d", chunks)
+	}
+}
+
+func countChunks(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir(testFilePath + ".blobs")
+	if err != nil {
+		t.Fatalf("Failed to read blob directory: %v", err)
+	}
+	return len(entries)
+}
@@ -0,0 +1,487 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrCompactionInProgress is returned when a compaction is requested while another one runs.
+var ErrCompactionInProgress = errors.New("a compaction is already running")
+
+// Compaction phases, in the order they run
+const (
+	PhaseRotate  = "rotate"  // New evictions go to a fresh flush file
+	PhaseSave    = "save"    // The in-memory data is saved, so it can hide older flushed records
+	PhaseScan    = "scan"    // The files are split into sorted runs
+	PhaseMerge   = "merge"   // The runs are merged into the compacted files
+	PhaseCleanup = "cleanup" // The rotated flush files are removed
+)
+
+var compactionPhases = []string{PhaseRotate, PhaseSave, PhaseScan, PhaseMerge, PhaseCleanup}
+
+// Files written by compaction next to the flush file
+const (
+	compactingFileSuffix = ".compacting" // Flush files being compacted
+	compactedFileSuffix  = ".compacted"  // Records merged by earlier compactions
+)
+
+// CompactionProgress reports how far the running compaction of an engine got.
+type CompactionProgress struct {
+	Running      bool      `json:"running"`
+	Started      time.Time `json:"started,omitempty"`
+	Phase        string    `json:"phase,omitempty"`
+	Step         int       `json:"step"`  // 1-based index of Phase
+	Steps        int       `json:"steps"` // Number of phases
+	BytesRead    int64     `json:"bytes_read"`
+	BytesWritten int64     `json:"bytes_written"`
+}
+
+// compactionState tracks the running compaction of an engine.
+type compactionState struct {
+	running  sync.Mutex // Held for the whole compaction, so only one runs at a time
+	mu       sync.Mutex
+	progress CompactionProgress
+}
+
+func (c *compactionState) begin(start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress = CompactionProgress{Running: true, Started: start, Steps: len(compactionPhases)}
+}
+
+func (c *compactionState) enter(phase string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress.Phase = phase
+	for i, p := range compactionPhases {
+		if p == phase {
+			c.progress.Step = i + 1
+		}
+	}
+	log.Trace().Str("phase", phase).Msg("Compaction progress")
+}
+
+func (c *compactionState) addBytes(n int, write bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if write {
+		c.progress.BytesWritten += int64(n)
+	} else {
+		c.progress.BytesRead += int64(n)
+	}
+}
+
+func (c *compactionState) end() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress = CompactionProgress{}
+}
+
+// CompactionProgress returns the progress of the running compaction.
+func (e *Engine) CompactionProgress() CompactionProgress {
+	e.compaction.mu.Lock()
+	defer e.compaction.mu.Unlock()
+	return e.compaction.progress
+}
+
+// Schedule is a cron-like interval: "@hourly", "@daily", "@every <duration>" or a plain duration.
+type Schedule struct {
+	Every time.Duration
+}
+
+// ParseSchedule parses a schedule. An empty string disables the interval trigger.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		return Schedule{}, nil
+	case "@hourly":
+		return Schedule{Every: time.Hour}, nil
+	case "@daily", "@midnight":
+		return Schedule{Every: 24 * time.Hour}, nil
+	case "@weekly":
+		return Schedule{Every: 7 * 24 * time.Hour}, nil
+	}
+	every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every")))
+	if err != nil || every <= 0 {
+		return Schedule{}, fmt.Errorf("invalid schedule %q (@hourly, @daily, @weekly or @every <duration>)", spec)
+	}
+	return Schedule{Every: every}, nil
+}
+
+// QuietHours is a daily window of local time, such as 01:00-05:00. Windows may wrap past midnight.
+type QuietHours struct {
+	Start, End time.Duration // Offsets from midnight
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM". An empty string disables quiet hours.
+func ParseQuietHours(spec string) (*QuietHours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q (HH:MM-HH:MM)", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid quiet hours %q: start and end are equal", spec)
+	}
+	return &QuietHours{Start: start, End: end}, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (q *QuietHours) Contains(t time.Time) bool {
+	return !q.windowStart(t).IsZero()
+}
+
+// windowStart returns the start of the window containing t, or the zero time when t is outside it.
+func (q *QuietHours) windowStart(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	switch {
+	case q.Start < q.End && offset >= q.Start && offset < q.End:
+		return midnight.Add(q.Start)
+	case q.Start > q.End && offset >= q.Start:
+		return midnight.Add(q.Start)
+	case q.Start > q.End && offset < q.End:
+		return midnight.AddDate(0, 0, -1).Add(q.Start)
+	}
+	return time.Time{}
+}
+
+// String formats the window as HH:MM-HH:MM.
+func (q *QuietHours) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(q.Start) + "-" + clock(q.End)
+}
+
+// CompactionPolicy decides when the scheduler compacts a namespace. A namespace is only
+// compacted when it has flushed data; zero values disable a trigger.
+type CompactionPolicy struct {
+	MaxFlushFileBytes int64       // Compact when the flush files grow beyond this size
+	MaxFlushedRatio   float64     // Compact when flush file bytes exceed this multiple of the in-memory bytes
+	Schedule          Schedule    // Compact when this long passed since the last compaction
+	QuietHours        *QuietHours // Compact once during each window
+	CheckInterval     time.Duration
+}
+
+// Compaction triggers reported by the scheduler
+const (
+	TriggerFileSize   = "file_size"
+	TriggerRatio      = "flushed_ratio"
+	TriggerSchedule   = "schedule"
+	TriggerQuietHours = "quiet_hours"
+)
+
+// CompactionRun describes a finished compaction started by the scheduler.
+type CompactionRun struct {
+	Namespace string        `json:"namespace"`
+	Trigger   string        `json:"trigger"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// SchedulerStatus is the state of the compaction scheduler.
+type SchedulerStatus struct {
+	Paused    bool                          `json:"paused"`
+	Running   string                        `json:"running,omitempty"` // Namespace being compacted
+	Trigger   string                        `json:"trigger,omitempty"`
+	Progress  map[string]CompactionProgress `json:"progress,omitempty"` // Running compactions by namespace
+	LastRun   *CompactionRun                `json:"last_run,omitempty"`
+	LastCheck time.Time                     `json:"last_check"`
+	Policy    PolicyStatus                  `json:"policy"`
+}
+
+// PolicyStatus is the scheduler policy in a readable form.
+type PolicyStatus struct {
+	MaxFlushFileBytes int64   `json:"max_flush_file_bytes,omitempty"`
+	MaxFlushedRatio   float64 `json:"max_flushed_ratio,omitempty"`
+	Schedule          string  `json:"schedule,omitempty"`
+	QuietHours        string  `json:"quiet_hours,omitempty"`
+	CheckInterval     string  `json:"check_interval"`
+}
+
+// CompactionScheduler compacts the namespaces whose flush files meet a trigger of its policy.
+// It checks every CheckInterval and compacts one namespace at a time.
+type CompactionScheduler struct {
+	namespaces *Namespaces
+
+	mu             sync.Mutex
+	policy         CompactionPolicy
+	paused         bool
+	running        string
+	trigger        string
+	lastRun        *CompactionRun
+	lastCheck      time.Time
+	lastCompaction map[string]time.Time // By namespace, starts at the scheduler start
+	lastQuiet      map[string]time.Time // Start of the last quiet window a namespace was compacted in
+	reset          chan struct{}
+
+	ctx      context.Context // Cancelled by Stop to interrupt a running compaction
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// defaultCheckInterval is used when the policy does not set one
+const defaultCheckInterval = 30 * time.Second
+
+// NewCompactionScheduler creates a scheduler for every namespace. Call Start to run it.
+func NewCompactionScheduler(namespaces *Namespaces, policy CompactionPolicy) *CompactionScheduler {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = defaultCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CompactionScheduler{
+		ctx:            ctx,
+		cancel:         cancel,
+		namespaces:     namespaces,
+		policy:         policy,
+		lastCompaction: make(map[string]time.Time),
+		lastQuiet:      make(map[string]time.Time),
+		reset:          make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler in the background until Stop is called.
+func (s *CompactionScheduler) Start() {
+	go s.loop()
+}
+
+// Stop stops the scheduler, interrupting a running compaction, and waits for it to return.
+// The next compaction picks up the flushed data an interrupted one left behind.
+func (s *CompactionScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		close(s.stop)
+		<-s.done
+	})
+}
+
+func (s *CompactionScheduler) loop() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		interval := s.policy.CheckInterval
+		s.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+			s.Check()
+		case <-s.reset:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// SetPolicy replaces the policy. It applies from the next check.
+func (s *CompactionScheduler) SetPolicy(policy CompactionPolicy) {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = defaultCheckInterval
+	}
+	s.mu.Lock()
+	s.policy = policy
+	s.mu.Unlock()
+
+	select {
+	case s.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops the scheduler from starting compactions. A running compaction finishes.
+func (s *CompactionScheduler) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume lets the scheduler start compactions again.
+func (s *CompactionScheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// Status returns the scheduler state and the progress of running compactions.
+func (s *CompactionScheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	status := SchedulerStatus{
+		Paused:    s.paused,
+		Running:   s.running,
+		Trigger:   s.trigger,
+		LastCheck: s.lastCheck,
+		Policy: PolicyStatus{
+			MaxFlushFileBytes: s.policy.MaxFlushFileBytes,
+			MaxFlushedRatio:   s.policy.MaxFlushedRatio,
+			CheckInterval:     s.policy.CheckInterval.String(),
+		},
+	}
+	if s.lastRun != nil {
+		run := *s.lastRun
+		status.LastRun = &run
+	}
+	if s.policy.Schedule.Every > 0 {
+		status.Policy.Schedule = "@every " + s.policy.Schedule.Every.String()
+	}
+	if s.policy.QuietHours != nil {
+		status.Policy.QuietHours = s.policy.QuietHours.String()
+	}
+	s.mu.Unlock()
+
+	// Include compactions started from /compact as well as by the scheduler
+	for name, e := range s.namespaces.engineMap() {
+		if progress := e.CompactionProgress(); progress.Running {
+			if status.Progress == nil {
+				status.Progress = make(map[string]CompactionProgress)
+			}
+			status.Progress[name] = progress
+		}
+	}
+	return status
+}
+
+// Check compacts, one after the other, every namespace that meets a trigger.
+// It does nothing while the scheduler is paused.
+func (s *CompactionScheduler) Check() {
+	engines := s.namespaces.engineMap()
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s.mu.Lock()
+		if s.paused {
+			s.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		s.lastCheck = now
+		trigger := s.triggerFor(name, engines[name], now)
+		if trigger == "" {
+			s.mu.Unlock()
+			continue
+		}
+		s.running, s.trigger = name, trigger
+		s.mu.Unlock()
+
+		s.compact(name, engines[name], trigger, now)
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// triggerFor returns the first trigger a namespace meets, or an empty string. s.mu must be held.
+func (s *CompactionScheduler) triggerFor(name string, e *Engine, now time.Time) string {
+	// The schedule counts from the last compaction, including manual ones, or from the first check
+	if _, seen := s.lastCompaction[name]; !seen {
+		s.lastCompaction[name] = now
+	}
+	if _, last := e.health.lastOperations(); last.Time.After(s.lastCompaction[name]) {
+		s.lastCompaction[name] = last.Time
+	}
+
+	stats := e.Stats()
+	if stats.FlushFileBytes == 0 {
+		return ""
+	}
+
+	p := s.policy
+	switch {
+	case p.MaxFlushFileBytes > 0 && stats.FlushFileBytes > p.MaxFlushFileBytes:
+		return TriggerFileSize
+	case p.MaxFlushedRatio > 0 && float64(stats.FlushFileBytes) > p.MaxFlushedRatio*float64(max(stats.MemoryUsage, 1)):
+		return TriggerRatio
+	case p.Schedule.Every > 0 && now.Sub(s.lastCompaction[name]) >= p.Schedule.Every:
+		return TriggerSchedule
+	}
+	if p.QuietHours != nil {
+		if window := p.QuietHours.windowStart(now); !window.IsZero() && !s.lastQuiet[name].Equal(window) {
+			return TriggerQuietHours
+		}
+	}
+	return ""
+}
+
+func (s *CompactionScheduler) compact(name string, e *Engine, trigger string, start time.Time) {
+	log.Info().Str("namespace", name).Str("trigger", trigger).Msg("Scheduled compaction starting")
+	err := e.CompactFlushedDataContext(s.ctx)
+	if errors.Is(err, ErrCompactionInProgress) {
+		// A compaction started from /compact is running; check again later
+		s.mu.Lock()
+		s.running, s.trigger = "", ""
+		s.mu.Unlock()
+		return
+	}
+
+	run := &CompactionRun{Namespace: name, Trigger: trigger, Started: start, Duration: time.Since(start)}
+	if err != nil {
+		run.Error = err.Error()
+		log.Error().Err(err).Str("namespace", name).Msg("Scheduled compaction failed")
+	} else {
+		log.Info().Str("namespace", name).Dur("duration", run.Duration).Msg("Scheduled compaction finished")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running, s.trigger = "", ""
+	s.lastRun = run
+	s.lastCompaction[name] = start
+	if s.policy.QuietHours != nil {
+		if window := s.policy.QuietHours.windowStart(start); !window.IsZero() {
+			s.lastQuiet[name] = window
+		}
+	}
+}
+
+// SetCompactionRateLimit limits how many bytes per second a compaction reads and writes,
+// so it does not starve requests of disk bandwidth. Zero removes the limit. It applies from
+// the next compaction.
+func (e *Engine) SetCompactionRateLimit(bytesPerSecond int64) {
+	e.compactionRate.Store(max(bytesPerSecond, 0))
+}
+
+// CompactionRateLimit returns the bytes per second a compaction may read and write, 0 for no limit.
+func (e *Engine) CompactionRateLimit() int64 {
+	return e.compactionRate.Load()
+}
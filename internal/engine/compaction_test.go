@@ -0,0 +1,369 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_ParseSchedule(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":             0,
+		"@hourly":      time.Hour,
+		"@daily":       24 * time.Hour,
+		"@every 90m":   90 * time.Minute,
+		"15m":          15 * time.Minute,
+		"@every 1h30m": 90 * time.Minute,
+	}
+	for spec, expected := range cases {
+		schedule, err := engine.ParseSchedule(spec)
+		if err != nil || schedule.Every != expected {
+			t.Errorf("ParseSchedule(%q) = %v, %v; expected %v", spec, schedule.Every, err, expected)
+		}
+	}
+	for _, spec := range []string{"@yearly", "0 3 * * *", "@every -1h", "soon"} {
+		if _, err := engine.ParseSchedule(spec); err == nil {
+			t.Errorf("Expected ParseSchedule(%q) to fail", spec)
+		}
+	}
+}
+
+func Test_QuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	night, err := engine.ParseQuietHours("22:30-04:00")
+	if err != nil {
+		t.Fatalf("ParseQuietHours() failed: %v", err)
+	}
+	for _, c := range []struct {
+		t        time.Time
+		expected bool
+	}{
+		{at(22, 29), false}, {at(22, 30), true}, {at(23, 59), true}, {at(0, 0), true}, {at(3, 59), true}, {at(4, 0), false}, {at(12, 0), false},
+	} {
+		if got := night.Contains(c.t); got != c.expected {
+			t.Errorf("Contains(%s) = %v, expected %v", c.t.Format("15:04"), got, c.expected)
+		}
+	}
+	if night.String() != "22:30-04:00" {
+		t.Errorf("Expected 22:30-04:00, got %s", night.String())
+	}
+
+	for _, spec := range []string{"22:00", "25:00-01:00", "01:00-01:00"} {
+		if _, err := engine.ParseQuietHours(spec); err == nil {
+			t.Errorf("Expected ParseQuietHours(%q) to fail", spec)
+		}
+	}
+	if q, err := engine.ParseQuietHours(""); q != nil || err != nil {
+		t.Errorf("Expected empty quiet hours to be disabled, got %v, %v", q, err)
+	}
+}
+
+// setupFlushedNamespaces returns namespaces whose default engine has flushed data on disk
+func setupFlushedNamespaces(t *testing.T) (*engine.Namespaces, *engine.Engine) {
+	t.Helper()
+	db := setupEngine(t, 30)
+	for i := 0; i < 5; i++ {
+		_ = db.Set(fmt.Sprintf("key%d", i), "value")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for db.Stats().FlushFileBytes == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected keys to be flushed to disk")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return engine.NewNamespaces(db), db
+}
+
+func Test_SchedulerCompactsOnFileSize(t *testing.T) {
+	namespaces, db := setupFlushedNamespaces(t)
+	scheduler := engine.NewCompactionScheduler(namespaces, engine.CompactionPolicy{MaxFlushFileBytes: 1})
+
+	scheduler.Pause()
+	scheduler.Check()
+	if status := scheduler.Status(); !status.Paused || status.LastRun != nil {
+		t.Fatalf("Expected a paused scheduler not to compact, got %+v", status)
+	}
+
+	scheduler.Resume()
+	scheduler.Check()
+	status := scheduler.Status()
+	if status.LastRun == nil || status.LastRun.Trigger != engine.TriggerFileSize || status.LastRun.Namespace != engine.DefaultNamespace {
+		t.Fatalf("Expected a file size compaction of the default namespace, got %+v", status.LastRun)
+	}
+	if status.LastRun.Error != "" || status.Running != "" {
+		t.Errorf("Unexpected status after compaction: %+v", status)
+	}
+	if db.Stats().FlushFileBytes != 0 {
+		t.Error("Expected the flush file to be removed")
+	}
+	if db.CompactionProgress().Running {
+		t.Error("Expected no compaction to be reported running")
+	}
+}
+
+func Test_SchedulerTriggers(t *testing.T) {
+	now := time.Now()
+	clock := func(t time.Time) string { return t.Format("15:04") }
+	quiet, err := engine.ParseQuietHours(clock(now.Add(-time.Hour)) + "-" + clock(now.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("ParseQuietHours() failed: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		policy  engine.CompactionPolicy
+		checks  int
+		trigger string
+	}{
+		{"no triggers", engine.CompactionPolicy{}, 2, ""},
+		{"flushed ratio", engine.CompactionPolicy{MaxFlushedRatio: 0.01}, 1, engine.TriggerRatio},
+		{"schedule", engine.CompactionPolicy{Schedule: engine.Schedule{Every: time.Nanosecond}}, 2, engine.TriggerSchedule},
+		{"quiet hours", engine.CompactionPolicy{QuietHours: quiet}, 1, engine.TriggerQuietHours},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			namespaces, _ := setupFlushedNamespaces(t)
+			scheduler := engine.NewCompactionScheduler(namespaces, c.policy)
+			for i := 0; i < c.checks; i++ {
+				scheduler.Check()
+			}
+
+			lastRun := scheduler.Status().LastRun
+			if c.trigger == "" {
+				if lastRun != nil {
+					t.Errorf("Expected no compaction, got %+v", lastRun)
+				}
+				return
+			}
+			if lastRun == nil || lastRun.Trigger != c.trigger {
+				t.Errorf("Expected a %s compaction, got %+v", c.trigger, lastRun)
+			}
+		})
+	}
+}
+
+func Test_SchedulerCompactsOncePerQuietWindow(t *testing.T) {
+	now := time.Now()
+	clock := func(t time.Time) string { return t.Format("15:04") }
+	quiet, _ := engine.ParseQuietHours(clock(now.Add(-time.Hour)) + "-" + clock(now.Add(time.Hour)))
+
+	namespaces, db := setupFlushedNamespaces(t)
+	scheduler := engine.NewCompactionScheduler(namespaces, engine.CompactionPolicy{QuietHours: quiet})
+	scheduler.Check()
+	first := scheduler.Status().LastRun
+
+	// New flushed data in the same window does not compact again
+	for i := 0; i < 5; i++ {
+		_ = db.Set(fmt.Sprintf("other%d", i), "value")
+	}
+	scheduler.Check()
+	if second := scheduler.Status().LastRun; first == nil || second.Started != first.Started {
+		t.Errorf("Expected a single compaction in the window, got %+v then %+v", first, second)
+	}
+}
+
+// reopen shuts db down and loads its files into a new engine
+func reopen(t *testing.T, db *engine.Engine) *engine.Engine {
+	t.Helper()
+	db.Shutdown()
+	db2, err := engine.NewEngine(testFilePath, testFlushPath, 1<<20)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	t.Cleanup(db2.Shutdown)
+	return db2
+}
+
+// Run with -race: writers, readers and evictions continue while compactions run back to back
+func Test_CompactionDuringConcurrentWrites(t *testing.T) {
+	db := setupEngine(t, 2048)
+	const writers, keysPerWriter = 4, 50
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	final := make([]map[string]string, writers) // Last value written to each key, by writer
+	for w := 0; w < writers; w++ {
+		final[w] = make(map[string]string)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for round := 0; ; round++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("w%d-key%02d", w, round%keysPerWriter)
+				value := fmt.Sprintf("round%d-%s", round, strings.Repeat("x", round%7))
+				if w == 0 {
+					// One writer stores hashes, so typed values are merged too
+					if _, err := db.HSet(key, map[string]string{"round": value}); err != nil {
+						t.Errorf("HSet() failed: %v", err)
+						return
+					}
+				} else if err := db.Set(key, value); err != nil {
+					t.Errorf("Set() failed: %v", err)
+					return
+				}
+				final[w][key] = value
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = db.Get("w1-key00")
+			_ = db.KeyCount()
+			_ = db.Snapshot(3)
+		}
+	}()
+
+	compactions := 0
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); compactions++ {
+		if err := db.CompactFlushedData(); err != nil {
+			t.Fatalf("Compaction failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if compactions < 2 || db.Stats().Evictions == 0 {
+		t.Fatalf("Expected several compactions with evictions, got %d compactions and %d evictions", compactions, db.Stats().Evictions)
+	}
+
+	db2 := reopen(t, db)
+	for w, values := range final {
+		for key, expected := range values {
+			var got string
+			var err error
+			if w == 0 {
+				got, err = db2.HGet(key, "round")
+			} else {
+				got, err = db2.Get(key)
+			}
+			if err != nil || got != expected {
+				t.Errorf("Expected %s = %q after compactions, got %q, %v", key, expected, got, err)
+			}
+		}
+	}
+}
+
+func Test_CompactionMergesUnsortedFlushFiles(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+
+	// Flush files written before runs were sorted: every line starts a new run and later
+	// lines win, which takes several merge passes
+	var lines []string
+	for i := 99; i >= 0; i-- {
+		lines = append(lines, fmt.Sprintf("key%02d old", i))
+	}
+	for i := 99; i >= 0; i -= 2 {
+		lines = append(lines, fmt.Sprintf("key%02d new value", i))
+	}
+	if err := os.WriteFile(testFlushPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	typed := `{"key":"hash","type":"hash","hash":{"f":"old"}}` + "\n" + `{"key":"hash","type":"hash","hash":{"f":"new"}}` + "\n"
+	if err := os.WriteFile(testFlushPath+".types", []byte(typed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	stats := db.Stats()
+	if stats.FlushFileBytes != 0 || stats.CompactedFileBytes == 0 {
+		t.Fatalf("Expected the flush files to be compacted, got %+v", stats)
+	}
+
+	db2 := reopen(t, db)
+	for i := 0; i < 100; i++ {
+		expected := "old"
+		if i%2 == 1 {
+			expected = "new value"
+		}
+		key := fmt.Sprintf("key%02d", i)
+		if value, err := db2.Get(key); err != nil || value != expected {
+			t.Errorf("Expected %s = %q, got %q, %v", key, expected, value, err)
+		}
+	}
+	if value, err := db2.HGet("hash", "f"); err != nil || value != "new" {
+		t.Errorf("Expected the latest hash, got %q, %v", value, err)
+	}
+}
+
+func Test_CompactionDropsKeysBackInMemory(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+	if err := os.WriteFile(testFlushPath, []byte("a stale\nb cold\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Set("a", "fresh")
+
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	_ = db.Delete("a")
+
+	db2 := reopen(t, db)
+	if value, err := db2.Get("a"); err == nil {
+		t.Errorf("Expected the stale flushed value of a deleted key to be dropped, got %q", value)
+	}
+	if value, err := db2.Get("b"); err != nil || value != "cold" {
+		t.Errorf("Expected the flushed key to be kept, got %q, %v", value, err)
+	}
+}
+
+func Test_CompactionRateLimit(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+	var flushed strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&flushed, "key%03d %s\n", i, strings.Repeat("v", 100))
+	}
+	if err := os.WriteFile(testFlushPath, []byte(flushed.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// At 1 KB/s the compaction cannot finish before the deadline
+	db.SetCompactionRateLimit(1024)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- db.CompactFlushedDataContext(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for progress := db.CompactionProgress(); progress.BytesRead == 0; progress = db.CompactionProgress() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the compaction to report the bytes it read")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the throttled compaction to stop at the deadline, got %v", err)
+	}
+
+	// The interrupted compaction left every record on disk and the next one finishes it
+	db.SetCompactionRateLimit(0)
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	db2 := reopen(t, db)
+	if count := db2.KeyCount(); count != 200 {
+		t.Errorf("Expected 200 keys after compaction, got %d", count)
+	}
+}
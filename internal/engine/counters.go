@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrNotNumeric is returned when a counter operation is used against a value that cannot be parsed as a number.
+var ErrNotNumeric = errors.New("value is not a number")
+
+// ErrOverflow is returned when incrementing a counter would overflow an int64.
+var ErrOverflow = errors.New("increment would overflow")
+
+// IncrOp describes a single increment applied by IncrBatch.
+// Float selects floating point arithmetic, using FloatDelta instead of Delta.
+type IncrOp struct {
+	Key        string
+	Delta      int64
+	FloatDelta float64
+	Float      bool
+}
+
+// Incr adds delta to the integer stored at key and returns the new value.
+// A missing key is treated as zero. The resulting value is stored as a plain string,
+// so persisted data always holds the outcome of the increment rather than the delta.
+func (e *Engine) Incr(key string, delta int64) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	current, err := e.counterValue(key)
+	if err != nil {
+		return 0, err
+	}
+	next, err := addInt(key, current, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	e.setLocked(key, strconv.FormatInt(next, 10))
+	e.triggerWrite()
+	return next, nil
+}
+
+// Decr subtracts delta from the integer stored at key and returns the new value.
+func (e *Engine) Decr(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, fmt.Errorf("key %q: %w", key, ErrOverflow)
+	}
+	return e.Incr(key, -delta)
+}
+
+// IncrFloat adds delta to the number stored at key and returns the new value.
+// A missing key is treated as zero.
+func (e *Engine) IncrFloat(key string, delta float64) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	current, err := e.floatCounterValue(key)
+	if err != nil {
+		return 0, err
+	}
+	next, err := addFloat(key, current, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	e.setLocked(key, formatFloat(next))
+	e.triggerWrite()
+	return next, nil
+}
+
+// IncrBatch applies the increments atomically and returns the resulting values in order.
+// If any increment fails no value is changed.
+func (e *Engine) IncrBatch(ops []IncrOp) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Compute every result before applying, so a failure leaves the store untouched
+	pending := make(map[string]string, len(ops))
+	results := make([]string, 0, len(ops))
+	for _, op := range ops {
+		current, seen := pending[op.Key]
+		if !seen {
+			var err error
+			if current, err = e.counterRaw(op.Key); err != nil {
+				return nil, err
+			}
+		}
+
+		var next string
+		if op.Float {
+			value, err := parseFloatCounter(op.Key, current)
+			if err != nil {
+				return nil, err
+			}
+			sum, err := addFloat(op.Key, value, op.FloatDelta)
+			if err != nil {
+				return nil, err
+			}
+			next = formatFloat(sum)
+		} else {
+			value, err := parseIntCounter(op.Key, current)
+			if err != nil {
+				return nil, err
+			}
+			sum, err := addInt(op.Key, value, op.Delta)
+			if err != nil {
+				return nil, err
+			}
+			next = strconv.FormatInt(sum, 10)
+		}
+
+		pending[op.Key] = next
+		results = append(results, next)
+	}
+
+	// Keys are applied in request order, which is their order in the eviction queue
+	for _, op := range ops {
+		if value, ok := pending[op.Key]; ok {
+			e.setLocked(op.Key, value)
+			delete(pending, op.Key)
+		}
+	}
+	if len(results) > 0 {
+		e.triggerWrite()
+	}
+	return results, nil
+}
+
+// counterValue returns the integer stored at key, or zero when the key is missing.
+// It must be called with e.mu held.
+func (e *Engine) counterValue(key string) (int64, error) {
+	raw, err := e.counterRaw(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseIntCounter(key, raw)
+}
+
+// floatCounterValue returns the number stored at key, or zero when the key is missing.
+// It must be called with e.mu held.
+func (e *Engine) floatCounterValue(key string) (float64, error) {
+	raw, err := e.counterRaw(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseFloatCounter(key, raw)
+}
+
+// counterRaw returns the string a counter at key starts from. Values stored in chunk files are
+// larger than any number, so they are not numeric, and missing keys must be allowed by the
+// limits. It must be called with e.mu held.
+func (e *Engine) counterRaw(key string) (string, error) {
+	if _, isTyped := e.typed[key]; isTyped {
+		return "", fmt.Errorf("key %q: %w", key, ErrWrongType)
+	}
+	if e.meta[key].Blob != nil {
+		return "", fmt.Errorf("key %q: %w", key, ErrNotNumeric)
+	}
+	raw, exists := e.data[key]
+	if !exists {
+		// The counter creates the key
+		if err := e.Limits().CheckKey(key); err != nil {
+			return "", err
+		}
+	}
+	return raw, nil
+}
+
+// setLocked stores a string value without metadata and updates memory accounting.
+// The key must not hold a typed value or a blob. It must be called with e.mu held.
+func (e *Engine) setLocked(key, value string) {
+	if oldVal, exists := e.data[key]; exists {
+		// Like Set, the content type and tags of the old value are dropped
+		e.currentMemoryUsage -= len(key) + len(oldVal) + e.meta[key].size()
+		delete(e.meta, key)
+	} else {
+		e.evictionQueue = append(e.evictionQueue, key)
+	}
+	e.data[key] = value
+	e.currentMemoryUsage += len(key) + len(value)
+	e.touch(key)
+	e.account(key)
+}
+
+func parseIntCounter(key, raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("key %q: %w", key, ErrNotNumeric)
+	}
+	return value, nil
+}
+
+func parseFloatCounter(key, raw string) (float64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("key %q: %w", key, ErrNotNumeric)
+	}
+	return value, nil
+}
+
+func addInt(key string, current, delta int64) (int64, error) {
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, fmt.Errorf("key %q: %w", key, ErrOverflow)
+	}
+	return current + delta, nil
+}
+
+func addFloat(key string, current, delta float64) (float64, error) {
+	next := current + delta
+	if math.IsNaN(next) || math.IsInf(next, 0) {
+		return 0, fmt.Errorf("key %q: %w", key, ErrOverflow)
+	}
+	return next, nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,144 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_IncrCreatesMissingKey(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	value, err := db.Incr("visits", 5)
+	if err != nil || value != 5 {
+		t.Fatalf("Incr() = %d, %v; expected 5", value, err)
+	}
+
+	value, _ = db.Decr("visits", 2)
+	if value != 3 {
+		t.Errorf("Decr() = %d, expected 3", value)
+	}
+
+	stored, _ := db.Get("visits")
+	if stored != "3" {
+		t.Errorf("Expected stored value '3', got '%s'", stored)
+	}
+}
+
+func Test_IncrFloat(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_ = db.Set("ratio", "1.5")
+	value, err := db.IncrFloat("ratio", 0.25)
+	if err != nil || value != 1.75 {
+		t.Fatalf("IncrFloat() = %f, %v; expected 1.75", value, err)
+	}
+}
+
+func Test_IncrRejectsInvalidValues(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_ = db.Set("name", "Alice")
+	if _, err := db.Incr("name", 1); !errors.Is(err, engine.ErrNotNumeric) {
+		t.Errorf("Expected ErrNotNumeric, got %v", err)
+	}
+
+	_ = db.Set("big", "9223372036854775807")
+	if _, err := db.Incr("big", 1); !errors.Is(err, engine.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if _, err := db.Decr("big", math.MinInt64); !errors.Is(err, engine.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow for Decr by MinInt64, got %v", err)
+	}
+
+	_, _ = db.SAdd("set", "a")
+	if _, err := db.Incr("set", 1); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func Test_IncrBatchIsAllOrNothing(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_ = db.Set("text", "abc")
+	_, err := db.IncrBatch([]engine.IncrOp{
+		{Key: "a", Delta: 1},
+		{Key: "text", Delta: 1},
+	})
+	if err == nil {
+		t.Fatal("Expected IncrBatch to fail on a non-numeric value")
+	}
+	if _, err := db.Get("a"); err == nil {
+		t.Error("No key should be changed when a batch fails")
+	}
+
+	results, err := db.IncrBatch([]engine.IncrOp{
+		{Key: "a", Delta: 2},
+		{Key: "a", Delta: 3},
+		{Key: "f", Float: true, FloatDelta: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("IncrBatch() failed: %v", err)
+	}
+	if results[0] != "2" || results[1] != "5" || results[2] != "0.5" {
+		t.Errorf("IncrBatch() returned %v", results)
+	}
+
+	// New keys join the eviction queue in request order
+	if _, err := db.IncrBatch([]engine.IncrOp{{Key: "k3", Delta: 1}, {Key: "k1", Delta: 1}, {Key: "k2", Delta: 1}, {Key: "k1", Delta: 1}}); err != nil {
+		t.Fatalf("IncrBatch() failed: %v", err)
+	}
+	var order []string
+	for _, pair := range db.GetSlice(10, 1) {
+		order = append(order, pair.Key)
+	}
+	if got := strings.Join(order, " "); got != "text a f k3 k1 k2" {
+		t.Errorf("Expected keys in request order, got %q", got)
+	}
+}
+
+func Test_IncrDropsMetadata(t *testing.T) {
+	db := setupEngine(t, 1024)
+	ctx := context.Background()
+
+	meta := engine.Metadata{ContentType: "image/png", Tags: map[string]string{"env": "prod"}}
+	if err := db.SetValue(ctx, "n", []byte("1"), meta); err != nil {
+		t.Fatalf("SetValue() failed: %v", err)
+	}
+	if _, err := db.Incr("n", 1); err != nil {
+		t.Fatalf("Incr() failed: %v", err)
+	}
+	value, stored, err := db.GetValue(ctx, "n")
+	if err != nil || string(value) != "2" || !stored.IsZero() {
+		t.Errorf("Expected 2 without metadata, got %q, %+v, %v", value, stored, err)
+	}
+	if db.MemoryUsage() != len("n")+len("2") {
+		t.Errorf("Expected the metadata to be released, memory usage is %d", db.MemoryUsage())
+	}
+}
+
+func Test_ConcurrentIncrDoesNotLoseUpdates(t *testing.T) {
+	db := setupEngine(t, 1024*1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, _ = db.Incr("counter", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, _ := db.Get("counter")
+	if value != "1000" {
+		t.Errorf("Expected counter to be 1000, got %s", value)
+	}
+}
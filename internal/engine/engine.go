@@ -2,14 +2,18 @@ package engine
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bendigiorgio/go-kv/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
@@ -17,16 +21,33 @@ const keyValueSeparator = " "
 
 type Engine struct {
 	data               map[string]string
-	evictionQueue      []string // Keeps track of insertion order
+	meta               map[string]Metadata    // Metadata of the string values that have any
+	typed              map[string]*typedValue // Hashes, lists, sets and sorted sets
+	evictionQueue      []string               // Keeps track of insertion order
+	evictionPolicy     EvictionPolicy
+	accessMu           sync.Mutex        // Guards lastUsed, which reads update under e.mu.RLock
+	lastUsed           map[string]uint64 // Access clock per key, only tracked for EvictionLRU
+	accessClock        uint64
 	filePath           string
 	flushPath          string
 	memoryLimit        int
 	currentMemoryUsage int
 	mu                 sync.RWMutex
 	fileMu             sync.Mutex
+	saveMu             sync.Mutex // Orders saves, so an older snapshot never replaces a newer one
 	saveChan           chan struct{}
 	flushChan          chan struct{}
 	shutdownChan       chan struct{} // For graceful shutdown
+	shutdownOnce       sync.Once
+	readOnly           bool // Set when shutting down, writes then fail with ErrReadOnly
+	workers            sync.WaitGroup
+	counters           engineCounters
+	health             engineHealth
+	compaction         compactionState
+	compactionRate     atomic.Int64 // Bytes per second a compaction may read and write, 0 for no limit
+	blobs              *blobStore   // Chunk files of the values larger than the blob threshold
+	owners             ownerIndex   // Owners of the keys, for quotas
+	limits             atomic.Pointer[Limits]
 }
 
 type EngineConfig struct {
@@ -60,13 +81,18 @@ func NewEngine(filePath, flushPath string, memoryLimit int) (*Engine, error) {
 	}
 
 	e := &Engine{
-		data:         make(map[string]string),
-		filePath:     filePath,
-		flushPath:    flushPath,
-		memoryLimit:  memoryLimit,
-		saveChan:     make(chan struct{}, 1),
-		flushChan:    make(chan struct{}, 1),
-		shutdownChan: make(chan struct{}),
+		data:           make(map[string]string),
+		meta:           make(map[string]Metadata),
+		typed:          make(map[string]*typedValue),
+		evictionPolicy: EvictionFIFO,
+		lastUsed:       make(map[string]uint64),
+		filePath:       filePath,
+		flushPath:      flushPath,
+		memoryLimit:    memoryLimit,
+		saveChan:       make(chan struct{}, 1),
+		flushChan:      make(chan struct{}, 1),
+		shutdownChan:   make(chan struct{}),
+		blobs:          newBlobStore(filePath + blobDirSuffix),
 	}
 
 	if err := e.Load(); err != nil {
@@ -74,85 +100,232 @@ func NewEngine(filePath, flushPath string, memoryLimit int) (*Engine, error) {
 	}
 
 	// Start background workers
+	e.workers.Add(backgroundWorkers)
+	e.health.workers.Add(backgroundWorkers)
 	go e.autoSaveWorker()
 	go e.autoFlushWorker()
 
 	return e, nil
 }
 
-// Shutdown gracefully stops the background workers.
+// Shutdown gracefully stops the background workers, waits for in-flight saves and
+// evictions to finish, then saves the in-memory data synchronously. Later calls do nothing.
 func (e *Engine) Shutdown() {
-	close(e.shutdownChan)
+	e.Close()
+}
+
+// Close is Shutdown, returning the error of the final save. Later calls return nil.
+func (e *Engine) Close() error {
+	var err error
+	e.shutdownOnce.Do(func() {
+		e.mu.Lock()
+		e.readOnly = true
+		e.mu.Unlock()
+
+		close(e.shutdownChan)
+		e.workers.Wait()
+
+		if err = e.Save(); err != nil {
+			log.Error().Stack().Err(err).Str("file", e.filePath).Msg("Final save failed")
+			return
+		}
+		log.Info().Str("file", e.filePath).Msg("Final save complete")
+	})
+	return err
 }
 
 // Set adds or updates a key-value pair and triggers async saving or flushing.
 func (e *Engine) Set(key, value string) error {
-	e.mu.Lock()
+	return e.SetContext(context.Background(), key, value)
+}
+
+// SetContext is Set, traced as a child of the span in ctx.
+func (e *Engine) SetContext(ctx context.Context, key, value string) error {
+	return e.setValue(ctx, key, value, Metadata{})
+}
+
+// SetValue stores value under key with its metadata, replacing the value and metadata the key
+// had. value is copied, so the caller may reuse it. It is kept in memory whatever its size; use
+// SetStream for values that may be larger than the blob threshold.
+func (e *Engine) SetValue(ctx context.Context, key string, value []byte, meta Metadata) error {
+	meta = meta.clone()
+	meta.Blob = nil
+	return e.setValue(ctx, key, string(value), meta)
+}
+
+func (e *Engine) setValue(ctx context.Context, key, value string, meta Metadata) error {
+	ctx, span := e.startSpan(ctx, "engine.Set")
+	defer span.End()
+	span.SetAttribute("value_bytes", len(value))
+
+	e.lock(ctx)
 	defer e.mu.Unlock()
 
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	limits := e.Limits()
+	if err := limits.CheckKey(key); err != nil {
+		return err
+	}
+	size := int64(len(value))
+	if meta.Blob != nil {
+		size = meta.Blob.Size
+	}
+	if err := limits.CheckValue(size); err != nil {
+		return err
+	}
+	if len(key)+len(value)+meta.size() > e.memoryLimit {
+		return ErrMemoryLimit
+	}
+
 	oldSize := 0
 	if oldVal, exists := e.data[key]; exists {
-		oldSize = len(oldVal) + len(key)
+		oldSize = len(oldVal) + len(key) + e.meta[key].size()
+	} else if oldTyped, exists := e.typed[key]; exists {
+		// Setting a string replaces a typed value stored under the same key
+		oldSize = oldTyped.size() + len(key)
+		delete(e.typed, key)
 	} else {
 		e.evictionQueue = append(e.evictionQueue, key) // Track insertion order
 	}
 
-	newSize := len(value) + len(key)
+	newSize := len(value) + len(key) + meta.size()
 	e.currentMemoryUsage = e.currentMemoryUsage - oldSize + newSize
 	e.data[key] = value
+	if meta.IsZero() {
+		delete(e.meta, key)
+	} else {
+		e.meta[key] = meta
+	}
+	e.touch(key)
+	e.account(key)
 
-	// If memory exceeds limit, trigger flush
+	e.triggerWrite()
+	return nil
+}
+
+// triggerWrite triggers a flush when memory exceeds the limit, otherwise an async save.
+// It must be called with e.mu held.
+func (e *Engine) triggerWrite() {
 	if e.currentMemoryUsage >= e.memoryLimit {
 		select {
 		case e.flushChan <- struct{}{}:
 		default:
 		}
-	} else {
-		// Otherwise, trigger async save
-		select {
-		case e.saveChan <- struct{}{}:
-		default:
-		}
+		return
 	}
+	e.triggerSave()
+}
 
-	return nil
+// triggerSave triggers an async save.
+func (e *Engine) triggerSave() {
+	select {
+	case e.saveChan <- struct{}{}:
+	default:
+	}
 }
 
 // Get retrieves a value by key.
 func (e *Engine) Get(key string) (string, error) {
-	e.mu.RLock()
+	return e.GetContext(context.Background(), key)
+}
+
+// GetContext is Get, traced as a child of the span in ctx.
+func (e *Engine) GetContext(ctx context.Context, key string) (string, error) {
+	value, meta, release, err := e.lookup(ctx, key)
+	if err != nil || meta.Blob == nil {
+		return value, err
+	}
+	defer release()
+	blob, err := e.blobs.readAll(meta.Blob)
+	return string(blob), err
+}
+
+// GetValue returns the value of key as bytes, with its metadata.
+func (e *Engine) GetValue(ctx context.Context, key string) ([]byte, Metadata, error) {
+	value, meta, release, err := e.lookup(ctx, key)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	if meta.Blob == nil {
+		return []byte(value), meta, nil
+	}
+	defer release()
+	blob, err := e.blobs.readAll(meta.Blob)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return blob, meta, nil
+}
+
+// lookup returns the value of key as it is held in memory, with a copy of its metadata.
+// Values stored in chunk files are read by the caller, outside the lock: their chunks are held
+// until the caller calls release, so a compaction does not remove them meanwhile.
+func (e *Engine) lookup(ctx context.Context, key string) (value string, meta Metadata, release func(), err error) {
+	ctx, span := e.startSpan(ctx, "engine.Get")
+	defer span.End()
+
+	e.rlock(ctx)
 	defer e.mu.RUnlock()
 
 	value, ok := e.data[key]
 	if !ok {
-		return "", errors.New("key not found")
+		if _, isTyped := e.typed[key]; isTyped {
+			return "", Metadata{}, nil, ErrWrongType
+		}
+		return "", Metadata{}, nil, ErrNotFound
+	}
+	e.touch(key)
+	meta = e.meta[key].clone()
+	release = func() {}
+	if meta.Blob != nil {
+		release = e.blobs.hold(meta.Blob.Chunks)
 	}
-	return value, nil
+	return value, meta, release, nil
 }
 
 // Delete removes a key-value pair and triggers async saving.
 func (e *Engine) Delete(key string) error {
-	e.mu.Lock()
+	return e.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is Delete, traced as a child of the span in ctx.
+func (e *Engine) DeleteContext(ctx context.Context, key string) error {
+	ctx, span := e.startSpan(ctx, "engine.Delete")
+	defer span.End()
+
+	e.lock(ctx)
 	defer e.mu.Unlock()
 
+	if e.readOnly {
+		return ErrReadOnly
+	}
+
 	if value, exists := e.data[key]; exists {
-		e.currentMemoryUsage -= len(key) + len(value)
+		e.currentMemoryUsage -= len(key) + len(value) + e.meta[key].size()
 		delete(e.data, key)
+		delete(e.meta, key)
 
 		// Remove from eviction queue
 		e.removeFromEvictionQueue(key)
+		e.account(key)
 
-		// Trigger async save
-		select {
-		case e.saveChan <- struct{}{}:
-		default:
-		}
+		e.triggerSave()
+	} else if v, exists := e.typed[key]; exists {
+		e.currentMemoryUsage -= len(key) + v.size()
+		delete(e.typed, key)
+		e.removeFromEvictionQueue(key)
+		e.account(key)
+
+		e.triggerSave()
 	}
 	return nil
 }
 
 // removeFromEvictionQueue removes a key from the eviction tracking queue.
 func (e *Engine) removeFromEvictionQueue(key string) {
+	e.forget(key)
 	for i, k := range e.evictionQueue {
 		if k == key {
 			e.evictionQueue = append(e.evictionQueue[:i], e.evictionQueue[i+1:]...)
@@ -161,263 +334,508 @@ func (e *Engine) removeFromEvictionQueue(key string) {
 	}
 }
 
-// Flush clears in-memory data and persists the change.
-func (e *Engine) Flush() {
+// Flush deletes every key, in memory and in the data, flush and compacted files, so none comes
+// back on the next load, and the blob chunks of their values. It waits for a running compaction
+// to finish.
+func (e *Engine) Flush() error {
+	// A compaction would write the flushed keys back to the compacted files, and a save in
+	// progress would write the data file back
+	e.compaction.running.Lock()
+	defer e.compaction.running.Unlock()
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	e.data = make(map[string]string)
+	e.meta = make(map[string]Metadata)
+	e.typed = make(map[string]*typedValue)
 	e.evictionQueue = []string{}
 	e.currentMemoryUsage = 0
+	claims := e.owners.claims // Writes in progress still give their keys an owner
+	e.owners = newOwnerIndex()
+	e.owners.claims = claims
+	e.accessMu.Lock()
+	e.lastUsed = make(map[string]uint64)
+	e.accessMu.Unlock()
 
-	// Trigger async save
-	select {
-	case e.saveChan <- struct{}{}:
-	default:
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+	for _, path := range []string{e.filePath, e.flushPath, e.flushPath + compactingFileSuffix, e.flushPath + compactedFileSuffix} {
+		for _, suffix := range []string{"", typedFileSuffix} {
+			if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", path+suffix, err)
+			}
+		}
+	}
+	if err := os.Remove(e.filePath + ownersFileSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", e.filePath+ownersFileSuffix, err)
+	}
+	// Nothing refers to the chunks anymore, but values being written or read hold theirs
+	if _, err := e.blobs.collect(nil); err != nil {
+		return fmt.Errorf("failed to remove blob chunks: %w", err)
 	}
+	return nil
+}
+
+// SaveFile writes only the latest data to disk, avoiding duplicate keys. Keys are written in
+// order, so compaction can merge the file with the flushed data without loading it.
+// The file is replaced atomically, so readers see either the old or the new data.
+func (e *Engine) SaveFile(data map[string]string, meta map[string]Metadata) error {
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+
+	return replaceFile(e.filePath, func(writer *bufio.Writer) error {
+		if err := writeRecords(writer, data, meta); err != nil {
+			return fmt.Errorf("failed to write data: %w", err)
+		}
+		return nil
+	})
 }
 
-// SaveFile writes only the latest data to disk, avoiding duplicate keys.
-func (e *Engine) SaveFile(data map[string]string) error {
+// saveTypedData writes the typed values to the typed data file, replacing its contents.
+func (e *Engine) saveTypedData(data map[string]*typedValue) error {
 	e.fileMu.Lock()
 	defer e.fileMu.Unlock()
+	return replaceFile(e.filePath+typedFileSuffix, func(writer *bufio.Writer) error {
+		return writeTypedRecords(writer, data)
+	})
+}
 
-	file, err := os.OpenFile(e.filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_SYNC, 0644)
+// replaceFile writes a temporary file next to path with write and renames it over path.
+func replaceFile(path string, write func(*bufio.Writer) error) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_SYNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
 
 	writer := bufio.NewWriterSize(file, 64*1024) // 64 KB buffer
-	for key, value := range data {
-		if _, err := writer.WriteString(key + keyValueSeparator + value + "\n"); err != nil {
-			return fmt.Errorf("failed to write data: %w", err)
-		}
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
 	}
-	return writer.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of data in ascending order.
+func sortedKeys[V any](data map[string]V) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // autoSaveWorker periodically saves data when triggered.
 func (e *Engine) autoSaveWorker() {
+	defer e.workers.Done()
+	defer e.health.workers.Add(-1)
 	for {
 		select {
 		case <-e.saveChan:
-			time.Sleep(1 * time.Second) // Debounce multiple save requests
-
-			e.mu.RLock()
-			dataCopy := make(map[string]string, len(e.data))
-			for k, v := range e.data {
-				dataCopy[k] = v
-			}
-			e.mu.RUnlock()
-
-			if err := e.SaveFile(dataCopy); err != nil {
-				log.Error().Stack().Err(err).Msg("Error saving data")
+			// Debounce multiple save requests. Shutdown saves anything still pending.
+			select {
+			case <-time.After(1 * time.Second):
+			case <-e.shutdownChan:
+				return
 			}
+			e.autoSave()
 		case <-e.shutdownChan:
 			return
 		}
 	}
 }
 
-// AppendFlushedData appends flushed data to the flush file.
-func (e *Engine) AppendFlushedData(data map[string]string) error {
-	e.fileMu.Lock()
-	defer e.fileMu.Unlock()
+// autoSave saves a snapshot of the in-memory data without blocking writers during the file write.
+func (e *Engine) autoSave() {
+	ctx, span := tracing.Start(context.Background(), "engine.save")
+	defer span.End()
+	span.SetAttribute("trigger", "auto")
+
+	keys, err := e.saveSnapshot(ctx)
+	span.SetAttribute("keys", keys)
+	span.RecordError(err)
+}
 
-	file, err := os.OpenFile(e.flushPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_SYNC, 0644)
+// saveSnapshot copies the in-memory data under a read lock and writes the copy to disk.
+// It returns the number of keys saved.
+func (e *Engine) saveSnapshot(ctx context.Context) (int, error) {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+
+	e.rlock(ctx)
+	dataCopy := make(map[string]string, len(e.data))
+	for k, v := range e.data {
+		dataCopy[k] = v
+	}
+	metaCopy := make(map[string]Metadata, len(e.meta))
+	for k, m := range e.meta {
+		metaCopy[k] = m // Metadata is replaced, never modified in place
+	}
+	typedCopy := e.copyTyped()
+	ownersCopy := e.copyOwners()
+	e.mu.RUnlock()
+
+	start := time.Now()
+	err := e.SaveFile(dataCopy, metaCopy)
 	if err != nil {
-		return fmt.Errorf("failed to open flush file: %w", err)
+		log.Error().Stack().Err(err).Msg("Error saving data")
+	}
+	if typedErr := e.saveTypedData(typedCopy); typedErr != nil {
+		log.Error().Stack().Err(typedErr).Msg("Error saving typed data")
+		err = typedErr
+	}
+	if ownersErr := e.saveOwners(ownersCopy); ownersErr != nil {
+		log.Error().Stack().Err(ownersErr).Msg("Error saving key owners")
+		err = ownersErr
 	}
-	defer file.Close()
+	e.recordSave(start, err)
+	return len(dataCopy) + len(typedCopy), err
+}
 
-	writer := bufio.NewWriterSize(file, 64*1024) // 64 KB buffer
-	for key, value := range data {
-		if _, err := writer.WriteString(key + keyValueSeparator + value + "\n"); err != nil {
+// AppendFlushedData appends flushed data to the flush file as a run sorted by key.
+func (e *Engine) AppendFlushedData(data map[string]string, meta map[string]Metadata) error {
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+	return e.appendFlushed(data, meta, nil)
+}
+
+// appendFlushed appends flushed strings to the flush file and typed values to the typed flush
+// file. e.fileMu must be held.
+func (e *Engine) appendFlushed(data map[string]string, meta map[string]Metadata, typed map[string]*typedValue) error {
+	if len(data) > 0 {
+		file, err := os.OpenFile(e.flushPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_SYNC, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open flush file: %w", err)
+		}
+		defer file.Close()
+
+		writer := bufio.NewWriterSize(file, 64*1024) // 64 KB buffer
+		if err := writeRecords(writer, data, meta); err != nil {
+			return fmt.Errorf("failed to write flushed data: %w", err)
+		}
+		if err := writer.Flush(); err != nil {
 			return fmt.Errorf("failed to write flushed data: %w", err)
 		}
 	}
-	return writer.Flush()
+	if len(typed) > 0 {
+		if err := writeTypedFile(e.flushPath+typedFileSuffix, typed, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_SYNC); err != nil {
+			return fmt.Errorf("failed to write flushed typed data: %w", err)
+		}
+	}
+	return nil
 }
 
 // autoFlushWorker removes just enough old data when memory usage exceeds the limit.
 func (e *Engine) autoFlushWorker() {
+	defer e.workers.Done()
+	defer e.health.workers.Add(-1)
 	for {
 		select {
 		case <-e.flushChan:
-			e.mu.Lock()
-
-			if e.currentMemoryUsage < e.memoryLimit {
-				e.mu.Unlock()
-				continue
-			}
+			e.evict()
+		case <-e.shutdownChan:
+			return
+		}
+	}
+}
 
-			bytesToFree := e.currentMemoryUsage - e.memoryLimit
-			evictedData := make(map[string]string)
-			freedBytes := 0
+// evict moves keys chosen by the eviction policy to the flushed tier until memory is back under the limit.
+func (e *Engine) evict() {
+	ctx, span := tracing.Start(context.Background(), "engine.flush")
+	defer span.End()
 
-			log.Info().Msgf("Memory limit exceeded! Flushing oldest keys to flushed.db... currentMemoryUsage: %d, memoryLimit: %d\n", e.currentMemoryUsage, e.memoryLimit)
+	e.lock(ctx)
 
-			for len(e.evictionQueue) > 0 && freedBytes < bytesToFree {
-				key := e.evictionQueue[0] // Remove oldest key first
-				e.evictionQueue = e.evictionQueue[1:]
+	if e.currentMemoryUsage < e.memoryLimit {
+		e.mu.Unlock()
+		return
+	}
 
-				if val, exists := e.data[key]; exists {
-					evictedData[key] = val
-					freedBytes += len(key) + len(val)
-					delete(e.data, key)
+	bytesToFree := e.currentMemoryUsage - e.memoryLimit
+	evictedData := make(map[string]string)
+	evictedMeta := make(map[string]Metadata)
+	evictedTyped := make(map[string]*typedValue)
+	var evictedChunks []string
+	freedBytes := 0
+
+	log.Info().Msgf("Memory limit exceeded! Flushing %s keys to flushed.db... currentMemoryUsage: %d, memoryLimit: %d\n", e.evictionPolicy, e.currentMemoryUsage, e.memoryLimit)
+
+	e.orderEvictionQueue()
+	for len(e.evictionQueue) > 0 && freedBytes < bytesToFree {
+		key := e.evictionQueue[0] // Remove the first key chosen by the eviction policy
+		e.evictionQueue = e.evictionQueue[1:]
+		e.forget(key)
+
+		if val, exists := e.data[key]; exists {
+			evictedData[key] = val
+			freedBytes += len(key) + len(val)
+			if meta, ok := e.meta[key]; ok {
+				evictedMeta[key] = meta
+				freedBytes += meta.size()
+				delete(e.meta, key)
+				if meta.Blob != nil {
+					evictedChunks = append(evictedChunks, meta.Blob.Chunks...)
 				}
 			}
+			delete(e.data, key)
+		} else if v, exists := e.typed[key]; exists {
+			evictedTyped[key] = v
+			freedBytes += len(key) + v.size()
+			delete(e.typed, key)
+		}
+	}
 
-			e.currentMemoryUsage -= freedBytes
-			e.mu.Unlock()
+	e.currentMemoryUsage -= freedBytes
+	// Chunks moving to the flush file are in neither place until it is written
+	release := e.blobs.hold(evictedChunks)
+	defer release()
+	// Neither are the keys, so the flush file is locked before they leave memory: a flush or an
+	// export that no longer finds them in memory waits until they are in the file
+	e.fileMu.Lock()
+	e.mu.Unlock()
+	e.recordEviction(len(evictedData)+len(evictedTyped), freedBytes)
+	span.SetAttribute("keys", len(evictedData)+len(evictedTyped))
+	span.SetAttribute("bytes", freedBytes)
 
-			log.Info().Msgf("Flushed keys: %d, Freed bytes: %d\n", len(evictedData), freedBytes)
+	log.Info().Msgf("Flushed keys: %d, Freed bytes: %d\n", len(evictedData)+len(evictedTyped), freedBytes)
 
-			// Save flushed data separately
-			if len(evictedData) > 0 {
-				if err := e.AppendFlushedData(evictedData); err != nil {
-					log.Error().Stack().Err(err).Msg("Error saving flushed data")
-				}
-			}
-		case <-e.shutdownChan:
-			return
-		}
+	// Save flushed data separately
+	if err := e.appendFlushed(evictedData, evictedMeta, evictedTyped); err != nil {
+		log.Error().Stack().Err(err).Msg("Error saving flushed data")
+		span.RecordError(err)
 	}
+	e.fileMu.Unlock()
+
+	// Drop the evicted keys from the data file, which takes precedence over the flush file on load
+	e.triggerSave()
 }
 
 // Load loads data from disk into memory.
 func (e *Engine) Load() error {
+	e.health.restoring.Store(true)
+	defer e.health.restoring.Store(false)
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	// Reset in-memory data structures
 	e.data = make(map[string]string)
+	e.meta = make(map[string]Metadata)
+	e.typed = make(map[string]*typedValue)
 	e.evictionQueue = []string{}
 
-	// Load primary data from data.db
-	dataFromFile, err := e.loadFromFile(e.filePath)
-	if err != nil {
-		return fmt.Errorf("failed to load data from file: %w", err)
-	}
-
-	// Load evicted (flushed) data from flushed.db
-	flushedData, err := e.loadFromFile(e.flushPath)
-	if err != nil {
-		return fmt.Errorf("failed to load flushed data: %w", err)
+	// The data file holds the latest saved snapshot, then come the flush file, the flush file of
+	// an interrupted compaction and the compacted records, from newest to oldest. Within a tier
+	// a string wins over a typed value of the same key.
+	e.currentMemoryUsage = 0
+	for _, path := range []string{e.filePath, e.flushPath, e.flushPath + compactingFileSuffix, e.flushPath + compactedFileSuffix} {
+		data, meta, err := e.loadFromFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load data from %s: %w", path, err)
+		}
+		typed, err := e.loadTypedFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load typed data from %s: %w", path, err)
+		}
+		for key, value := range data {
+			if e.loaded(key) {
+				continue
+			}
+			e.data[key] = value
+			if m, ok := meta[key]; ok {
+				e.meta[key] = m
+			}
+			e.evictionQueue = append(e.evictionQueue, key)
+			e.currentMemoryUsage += len(key) + len(value) + meta[key].size()
+		}
+		for key, v := range typed {
+			if e.loaded(key) {
+				continue
+			}
+			e.typed[key] = v
+			e.evictionQueue = append(e.evictionQueue, key)
+			e.currentMemoryUsage += len(key) + v.size()
+		}
 	}
 
-	// Merge flushed data into main memory (flushed keys take precedence)
-	for key, value := range dataFromFile {
-		e.data[key] = value
-		e.evictionQueue = append(e.evictionQueue, key)
-	}
-	for key, value := range flushedData {
-		e.data[key] = value // Overwrite if key was in `data.db`
-		e.evictionQueue = append(e.evictionQueue, key)
-		e.currentMemoryUsage += len(key) + len(value)
+	if err := e.loadOwners(); err != nil {
+		return err
 	}
 
+	e.health.loaded.Store(true)
 	log.Info().Msg("Load complete: Memory store restored from disk.")
 	return nil
 }
 
-// loadFromFile loads key-value pairs from a given file.
-func (e *Engine) loadFromFile(filePath string) (map[string]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]string), nil // Return an empty map if file doesn't exist
-		}
-		return nil, fmt.Errorf("failed to open file: %w", err)
+// loaded reports whether key was already loaded from a newer tier. e.mu must be held.
+func (e *Engine) loaded(key string) bool {
+	if _, exists := e.data[key]; exists {
+		return true
 	}
-	defer file.Close()
+	_, exists := e.typed[key]
+	return exists
+}
 
+// loadFromFile loads key-value pairs and their metadata from a given file. Later records of a
+// key replace earlier ones.
+func (e *Engine) loadFromFile(filePath string) (map[string]string, map[string]Metadata, error) {
 	data := make(map[string]string)
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, keyValueSeparator, 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key, value := parts[0], parts[1]
+	meta := make(map[string]Metadata)
+	err := readRecords(filePath, func(key, value string, m Metadata) {
 		data[key] = value
+		if m.IsZero() {
+			delete(meta, key)
+		} else {
+			meta[key] = m
+		}
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return data, scanner.Err()
+	return data, meta, nil
 }
 
-// CompactFlushedData ensures flushed data is merged into data.db and safely deleted.
+// CompactFlushedData merges the flushed data into the compacted files and removes the flush files.
+// Reads and writes continue while it runs.
 func (e *Engine) CompactFlushedData() error {
-	log.Info().Msg("Starting compaction of flushed data...")
+	return e.CompactFlushedDataContext(context.Background())
+}
 
-	// Step 1: Pause auto-save to avoid race conditions
-	e.mu.Lock()
-	saveWorker := e.saveChan // Capture save worker state
-	e.saveChan = nil         // Disable save worker
-	e.mu.Unlock()
+// CompactFlushedDataContext is CompactFlushedData, traced as a child of the span in ctx.
+// It returns ErrCompactionInProgress when another compaction of the engine is running and
+// stops early when ctx is done or the engine shuts down.
+func (e *Engine) CompactFlushedDataContext(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "engine.compaction")
+	defer span.End()
 
-	// Step 2: Ensure any pending flush completes before compaction
-	err := e.forceFlush()
-	if err != nil {
-		return fmt.Errorf("force flush failed: %w", err)
+	if !e.compaction.running.TryLock() {
+		return ErrCompactionInProgress
 	}
-	log.Trace().Msg("Forced flush completed")
+	defer e.compaction.running.Unlock()
 
-	// Step 3: Load flushed data **without locking**
-	flushedData, err := e.loadFromFile(e.flushPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to load flushed data: %w", err)
-	}
-	log.Trace().Msg("Flushed data loaded")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-e.shutdownChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	e.counters.compactionRuns.Add(1)
+	e.health.compactionStart.Store(start.UnixNano())
+	defer e.health.compactionStart.Store(0)
+	e.compaction.begin(start)
+	defer e.compaction.end()
 
-	// Step 4: Load existing data from data.db **without locking**
-	existingData, err := e.loadFromFile(e.filePath)
+	err := e.compactFlushedData(ctx)
+	e.health.recordCompactionResult(start, err)
 	if err != nil {
-		return fmt.Errorf("failed to load existing data: %w", err)
+		e.counters.compactionFailures.Add(1)
+		span.RecordError(err)
+		return err
 	}
-	log.Trace().Msg("Existing data loaded")
+	return nil
+}
 
-	// Step 5: Merge flushed data into existing data
-	for key, value := range flushedData {
-		existingData[key] = value
-	}
-	log.Trace().Msg("Data merged")
+// compactFlushedData moves the flush files aside, so evictions continue into new ones, and
+// merges them with the compacted files as a stream of sorted runs. The saved in-memory data
+// takes part in the merge only to drop flushed records of keys that are back in memory.
+func (e *Engine) compactFlushedData(ctx context.Context) error {
+	log.Info().Msg("Starting compaction of flushed data...")
 
-	// Step 6: Save merged data to main data file
-	if err := e.SaveFile(existingData); err != nil {
-		return fmt.Errorf("failed to save merged data: %w", err)
+	e.compaction.enter(PhaseRotate)
+	if err := e.rotateFlushFiles(); err != nil {
+		return fmt.Errorf("failed to rotate flush files: %w", err)
 	}
-	log.Trace().Msg("Merged data saved")
 
-	// Step 7: Update memory usage accurately
-	e.mu.Lock()
-	e.currentMemoryUsage = 0
-	for key, value := range existingData {
-		e.currentMemoryUsage += len(key) + len(value)
+	// Keys evicted before the rotation are not in this snapshot unless they were set again,
+	// in which case the snapshot holds their latest value
+	e.compaction.enter(PhaseSave)
+	if _, err := e.saveSnapshot(ctx); err != nil {
+		return fmt.Errorf("failed to save data: %w", err)
 	}
-	e.saveChan = saveWorker // Restore save worker after compaction
-	e.mu.Unlock()
 
-	log.Trace().Msg("Memory usage updated")
+	if err := e.mergeFlushedData(ctx); err != nil {
+		return err
+	}
 
-	// Step 8: Remove flushed.db after unlocking
-	if err := os.Remove(e.flushPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove flushed file: %w", err)
+	e.compaction.enter(PhaseCleanup)
+	for _, suffix := range []string{"", typedFileSuffix} {
+		if err := os.Remove(e.flushPath + compactingFileSuffix + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove flushed file: %w", err)
+		}
+	}
+	removed, err := e.collectBlobs()
+	if err != nil {
+		return fmt.Errorf("failed to collect blob chunks: %w", err)
+	}
+	if removed > 0 {
+		log.Info().Int("chunks", removed).Msg("Removed unreferenced blob chunks")
 	}
-	log.Trace().Msg("Flushed data removed")
 
 	log.Info().Bool("success", true).Msg("Compaction completed successfully.")
 	return nil
 }
 
+// rotateFlushFiles renames the flush files to the compacting files. Files left by a compaction
+// that did not finish are merged first, and the current flush files wait for the next one.
+func (e *Engine) rotateFlushFiles() error {
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+
+	for _, suffix := range []string{"", typedFileSuffix} {
+		from, to := e.flushPath+suffix, e.flushPath+compactingFileSuffix+suffix
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // Save persists the current in-memory data to disk.
-func (e *Engine) Save() error {
-	e.mu.RLock()
+func (e *Engine) Save() (err error) {
+	ctx, span := tracing.Start(context.Background(), "engine.save")
+	defer span.End()
+	span.SetAttribute("trigger", "manual")
+
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	e.rlock(ctx)
 	defer e.mu.RUnlock()
-	return e.SaveFile(e.data)
+
+	start := time.Now()
+	defer func() {
+		e.recordSave(start, err)
+		span.RecordError(err)
+	}()
+
+	if err := e.SaveFile(e.data, e.meta); err != nil {
+		return err
+	}
+	if err := e.saveTypedData(e.typed); err != nil {
+		return err
+	}
+	return e.saveOwners(e.copyOwners())
 }
 
 // PrintMemoryUsage prints memory statistics.
@@ -441,53 +859,45 @@ func (e *Engine) DataSize() int {
 	return len(e.data)
 }
 
-// List returns a copy of the in-memory data.
+// List returns a copy of the in-memory data. Values stored in chunk files by SetStream are left
+// out, since memory only holds a reference to them; read them with Open.
 func (e *Engine) List() map[string]string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	copy := make(map[string]string)
 	for k, v := range e.data {
-		copy[k] = v
+		if e.meta[k].Blob == nil {
+			copy[k] = v
+		}
 	}
 	return copy
 }
 
-// forceFlush ensures that all in-memory data exceeding memoryLimit is saved before compaction
-func (e *Engine) forceFlush() error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	if e.currentMemoryUsage < e.memoryLimit {
-		return nil // No flush needed
-	}
-
-	// Move current data to flushed.db
-	evictedData := make(map[string]string)
-	for key, value := range e.data {
-		evictedData[key] = value
-		delete(e.data, key)
-	}
-
-	// Reset memory usage
-	e.currentMemoryUsage = 0
-
-	// Save flushed data to flushed.db
-	return e.AppendFlushedData(evictedData)
-}
-
 func (e *Engine) KeyCount() int {
-	return len(e.data)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.data) + len(e.typed)
 }
 
 func (e *Engine) GetMemoryLimit() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	return e.memoryLimit
 }
 
+// SetMemoryLimit changes the memory limit. Keys are evicted in the background when the usage
+// is over the new limit, rather than on the next write.
 func (e *Engine) SetMemoryLimit(limit int) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.memoryLimit = limit
+	if e.currentMemoryUsage >= e.memoryLimit {
+		select {
+		case e.flushChan <- struct{}{}:
+		default:
+		}
+	}
 }
 
 func (e *Engine) LoadConfig(config EngineConfig) error {
@@ -534,3 +944,29 @@ func (e *Engine) GetSlice(limit int, offset int) []KVPair {
 
 	return kvPairs
 }
+
+// Scan returns up to limit keys of any type that start with prefix and sort after cursor, in
+// lexicographic order. next is the cursor of the following page, or empty after the last page.
+func (e *Engine) Scan(prefix, cursor string, limit int) (keys []string, next string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	keys = make([]string, 0)
+	for key := range e.data {
+		if key > cursor && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range e.typed {
+		if key > cursor && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	return keys, next
+}
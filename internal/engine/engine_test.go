@@ -1,7 +1,11 @@
 package engine_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -11,15 +15,25 @@ import (
 const TEST_FILE_PATH = "test_data.db"
 const TEST_FLUSH_PATH = "test_flush.db"
 
-// Helper function to create a fresh engine instance
-func setupEngine(memoryLimit int) *engine.Engine {
-	_ = os.Remove(TEST_FILE_PATH) // Ensure a fresh start
-	engine, _ := engine.NewEngine(TEST_FILE_PATH, TEST_FLUSH_PATH, memoryLimit)
+// Paths of the data files used by the current test, set by setupEngine
+var testFilePath, testFlushPath string
+
+// Helper function to create a fresh engine instance in its own directory
+func setupEngine(t *testing.T, memoryLimit int) *engine.Engine {
+	t.Helper()
+	dir := t.TempDir() // Ensure a fresh start, isolated from engines of earlier tests
+	testFilePath = filepath.Join(dir, TEST_FILE_PATH)
+	testFlushPath = filepath.Join(dir, TEST_FLUSH_PATH)
+	engine, err := engine.NewEngine(testFilePath, testFlushPath, memoryLimit)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	t.Cleanup(engine.Shutdown)
 	return engine
 }
 
 func Test_SetAndGet(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	err := db.Set("name", "Alice")
 	if err != nil {
@@ -37,7 +51,7 @@ func Test_SetAndGet(t *testing.T) {
 }
 
 func Test_GetNonExistentKey(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_, err := db.Get("unknown")
 	if err == nil {
@@ -46,7 +60,7 @@ func Test_GetNonExistentKey(t *testing.T) {
 }
 
 func Test_DeleteKey(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("name", "Alice")
 	err := db.Delete("name")
@@ -61,7 +75,7 @@ func Test_DeleteKey(t *testing.T) {
 }
 
 func Test_ListKeys(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("name", "Alice")
 	_ = db.Set("age", "25")
@@ -77,18 +91,65 @@ func Test_ListKeys(t *testing.T) {
 }
 
 func Test_Flush(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 50) // Small enough to evict keys to the flush file
 
-	_ = db.Set("name", "Alice")
-	db.Flush()
+	for i := 1; i <= 6; i++ {
+		_ = db.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	_, _ = db.HSet("hash", map[string]string{"field": "value"})
+	waitForFile(t, testFlushPath)
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("CompactFlushedData() failed: %v", err)
+	}
+	_ = db.Set("key7", "value7")
+	db.SetMemoryLimit(1024)
+	db.SetBlobThreshold(64)
+	if _, err := db.SetStream(context.Background(), "blob", bytes.NewReader(bytes.Repeat([]byte("b"), 100)), engine.Metadata{}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
 
-	if len(db.List()) != 0 {
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if len(db.List()) != 0 || db.KeyCount() != 0 {
 		t.Error("Flush() did not clear data")
 	}
+	if chunks := countChunks(t); chunks != 0 {
+		t.Errorf("Expected Flush() to remove the blob chunks, got %d", chunks)
+	}
+
+	// Neither the saved nor the flushed keys come back
+	db.Shutdown()
+	db2, err := engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db2.Shutdown()
+	if n := db2.KeyCount(); n != 0 {
+		t.Errorf("Expected no keys after a restart, got %d", n)
+	}
+}
+
+// waitForFile waits for a background worker to create the file at path
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to be written", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 func Test_SaveAndLoad(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("name", "Alice")
 	_ = db.Set("city", "New York")
@@ -100,7 +161,7 @@ func Test_SaveAndLoad(t *testing.T) {
 	}
 
 	// Create a new engine and load from file
-	db2, _ := engine.NewEngine(TEST_FILE_PATH, TEST_FLUSH_PATH, 1024)
+	db2, _ := engine.NewEngine(testFilePath, testFlushPath, 1024)
 
 	value, err := db2.Get("name")
 	if err != nil || value != "Alice" {
@@ -115,7 +176,7 @@ func Test_SaveAndLoad(t *testing.T) {
 
 func Test_MemoryLimitTriggersRollingFlush(t *testing.T) {
 	// Set a small memory limit to force a rolling flush quickly
-	db := setupEngine(50)
+	db := setupEngine(t, 50)
 
 	// Insert multiple keys that will exceed memory
 	_ = db.Set("k1", "value1")
@@ -132,7 +193,7 @@ func Test_MemoryLimitTriggersRollingFlush(t *testing.T) {
 	}
 
 	// Load a new engine and check data is still retrievable
-	db2, _ := engine.NewEngine(TEST_FILE_PATH, TEST_FLUSH_PATH, 50)
+	db2, _ := engine.NewEngine(testFilePath, testFlushPath, 50)
 
 	_, err := db2.Get("k1")
 	_, err2 := db2.Get("k2")
@@ -142,7 +203,7 @@ func Test_MemoryLimitTriggersRollingFlush(t *testing.T) {
 }
 
 func Test_OverwriteExistingKey(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("key", "oldValue")
 	_ = db.Set("key", "newValue")
@@ -154,7 +215,7 @@ func Test_OverwriteExistingKey(t *testing.T) {
 }
 
 func Test_MemoryUsageTracking(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("small", "test")
 	initialMemory := db.MemoryUsage()
@@ -170,14 +231,32 @@ func Test_MemoryUsageTracking(t *testing.T) {
 	}
 }
 
+func Test_LoweredMemoryLimitEvicts(t *testing.T) {
+	db := setupEngine(t, 1024)
+	for i := 0; i < 10; i++ {
+		_ = db.Set(fmt.Sprintf("key-%d", i), "value")
+	}
+
+	// Lowering the limit, as a config reload does, evicts without waiting for a write
+	db.SetMemoryLimit(40)
+	deadline := time.Now().Add(5 * time.Second)
+	for db.MemoryUsage() > 40 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the usage to drop to the new limit, got %d", db.MemoryUsage())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitForFile(t, testFlushPath)
+}
+
 func Test_EnsureDataPersistsAcrossInstances(t *testing.T) {
-	db := setupEngine(1024)
+	db := setupEngine(t, 1024)
 
 	_ = db.Set("persistentKey", "PersistentData")
 	_ = db.Save()
 
 	// Create a new engine instance to test persistence
-	db2, _ := engine.NewEngine(TEST_FILE_PATH, TEST_FLUSH_PATH, 1024)
+	db2, _ := engine.NewEngine(testFilePath, testFlushPath, 1024)
 
 	value, err := db2.Get("persistentKey")
 	if err != nil {
@@ -189,7 +268,7 @@ func Test_EnsureDataPersistsAcrossInstances(t *testing.T) {
 }
 
 func Test_EnsureLRUFlushLogic(t *testing.T) {
-	db := setupEngine(300)
+	db := setupEngine(t, 300)
 
 	// Insert 5 keys that will exceed memory limit
 	_ = db.Set("a", "dataA")
@@ -207,7 +286,7 @@ func Test_EnsureLRUFlushLogic(t *testing.T) {
 	}
 
 	// Reload from disk to check persistence
-	db2, _ := engine.NewEngine(TEST_FILE_PATH, TEST_FLUSH_PATH, 100)
+	db2, _ := engine.NewEngine(testFilePath, testFlushPath, 100)
 
 	// Some keys should still be available after the flush
 	_, err := db2.Get("c")
@@ -218,7 +297,7 @@ func Test_EnsureLRUFlushLogic(t *testing.T) {
 }
 
 func Test_CompactFlushedData(t *testing.T) {
-	db := setupEngine(50) // Set low memory limit to force flush
+	db := setupEngine(t, 50) // Set low memory limit to force flush
 
 	// Step 1: Insert multiple keys to exceed memory limit and trigger a flush
 	_ = db.Set("key1", "value1")
@@ -235,7 +314,7 @@ func Test_CompactFlushedData(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Step 4: Ensure flushed.db is created
-	if _, err := os.Stat(TEST_FLUSH_PATH); os.IsNotExist(err) {
+	if _, err := os.Stat(testFlushPath); os.IsNotExist(err) {
 		t.Fatalf("Flushed data file not found; expected a flush to occur")
 	}
 
@@ -246,24 +325,51 @@ func Test_CompactFlushedData(t *testing.T) {
 	}
 
 	// Step 6: Ensure flushed.db is deleted after compaction
-	if _, err := os.Stat(TEST_FLUSH_PATH); !os.IsNotExist(err) {
+	if _, err := os.Stat(testFlushPath); !os.IsNotExist(err) {
 		t.Fatalf("Flushed data file still exists after compaction")
 	}
 
-	// Step 7: Ensure all keys are still retrievable
-	_, err1 := db.Get("key1")
-	_, err2 := db.Get("key2")
-	_, err3 := db.Get("key3")
-	_, err4 := db.Get("key4")
-	_, err5 := db.Get("key5")
-	_, err6 := db.Get("key6")
+	// Step 7: Ensure keys below the memory limit stay in memory
+	if db.DataSize() == 0 {
+		t.Fatalf("Compaction evicted every key from memory")
+	}
+	if db.MemoryUsage() == 0 || db.MemoryUsage() > db.GetMemoryLimit() {
+		t.Fatalf("Expected memory usage to stay within the limit, got %d", db.MemoryUsage())
+	}
 
-	if err1 == nil || err2 == nil || err3 == nil || err4 == nil || err5 == nil || err6 == nil {
-		t.Fatalf("Some keys are missing after compaction")
+	// Step 8: Ensure all keys are still retrievable from disk
+	db.Shutdown()
+	db2, err := engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db2.Shutdown()
+	for i := 1; i <= 6; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if value, err := db2.Get(key); err != nil || value != fmt.Sprintf("value%d", i) {
+			t.Errorf("Expected %s to survive compaction, got %q, %v", key, value, err)
+		}
+	}
+}
+
+func Test_Scan(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	for _, key := range []string{"user:3", "user:1", "order:1", "user:2"} {
+		if err := db.Set(key, "v"); err != nil {
+			t.Fatalf("Set() failed: %v", err)
+		}
+	}
+	if _, err := db.HSet("user:4", map[string]string{"name": "Dana"}); err != nil {
+		t.Fatalf("HSet() failed: %v", err)
 	}
 
-	// Step 8: Ensure memory usage is updated correctly
-	if db.MemoryUsage() == 0 {
-		t.Fatalf("Memory usage should be updated after compaction")
+	keys, next := db.Scan("user:", "", 3)
+	if fmt.Sprint(keys) != "[user:1 user:2 user:3]" || next != "user:3" {
+		t.Fatalf("Expected the first page of user keys, got %v and cursor %q", keys, next)
+	}
+	keys, next = db.Scan("user:", next, 3)
+	if fmt.Sprint(keys) != "[user:4]" || next != "" {
+		t.Errorf("Expected the typed key on the last page, got %v and cursor %q", keys, next)
 	}
 }
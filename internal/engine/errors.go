@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned for keys that do not exist.
+	ErrNotFound = errors.New("key not found")
+	// ErrMemoryLimit is returned when a key and its value are larger than the memory limit, so they
+	// could never be held in memory.
+	ErrMemoryLimit = errors.New("value exceeds the memory limit")
+	// ErrReadOnly is returned by writes once the engine is shutting down.
+	ErrReadOnly = errors.New("engine is read-only")
+	// ErrCorrupted matches a *CorruptedError.
+	ErrCorrupted = errors.New("data file is corrupted")
+)
+
+// CorruptedError reports a persistence file that cannot be decoded.
+type CorruptedError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("%s: %v: %v", e.Path, ErrCorrupted, e.Err)
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrCorrupted) true for every *CorruptedError.
+func (e *CorruptedError) Is(target error) bool {
+	return target == ErrCorrupted
+}
@@ -0,0 +1,71 @@
+package engine_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_ErrNotFound(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	if _, err := db.Get("missing"); !errors.Is(err, engine.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func Test_ErrMemoryLimit(t *testing.T) {
+	db := setupEngine(t, 64)
+
+	err := db.Set("big", strings.Repeat("x", 128))
+	if !errors.Is(err, engine.ErrMemoryLimit) {
+		t.Fatalf("Expected ErrMemoryLimit, got %v", err)
+	}
+	if _, err := db.Get("big"); !errors.Is(err, engine.ErrNotFound) {
+		t.Errorf("Expected the rejected value not to be stored, got %v", err)
+	}
+}
+
+func Test_ErrReadOnlyAfterClose(t *testing.T) {
+	db := setupEngine(t, 1024)
+	if err := db.Set("key", "value"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if err := db.Set("key", "other"); !errors.Is(err, engine.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Set, got %v", err)
+	}
+	if err := db.Delete("key"); !errors.Is(err, engine.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Delete, got %v", err)
+	}
+	if _, err := db.HSet("hash", map[string]string{"f": "v"}); !errors.Is(err, engine.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from HSet, got %v", err)
+	}
+	if value, err := db.Get("key"); err != nil || value != "value" {
+		t.Errorf("Expected reads to keep working, got %q, %v", value, err)
+	}
+}
+
+func Test_ErrCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, TEST_FILE_PATH)
+	if err := os.WriteFile(dataPath+".types", []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write typed file: %v", err)
+	}
+
+	_, err := engine.NewEngine(dataPath, filepath.Join(dir, TEST_FLUSH_PATH), 1024)
+	if !errors.Is(err, engine.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	var corrupted *engine.CorruptedError
+	if !errors.As(err, &corrupted) || corrupted.Path != dataPath+".types" {
+		t.Errorf("Expected a CorruptedError for %s, got %v", dataPath+".types", err)
+	}
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EvictionPolicy selects which keys are flushed to disk first when memory exceeds the limit.
+type EvictionPolicy string
+
+const (
+	// EvictionFIFO evicts the oldest inserted keys first
+	EvictionFIFO EvictionPolicy = "fifo"
+	// EvictionLRU evicts the least recently read or written keys first
+	EvictionLRU EvictionPolicy = "lru"
+)
+
+// ParseEvictionPolicy parses an eviction policy name. An empty name selects EvictionFIFO.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch EvictionPolicy(name) {
+	case "", EvictionFIFO:
+		return EvictionFIFO, nil
+	case EvictionLRU:
+		return EvictionLRU, nil
+	}
+	return "", fmt.Errorf("unknown eviction policy %q (fifo, lru)", name)
+}
+
+// EvictionPolicy returns the policy used to choose keys to evict.
+func (e *Engine) EvictionPolicy() EvictionPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.evictionPolicy
+}
+
+// SetEvictionPolicy changes the policy used to choose keys to evict. It takes effect on the next eviction.
+func (e *Engine) SetEvictionPolicy(policy EvictionPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if policy == e.evictionPolicy {
+		return
+	}
+	e.evictionPolicy = policy
+
+	e.accessMu.Lock()
+	e.lastUsed = make(map[string]uint64)
+	e.accessClock = 0
+	e.accessMu.Unlock()
+}
+
+// touch records an access to key for the LRU policy.
+// It must be called with e.mu held, for reading or writing.
+func (e *Engine) touch(key string) {
+	if e.evictionPolicy != EvictionLRU {
+		return
+	}
+	e.accessMu.Lock()
+	e.accessClock++
+	e.lastUsed[key] = e.accessClock
+	e.accessMu.Unlock()
+}
+
+// forget drops the access record of a removed key. It must be called with e.mu held.
+func (e *Engine) forget(key string) {
+	if e.evictionPolicy != EvictionLRU {
+		return
+	}
+	e.accessMu.Lock()
+	delete(e.lastUsed, key)
+	e.accessMu.Unlock()
+}
+
+// orderEvictionQueue sorts the queue so the next key to evict comes first.
+// Keys never accessed since the policy was set keep their insertion order and go first.
+// It must be called with e.mu held for writing.
+func (e *Engine) orderEvictionQueue() {
+	if e.evictionPolicy != EvictionLRU {
+		return
+	}
+	e.accessMu.Lock()
+	defer e.accessMu.Unlock()
+	sort.SliceStable(e.evictionQueue, func(i, j int) bool {
+		return e.lastUsed[e.evictionQueue[i]] < e.lastUsed[e.evictionQueue[j]]
+	})
+}
@@ -0,0 +1,41 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_EvictionPolicyLRU(t *testing.T) {
+	db := setupEngine(t, 30)
+	db.SetEvictionPolicy(engine.EvictionLRU)
+
+	_ = db.Set("k1", "value1")
+	_ = db.Set("k2", "value2")
+	_ = db.Set("k3", "value3")
+	// Reading k1 makes k2 the least recently used key
+	_, _ = db.Get("k1")
+	_ = db.Set("k4", "value4")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for db.MemoryUsage() >= 30 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := db.Get("k2"); err == nil {
+		t.Error("Expected the least recently used key k2 to be evicted")
+	}
+	if _, err := db.Get("k1"); err != nil {
+		t.Errorf("Expected recently read key k1 to stay in memory, got error: %v", err)
+	}
+}
+
+func Test_ParseEvictionPolicy(t *testing.T) {
+	if policy, err := engine.ParseEvictionPolicy(""); err != nil || policy != engine.EvictionFIFO {
+		t.Errorf("Expected fifo by default, got %q, %v", policy, err)
+	}
+	if _, err := engine.ParseEvictionPolicy("random"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ExportRecord is a key with its value, as Export returns them. Strings have Value and Meta,
+// the other kinds of values one of Hash, List, Set and ZSet.
+type ExportRecord struct {
+	Key   string
+	Type  ValueType
+	Value []byte
+	Meta  Metadata // Never has Blob, Value holds the contents of the chunk files
+	Hash  map[string]string
+	List  []string
+	Set   []string  // In ascending order
+	ZSet  []ZMember // Ordered by score, then member
+}
+
+// Export calls fn for every key of the engine in lexicographic order, with the value a load
+// would give it: the keys in memory and the keys evicted to the flush and compacted files.
+// Like Load, it reads the flushed keys into memory, so it is meant for backups rather than hot
+// paths. Compactions wait while the keys are read, not while fn runs. It stops at the first
+// error of fn or when ctx is done.
+func (e *Engine) Export(ctx context.Context, fn func(ExportRecord) error) error {
+	data, meta, typed, release, err := e.exportSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	keys := make([]string, 0, len(data)+len(typed))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	for key := range typed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec, err := e.exportRecord(key, data, meta, typed)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportSnapshot returns every key with its value, merged from memory and the files. The blob
+// chunks of the values are held until release is called.
+func (e *Engine) exportSnapshot(ctx context.Context) (map[string]string, map[string]Metadata, map[string]*typedValue, func(), error) {
+	// Compaction replaces the compacted files and removes the blob chunks nothing refers to
+	e.compaction.running.Lock()
+	defer e.compaction.running.Unlock()
+
+	e.rlock(ctx)
+	data := make(map[string]string, len(e.data))
+	for k, v := range e.data {
+		data[k] = v
+	}
+	meta := make(map[string]Metadata, len(e.meta))
+	for k, m := range e.meta {
+		meta[k] = m // Metadata is replaced, never modified in place
+	}
+	typed := e.copyTyped()
+	flushPath := e.flushPath
+	// Evictions lock the files before their keys leave memory, so every key is either in
+	// this copy or in the files opened below
+	e.fileMu.Lock()
+	e.mu.RUnlock()
+	tiers := []string{flushPath, flushPath + compactingFileSuffix, flushPath + compactedFileSuffix}
+	files := make([]*os.File, 0, 2*len(tiers))
+	readers := make([]io.Reader, 0, 2*len(tiers))
+	for _, path := range tiers {
+		for _, suffix := range []string{"", typedFileSuffix} {
+			stats, file := openFileStats(path + suffix)
+			files = append(files, file)
+			var r io.Reader = strings.NewReader("") // A missing file has no records
+			if file != nil {
+				r = io.NewSectionReader(file, 0, stats.Bytes)
+			}
+			readers = append(readers, r)
+		}
+	}
+	e.fileMu.Unlock()
+	defer func() {
+		for _, file := range files {
+			if file != nil {
+				file.Close()
+			}
+		}
+	}()
+
+	// Tiers go from newest to oldest, and within a tier a string wins over a typed value
+	loaded := func(key string) bool {
+		if _, exists := data[key]; exists {
+			return true
+		}
+		_, exists := typed[key]
+		return exists
+	}
+	for i, path := range tiers {
+		tierData := make(map[string]string)
+		tierMeta := make(map[string]Metadata)
+		err := decodeRecords(readers[2*i], path, func(key, value string, m Metadata) {
+			tierData[key] = value
+			if m.IsZero() {
+				delete(tierMeta, key)
+			} else {
+				tierMeta[key] = m
+			}
+		})
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		tierTyped, err := decodeTypedRecords(readers[2*i+1], path+typedFileSuffix)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to read %s: %w", path+typedFileSuffix, err)
+		}
+		for key, value := range tierData {
+			if loaded(key) {
+				continue
+			}
+			data[key] = value
+			if m, ok := tierMeta[key]; ok {
+				meta[key] = m
+			}
+		}
+		for key, v := range tierTyped {
+			if !loaded(key) {
+				typed[key] = v
+			}
+		}
+	}
+
+	// Compaction may run again once the lock is released, the chunks are kept until fn saw them
+	var chunks []string
+	for _, m := range meta {
+		if m.Blob != nil {
+			chunks = append(chunks, m.Blob.Chunks...)
+		}
+	}
+	return data, meta, typed, e.blobs.hold(chunks), nil
+}
+
+// exportRecord returns the record of key, reading the chunk files of a blob value.
+func (e *Engine) exportRecord(key string, data map[string]string, meta map[string]Metadata, typed map[string]*typedValue) (ExportRecord, error) {
+	v, ok := typed[key]
+	if !ok {
+		rec := ExportRecord{Key: key, Type: TypeString, Value: []byte(data[key]), Meta: meta[key]}
+		if blob := rec.Meta.Blob; blob != nil {
+			value, err := e.blobs.readAll(blob)
+			if err != nil {
+				return rec, fmt.Errorf("failed to read the value of %q: %w", key, err)
+			}
+			rec.Value = value
+			rec.Meta = rec.Meta.clone()
+			rec.Meta.Blob = nil
+		}
+		return rec, nil
+	}
+
+	rec := ExportRecord{Key: key, Type: v.kind}
+	switch v.kind {
+	case TypeHash:
+		rec.Hash = v.hash
+	case TypeList:
+		rec.List = v.list
+	case TypeSet:
+		rec.Set = sortedKeys(v.set)
+	case TypeZSet:
+		rec.ZSet = v.sortedZSet()
+	}
+	return rec, nil
+}
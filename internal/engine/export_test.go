@@ -0,0 +1,64 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_Export(t *testing.T) {
+	db := setupEngine(t, 100) // Small enough to evict keys to the flush file
+	ctx := context.Background()
+	db.SetBlobThreshold(64)
+
+	blob := bytes.Repeat([]byte{0, 0xff}, 100)
+	if _, err := db.SetStream(ctx, "blob", bytes.NewReader(blob), engine.Metadata{ContentType: "image/png"}); err != nil {
+		t.Fatalf("SetStream() failed: %v", err)
+	}
+	_, _ = db.HSet("hash", map[string]string{"field": "value"})
+	_, _ = db.ZAdd("zset", engine.ZMember{Member: "b", Score: 2}, engine.ZMember{Member: "a", Score: 1})
+	for i := 1; i <= 6; i++ {
+		_ = db.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	waitForFile(t, testFlushPath)
+	if db.KeyCount() == 9 {
+		t.Fatal("Expected keys to be evicted")
+	}
+
+	var keys []string
+	records := make(map[string]engine.ExportRecord)
+	err := db.Export(ctx, func(rec engine.ExportRecord) error {
+		if len(keys) == 0 {
+			// A slow reader does not hold up compactions, nor lose the blob chunks to them
+			_ = db.Delete("blob")
+			if err := db.CompactFlushedData(); err != nil {
+				t.Errorf("Expected a compaction while exporting, got %v", err)
+			}
+		}
+		keys = append(keys, rec.Key)
+		records[rec.Key] = rec
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+
+	if fmt.Sprint(keys) != "[blob hash key1 key2 key3 key4 key5 key6 zset]" {
+		t.Fatalf("Expected every key in order, got %v", keys)
+	}
+	if rec := records["blob"]; !bytes.Equal(rec.Value, blob) || rec.Meta.ContentType != "image/png" || rec.Meta.Blob != nil {
+		t.Errorf("Expected the blob contents and content type, got %d bytes, %+v", len(rec.Value), rec.Meta)
+	}
+	if rec := records["key1"]; rec.Type != engine.TypeString || string(rec.Value) != "value1" {
+		t.Errorf("Expected key1 to be value1, got %+v", rec)
+	}
+	if rec := records["hash"]; rec.Type != engine.TypeHash || rec.Hash["field"] != "value" {
+		t.Errorf("Expected the hash, got %+v", rec)
+	}
+	if rec := records["zset"]; rec.Type != engine.TypeZSet || fmt.Sprint(rec.ZSet) != "[{a 1} {b 2}]" {
+		t.Errorf("Expected the sorted set by score, got %+v", rec)
+	}
+}
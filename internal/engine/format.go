@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// String values are stored one record per line. Files written before values could hold
+// arbitrary bytes use the legacy format, "key value" with both written as is. Every run the
+// engine writes now starts with formatHeader and its records are "key value" or
+// "key value metadata", each field escaped so it holds no space or newline, with the metadata
+// as JSON. The header has no space, so versions that only know the legacy format skip it.
+const formatHeader = "%gokv-v2"
+
+// Metadata describes a string value. Values set without metadata have the zero Metadata.
+type Metadata struct {
+	ContentType string            `json:"content_type,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Blob        *BlobRef          `json:"blob,omitempty"` // Set when the value is stored in chunk files
+}
+
+// IsZero reports whether m holds no metadata
+func (m Metadata) IsZero() bool {
+	return m.ContentType == "" && len(m.Tags) == 0 && m.Blob == nil
+}
+
+// size is the memory accounted for m
+func (m Metadata) size() int {
+	n := len(m.ContentType)
+	for k, v := range m.Tags {
+		n += len(k) + len(v)
+	}
+	if m.Blob != nil {
+		n += m.Blob.size()
+	}
+	return n
+}
+
+// clone returns a copy of m that does not share its tags. Blob references are never modified,
+// so they are shared.
+func (m Metadata) clone() Metadata {
+	if m.Tags != nil {
+		tags := make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			tags[k] = v
+		}
+		m.Tags = tags
+	}
+	return m
+}
+
+var (
+	fieldEscaper   = strings.NewReplacer(`\`, `\\`, " ", `\s`, "\n", `\n`, "\r", `\r`)
+	fieldUnescaper = strings.NewReplacer(`\\`, `\`, `\s`, " ", `\n`, "\n", `\r`, "\r")
+)
+
+// encodeRecord returns the line of a string value, without the trailing newline
+func encodeRecord(key, value string, meta Metadata) []byte {
+	line := fieldEscaper.Replace(key) + keyValueSeparator + fieldEscaper.Replace(value)
+	if !meta.IsZero() {
+		encoded, _ := json.Marshal(meta) // Strings and maps of strings always encode
+		line += keyValueSeparator + fieldEscaper.Replace(string(encoded))
+	}
+	return []byte(line)
+}
+
+// decodeRecord parses a line of a string file. ok is false for lines without a value, which
+// are skipped. Legacy lines are read as is.
+func decodeRecord(line []byte, legacy bool) (key, value string, meta Metadata, ok bool, err error) {
+	if legacy {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		k, v, found := bytes.Cut(line, []byte(keyValueSeparator))
+		return string(k), string(v), Metadata{}, found, nil
+	}
+
+	fields := bytes.Split(line, []byte(keyValueSeparator))
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", "", Metadata{}, false, nil
+	}
+	key, value = fieldUnescaper.Replace(string(fields[0])), fieldUnescaper.Replace(string(fields[1]))
+	if len(fields) == 3 {
+		if err := json.Unmarshal([]byte(fieldUnescaper.Replace(string(fields[2]))), &meta); err != nil {
+			return "", "", Metadata{}, false, fmt.Errorf("invalid metadata of %q: %w", key, err)
+		}
+	}
+	return key, value, meta, true, nil
+}
+
+// recordKey returns the key of a line of a string file without decoding its value
+func recordKey(line []byte, legacy bool) (string, bool) {
+	key, _, ok := bytes.Cut(line, []byte(keyValueSeparator))
+	if !ok {
+		return "", false
+	}
+	if legacy {
+		return string(key), true
+	}
+	return fieldUnescaper.Replace(string(key)), true
+}
+
+// writeHeader starts a run of records in the current format
+func writeHeader(writer *bufio.Writer) error {
+	_, err := writer.WriteString(formatHeader + "\n")
+	return err
+}
+
+// writeRecords writes the string values of data as one run sorted by key
+func writeRecords(writer *bufio.Writer, data map[string]string, meta map[string]Metadata) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := writeHeader(writer); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(data) {
+		writer.Write(encodeRecord(key, data[key], meta[key]))
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRecords calls fn for every string value of the file at path, in file order. A missing
+// file has no records.
+func readRecords(path string, fn func(key, value string, meta Metadata)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	return decodeRecords(file, path, fn)
+}
+
+// decodeRecords calls fn for every string value read from r, the contents of the file at path.
+func decodeRecords(r io.Reader, path string, fn func(key, value string, meta Metadata)) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	legacy := true
+	for {
+		line, _, err := readLine(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if string(line) == formatHeader {
+			legacy = false
+			continue
+		}
+		key, value, meta, ok, err := decodeRecord(line, legacy)
+		if err != nil {
+			return &CorruptedError{Path: path, Err: err}
+		}
+		if ok {
+			fn(key, value, meta)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// binaryValue holds every byte, including the separators of the legacy format
+var binaryValue = func() []byte {
+	value := []byte(" leading space\nnew line\\s \r\n")
+	for b := 0; b < 256; b++ {
+		value = append(value, byte(b))
+	}
+	return value
+}()
+
+func Test_BinaryValuesPersist(t *testing.T) {
+	dir := t.TempDir()
+	dataPath, flushPath := filepath.Join(dir, TEST_FILE_PATH), filepath.Join(dir, TEST_FLUSH_PATH)
+	ctx := context.Background()
+
+	db, err := engine.NewEngine(dataPath, flushPath, 4096)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	meta := engine.Metadata{ContentType: "application/x-protobuf", Tags: map[string]string{"owner": "team a"}}
+	if err := db.SetValue(ctx, "key with\nspaces", binaryValue, meta); err != nil {
+		t.Fatalf("SetValue() failed: %v", err)
+	}
+	if err := db.Set("plain", "text"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	db, err = engine.NewEngine(dataPath, flushPath, 4096)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db.Shutdown()
+
+	value, got, err := db.GetValue(ctx, "key with\nspaces")
+	if err != nil {
+		t.Fatalf("GetValue() failed: %v", err)
+	}
+	if !bytes.Equal(value, binaryValue) {
+		t.Errorf("Expected the value to round-trip exactly, got %q", value)
+	}
+	if got.ContentType != meta.ContentType || got.Tags["owner"] != "team a" {
+		t.Errorf("Expected the metadata to persist, got %+v", got)
+	}
+	if _, plain, err := db.GetValue(ctx, "plain"); err != nil || !plain.IsZero() {
+		t.Errorf("Expected a value without metadata, got %+v, %v", plain, err)
+	}
+}
+
+func Test_SetReplacesMetadata(t *testing.T) {
+	db := setupEngine(t, 1024)
+	ctx := context.Background()
+
+	if err := db.SetValue(ctx, "key", []byte("v1"), engine.Metadata{ContentType: "text/plain"}); err != nil {
+		t.Fatalf("SetValue() failed: %v", err)
+	}
+	usage := db.MemoryUsage()
+	if err := db.Set("key", "v2"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if _, meta, _ := db.GetValue(ctx, "key"); !meta.IsZero() {
+		t.Errorf("Expected Set to clear the metadata, got %+v", meta)
+	}
+	if db.MemoryUsage() != usage-len("text/plain") {
+		t.Errorf("Expected the metadata to be released from the memory usage, got %d", db.MemoryUsage())
+	}
+}
+
+func Test_LegacyFormatMigrates(t *testing.T) {
+	db := setupEngine(t, 1024)
+	db.Shutdown()
+
+	// Data and flush files written before the current format
+	if err := os.WriteFile(testFilePath, []byte("a first value\nb second\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	if err := os.WriteFile(testFlushPath, []byte("c flushed \\ value\n"), 0644); err != nil {
+		t.Fatalf("Failed to write flush file: %v", err)
+	}
+
+	db, err := engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db.Shutdown()
+
+	expected := map[string]string{"a": "first value", "b": "second", "c": `flushed \ value`}
+	for key, want := range expected {
+		if value, err := db.Get(key); err != nil || value != want {
+			t.Errorf("Expected %q for %s, got %q, %v", want, key, value, err)
+		}
+	}
+
+	// Compaction rewrites the legacy records, and values added since survive a restart
+	if err := db.SetValue(context.Background(), "d", []byte("new\nline"), engine.Metadata{}); err != nil {
+		t.Fatalf("SetValue() failed: %v", err)
+	}
+	if err := db.CompactFlushedData(); err != nil {
+		t.Fatalf("CompactFlushedData() failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	db, err = engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db.Shutdown()
+
+	expected["d"] = "new\nline"
+	for key, want := range expected {
+		if value, err := db.Get(key); err != nil || value != want {
+			t.Errorf("Expected %q for %s after compaction, got %q, %v", want, key, value, err)
+		}
+	}
+}
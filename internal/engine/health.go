@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backgroundWorkers is the number of workers started by NewEngine
+const backgroundWorkers = 2
+
+// Health is a snapshot of what an engine needs to serve requests.
+type Health struct {
+	Loaded            bool      // The initial Load completed
+	Restoring         bool      // Load is replacing the in-memory data
+	Compacting        bool      // A compaction is running
+	CompactionStarted time.Time // Start of the running compaction, zero when idle
+	LastSave          time.Time // End of the last save, zero before the first one
+	LastSaveError     string    // Error of the last save, empty when it succeeded
+	WorkersAlive      int
+	WorkersExpected   int
+	FilePath          string
+	FlushPath         string
+}
+
+// engineHealth is updated by Load, compaction, saves and the background workers.
+type engineHealth struct {
+	loaded          atomic.Bool
+	restoring       atomic.Bool
+	compactionStart atomic.Int64 // Unix nanoseconds, 0 when no compaction is running
+	workers         atomic.Int32 // Background workers that have not exited
+
+	mu             sync.Mutex
+	lastSave       Operation
+	lastCompaction Operation
+}
+
+// Operation describes the last run of a background operation.
+type Operation struct {
+	Time     time.Time     `json:"time"` // When it finished, zero if it never ran
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Health returns the engine's current health.
+func (e *Engine) Health() Health {
+	e.health.mu.Lock()
+	h := Health{
+		LastSave:      e.health.lastSave.Time,
+		LastSaveError: e.health.lastSave.Error,
+	}
+	e.health.mu.Unlock()
+
+	h.Loaded = e.health.loaded.Load()
+	h.Restoring = e.health.restoring.Load()
+	if started := e.health.compactionStart.Load(); started != 0 {
+		h.Compacting = true
+		h.CompactionStarted = time.Unix(0, started)
+	}
+	h.WorkersAlive = int(e.health.workers.Load())
+	h.WorkersExpected = backgroundWorkers
+
+	e.mu.RLock()
+	h.FilePath, h.FlushPath = e.filePath, e.flushPath
+	e.mu.RUnlock()
+	return h
+}
+
+// lastOperations returns the last save and compaction.
+func (h *engineHealth) lastOperations() (save, compaction Operation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastSave, h.lastCompaction
+}
+
+// recordSaveResult remembers when the last save finished, how long it took and whether it failed.
+func (h *engineHealth) recordSaveResult(start time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSave = newOperation(start, err)
+}
+
+// recordCompactionResult remembers the outcome of the last compaction.
+func (h *engineHealth) recordCompactionResult(start time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCompaction = newOperation(start, err)
+}
+
+func newOperation(start time.Time, err error) Operation {
+	op := Operation{Time: time.Now()}
+	op.Duration = op.Time.Sub(start)
+	if err != nil {
+		op.Error = err.Error()
+	}
+	return op
+}
@@ -0,0 +1,65 @@
+package engine_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_HealthTracksLoadSavesAndWorkers(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	h := db.Health()
+	if !h.Loaded || h.Restoring || h.Compacting {
+		t.Errorf("Expected a loaded, idle engine, got %+v", h)
+	}
+	if h.WorkersAlive != h.WorkersExpected || h.WorkersExpected == 0 {
+		t.Errorf("Expected every worker to run, got %d of %d", h.WorkersAlive, h.WorkersExpected)
+	}
+	if !h.LastSave.IsZero() {
+		t.Errorf("Expected no save yet, got %v", h.LastSave)
+	}
+
+	_ = db.Set("k1", "v1")
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	h = db.Health()
+	if h.LastSave.IsZero() || h.LastSaveError != "" {
+		t.Errorf("Expected a successful save, got %v with error %q", h.LastSave, h.LastSaveError)
+	}
+
+	db.Shutdown()
+	if h := db.Health(); h.WorkersAlive != 0 {
+		t.Errorf("Expected no workers after shutdown, got %d", h.WorkersAlive)
+	}
+}
+
+func Test_HealthReportsFailedSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := engine.NewEngine(filepath.Join(dir, "data.db"), filepath.Join(dir, "flush.db"), 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	t.Cleanup(db.Shutdown)
+
+	// Replace the data directory with a file so every save fails
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Save(); err == nil {
+		t.Fatal("Expected Save() to fail")
+	}
+	if h := db.Health(); h.LastSaveError == "" {
+		t.Error("Expected the failed save to be reported")
+	}
+}
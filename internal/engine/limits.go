@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrKeyTooLong is returned by writes of keys longer than Limits.MaxKeyLength.
+	ErrKeyTooLong = errors.New("key is too long")
+	// ErrInvalidKey is returned by writes of keys with characters Limits.KeyPolicy does not allow.
+	ErrInvalidKey = errors.New("key has invalid characters")
+	// ErrValueTooLarge is returned by writes of string values larger than Limits.MaxValueSize.
+	ErrValueTooLarge = errors.New("value is too large")
+)
+
+// KeyPolicy selects the characters allowed in keys.
+type KeyPolicy string
+
+const (
+	// KeyPolicyAny allows any bytes
+	KeyPolicyAny KeyPolicy = "any"
+	// KeyPolicyPrintable allows valid UTF-8 without control characters
+	KeyPolicyPrintable KeyPolicy = "printable"
+	// KeyPolicyASCII allows printable ASCII characters other than space
+	KeyPolicyASCII KeyPolicy = "ascii"
+)
+
+// ParseKeyPolicy parses a key policy name. An empty name selects KeyPolicyAny.
+func ParseKeyPolicy(name string) (KeyPolicy, error) {
+	switch KeyPolicy(name) {
+	case "", KeyPolicyAny:
+		return KeyPolicyAny, nil
+	case KeyPolicyPrintable:
+		return KeyPolicyPrintable, nil
+	case KeyPolicyASCII:
+		return KeyPolicyASCII, nil
+	}
+	return "", fmt.Errorf("unknown key policy %q (any, printable, ascii)", name)
+}
+
+// allows reports whether key only has characters the policy allows
+func (p KeyPolicy) allows(key string) bool {
+	switch p {
+	case KeyPolicyPrintable:
+		if !utf8.ValidString(key) {
+			return false
+		}
+		for _, r := range key {
+			if unicode.IsControl(r) {
+				return false
+			}
+		}
+	case KeyPolicyASCII:
+		for i := 0; i < len(key); i++ {
+			if key[i] <= ' ' || key[i] > '~' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Limits bounds the keys and values written to an engine. Keys already stored are not checked
+// until they are written again.
+type Limits struct {
+	MaxKeyLength int       // Bytes of a key, no limit when 0
+	MaxValueSize int64     // Bytes of a string value, no limit when 0
+	KeyPolicy    KeyPolicy // Characters allowed in keys, KeyPolicyAny when empty
+}
+
+// CheckKey returns an error matching ErrKeyTooLong or ErrInvalidKey when key cannot be written
+func (l Limits) CheckKey(key string) error {
+	if l.MaxKeyLength > 0 && len(key) > l.MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrKeyTooLong, len(key), l.MaxKeyLength)
+	}
+	if !l.KeyPolicy.allows(key) {
+		return fmt.Errorf("%w: %q is not allowed by the %s key policy", ErrInvalidKey, key, l.KeyPolicy)
+	}
+	return nil
+}
+
+// CheckValue returns an error matching ErrValueTooLarge when a value of size bytes cannot be written
+func (l Limits) CheckValue(size int64) error {
+	if l.MaxValueSize > 0 && size > l.MaxValueSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrValueTooLarge, size, l.MaxValueSize)
+	}
+	return nil
+}
+
+// limitedReader reads at most limit bytes and fails with ErrValueTooLarge after them
+type limitedReader struct {
+	r      io.Reader
+	limits Limits
+	read   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if limitErr := l.limits.CheckValue(l.read); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+// SetLimits sets the limits checked by writes
+func (e *Engine) SetLimits(limits Limits) {
+	e.limits.Store(&limits)
+}
+
+// Limits returns the limits checked by writes
+func (e *Engine) Limits() Limits {
+	if limits := e.limits.Load(); limits != nil {
+		return *limits
+	}
+	return Limits{}
+}
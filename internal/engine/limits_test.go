@@ -0,0 +1,83 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_Limits(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+	ctx := context.Background()
+	if err := db.Set("a\nb", "stored before the limits"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	db.SetLimits(engine.Limits{MaxKeyLength: 8, MaxValueSize: 16, KeyPolicy: engine.KeyPolicyPrintable})
+
+	tests := []struct {
+		name string
+		set  func() error
+		want error
+	}{
+		{"key too long", func() error { return db.Set("123456789", "v") }, engine.ErrKeyTooLong},
+		{"control character", func() error { return db.Set("a\tb", "v") }, engine.ErrInvalidKey},
+		{"invalid UTF-8", func() error { return db.Set("a\xffb", "v") }, engine.ErrInvalidKey},
+		{"value too large", func() error { return db.Set("key", strings.Repeat("x", 17)) }, engine.ErrValueTooLarge},
+		{"typed key", func() error { _, err := db.HSet("123456789", map[string]string{"f": "v"}); return err }, engine.ErrKeyTooLong},
+		{"counter key", func() error { _, err := db.Incr("a\tb", 1); return err }, engine.ErrInvalidKey},
+		{"streamed value", func() error {
+			_, err := db.SetStream(ctx, "stream", bytes.NewReader(make([]byte, 17)), engine.Metadata{})
+			return err
+		}, engine.ErrValueTooLarge},
+		{"hash field", func() error { _, err := db.HSet("h", map[string]string{"f": strings.Repeat("x", 16)}); return err }, engine.ErrValueTooLarge},
+		{"list element", func() error { _, err := db.RPush("l", "v", strings.Repeat("x", 17)); return err }, engine.ErrValueTooLarge},
+		{"set member", func() error { _, err := db.SAdd("s", strings.Repeat("x", 17)); return err }, engine.ErrValueTooLarge},
+		{"sorted set member", func() error {
+			_, err := db.ZAdd("z", engine.ZMember{Member: strings.Repeat("x", 9), Score: 1})
+			return err
+		}, engine.ErrValueTooLarge},
+		{"within limits", func() error { return db.Set("key", strings.Repeat("x", 16)) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.set(); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	for _, key := range []string{"h", "l", "s", "z"} {
+		if _, err := db.Type(key); !errors.Is(err, engine.ErrNotFound) {
+			t.Errorf("Expected the rejected %s not to be created, got %v", key, err)
+		}
+	}
+	if _, err := db.Get("stream"); !errors.Is(err, engine.ErrNotFound) {
+		t.Errorf("Expected the rejected stream not to be stored, got %v", err)
+	}
+	// Keys stored before the limits can still be read and deleted
+	if err := db.Delete("a\nb"); err != nil {
+		t.Errorf("Delete() of an existing key failed: %v", err)
+	}
+}
+
+func Test_ParseKeyPolicy(t *testing.T) {
+	if policy, err := engine.ParseKeyPolicy(""); err != nil || policy != engine.KeyPolicyAny {
+		t.Errorf("Expected the any policy by default, got %q, %v", policy, err)
+	}
+	if _, err := engine.ParseKeyPolicy("unicode"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+	ascii := engine.Limits{KeyPolicy: engine.KeyPolicyASCII}
+	if err := ascii.CheckKey("user:1"); err != nil {
+		t.Errorf("Expected printable ASCII to be allowed, got %v", err)
+	}
+	for _, key := range []string{"with space", "é"} {
+		if err := ascii.CheckKey(key); !errors.Is(err, engine.ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
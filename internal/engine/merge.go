@@ -0,0 +1,554 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Every file the engine writes is a sequence of runs sorted by key: a save writes one run and
+// each eviction appends one. Compaction merges at most mergeFanIn runs at a time, reading each
+// through a buffer of mergeBufferSize bytes, so its memory use does not grow with the files.
+const (
+	mergeFanIn      = 16
+	mergeBufferSize = 64 * 1024
+)
+
+// recordKind is the encoding of a record's line.
+type recordKind byte
+
+const (
+	kindString recordKind = 's' // A string value, as in the data and flush files, see encodeRecord
+	kindTyped  recordKind = 't' // A typedRecord encoded as JSON, as in the typed files
+)
+
+// record is one line of a file being merged.
+type record struct {
+	key    string
+	kind   recordKind
+	shadow bool   // Hides older records of the key but is not written itself
+	line   []byte // Without the trailing newline
+}
+
+// run is a range of a file whose records are sorted by key.
+type run struct {
+	file       *os.File
+	kind       recordKind
+	shadow     bool
+	internal   bool // An intermediate merge file, each line prefixed with its kind and shadow flag
+	legacy     bool // String records in the legacy format, which parseRecord converts
+	start, end int64
+}
+
+// source is a file to merge. Files are opened once, so a save replacing the data file while
+// a compaction runs does not change what the compaction reads.
+type source struct {
+	path   string
+	kind   recordKind
+	shadow bool
+}
+
+// parseRecord decodes a line of a run. Lines without a key are skipped, as when loading.
+func parseRecord(r run, line []byte) (record, bool, error) {
+	rec := record{kind: r.kind, shadow: r.shadow, line: line}
+	if r.internal {
+		if len(line) < 2 {
+			return rec, false, &CorruptedError{Path: r.file.Name(), Err: errors.New("truncated merge record")}
+		}
+		rec.kind, rec.shadow, rec.line = recordKind(line[0]), line[1] == '1', line[2:]
+	}
+
+	switch rec.kind {
+	case kindString:
+		key, ok := recordKey(rec.line, r.legacy)
+		if !ok {
+			return rec, false, nil
+		}
+		rec.key = key
+		if r.legacy {
+			// Merged files are written in the current format
+			_, value, _, _, _ := decodeRecord(rec.line, true)
+			rec.line = encodeRecord(key, value, Metadata{})
+		}
+	case kindTyped:
+		var header struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(rec.line, &header); err != nil {
+			return rec, false, &CorruptedError{Path: r.file.Name(), Err: err}
+		}
+		rec.key = header.Key
+	default:
+		return rec, false, &CorruptedError{Path: r.file.Name(), Err: fmt.Errorf("unknown record kind %q", rec.kind)}
+	}
+	return rec, true, nil
+}
+
+// readLine returns the next non-empty line without its newline, or io.EOF.
+func readLine(reader *bufio.Reader) ([]byte, int, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		n := len(line)
+		if err != nil && (err != io.EOF || n == 0) {
+			return nil, n, err
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) > 0 {
+			return line, n, nil
+		}
+		if err == io.EOF {
+			return nil, n, io.EOF
+		}
+	}
+}
+
+// scanRuns splits a file into its sorted runs, oldest first. A new run starts wherever a key
+// is not greater than the one before it, so files written before saves were sorted still merge,
+// and at every format header, so a run never mixes legacy and current records.
+func scanRuns(file *os.File, src source, t *throttle) ([]run, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReaderSize(t.reader(io.NewSectionReader(file, 0, info.Size())), mergeBufferSize)
+
+	var runs []run
+	current := run{file: file, kind: src.kind, shadow: src.shadow, legacy: src.kind == kindString}
+	var offset int64
+	var previous string
+	started := false
+	for {
+		line, n, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", src.path, err)
+		}
+		if src.kind == kindString && string(line) == formatHeader {
+			if started {
+				current.end = offset
+				runs = append(runs, current)
+				started = false
+			}
+			offset += int64(n)
+			current.start, current.legacy = offset, false
+			continue
+		}
+		rec, ok, err := parseRecord(current, line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", src.path, err)
+		}
+		if ok {
+			if started && rec.key <= previous {
+				current.end = offset
+				runs = append(runs, current)
+				current.start = offset
+			}
+			previous, started = rec.key, true
+		}
+		offset += int64(n)
+	}
+	if started {
+		current.end = offset
+		runs = append(runs, current)
+	}
+	return runs, nil
+}
+
+// runReader reads the records of a run in order.
+type runReader struct {
+	run     run
+	reader  *bufio.Reader
+	current record
+	index   int // Position of the run in the merge, lower is newer
+}
+
+// next advances to the next record and reports whether there was one.
+func (r *runReader) next() (bool, error) {
+	for {
+		line, _, err := readLine(r.reader)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		rec, ok, err := parseRecord(r.run, line)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			r.current = rec
+			return true, nil
+		}
+	}
+}
+
+// readerHeap orders run readers by their current key, newest run first for equal keys.
+type readerHeap []*runReader
+
+func (h readerHeap) Len() int { return len(h) }
+func (h readerHeap) Less(i, j int) bool {
+	if h[i].current.key != h[j].current.key {
+		return h[i].current.key < h[j].current.key
+	}
+	return h[i].index < h[j].index
+}
+func (h readerHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *readerHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *readerHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// mergeRuns calls emit for every key of runs, ordered newest first, with the record of the
+// newest run containing the key. Older records of the key are skipped.
+func mergeRuns(runs []run, t *throttle, emit func(record) error) error {
+	h := make(readerHeap, 0, len(runs))
+	for i, r := range runs {
+		reader := &runReader{
+			run:    r,
+			reader: bufio.NewReaderSize(t.reader(io.NewSectionReader(r.file, r.start, r.end-r.start)), mergeBufferSize),
+			index:  i,
+		}
+		ok, err := reader.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, reader)
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		newest := h[0].current
+		for h.Len() > 0 && h[0].current.key == newest.key {
+			ok, err := h[0].next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+		if err := emit(newest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reduceRuns merges runs, ordered newest first, in groups of mergeFanIn into intermediate files
+// next to prefix until at most mergeFanIn are left. Merging neighbouring runs keeps the order,
+// so newer records still win. Intermediate files are removed once merged again; the caller
+// closes and removes the returned ones.
+func reduceRuns(runs []run, prefix string, t *throttle) ([]run, []*os.File, error) {
+	var temps []*os.File
+	for len(runs) > mergeFanIn {
+		var reduced []run
+		var created []*os.File
+		for i := 0; i < len(runs); i += mergeFanIn {
+			group := runs[i:min(i+mergeFanIn, len(runs))]
+			if len(group) == 1 {
+				reduced = append(reduced, group[0])
+				continue
+			}
+			merged, err := mergeToTemp(group, prefix, t)
+			if merged.file != nil {
+				created = append(created, merged.file)
+			}
+			if err != nil {
+				return nil, append(temps, created...), err
+			}
+			reduced = append(reduced, merged)
+		}
+
+		// Keep the intermediate files still used by a run of the next pass
+		var kept []*os.File
+		for _, file := range temps {
+			if usedBy(reduced, file) {
+				kept = append(kept, file)
+			} else {
+				file.Close()
+				os.Remove(file.Name())
+			}
+		}
+		temps = append(kept, created...)
+		runs = reduced
+	}
+	return runs, temps, nil
+}
+
+func usedBy(runs []run, file *os.File) bool {
+	for _, r := range runs {
+		if r.file == file {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeToTemp merges runs into a single run in a new intermediate file.
+func mergeToTemp(runs []run, prefix string, t *throttle) (run, error) {
+	file, err := os.CreateTemp(filepath.Dir(prefix), filepath.Base(prefix)+".merge-*")
+	if err != nil {
+		return run{}, fmt.Errorf("failed to create merge file: %w", err)
+	}
+	merged := run{file: file, internal: true}
+
+	writer := bufio.NewWriterSize(t.writer(file), mergeBufferSize)
+	err = mergeRuns(runs, t, func(rec record) error {
+		shadow := byte('0')
+		if rec.shadow {
+			shadow = '1'
+		}
+		writer.WriteByte(byte(rec.kind))
+		writer.WriteByte(shadow)
+		writer.Write(rec.line)
+		return writer.WriteByte('\n')
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return merged, fmt.Errorf("failed to write merge file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return merged, err
+	}
+	merged.end = info.Size()
+	return merged, nil
+}
+
+// throttle limits the bytes a compaction reads and writes and reports them as progress.
+// It stops the compaction when ctx is done.
+type throttle struct {
+	ctx      context.Context
+	limiter  *rateLimiter
+	progress *compactionState
+}
+
+func (t *throttle) account(n int, write bool) error {
+	if n > 0 {
+		t.progress.addBytes(n, write)
+		if err := t.limiter.wait(t.ctx, n); err != nil {
+			return err
+		}
+	}
+	return t.ctx.Err()
+}
+
+func (t *throttle) reader(r io.Reader) io.Reader { return throttledReader{r, t} }
+func (t *throttle) writer(w io.Writer) io.Writer { return throttledWriter{w, t} }
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if terr := r.t.account(n, false); terr != nil {
+		return n, terr
+	}
+	return n, err
+}
+
+type throttledWriter struct {
+	w io.Writer
+	t *throttle
+}
+
+func (w throttledWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if terr := w.t.account(n, true); terr != nil && err == nil {
+		err = terr
+	}
+	return n, err
+}
+
+// rateLimiter is a token bucket of bytes. It holds up to one second of tokens and lets callers
+// borrow against the future, so a read larger than the bucket waits instead of failing.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second, 0 for no limit
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until the bucket is no longer in debt or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	debt := -l.tokens
+	l.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(debt / l.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mergeFlushedData merges the compacting files into the compacted files. Records of the
+// compacting files win over compacted ones, and keys in the saved data are dropped.
+func (e *Engine) mergeFlushedData(ctx context.Context) error {
+	t := &throttle{ctx: ctx, limiter: newRateLimiter(e.compactionRate.Load()), progress: &e.compaction}
+	compacting, compacted := e.flushPath+compactingFileSuffix, e.flushPath+compactedFileSuffix
+
+	// Newest first
+	sources := []source{
+		{path: e.filePath, kind: kindString, shadow: true},
+		{path: e.filePath + typedFileSuffix, kind: kindTyped, shadow: true},
+		{path: compacting, kind: kindString},
+		{path: compacting + typedFileSuffix, kind: kindTyped},
+		{path: compacted, kind: kindString},
+		{path: compacted + typedFileSuffix, kind: kindTyped},
+	}
+
+	e.compaction.enter(PhaseScan)
+	var runs []run
+	for _, src := range sources {
+		file, err := os.Open(src.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", src.path, err)
+		}
+		defer file.Close()
+
+		fileRuns, err := scanRuns(file, src, t)
+		if err != nil {
+			return err
+		}
+		// Later runs of a file were appended later
+		for i := len(fileRuns) - 1; i >= 0; i-- {
+			runs = append(runs, fileRuns[i])
+		}
+	}
+
+	e.compaction.enter(PhaseMerge)
+	runs, temps, err := reduceRuns(runs, e.flushPath, t)
+	defer func() {
+		for _, file := range temps {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	return writeCompacted(compacted, func(strings, typed *bufio.Writer) error {
+		headerWritten := false
+		return mergeRuns(runs, t, func(rec record) error {
+			if rec.shadow {
+				return nil
+			}
+			writer := strings
+			if rec.kind == kindTyped {
+				writer = typed
+			} else if !headerWritten {
+				if err := writeHeader(strings); err != nil {
+					return err
+				}
+				headerWritten = true
+			}
+			writer.Write(rec.line)
+			return writer.WriteByte('\n')
+		})
+	}, t)
+}
+
+// writeCompacted writes the string and typed compacted files with write and replaces both once
+// it succeeded. Empty files are removed instead.
+func writeCompacted(path string, write func(strings, typed *bufio.Writer) error, t *throttle) error {
+	paths := []string{path, path + typedFileSuffix}
+	files := make([]*os.File, len(paths))
+	writers := make([]*bufio.Writer, len(paths))
+	defer func() {
+		for _, file := range files {
+			if file != nil {
+				file.Close()
+				os.Remove(file.Name())
+			}
+		}
+	}()
+	for i, p := range paths {
+		file, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".tmp-*")
+		if err != nil {
+			return fmt.Errorf("failed to create compacted file: %w", err)
+		}
+		files[i] = file
+		writers[i] = bufio.NewWriterSize(t.writer(file), mergeBufferSize)
+	}
+
+	if err := write(writers[0], writers[1]); err != nil {
+		return fmt.Errorf("failed to merge flushed data: %w", err)
+	}
+	for i, file := range files {
+		if err := writers[i].Flush(); err != nil {
+			return fmt.Errorf("failed to write compacted file: %w", err)
+		}
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync compacted file: %w", err)
+		}
+	}
+
+	// The compacting files are only removed after both renames, so a crash in between
+	// leaves every record on disk
+	for i, file := range files {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		file.Close()
+		files[i] = nil
+		if info.Size() == 0 {
+			os.Remove(file.Name())
+			if err := os.Remove(paths[i]); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove compacted file: %w", err)
+			}
+			continue
+		}
+		if err := os.Rename(file.Name(), paths[i]); err != nil {
+			os.Remove(file.Name())
+			return fmt.Errorf("failed to replace compacted file: %w", err)
+		}
+	}
+	return nil
+}
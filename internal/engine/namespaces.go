@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultNamespace is the name of the namespace backed by the configured data files.
+const DefaultNamespace = "default"
+
+const (
+	namespacesDirName     = "namespaces"
+	namespaceMetaFileName = "namespace.json"
+	namespaceDataFileName = "data.db"
+	namespaceFlushName    = "flush.db"
+)
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var (
+	ErrNamespaceNotFound  = errors.New("namespace not found")
+	ErrNamespaceExists    = errors.New("namespace already exists")
+	ErrInvalidNamespace   = errors.New("namespace names must be 1-64 letters, digits, '-' or '_'")
+	ErrInvalidMemoryLimit = errors.New("memory limit must be positive")
+)
+
+// Namespaces manages a set of independent engines, one per namespace.
+// Each namespace has its own data map, eviction queue, memory limit and persistence files.
+type Namespaces struct {
+	mu      sync.RWMutex
+	engines map[string]*Engine
+	baseDir string
+}
+
+// NamespaceInfo describes a namespace and its current usage.
+type NamespaceInfo struct {
+	Name        string `json:"name"`
+	KeyCount    int    `json:"key_count"`
+	MemoryUsage int    `json:"memory_usage"`
+	MemoryLimit int    `json:"memory_limit"`
+}
+
+// namespaceMeta is persisted alongside each namespace's data files.
+type namespaceMeta struct {
+	MemoryLimit int `json:"memoryLimit"`
+}
+
+// NewNamespaces creates a namespace manager around the default engine. Additional namespaces
+// are stored in a "namespaces" directory next to the default engine's data file and are
+// reopened automatically. Namespaces that fail to load are logged and skipped.
+func NewNamespaces(defaultEngine *Engine) *Namespaces {
+	n := &Namespaces{
+		engines: map[string]*Engine{DefaultNamespace: defaultEngine},
+		baseDir: filepath.Join(filepath.Dir(defaultEngine.filePath), namespacesDirName),
+	}
+
+	entries, err := os.ReadDir(n.baseDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error().Err(err).Msg("Failed to read namespaces directory")
+		}
+		return n
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !namespaceNamePattern.MatchString(name) || name == DefaultNamespace {
+			continue
+		}
+		e, err := n.open(name)
+		if err != nil {
+			log.Error().Err(err).Str("namespace", name).Msg("Failed to load namespace")
+			continue
+		}
+		n.engines[name] = e
+	}
+	return n
+}
+
+// open loads an existing namespace from disk.
+func (n *Namespaces) open(name string) (*Engine, error) {
+	dir := filepath.Join(n.baseDir, name)
+	raw, err := os.ReadFile(filepath.Join(dir, namespaceMetaFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace metadata: %w", err)
+	}
+
+	var meta namespaceMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode namespace metadata: %w", err)
+	}
+
+	e, err := NewEngine(filepath.Join(dir, namespaceDataFileName), filepath.Join(dir, namespaceFlushName), meta.MemoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	e.SetEvictionPolicy(n.engines[DefaultNamespace].EvictionPolicy())
+	e.SetCompactionRateLimit(n.engines[DefaultNamespace].CompactionRateLimit())
+	e.SetBlobThreshold(n.engines[DefaultNamespace].BlobThreshold())
+	e.SetLimits(n.engines[DefaultNamespace].Limits())
+	return e, nil
+}
+
+// Get returns the engine for a namespace.
+func (n *Namespaces) Get(name string) (*Engine, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	e, ok := n.engines[name]
+	if !ok {
+		return nil, ErrNamespaceNotFound
+	}
+	return e, nil
+}
+
+// Default returns the engine for the default namespace.
+func (n *Namespaces) Default() *Engine {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.engines[DefaultNamespace]
+}
+
+// Create creates a new namespace with its own memory limit and persistence files.
+// A memoryLimit of zero uses the default namespace's limit.
+func (n *Namespaces) Create(name string, memoryLimit int) (*Engine, error) {
+	if !namespaceNamePattern.MatchString(name) {
+		return nil, ErrInvalidNamespace
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, exists := n.engines[name]; exists {
+		return nil, ErrNamespaceExists
+	}
+	if memoryLimit == 0 {
+		memoryLimit = n.engines[DefaultNamespace].GetMemoryLimit()
+	}
+	if memoryLimit < 0 {
+		return nil, ErrInvalidMemoryLimit
+	}
+
+	dir := filepath.Join(n.baseDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create namespace directory: %w", err)
+	}
+
+	raw, err := json.Marshal(namespaceMeta{MemoryLimit: memoryLimit})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, namespaceMetaFileName), raw, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write namespace metadata: %w", err)
+	}
+
+	e, err := NewEngine(filepath.Join(dir, namespaceDataFileName), filepath.Join(dir, namespaceFlushName), memoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	e.SetEvictionPolicy(n.engines[DefaultNamespace].EvictionPolicy())
+	e.SetCompactionRateLimit(n.engines[DefaultNamespace].CompactionRateLimit())
+	e.SetBlobThreshold(n.engines[DefaultNamespace].BlobThreshold())
+	e.SetLimits(n.engines[DefaultNamespace].Limits())
+	n.engines[name] = e
+
+	log.Info().Str("namespace", name).Int("memoryLimit", memoryLimit).Msg("Namespace created")
+	return e, nil
+}
+
+// Drop stops a namespace's engine and deletes its data. The default namespace cannot be dropped.
+func (n *Namespaces) Drop(name string) error {
+	if name == DefaultNamespace {
+		return errors.New("the default namespace cannot be dropped")
+	}
+
+	n.mu.Lock()
+	e, ok := n.engines[name]
+	if !ok {
+		n.mu.Unlock()
+		return ErrNamespaceNotFound
+	}
+	delete(n.engines, name)
+	n.mu.Unlock()
+
+	e.Shutdown()
+	// Shutdown cancels a running compaction, wait for it to stop writing to the directory
+	e.compaction.running.Lock()
+	defer e.compaction.running.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(n.baseDir, name)); err != nil {
+		return fmt.Errorf("failed to remove namespace data: %w", err)
+	}
+
+	log.Info().Str("namespace", name).Msg("Namespace dropped")
+	return nil
+}
+
+// List returns every namespace with its usage, ordered by name.
+func (n *Namespaces) List() []NamespaceInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	infos := make([]NamespaceInfo, 0, len(n.engines))
+	for name, e := range n.engines {
+		infos = append(infos, NamespaceInfo{
+			Name:        name,
+			KeyCount:    e.KeyCount(),
+			MemoryUsage: e.MemoryUsage(),
+			MemoryLimit: e.GetMemoryLimit(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Owners returns what every owner stores, summed over the namespaces.
+func (n *Namespaces) Owners() map[string]OwnerUsage {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	usage := make(map[string]OwnerUsage)
+	for _, e := range n.engines {
+		for owner, u := range e.Owners() {
+			total := usage[owner]
+			total.Keys += u.Keys
+			total.Bytes += u.Bytes
+			usage[owner] = total
+		}
+	}
+	return usage
+}
+
+// OwnerUsage returns what owner stores, summed over the namespaces.
+func (n *Namespaces) OwnerUsage(owner string) OwnerUsage {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var usage OwnerUsage
+	for _, e := range n.engines {
+		u := e.OwnerUsage(owner)
+		usage.Keys += u.Keys
+		usage.Bytes += u.Bytes
+	}
+	return usage
+}
+
+// Stats returns the statistics of every namespace by name.
+func (n *Namespaces) Stats() map[string]Stats {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	stats := make(map[string]Stats, len(n.engines))
+	for name, e := range n.engines {
+		stats[name] = e.Stats()
+	}
+	return stats
+}
+
+// engineMap returns a copy of the engines by namespace name.
+func (n *Namespaces) engineMap() map[string]*Engine {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	engines := make(map[string]*Engine, len(n.engines))
+	for name, e := range n.engines {
+		engines[name] = e
+	}
+	return engines
+}
+
+// Health returns the health of every namespace by name.
+func (n *Namespaces) Health() map[string]Health {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	health := make(map[string]Health, len(n.engines))
+	for name, e := range n.engines {
+		health[name] = e.Health()
+	}
+	return health
+}
+
+// SetEvictionPolicy changes the eviction policy of every namespace. Namespaces created later
+// use the policy of the default namespace.
+func (n *Namespaces) SetEvictionPolicy(policy EvictionPolicy) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, e := range n.engines {
+		e.SetEvictionPolicy(policy)
+	}
+}
+
+// SetCompactionRateLimit limits the disk bandwidth of compactions in every namespace. Namespaces
+// created later use the limit of the default namespace.
+func (n *Namespaces) SetCompactionRateLimit(bytesPerSecond int64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, e := range n.engines {
+		e.SetCompactionRateLimit(bytesPerSecond)
+	}
+}
+
+// SetBlobThreshold sets the size above which streamed values are stored in chunk files in every
+// namespace. Namespaces created later use the threshold of the default namespace.
+func (n *Namespaces) SetBlobThreshold(bytes int64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, e := range n.engines {
+		e.SetBlobThreshold(bytes)
+	}
+}
+
+// SetLimits sets the key and value limits of every namespace. Namespaces created later use the
+// limits of the default namespace.
+func (n *Namespaces) SetLimits(limits Limits) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, e := range n.engines {
+		e.SetLimits(limits)
+	}
+}
+
+// Shutdown stops the background workers of every namespace.
+func (n *Namespaces) Shutdown() {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, e := range n.engines {
+		e.Shutdown()
+	}
+}
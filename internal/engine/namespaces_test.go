@@ -0,0 +1,83 @@
+package engine_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_NamespacesAreIsolated(t *testing.T) {
+	db := setupEngine(t, 1024)
+	namespaces := engine.NewNamespaces(db)
+
+	teamA, err := namespaces.Create("team-a", 512)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	_ = db.Set("shared", "default value")
+	_ = teamA.Set("shared", "team value")
+
+	value, _ := db.Get("shared")
+	if value != "default value" {
+		t.Errorf("Default namespace value was overwritten, got '%s'", value)
+	}
+	if teamA.GetMemoryLimit() != 512 {
+		t.Errorf("Expected namespace memory limit 512, got %d", teamA.GetMemoryLimit())
+	}
+
+	if _, err := namespaces.Create("team-a", 0); !errors.Is(err, engine.ErrNamespaceExists) {
+		t.Errorf("Expected ErrNamespaceExists, got %v", err)
+	}
+	if _, err := namespaces.Create("bad name", 0); !errors.Is(err, engine.ErrInvalidNamespace) {
+		t.Errorf("Expected ErrInvalidNamespace, got %v", err)
+	}
+	if _, err := namespaces.Create("team-b", -1); !errors.Is(err, engine.ErrInvalidMemoryLimit) {
+		t.Errorf("Expected ErrInvalidMemoryLimit, got %v", err)
+	}
+}
+
+func Test_NamespacesPersistAcrossInstances(t *testing.T) {
+	db := setupEngine(t, 1024)
+	namespaces := engine.NewNamespaces(db)
+
+	teamA, _ := namespaces.Create("team-a", 2048)
+	_ = teamA.Set("key", "value")
+	if err := teamA.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	reopened := engine.NewNamespaces(db)
+	restored, err := reopened.Get("team-a")
+	if err != nil {
+		t.Fatalf("Namespace was not restored: %v", err)
+	}
+	t.Cleanup(restored.Shutdown)
+
+	if value, err := restored.Get("key"); err != nil || value != "value" {
+		t.Errorf("Namespace data was not restored, got '%s', error: %v", value, err)
+	}
+	if restored.GetMemoryLimit() != 2048 {
+		t.Errorf("Namespace memory limit was not restored, got %d", restored.GetMemoryLimit())
+	}
+}
+
+func Test_DropNamespace(t *testing.T) {
+	db := setupEngine(t, 1024)
+	namespaces := engine.NewNamespaces(db)
+
+	_, _ = namespaces.Create("temp", 0)
+	if err := namespaces.Drop("temp"); err != nil {
+		t.Fatalf("Drop() failed: %v", err)
+	}
+	if _, err := namespaces.Get("temp"); !errors.Is(err, engine.ErrNamespaceNotFound) {
+		t.Errorf("Expected dropped namespace to be gone, got %v", err)
+	}
+	if err := namespaces.Drop(engine.DefaultNamespace); err == nil {
+		t.Error("Expected an error when dropping the default namespace")
+	}
+	if len(engine.NewNamespaces(db).List()) != 1 {
+		t.Error("Dropped namespace should not be restored")
+	}
+}
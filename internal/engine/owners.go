@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Keys may be owned by a client, for quotas. The engine counts the keys of each owner and the
+// bytes they store: key, value and metadata, with the contents of blob values. Keys evicted to
+// the flush file keep counting, since they are still stored. Owners are saved in a file next to
+// the data file and counted again on load.
+
+// ownersFileSuffix is appended to the data file path to store the owners of the keys.
+const ownersFileSuffix = ".owners"
+
+// OwnerUsage is what an owner stores
+type OwnerUsage struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// ownedKey is the owner of a key and the bytes counted for it
+type ownedKey struct {
+	owner string
+	bytes int64
+}
+
+// ownerRecord is the on-disk JSON encoding of the owner of a key, one record per line.
+type ownerRecord struct {
+	Key   string `json:"key"`
+	Owner string `json:"owner"`
+}
+
+// ownerIndex counts the keys and bytes of each owner. It is guarded by e.mu.
+type ownerIndex struct {
+	keys   map[string]ownedKey
+	usage  map[string]*OwnerUsage
+	claims map[string]string // Owner given to a key by its next write, see Claim
+}
+
+func newOwnerIndex() ownerIndex {
+	return ownerIndex{keys: make(map[string]ownedKey), usage: make(map[string]*OwnerUsage), claims: make(map[string]string)}
+}
+
+// set makes owner the owner of key, storing bytes
+func (o *ownerIndex) set(key, owner string, bytes int64) {
+	o.remove(key)
+	usage, ok := o.usage[owner]
+	if !ok {
+		usage = &OwnerUsage{}
+		o.usage[owner] = usage
+	}
+	usage.Keys++
+	usage.Bytes += bytes
+	o.keys[key] = ownedKey{owner: owner, bytes: bytes}
+}
+
+// remove removes key from the usage of its owner
+func (o *ownerIndex) remove(key string) {
+	owned, ok := o.keys[key]
+	if !ok {
+		return
+	}
+	delete(o.keys, key)
+	usage := o.usage[owned.owner]
+	usage.Keys--
+	usage.Bytes -= owned.bytes
+	if usage.Keys <= 0 {
+		delete(o.usage, owned.owner)
+	}
+}
+
+// storedSize returns the bytes key stores in memory, and false when it is not in memory.
+// It must be called with e.mu held.
+func (e *Engine) storedSize(key string) (int64, bool) {
+	if value, ok := e.data[key]; ok {
+		meta := e.meta[key]
+		size := int64(len(key) + len(value) + meta.size())
+		if meta.Blob != nil {
+			size += meta.Blob.Size
+		}
+		return size, true
+	}
+	if v, ok := e.typed[key]; ok {
+		return int64(len(key) + v.size()), true
+	}
+	return 0, false
+}
+
+// account updates the usage of the owner of key once a write or a delete changed it in memory.
+// A claimed key moves to the owner of the claim. It must be called with e.mu held.
+func (e *Engine) account(key string) {
+	size, exists := e.storedSize(key)
+	if !exists {
+		e.owners.remove(key)
+		return
+	}
+	owner, claimed := e.owners.claims[key]
+	if !claimed {
+		owned, ok := e.owners.keys[key]
+		if !ok {
+			return
+		}
+		owner = owned.owner
+	}
+	e.owners.set(key, owner, size)
+}
+
+// Claim makes owner the owner of keys as they are written, until release is called. A key
+// belongs to the client that last wrote it; when two claims of a key overlap, the last one wins.
+func (e *Engine) Claim(owner string, keys []string) (release func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, key := range keys {
+		e.owners.claims[key] = owner
+	}
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		for _, key := range keys {
+			if e.owners.claims[key] == owner {
+				delete(e.owners.claims, key)
+			}
+		}
+	}
+}
+
+// Owners returns what every owner stores
+func (e *Engine) Owners() map[string]OwnerUsage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	usage := make(map[string]OwnerUsage, len(e.owners.usage))
+	for owner, u := range e.owners.usage {
+		usage[owner] = *u
+	}
+	return usage
+}
+
+// OwnerUsage returns what owner stores
+func (e *Engine) OwnerUsage(owner string) OwnerUsage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if u, ok := e.owners.usage[owner]; ok {
+		return *u
+	}
+	return OwnerUsage{}
+}
+
+// Owned returns how many of keys owner owns and the bytes they store
+func (e *Engine) Owned(owner string, keys []string) OwnerUsage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var usage OwnerUsage
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if owned, ok := e.owners.keys[key]; ok && owned.owner == owner && !seen[key] {
+			seen[key] = true
+			usage.Keys++
+			usage.Bytes += owned.bytes
+		}
+	}
+	return usage
+}
+
+// copyOwners returns the owner of every owned key. It must be called with e.mu held.
+func (e *Engine) copyOwners() map[string]string {
+	owners := make(map[string]string, len(e.owners.keys))
+	for key, owned := range e.owners.keys {
+		owners[key] = owned.owner
+	}
+	return owners
+}
+
+// saveOwners writes the owners of the keys to the owners file, replacing its contents.
+func (e *Engine) saveOwners(owners map[string]string) error {
+	e.fileMu.Lock()
+	defer e.fileMu.Unlock()
+	if len(owners) == 0 {
+		if err := os.Remove(e.filePath + ownersFileSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return replaceFile(e.filePath+ownersFileSuffix, func(writer *bufio.Writer) error {
+		encoder := json.NewEncoder(writer)
+		for _, key := range sortedKeys(owners) {
+			if err := encoder.Encode(ownerRecord{Key: key, Owner: owners[key]}); err != nil {
+				return fmt.Errorf("failed to write owners: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// loadOwners counts the keys in memory that the owners file gives an owner. It must be called
+// with e.mu held, once every key is loaded.
+func (e *Engine) loadOwners() error {
+	e.owners = newOwnerIndex()
+	path := e.filePath + ownersFileSuffix
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open owners file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var rec ownerRecord
+		if err := decoder.Decode(&rec); err != nil {
+			return &CorruptedError{Path: path, Err: err}
+		}
+		// Keys deleted since the owners were saved are left out
+		if size, exists := e.storedSize(rec.Key); exists {
+			e.owners.set(rec.Key, rec.Owner, size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package engine_test
+
+import (
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_OwnerUsage(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	release := db.Claim("alice", []string{"name", "list"})
+	_ = db.Set("name", "Alice")
+	_, _ = db.LPush("list", "a", "bc")
+	release()
+	_ = db.Set("unowned", "value") // Keys written without a claim have no owner
+
+	if got, want := db.OwnerUsage("alice"), (engine.OwnerUsage{Keys: 2, Bytes: int64(len("name"+"Alice") + len("list"+"a"+"bc"))}); got != want {
+		t.Errorf("Expected usage %+v, got %+v", want, got)
+	}
+
+	// Writes update the bytes of the owner, whoever sends them
+	_, _ = db.LPop("list") // "bc", pushed last
+	_ = db.Set("name", "Al")
+	if got, want := db.OwnerUsage("alice"), (engine.OwnerUsage{Keys: 2, Bytes: int64(len("name"+"Al") + len("list"+"a"))}); got != want {
+		t.Errorf("Expected usage %+v, got %+v", want, got)
+	}
+	if got, want := db.Owned("alice", []string{"name", "name", "unowned"}), (engine.OwnerUsage{Keys: 1, Bytes: int64(len("name" + "Al"))}); got != want {
+		t.Errorf("Expected Owned() to return %+v, got %+v", want, got)
+	}
+
+	// The last claim of a key moves it to its client
+	release = db.Claim("bob", []string{"name"})
+	_ = db.Set("name", "Bob")
+	release()
+	owners := db.Owners()
+	if len(owners) != 2 || owners["alice"].Keys != 1 || owners["bob"].Keys != 1 {
+		t.Errorf("Expected alice and bob to own a key each, got %+v", owners)
+	}
+
+	_ = db.Delete("list")
+	if got := db.OwnerUsage("alice"); got != (engine.OwnerUsage{}) {
+		t.Errorf("Expected deleting the key of alice to free it, got %+v", got)
+	}
+
+	// Owners are saved and counted again on load
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	db.Shutdown()
+	db2, err := engine.NewEngine(testFilePath, testFlushPath, 1024)
+	if err != nil {
+		t.Fatalf("NewEngine() failed: %v", err)
+	}
+	defer db2.Shutdown()
+	if got, want := db2.OwnerUsage("bob"), (engine.OwnerUsage{Keys: 1, Bytes: int64(len("name" + "Bob"))}); got != want {
+		t.Errorf("Expected usage %+v after reload, got %+v", want, got)
+	}
+
+	if err := db2.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if owners := db2.Owners(); len(owners) != 0 {
+		t.Errorf("Expected Flush() to free every key, got %+v", owners)
+	}
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultTopKeys is the number of largest keys included in a snapshot when none is requested.
+const DefaultTopKeys = 10
+
+// sizeBuckets are the upper bounds, in bytes, of the key and value size histograms.
+var sizeBuckets = []int{16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Snapshot is a detailed, point-in-time view of an engine for introspection.
+type Snapshot struct {
+	Time                time.Time      `json:"time"`
+	KeyCount            int            `json:"key_count"`
+	StoreBytes          int            `json:"store_bytes"`
+	MemoryLimit         int            `json:"memory_limit"`
+	EvictionPolicy      EvictionPolicy `json:"eviction_policy"`
+	EvictionQueueLength int            `json:"eviction_queue_length"`
+	Files               []FileStats    `json:"files"`
+	LastSave            Operation      `json:"last_save"`
+	LastCompaction      Operation      `json:"last_compaction"`
+	PendingSave         bool           `json:"pending_save"`  // A save was requested and not yet started
+	PendingFlush        bool           `json:"pending_flush"` // A flush was requested and not yet started
+	Counters            Stats          `json:"counters"`
+	LargestKeys         []KeySize      `json:"largest_keys"`
+	KeySizes            []SizeBucket   `json:"key_sizes"`   // Histogram of key lengths
+	ValueSizes          []SizeBucket   `json:"value_sizes"` // Histogram of value sizes
+}
+
+// FileStats describes a persistence file. Records counts lines, so keys appended to the
+// flush file more than once are counted each time until the next compaction.
+type FileStats struct {
+	Path    string `json:"path"`
+	Exists  bool   `json:"exists"`
+	Bytes   int64  `json:"bytes"`
+	Records int    `json:"records"`
+}
+
+// KeySize is the in-memory size of a key and its value.
+type KeySize struct {
+	Key   string    `json:"key"`
+	Type  ValueType `json:"type"`
+	Bytes int       `json:"bytes"`
+}
+
+// SizeBucket counts sizes up to Max bytes that are larger than the previous bucket's Max.
+// The last bucket has no Max and counts everything larger.
+type SizeBucket struct {
+	Max   int `json:"max,omitempty"`
+	Count int `json:"count"`
+}
+
+// Snapshot returns a detailed view of the engine with the topKeys largest keys.
+// It walks every key under a read lock, so it is meant for admin tools rather than hot paths.
+func (e *Engine) Snapshot(topKeys int) Snapshot {
+	if topKeys < 0 {
+		topKeys = 0
+	}
+	snap := Snapshot{
+		Time:       time.Now(),
+		KeySizes:   newHistogram(),
+		ValueSizes: newHistogram(),
+	}
+	largest := &keySizeHeap{}
+
+	e.mu.RLock()
+	snap.KeyCount = len(e.data) + len(e.typed)
+	snap.StoreBytes = e.currentMemoryUsage
+	snap.MemoryLimit = e.memoryLimit
+	snap.EvictionPolicy = e.evictionPolicy
+	snap.EvictionQueueLength = len(e.evictionQueue)
+	snap.PendingSave = len(e.saveChan) > 0
+	snap.PendingFlush = len(e.flushChan) > 0
+	for key, value := range e.data {
+		size := len(value)
+		if blob := e.meta[key].Blob; blob != nil {
+			size = int(blob.Size) // Values in chunk files are sized by their contents
+		}
+		snap.recordSizes(key, size)
+		largest.offer(KeySize{Key: key, Type: TypeString, Bytes: len(key) + size}, topKeys)
+	}
+	for key, v := range e.typed {
+		size := v.size()
+		snap.recordSizes(key, size)
+		largest.offer(KeySize{Key: key, Type: v.kind, Bytes: len(key) + size}, topKeys)
+	}
+	filePath, flushPath := e.filePath, e.flushPath
+	e.mu.RUnlock()
+
+	snap.LargestKeys = largest.sorted()
+	snap.LastSave, snap.LastCompaction = e.health.lastOperations()
+	snap.Counters = e.Stats()
+
+	paths := []string{filePath, filePath + typedFileSuffix, flushPath, flushPath + typedFileSuffix,
+		flushPath + compactedFileSuffix, flushPath + compactedFileSuffix + typedFileSuffix}
+	snap.Files = make([]FileStats, len(paths))
+	files := make([]*os.File, len(paths))
+	// Only opening the files waits for saves and flushes, records are counted after
+	e.fileMu.Lock()
+	for i, path := range paths {
+		snap.Files[i], files[i] = openFileStats(path)
+	}
+	e.fileMu.Unlock()
+	for i, file := range files {
+		if file != nil {
+			snap.Files[i].Records = countRecords(file, snap.Files[i].Bytes)
+		}
+	}
+	return snap
+}
+
+func (s *Snapshot) recordSizes(key string, valueSize int) {
+	observe(s.KeySizes, len(key))
+	observe(s.ValueSizes, valueSize)
+}
+
+func newHistogram() []SizeBucket {
+	buckets := make([]SizeBucket, len(sizeBuckets)+1)
+	for i, max := range sizeBuckets {
+		buckets[i].Max = max
+	}
+	return buckets
+}
+
+func observe(buckets []SizeBucket, size int) {
+	i := sort.SearchInts(sizeBuckets, size)
+	buckets[i].Count++
+}
+
+// openFileStats opens a persistence file and returns its size, with the file to count its records.
+// Files are replaced by renames and only grow by appends, so the open file keeps the records
+// counted in the size until it is closed. The file is nil when it does not exist.
+func openFileStats(path string) (FileStats, *os.File) {
+	stats := FileStats{Path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		return stats, nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return stats, nil
+	}
+	stats.Exists = true
+	stats.Bytes = info.Size()
+	return stats, file
+}
+
+// countRecords counts the records of the first size bytes of file, one per line, and closes it.
+// Format headers are not records.
+func countRecords(file *os.File, size int64) int {
+	defer file.Close()
+	records := 0
+	reader := bufio.NewReaderSize(io.LimitReader(file, size), 64*1024)
+	for {
+		line, _, err := readLine(reader)
+		if err != nil {
+			return records
+		}
+		if string(line) != formatHeader {
+			records++
+		}
+	}
+}
+
+// keySizeHeap is a min-heap keeping the largest keys seen so far.
+type keySizeHeap []KeySize
+
+func (h keySizeHeap) Len() int           { return len(h) }
+func (h keySizeHeap) Less(i, j int) bool { return h[i].Bytes < h[j].Bytes }
+func (h keySizeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *keySizeHeap) Push(x any)        { *h = append(*h, x.(KeySize)) }
+func (h *keySizeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// offer keeps size if it is among the n largest seen so far.
+func (h *keySizeHeap) offer(size KeySize, n int) {
+	if n == 0 {
+		return
+	}
+	if h.Len() < n {
+		heap.Push(h, size)
+		return
+	}
+	if size.Bytes > (*h)[0].Bytes {
+		(*h)[0] = size
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the kept keys, largest first, ties ordered by key.
+func (h *keySizeHeap) sorted() []KeySize {
+	keys := append([]KeySize{}, *h...)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Bytes != keys[j].Bytes {
+			return keys[i].Bytes > keys[j].Bytes
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
@@ -0,0 +1,91 @@
+package engine_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_Snapshot(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+
+	_ = db.Set("small", "v")
+	_ = db.Set("medium", strings.Repeat("m", 100))
+	_ = db.Set("large", strings.Repeat("l", 2000))
+	_, _ = db.HSet("hash", map[string]string{"field": "value"})
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	snap := db.Snapshot(2)
+	if snap.KeyCount != 4 || snap.EvictionQueueLength != 4 || snap.MemoryLimit != 1<<20 {
+		t.Errorf("Unexpected size fields: %+v", snap)
+	}
+	if snap.StoreBytes != db.MemoryUsage() {
+		t.Errorf("Expected store bytes %d, got %d", db.MemoryUsage(), snap.StoreBytes)
+	}
+
+	if len(snap.LargestKeys) != 2 || snap.LargestKeys[0].Key != "large" || snap.LargestKeys[1].Key != "medium" {
+		t.Errorf("Expected the two largest keys, got %+v", snap.LargestKeys)
+	}
+	if snap.LargestKeys[0].Bytes != len("large")+2000 || snap.LargestKeys[0].Type != engine.TypeString {
+		t.Errorf("Unexpected largest key %+v", snap.LargestKeys[0])
+	}
+
+	count := func(buckets []engine.SizeBucket) (total int) {
+		for _, b := range buckets {
+			total += b.Count
+		}
+		return total
+	}
+	if count(snap.KeySizes) != 4 || count(snap.ValueSizes) != 4 {
+		t.Errorf("Expected every key in the histograms, got %+v and %+v", snap.KeySizes, snap.ValueSizes)
+	}
+	// 2000 bytes falls in the (1024, 4096] bucket
+	for _, b := range snap.ValueSizes {
+		if b.Max == 4096 && b.Count != 1 {
+			t.Errorf("Expected one value in the 4096 bucket, got %d", b.Count)
+		}
+	}
+
+	if snap.LastSave.Time.IsZero() || snap.LastSave.Error != "" {
+		t.Errorf("Expected the last save to be reported, got %+v", snap.LastSave)
+	}
+	if !snap.LastCompaction.Time.IsZero() {
+		t.Errorf("Expected no compaction yet, got %+v", snap.LastCompaction)
+	}
+
+	records := map[string]int{}
+	for _, f := range snap.Files {
+		if f.Exists {
+			records[f.Path] = f.Records
+		}
+	}
+	if records[testFilePath] != 3 || records[testFilePath+".types"] != 1 {
+		t.Errorf("Expected 3 string and 1 typed record on disk, got %v", records)
+	}
+}
+
+func Test_KeyCountIsSafeDuringWrites(t *testing.T) {
+	db := setupEngine(t, 1<<20)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = db.Set(strings.Repeat("k", i%20+1), "v")
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		_ = db.KeyCount()
+		_ = db.GetMemoryLimit()
+	}
+	wg.Wait()
+
+	if count := db.KeyCount(); count != 20 {
+		t.Errorf("Expected 20 keys, got %d", count)
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of an engine's size and cumulative background activity.
+type Stats struct {
+	KeyCount           int           `json:"key_count"`
+	MemoryUsage        int           `json:"memory_usage"`
+	MemoryLimit        int           `json:"memory_limit"`
+	Evictions          uint64        `json:"evictions"`
+	EvictedBytes       uint64        `json:"evicted_bytes"`
+	Saves              uint64        `json:"saves"`
+	SaveFailures       uint64        `json:"save_failures"`
+	SaveDuration       time.Duration `json:"save_duration_ns"` // Total time spent saving
+	CompactionRuns     uint64        `json:"compaction_runs"`
+	CompactionFailures uint64        `json:"compaction_failures"`
+	FlushFileBytes     int64         `json:"flush_file_bytes"`     // Flushed data not compacted yet
+	CompactedFileBytes int64         `json:"compacted_file_bytes"` // Flushed data merged by compactions
+}
+
+// engineCounters are updated by the background workers without holding e.mu
+type engineCounters struct {
+	evictions          atomic.Uint64
+	evictedBytes       atomic.Uint64
+	saves              atomic.Uint64
+	saveFailures       atomic.Uint64
+	saveNanos          atomic.Uint64
+	compactionRuns     atomic.Uint64
+	compactionFailures atomic.Uint64
+}
+
+// Stats returns a consistent snapshot of the engine's size and counters.
+func (e *Engine) Stats() Stats {
+	e.mu.RLock()
+	stats := Stats{
+		KeyCount:    len(e.data) + len(e.typed),
+		MemoryUsage: e.currentMemoryUsage,
+		MemoryLimit: e.memoryLimit,
+	}
+	flushPath := e.flushPath
+	e.mu.RUnlock()
+
+	stats.Evictions = e.counters.evictions.Load()
+	stats.EvictedBytes = e.counters.evictedBytes.Load()
+	stats.Saves = e.counters.saves.Load()
+	stats.SaveFailures = e.counters.saveFailures.Load()
+	stats.SaveDuration = time.Duration(e.counters.saveNanos.Load())
+	stats.CompactionRuns = e.counters.compactionRuns.Load()
+	stats.CompactionFailures = e.counters.compactionFailures.Load()
+	// Flush files being compacted count until the compaction finishes
+	for _, path := range []string{flushPath, flushPath + typedFileSuffix, flushPath + compactingFileSuffix, flushPath + compactingFileSuffix + typedFileSuffix} {
+		if info, err := os.Stat(path); err == nil {
+			stats.FlushFileBytes += info.Size()
+		}
+	}
+	for _, path := range []string{flushPath + compactedFileSuffix, flushPath + compactedFileSuffix + typedFileSuffix} {
+		if info, err := os.Stat(path); err == nil {
+			stats.CompactedFileBytes += info.Size()
+		}
+	}
+	return stats
+}
+
+// recordSave counts a save that started at start and finished with err.
+func (e *Engine) recordSave(start time.Time, err error) {
+	e.counters.saves.Add(1)
+	e.counters.saveNanos.Add(uint64(time.Since(start)))
+	e.health.recordSaveResult(start, err)
+	if err != nil {
+		e.counters.saveFailures.Add(1)
+	}
+}
+
+// recordEviction counts keys moved to the flushed tier.
+func (e *Engine) recordEviction(keys, bytes int) {
+	e.counters.evictions.Add(uint64(keys))
+	e.counters.evictedBytes.Add(uint64(bytes))
+}
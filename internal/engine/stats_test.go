@@ -0,0 +1,37 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_StatsCountBackgroundWork(t *testing.T) {
+	db := setupEngine(t, 30)
+
+	_ = db.Set("k1", "value1")
+	_ = db.Set("k2", "value2")
+	_ = db.Set("k3", "value3")
+	_ = db.Set("k4", "value4")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for db.Stats().Evictions == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	stats := db.Stats()
+	if stats.Evictions != 1 || stats.EvictedBytes != 8 {
+		t.Errorf("Expected 1 eviction of 8 bytes, got %d evictions of %d bytes", stats.Evictions, stats.EvictedBytes)
+	}
+	if stats.Saves == 0 || stats.SaveDuration <= 0 {
+		t.Errorf("Expected saves to be counted, got %d saves taking %v", stats.Saves, stats.SaveDuration)
+	}
+	if stats.FlushFileBytes == 0 {
+		t.Error("Expected the flushed tier to have a size after an eviction")
+	}
+	if stats.MemoryLimit != 30 || stats.KeyCount == 0 {
+		t.Errorf("Unexpected size stats: %+v", stats)
+	}
+}
@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/bendigiorgio/go-kv/internal/tracing"
+)
+
+// startSpan starts a span for an engine operation when ctx is already traced.
+// Untraced calls, such as those from tests or background workers, record nothing.
+func (e *Engine) startSpan(ctx context.Context, name string) (context.Context, *tracing.Span) {
+	if tracing.SpanFromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return tracing.Start(ctx, name)
+}
+
+// lock acquires e.mu for writing, recording the wait as a span when ctx is traced.
+func (e *Engine) lock(ctx context.Context) {
+	_, span := e.startSpan(ctx, "engine.lock.wait")
+	span.SetAttribute("mode", "write")
+	e.mu.Lock()
+	span.End()
+}
+
+// rlock acquires e.mu for reading, recording the wait as a span when ctx is traced.
+func (e *Engine) rlock(ctx context.Context) {
+	_, span := e.startSpan(ctx, "engine.lock.wait")
+	span.SetAttribute("mode", "read")
+	e.mu.RLock()
+	span.End()
+}
@@ -0,0 +1,762 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// ValueType identifies the kind of value stored under a key.
+type ValueType string
+
+const (
+	TypeString ValueType = "string"
+	TypeHash   ValueType = "hash"
+	TypeList   ValueType = "list"
+	TypeSet    ValueType = "set"
+	TypeZSet   ValueType = "zset"
+)
+
+// ErrWrongType is returned when an operation is used against a key holding a different kind of value.
+var ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
+// ErrFieldNotFound is returned for hash fields that do not exist.
+var ErrFieldNotFound = errors.New("field not found")
+
+// ErrInvalidScore is returned for sorted set scores that are NaN or infinite, which cannot be saved.
+var ErrInvalidScore = errors.New("score must be a finite number")
+
+// typedFileSuffix is appended to the data and flush file paths to store typed values.
+const typedFileSuffix = ".types"
+
+// zsetScoreSize is the number of bytes accounted for each sorted set score.
+const zsetScoreSize = 8
+
+// ZMember is a member of a sorted set together with its score.
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// typedValue holds the contents of a hash, list, set or sorted set.
+// Only the field matching kind is populated.
+type typedValue struct {
+	kind ValueType
+	hash map[string]string
+	list []string
+	set  map[string]struct{}
+	zset map[string]float64
+}
+
+// typedRecord is the on-disk JSON encoding of a typed value, one record per line.
+type typedRecord struct {
+	Key  string             `json:"key"`
+	Type ValueType          `json:"type"`
+	Hash map[string]string  `json:"hash,omitempty"`
+	List []string           `json:"list,omitempty"`
+	Set  []string           `json:"set,omitempty"`
+	ZSet map[string]float64 `json:"zset,omitempty"`
+}
+
+func newTypedValue(kind ValueType) *typedValue {
+	v := &typedValue{kind: kind}
+	switch kind {
+	case TypeHash:
+		v.hash = make(map[string]string)
+	case TypeSet:
+		v.set = make(map[string]struct{})
+	case TypeZSet:
+		v.zset = make(map[string]float64)
+	}
+	return v
+}
+
+// size returns the number of bytes accounted for the value's contents.
+func (v *typedValue) size() int {
+	size := 0
+	switch v.kind {
+	case TypeHash:
+		for field, value := range v.hash {
+			size += len(field) + len(value)
+		}
+	case TypeList:
+		for _, item := range v.list {
+			size += len(item)
+		}
+	case TypeSet:
+		for member := range v.set {
+			size += len(member)
+		}
+	case TypeZSet:
+		for member := range v.zset {
+			size += len(member) + zsetScoreSize
+		}
+	}
+	return size
+}
+
+// empty reports whether the value no longer holds any elements.
+func (v *typedValue) empty() bool {
+	switch v.kind {
+	case TypeHash:
+		return len(v.hash) == 0
+	case TypeList:
+		return len(v.list) == 0
+	case TypeSet:
+		return len(v.set) == 0
+	case TypeZSet:
+		return len(v.zset) == 0
+	}
+	return true
+}
+
+// clone returns a deep copy of the value, used when snapshotting for saves.
+func (v *typedValue) clone() *typedValue {
+	c := newTypedValue(v.kind)
+	switch v.kind {
+	case TypeHash:
+		for field, value := range v.hash {
+			c.hash[field] = value
+		}
+	case TypeList:
+		c.list = append([]string(nil), v.list...)
+	case TypeSet:
+		for member := range v.set {
+			c.set[member] = struct{}{}
+		}
+	case TypeZSet:
+		for member, score := range v.zset {
+			c.zset[member] = score
+		}
+	}
+	return c
+}
+
+// sortedZSet returns the members of a sorted set ordered by score, then member.
+func (v *typedValue) sortedZSet() []ZMember {
+	members := make([]ZMember, 0, len(v.zset))
+	for member, score := range v.zset {
+		members = append(members, ZMember{Member: member, Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members
+}
+
+// Type returns the kind of value stored under key.
+func (e *Engine) Type(key string) (ValueType, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if _, ok := e.data[key]; ok {
+		return TypeString, nil
+	}
+	if v, ok := e.typed[key]; ok {
+		return v.kind, nil
+	}
+	return "", ErrNotFound
+}
+
+// typedValueFor looks up the typed value stored under key. If create is true a
+// missing key is initialised with an empty value of the requested kind.
+// It must be called with e.mu held.
+func (e *Engine) typedValueFor(key string, kind ValueType, create bool) (*typedValue, error) {
+	if _, ok := e.data[key]; ok {
+		return nil, ErrWrongType
+	}
+	v, ok := e.typed[key]
+	if ok {
+		if v.kind != kind {
+			return nil, ErrWrongType
+		}
+		e.touch(key)
+		return v, nil
+	}
+	if !create {
+		return nil, nil
+	}
+	if err := e.Limits().CheckKey(key); err != nil {
+		return nil, err
+	}
+
+	v = newTypedValue(kind)
+	e.typed[key] = v
+	e.evictionQueue = append(e.evictionQueue, key)
+	e.currentMemoryUsage += len(key)
+	e.touch(key)
+	return v, nil
+}
+
+// checkElement applies the value size limit and the memory limit of Set to an element of
+// size bytes added to the typed value at key. It must be called with e.mu held.
+func (e *Engine) checkElement(key string, size int) error {
+	if err := e.Limits().CheckValue(int64(size)); err != nil {
+		return err
+	}
+	if len(key)+size > e.memoryLimit {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// removeTypedIfEmpty deletes a typed key once its last element is removed.
+// It must be called with e.mu held.
+func (e *Engine) removeTypedIfEmpty(key string, v *typedValue) {
+	if !v.empty() {
+		return
+	}
+	delete(e.typed, key)
+	e.removeFromEvictionQueue(key)
+	e.currentMemoryUsage -= len(key)
+}
+
+// HSet sets fields in the hash stored at key and returns the number of fields that were added.
+func (e *Engine) HSet(key string, fields map[string]string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	for field, value := range fields {
+		if err := e.checkElement(key, len(field)+len(value)); err != nil {
+			return 0, err
+		}
+	}
+	v, err := e.typedValueFor(key, TypeHash, true)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for field, value := range fields {
+		if old, exists := v.hash[field]; exists {
+			e.currentMemoryUsage -= len(field) + len(old)
+		} else {
+			added++
+		}
+		v.hash[field] = value
+		e.currentMemoryUsage += len(field) + len(value)
+	}
+	e.removeTypedIfEmpty(key, v)
+	e.account(key)
+
+	e.triggerWrite()
+	return added, nil
+}
+
+// HGet returns the value of a field in the hash stored at key.
+func (e *Engine) HGet(key, field string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeHash, false)
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		return "", ErrNotFound
+	}
+	value, ok := v.hash[field]
+	if !ok {
+		return "", ErrFieldNotFound
+	}
+	return value, nil
+}
+
+// HDel removes fields from the hash stored at key and returns the number of fields removed.
+func (e *Engine) HDel(key string, fields ...string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	v, err := e.typedValueFor(key, TypeHash, false)
+	if err != nil || v == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, field := range fields {
+		if value, exists := v.hash[field]; exists {
+			e.currentMemoryUsage -= len(field) + len(value)
+			delete(v.hash, field)
+			removed++
+		}
+	}
+	e.removeTypedIfEmpty(key, v)
+	e.account(key)
+
+	if removed > 0 {
+		e.triggerSave()
+	}
+	return removed, nil
+}
+
+// HGetAll returns a copy of all fields and values in the hash stored at key.
+func (e *Engine) HGetAll(key string) (map[string]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeHash, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	if v == nil {
+		return result, nil
+	}
+	for field, value := range v.hash {
+		result[field] = value
+	}
+	return result, nil
+}
+
+// LPush prepends values to the list stored at key and returns the new length of the list.
+func (e *Engine) LPush(key string, values ...string) (int, error) {
+	return e.push(key, values, true)
+}
+
+// RPush appends values to the list stored at key and returns the new length of the list.
+func (e *Engine) RPush(key string, values ...string) (int, error) {
+	return e.push(key, values, false)
+}
+
+func (e *Engine) push(key string, values []string, head bool) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if len(values) == 0 {
+		v, err := e.typedValueFor(key, TypeList, false)
+		if err != nil || v == nil {
+			return 0, err
+		}
+		return len(v.list), nil
+	}
+
+	for _, value := range values {
+		if err := e.checkElement(key, len(value)); err != nil {
+			return 0, err
+		}
+	}
+	v, err := e.typedValueFor(key, TypeList, true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		if head {
+			v.list = append([]string{value}, v.list...)
+		} else {
+			v.list = append(v.list, value)
+		}
+		e.currentMemoryUsage += len(value)
+	}
+	e.account(key)
+
+	e.triggerWrite()
+	return len(v.list), nil
+}
+
+// LPop removes and returns the first element of the list stored at key.
+func (e *Engine) LPop(key string) (string, error) {
+	return e.pop(key, true)
+}
+
+// RPop removes and returns the last element of the list stored at key.
+func (e *Engine) RPop(key string) (string, error) {
+	return e.pop(key, false)
+}
+
+func (e *Engine) pop(key string, head bool) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return "", ErrReadOnly
+	}
+
+	v, err := e.typedValueFor(key, TypeList, false)
+	if err != nil {
+		return "", err
+	}
+	if v == nil || len(v.list) == 0 {
+		return "", ErrNotFound
+	}
+
+	var value string
+	if head {
+		value = v.list[0]
+		v.list = v.list[1:]
+	} else {
+		value = v.list[len(v.list)-1]
+		v.list = v.list[:len(v.list)-1]
+	}
+	e.currentMemoryUsage -= len(value)
+	e.removeTypedIfEmpty(key, v)
+	e.account(key)
+
+	e.triggerSave()
+	return value, nil
+}
+
+// LRange returns the elements of the list stored at key between start and stop (inclusive).
+// Negative indexes count from the end of the list, so -1 is the last element.
+func (e *Engine) LRange(key string, start, stop int) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeList, false)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []string{}, nil
+	}
+
+	from, to, ok := normaliseRange(start, stop, len(v.list))
+	if !ok {
+		return []string{}, nil
+	}
+	return append([]string(nil), v.list[from:to]...), nil
+}
+
+// SAdd adds members to the set stored at key and returns the number of members that were added.
+func (e *Engine) SAdd(key string, members ...string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if len(members) == 0 {
+		_, err := e.typedValueFor(key, TypeSet, false)
+		return 0, err
+	}
+
+	for _, member := range members {
+		if err := e.checkElement(key, len(member)); err != nil {
+			return 0, err
+		}
+	}
+	v, err := e.typedValueFor(key, TypeSet, true)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, member := range members {
+		if _, exists := v.set[member]; exists {
+			continue
+		}
+		v.set[member] = struct{}{}
+		e.currentMemoryUsage += len(member)
+		added++
+	}
+	e.account(key)
+
+	e.triggerWrite()
+	return added, nil
+}
+
+// SRem removes members from the set stored at key and returns the number of members removed.
+func (e *Engine) SRem(key string, members ...string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	v, err := e.typedValueFor(key, TypeSet, false)
+	if err != nil || v == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if _, exists := v.set[member]; exists {
+			delete(v.set, member)
+			e.currentMemoryUsage -= len(member)
+			removed++
+		}
+	}
+	e.removeTypedIfEmpty(key, v)
+	e.account(key)
+
+	if removed > 0 {
+		e.triggerSave()
+	}
+	return removed, nil
+}
+
+// SMembers returns the members of the set stored at key in lexicographical order.
+func (e *Engine) SMembers(key string) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeSet, false)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []string{}
+	if v == nil {
+		return members, nil
+	}
+	for member := range v.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// SIsMember reports whether member belongs to the set stored at key.
+func (e *Engine) SIsMember(key, member string) (bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeSet, false)
+	if err != nil || v == nil {
+		return false, err
+	}
+	_, ok := v.set[member]
+	return ok, nil
+}
+
+// ZAdd adds members to the sorted set stored at key, updating the score of existing members.
+// It returns the number of members that were added.
+func (e *Engine) ZAdd(key string, members ...ZMember) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) || math.IsInf(m.Score, 0) {
+			return 0, fmt.Errorf("%w: %v for member %q", ErrInvalidScore, m.Score, m.Member)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if len(members) == 0 {
+		_, err := e.typedValueFor(key, TypeZSet, false)
+		return 0, err
+	}
+
+	for _, m := range members {
+		if err := e.checkElement(key, len(m.Member)+zsetScoreSize); err != nil {
+			return 0, err
+		}
+	}
+	v, err := e.typedValueFor(key, TypeZSet, true)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, m := range members {
+		if _, exists := v.zset[m.Member]; !exists {
+			e.currentMemoryUsage += len(m.Member) + zsetScoreSize
+			added++
+		}
+		v.zset[m.Member] = m.Score
+	}
+	e.account(key)
+
+	e.triggerWrite()
+	return added, nil
+}
+
+// ZRange returns the members of the sorted set stored at key between the ranks start and stop (inclusive).
+// Negative ranks count from the highest scored member.
+func (e *Engine) ZRange(key string, start, stop int) ([]ZMember, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeZSet, false)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []ZMember{}, nil
+	}
+
+	members := v.sortedZSet()
+	from, to, ok := normaliseRange(start, stop, len(members))
+	if !ok {
+		return []ZMember{}, nil
+	}
+	return members[from:to], nil
+}
+
+// ZRangeByScore returns the members of the sorted set stored at key with a score between min and max (inclusive).
+func (e *Engine) ZRangeByScore(key string, min, max float64) ([]ZMember, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := e.typedValueFor(key, TypeZSet, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []ZMember{}
+	if v == nil {
+		return result, nil
+	}
+	for _, m := range v.sortedZSet() {
+		if m.Score >= min && m.Score <= max {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// normaliseRange converts inclusive, possibly negative, start and stop indexes into
+// slice bounds for a collection of the given length.
+func normaliseRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// copyTyped returns a deep copy of the typed values, used when snapshotting for saves.
+// It must be called with e.mu held.
+func (e *Engine) copyTyped() map[string]*typedValue {
+	snapshot := make(map[string]*typedValue, len(e.typed))
+	for k, v := range e.typed {
+		snapshot[k] = v.clone()
+	}
+	return snapshot
+}
+
+func writeTypedFile(path string, data map[string]*typedValue, flag int) error {
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open typed file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 64*1024) // 64 KB buffer
+	if err := writeTypedRecords(writer, data); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// writeTypedRecords encodes the typed values as JSON lines sorted by key.
+func writeTypedRecords(writer *bufio.Writer, data map[string]*typedValue) error {
+	encoder := json.NewEncoder(writer)
+	for _, key := range sortedKeys(data) {
+		if err := encoder.Encode(data[key].record(key)); err != nil {
+			return fmt.Errorf("failed to write typed data: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadTypedFile loads typed values from the typed file next to filePath.
+// Later records for the same key replace earlier ones.
+func (e *Engine) loadTypedFile(filePath string) (map[string]*typedValue, error) {
+	file, err := os.Open(filePath + typedFileSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]*typedValue), nil
+		}
+		return nil, fmt.Errorf("failed to open typed file: %w", err)
+	}
+	defer file.Close()
+	return decodeTypedRecords(file, filePath+typedFileSuffix)
+}
+
+// decodeTypedRecords decodes the typed values read from r, the contents of the typed file at
+// path. Later records for the same key replace earlier ones.
+func decodeTypedRecords(r io.Reader, path string) (map[string]*typedValue, error) {
+	data := make(map[string]*typedValue)
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for decoder.More() {
+		var rec typedRecord
+		if err := decoder.Decode(&rec); err != nil {
+			return nil, &CorruptedError{Path: path, Err: err}
+		}
+		v, err := rec.value()
+		if err != nil {
+			return nil, &CorruptedError{Path: path, Err: err}
+		}
+		data[rec.Key] = v
+	}
+	return data, nil
+}
+
+func (v *typedValue) record(key string) typedRecord {
+	rec := typedRecord{Key: key, Type: v.kind}
+	switch v.kind {
+	case TypeHash:
+		rec.Hash = v.hash
+	case TypeList:
+		rec.List = v.list
+	case TypeSet:
+		rec.Set = make([]string, 0, len(v.set))
+		for member := range v.set {
+			rec.Set = append(rec.Set, member)
+		}
+	case TypeZSet:
+		rec.ZSet = v.zset
+	}
+	return rec
+}
+
+func (rec typedRecord) value() (*typedValue, error) {
+	v := newTypedValue(rec.Type)
+	switch rec.Type {
+	case TypeHash:
+		for field, value := range rec.Hash {
+			v.hash[field] = value
+		}
+	case TypeList:
+		v.list = append(v.list, rec.List...)
+	case TypeSet:
+		for _, member := range rec.Set {
+			v.set[member] = struct{}{}
+		}
+	case TypeZSet:
+		for member, score := range rec.ZSet {
+			v.zset[member] = score
+		}
+	default:
+		return nil, fmt.Errorf("unknown value type %q for key %q", rec.Type, rec.Key)
+	}
+	return v, nil
+}
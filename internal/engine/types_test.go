@@ -0,0 +1,193 @@
+package engine_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+func Test_HashOperations(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	added, err := db.HSet("user", map[string]string{"name": "Alice", "city": "Paris"})
+	if err != nil || added != 2 {
+		t.Fatalf("HSet() = %d, %v; expected 2 fields added", added, err)
+	}
+
+	value, err := db.HGet("user", "name")
+	if err != nil || value != "Alice" {
+		t.Errorf("HGet() = '%s', %v; expected 'Alice'", value, err)
+	}
+
+	removed, _ := db.HDel("user", "city", "missing")
+	if removed != 1 {
+		t.Errorf("HDel() removed %d fields, expected 1", removed)
+	}
+
+	all, _ := db.HGetAll("user")
+	if !reflect.DeepEqual(all, map[string]string{"name": "Alice"}) {
+		t.Errorf("HGetAll() returned incorrect data: %v", all)
+	}
+}
+
+func Test_ListOperations(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_, _ = db.RPush("queue", "b", "c")
+	length, err := db.LPush("queue", "a")
+	if err != nil || length != 3 {
+		t.Fatalf("LPush() = %d, %v; expected length 3", length, err)
+	}
+
+	values, _ := db.LRange("queue", 0, -1)
+	if !reflect.DeepEqual(values, []string{"a", "b", "c"}) {
+		t.Errorf("LRange() returned %v", values)
+	}
+
+	first, _ := db.LPop("queue")
+	last, _ := db.RPop("queue")
+	if first != "a" || last != "c" {
+		t.Errorf("Expected to pop 'a' and 'c', got '%s' and '%s'", first, last)
+	}
+
+	_, _ = db.LPop("queue")
+	if _, err := db.LPop("queue"); err == nil {
+		t.Error("Expected error when popping an empty list, got nil")
+	}
+	if db.KeyCount() != 0 {
+		t.Error("Empty list should be removed from the store")
+	}
+}
+
+func Test_SetOperations(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	added, _ := db.SAdd("tags", "go", "kv", "go")
+	if added != 2 {
+		t.Errorf("SAdd() added %d members, expected 2", added)
+	}
+
+	isMember, _ := db.SIsMember("tags", "kv")
+	if !isMember {
+		t.Error("Expected 'kv' to be a member of the set")
+	}
+
+	_, _ = db.SRem("tags", "kv")
+	members, _ := db.SMembers("tags")
+	if !reflect.DeepEqual(members, []string{"go"}) {
+		t.Errorf("SMembers() returned %v", members)
+	}
+}
+
+func Test_SortedSetOperations(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_, _ = db.ZAdd("scores",
+		engine.ZMember{Member: "carol", Score: 30},
+		engine.ZMember{Member: "alice", Score: 10},
+		engine.ZMember{Member: "bob", Score: 20},
+	)
+	// Updating a score should not add a new member
+	added, _ := db.ZAdd("scores", engine.ZMember{Member: "alice", Score: 25})
+	if added != 0 {
+		t.Errorf("ZAdd() added %d members when updating a score, expected 0", added)
+	}
+
+	ranked, _ := db.ZRange("scores", 0, -1)
+	expected := []engine.ZMember{{Member: "bob", Score: 20}, {Member: "alice", Score: 25}, {Member: "carol", Score: 30}}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("ZRange() returned %v", ranked)
+	}
+
+	byScore, _ := db.ZRangeByScore("scores", 21, 30)
+	if len(byScore) != 2 || byScore[0].Member != "alice" {
+		t.Errorf("ZRangeByScore() returned %v", byScore)
+	}
+
+	// Scores that cannot be saved are rejected
+	for _, score := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := db.ZAdd("scores", engine.ZMember{Member: "dave", Score: score}); !errors.Is(err, engine.ErrInvalidScore) {
+			t.Errorf("Expected ErrInvalidScore for %v, got %v", score, err)
+		}
+	}
+}
+
+func Test_TypedMemoryLimit(t *testing.T) {
+	db := setupEngine(t, 16)
+
+	if _, err := db.SAdd("set", strings.Repeat("x", 16)); !errors.Is(err, engine.ErrMemoryLimit) {
+		t.Errorf("Expected ErrMemoryLimit for a member larger than the memory limit, got %v", err)
+	}
+	if _, err := db.HSet("hash", map[string]string{"field": strings.Repeat("x", 8)}); !errors.Is(err, engine.ErrMemoryLimit) {
+		t.Errorf("Expected ErrMemoryLimit for a field larger than the memory limit, got %v", err)
+	}
+}
+
+func Test_WrongTypeOperations(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_ = db.Set("plain", "value")
+	if _, err := db.LPush("plain", "x"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for LPush on a string, got %v", err)
+	}
+
+	_, _ = db.SAdd("members", "a")
+	if _, err := db.Get("members"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for Get on a set, got %v", err)
+	}
+
+	// Set replaces a typed value
+	_ = db.Set("members", "now a string")
+	if kind, _ := db.Type("members"); kind != engine.TypeString {
+		t.Errorf("Expected key to hold a string after Set, got %s", kind)
+	}
+}
+
+func Test_TypedMemoryAccounting(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_, _ = db.HSet("h", map[string]string{"field": "value"})
+	if db.MemoryUsage() != len("h")+len("field")+len("value") {
+		t.Errorf("Unexpected memory usage after HSet: %d", db.MemoryUsage())
+	}
+
+	_ = db.Delete("h")
+	if db.MemoryUsage() != 0 {
+		t.Errorf("Memory usage should return to zero after deletion, got %d", db.MemoryUsage())
+	}
+}
+
+func Test_TypedValuesPersistAcrossInstances(t *testing.T) {
+	db := setupEngine(t, 1024)
+
+	_, _ = db.HSet("h", map[string]string{"a": "1"})
+	_, _ = db.RPush("l", "x", "y")
+	_, _ = db.SAdd("s", "m")
+	_, _ = db.ZAdd("z", engine.ZMember{Member: "m", Score: 1.5})
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	db2, _ := engine.NewEngine(testFilePath, testFlushPath, 1024)
+	t.Cleanup(db2.Shutdown)
+
+	if value, err := db2.HGet("h", "a"); err != nil || value != "1" {
+		t.Errorf("Hash did not persist, got '%s', error: %v", value, err)
+	}
+	if values, _ := db2.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"x", "y"}) {
+		t.Errorf("List did not persist, got %v", values)
+	}
+	if ok, _ := db2.SIsMember("s", "m"); !ok {
+		t.Error("Set did not persist")
+	}
+	if members, _ := db2.ZRange("z", 0, -1); len(members) != 1 || members[0].Score != 1.5 {
+		t.Errorf("Sorted set did not persist, got %v", members)
+	}
+	if db2.MemoryUsage() != db.MemoryUsage() {
+		t.Errorf("Expected memory usage %d after reload, got %d", db.MemoryUsage(), db2.MemoryUsage())
+	}
+}
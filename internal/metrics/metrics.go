@@ -0,0 +1,264 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the latency histogram bounds in seconds
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// ContentType is the Prometheus text exposition format served by Handler
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Sample is a single value of a metric family, identified by its label values
+type Sample struct {
+	Labels []string // Values in the order of the family's label names
+	Value  float64
+}
+
+// Registry holds metric families and writes them in the Prometheus text exposition format
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// family is a metric written to the exposition
+type family interface {
+	write(w io.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// Write writes every registered metric in registration order
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		r.Write(w)
+	})
+}
+
+// CounterVec is a monotonically increasing value per combination of label values
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]*Sample
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*Sample)}
+	r.register(c)
+	return c
+}
+
+// Add increases the counter for the label values by delta
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &Sample{Labels: labelValues}
+		c.values[key] = sample
+	}
+	sample.Value += delta
+}
+
+// Inc increases the counter for the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, sample := range c.values {
+		samples = append(samples, *sample)
+	}
+	c.mu.Unlock()
+
+	writeFamily(w, c.name, c.help, "counter", c.labels, samples)
+}
+
+// HistogramVec counts observations into cumulative buckets per combination of label values
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	values     map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // Per bucket, not cumulative; the last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram with sorted upper bucket bounds and the given label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+	r.register(h)
+	return h
+}
+
+// Observe records a value for the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{labels: labelValues, counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hist
+	}
+	hist.counts[sort.SearchFloat64s(h.buckets, value)]++
+	hist.sum += value
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	hists := make([]*histogram, 0, len(h.values))
+	for _, hist := range h.values {
+		hists = append(hists, hist)
+	}
+	sort.Slice(hists, func(i, j int) bool { return labelKey(hists[i].labels) < labelKey(hists[j].labels) })
+
+	labelNames := append(append([]string(nil), h.labels...), "le")
+	for _, hist := range hists {
+		var cumulative uint64
+		for i, count := range hist.counts {
+			cumulative += count
+			bound := math.Inf(1)
+			if i < len(h.buckets) {
+				bound = h.buckets[i]
+			}
+			labelValues := append(append([]string(nil), hist.labels...), formatValue(bound))
+			writeSample(w, h.name+"_bucket", labelNames, labelValues, float64(cumulative))
+		}
+		writeSample(w, h.name+"_sum", h.labels, hist.labels, hist.sum)
+		writeSample(w, h.name+"_count", h.labels, hist.labels, float64(hist.count))
+	}
+}
+
+// collector writes samples computed at scrape time
+type collector struct {
+	name, help, kind string
+	labels           []string
+	collect          func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are computed by collect on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, collect func() []Sample, labels ...string) {
+	r.register(&collector{name: name, help: help, kind: "gauge", labels: labels, collect: collect})
+}
+
+// NewCounterFunc registers a counter whose samples are computed by collect on every scrape
+func (r *Registry) NewCounterFunc(name, help string, collect func() []Sample, labels ...string) {
+	r.register(&collector{name: name, help: help, kind: "counter", labels: labels, collect: collect})
+}
+
+func (c *collector) write(w io.Writer) {
+	writeFamily(w, c.name, c.help, c.kind, c.labels, c.collect())
+}
+
+func writeFamily(w io.Writer, name, help, kind string, labels []string, samples []Sample) {
+	writeHeader(w, name, help, kind)
+	sort.Slice(samples, func(i, j int) bool { return labelKey(samples[i].Labels) < labelKey(samples[j].Labels) })
+	for _, sample := range samples {
+		writeSample(w, name, labels, sample.Labels, sample.Value)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func writeSample(w io.Writer, name string, labelNames, labelValues []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labelNames) > 0 {
+		b.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			labelValue := ""
+			if i < len(labelValues) {
+				labelValue = labelValues[i]
+			}
+			b.WriteString(labelName + `="` + escapeLabel(labelValue) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(value))
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func labelKey(labels []string) string {
+	return strings.Join(labels, "\xff")
+}
@@ -0,0 +1,91 @@
+package metrics_test
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+)
+
+// parseExposition parses the text format into series values and family types,
+// failing on malformed lines or samples without a TYPE line
+func parseExposition(t *testing.T, text string) (map[string]float64, map[string]string) {
+	t.Helper()
+	values := make(map[string]float64)
+	types := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			types[fields[2]] = fields[3]
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cut := strings.LastIndexByte(line, ' ')
+		if cut < 0 {
+			t.Fatalf("Malformed sample line: %q", line)
+		}
+		series, raw := line[:cut], line[cut+1:]
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			t.Fatalf("Malformed sample value in %q: %v", line, err)
+		}
+		name, _, _ := strings.Cut(series, "{")
+		base := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+		if _, ok := types[name]; !ok {
+			if _, ok := types[base]; !ok {
+				t.Fatalf("Sample %q has no TYPE line", series)
+			}
+		}
+		values[series] = value
+	}
+	return values, types
+}
+
+func TestRegistryExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounterVec("test_requests_total", "Requests.", "path", "status")
+	latency := reg.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "path")
+	reg.NewGaugeFunc("test_keys", "Keys.", func() []metrics.Sample {
+		return []metrics.Sample{{Labels: []string{`quoted "ns"`}, Value: 3}}
+	}, "namespace")
+
+	requests.Inc("/get", "200")
+	requests.Add(2, "/get", "200")
+	requests.Inc("/set", "500")
+	latency.Observe(0.05, "/get")
+	latency.Observe(0.5, "/get")
+	latency.Observe(5, "/get")
+
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	values, types := parseExposition(t, buf.String())
+
+	expected := map[string]float64{
+		`test_requests_total{path="/get",status="200"}`:      3,
+		`test_requests_total{path="/set",status="500"}`:      1,
+		`test_latency_seconds_bucket{path="/get",le="0.1"}`:  1,
+		`test_latency_seconds_bucket{path="/get",le="1"}`:    2,
+		`test_latency_seconds_bucket{path="/get",le="+Inf"}`: 3,
+		`test_latency_seconds_sum{path="/get"}`:              5.55,
+		`test_latency_seconds_count{path="/get"}`:            3,
+		`test_keys{namespace="quoted \"ns\""}`:               3,
+	}
+	for series, want := range expected {
+		if got, ok := values[series]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", series, want, got, ok)
+		}
+	}
+
+	if types["test_requests_total"] != "counter" || types["test_latency_seconds"] != "histogram" || types["test_keys"] != "gauge" {
+		t.Errorf("Unexpected metric types: %v", types)
+	}
+}
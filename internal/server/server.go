@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/audit"
+	"github.com/bendigiorgio/go-kv/internal/auth"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/metrics"
+	"github.com/bendigiorgio/go-kv/internal/tlsutil"
+	"github.com/bendigiorgio/go-kv/internal/tracing"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// configWatchInterval is how often the config file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// Run starts the server and blocks until ctx is cancelled or the process receives SIGINT or SIGTERM.
+// It then stops accepting connections, drains in-flight requests, waits for the engine workers
+// and saves every namespace before returning. args are the command-line arguments the
+// configuration was loaded from, used to reload it.
+func Run(ctx context.Context, cfg *utils.ConfigStructure, args []string) error {
+	ctx, stopSignals := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	e, err := engine.NewEngine(cfg.Database.FilePath, cfg.Database.FlushFilePath, cfg.Database.MaxMemory)
+	if err != nil {
+		return err
+	}
+	trail, err := audit.Open(cfg.Audit.FilePath)
+	if err != nil {
+		e.Shutdown()
+		return err
+	}
+	defer trail.Close()
+
+	if cfg.Tracing.Enabled {
+		// Installed before the router so the final saves on shutdown are exported too
+		provider := newTracingProvider(cfg.Tracing)
+		tracing.SetProvider(provider)
+		defer shutdownTracing(provider)
+	}
+
+	router := api.NewRouter(e, true)
+	defer router.Namespaces().Shutdown()
+
+	policy, err := compactionPolicy(cfg.Compaction)
+	if err != nil {
+		return err
+	}
+	scheduler := engine.NewCompactionScheduler(router.Namespaces(), policy)
+	scheduler.Start()
+	defer scheduler.Stop() // Before the namespaces shut down, interrupting a running compaction
+	router.SetCompactionScheduler(scheduler)
+	applyConfig(cfg, router)
+
+	if cfg.Auth.Enabled {
+		authenticator, err := auth.New(cfg.Auth)
+		if err != nil {
+			return err
+		}
+		router.Use(api.AuthMiddleware(authenticator))
+	}
+	router.EnableMetrics(metrics.NewRegistry())
+	if cfg.Tracing.Enabled {
+		router.EnableTracing()
+	}
+	router.EnableAudit(trail)
+	if cfg.AccessLog {
+		router.EnableAccessLog()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if cfg.TLS.Enabled {
+		reloader, tlsConfig, err := tlsutil.FromConfig(cfg.TLS)
+		if err != nil {
+			return err
+		}
+		if cfg.TLS.ReloadInterval > 0 {
+			go reloader.Watch(time.Duration(cfg.TLS.ReloadInterval)*time.Second, stop)
+		}
+		router.SetTLSConfig(tlsConfig)
+	}
+
+	configReloader := utils.NewConfigReloader(args, cfg)
+	configReloader.OnApply(func(updated *utils.ConfigStructure) { applyConfig(updated, router) })
+	configReloader.OnReload(func(result utils.ReloadResult) { recordReload(trail, result) })
+	go configReloader.Watch(configWatchInterval, stop)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- router.Start(strconv.Itoa(cfg.AppPort))
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server failed before a shutdown was requested, e.g. the port is in use
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Shutdown requested, draining requests")
+	if err := router.Stop(); err != nil {
+		log.Error().Err(err).Msg("Failed to drain HTTP requests")
+	}
+	if err := <-serveErr; err != nil {
+		log.Error().Err(err).Msg("Server stopped with an error")
+	}
+
+	// Deferred calls stop the watchers, then shut down every namespace with a final save
+	log.Info().Msg("Saving data before exit")
+	return nil
+}
+
+// applyConfig applies the settings that can change while the server runs
+func applyConfig(cfg *utils.ConfigStructure, router *api.Router) {
+	utils.SetLogLevel(cfg.LogLevel)
+	router.Namespaces().Default().SetMemoryLimit(cfg.Database.MaxMemory)
+	policy, err := engine.ParseEvictionPolicy(cfg.Database.EvictionPolicy)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid eviction policy")
+	} else {
+		router.Namespaces().SetEvictionPolicy(policy)
+	}
+	router.Namespaces().SetCompactionRateLimit(int64(cfg.Compaction.MaxBytesPerSecond))
+	router.Namespaces().SetBlobThreshold(int64(cfg.Database.BlobThreshold))
+	if err := router.SetLimits(cfg.Limits); err != nil {
+		log.Error().Err(err).Msg("Invalid limits")
+	}
+	router.SetRateLimit(cfg.RateLimit)
+	if scheduler := router.CompactionScheduler(); scheduler != nil {
+		if policy, err := compactionPolicy(cfg.Compaction); err != nil {
+			log.Error().Err(err).Msg("Invalid compaction settings")
+		} else {
+			scheduler.SetPolicy(policy)
+		}
+	}
+	router.SetConfig(cfg)
+}
+
+// compactionPolicy converts the compaction settings. A disabled scheduler gets a policy without triggers.
+func compactionPolicy(cfg utils.CompactionConfig) (engine.CompactionPolicy, error) {
+	policy := engine.CompactionPolicy{CheckInterval: time.Duration(cfg.CheckInterval) * time.Second}
+	if !cfg.Enabled {
+		return policy, nil
+	}
+
+	schedule, err := engine.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return policy, err
+	}
+	quietHours, err := engine.ParseQuietHours(cfg.QuietHours)
+	if err != nil {
+		return policy, err
+	}
+	policy.MaxFlushFileBytes = int64(cfg.MaxFlushFileBytes)
+	policy.MaxFlushedRatio = cfg.MaxFlushedRatio
+	policy.Schedule = schedule
+	policy.QuietHours = quietHours
+	return policy, nil
+}
+
+// newTracingProvider creates the span provider for the configured exporter
+func newTracingProvider(cfg utils.TracingConfig) *tracing.Provider {
+	var exporter tracing.Exporter
+	switch cfg.Exporter {
+	case "otlp":
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = tracing.DefaultOTLPEndpoint
+		}
+		exporter = tracing.NewOTLPExporter(endpoint, cfg.ServiceName)
+	default:
+		exporter = tracing.NewStdoutExporter(os.Stdout)
+	}
+	log.Info().Str("exporter", cfg.Exporter).Float64("sampleRatio", cfg.SampleRatio).Msg("Tracing enabled")
+	return tracing.NewProvider(exporter, tracing.Options{SampleRatio: cfg.SampleRatio})
+}
+
+// shutdownTracing exports the remaining spans and disables tracing
+func shutdownTracing(provider *tracing.Provider) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to export remaining spans")
+	}
+	tracing.SetProvider(nil)
+}
+
+// recordReload writes a configuration reload to the audit trail
+func recordReload(trail *audit.Trail, result utils.ReloadResult) {
+	event := audit.Event{
+		Actor:   "system",
+		Action:  audit.ActionConfigReload,
+		Outcome: audit.OutcomeSuccess,
+		Details: map[string]any{"trigger": result.Trigger, "applied": result.Applied, "rejected": result.Rejected},
+	}
+	switch {
+	case result.Err != nil:
+		event.Outcome = audit.OutcomeFailure
+		event.Details["error"] = result.Err.Error()
+	case len(result.Applied) == 0 && len(result.Rejected) > 0:
+		event.Outcome = audit.OutcomeRejected
+	}
+	if err := trail.Record(event); err != nil {
+		log.Error().Err(err).Msg("Failed to record configuration reload in the audit log")
+	}
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/internal/server"
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestShutdownOnSIGTERMKeepsAcknowledgedWrites(t *testing.T) {
+	dir := t.TempDir()
+	cfg := utils.DefaultConfig()
+	cfg.AppPort = freePort(t)
+	cfg.Database.FilePath = filepath.Join(dir, "data.db")
+	cfg.Database.FlushFilePath = filepath.Join(dir, "flush.db")
+	cfg.Database.MaxMemory = 2048 // Small enough for evictions to the flushed tier during the test
+	cfg.Audit.FilePath = filepath.Join(dir, "audit.log")
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(context.Background(), &cfg, nil) }()
+
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", cfg.AppPort)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(baseURL + "/count")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Write until the server goes away, sending SIGTERM part way through
+	acknowledged := make(map[string]string)
+	for i := 0; ; i++ {
+		if i == 200 {
+			if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+				t.Fatalf("Failed to send SIGTERM: %v", err)
+			}
+		}
+		key, value := fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%04d", i)
+		body := fmt.Sprintf(`{"key":%q,"value":%q}`, key, value)
+		resp, err := http.Post(baseURL+"/set", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			acknowledged[key] = value
+		}
+		if i > 100000 {
+			t.Fatal("Server kept accepting writes after SIGTERM")
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() returned an error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	if len(acknowledged) < 200 {
+		t.Fatalf("Expected at least 200 acknowledged writes, got %d", len(acknowledged))
+	}
+
+	// Every acknowledged write must be on disk, in the data file or the flushed tier
+	reopened, err := engine.NewEngine(cfg.Database.FilePath, cfg.Database.FlushFilePath, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to reopen the store: %v", err)
+	}
+	defer reopened.Shutdown()
+
+	for key, value := range acknowledged {
+		if got, err := reopened.Get(key); err != nil || got != value {
+			t.Errorf("Acknowledged write %s was lost: got '%s', error: %v", key, got, err)
+		}
+	}
+}
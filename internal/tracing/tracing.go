@@ -0,0 +1,310 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TraceID identifies a trace across services
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+
+// SpanKind describes the relationship of a span to its trace, using the OTLP values
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+)
+
+// SpanContext is the part of a span that is propagated to children and other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanData is a finished span handed to the exporter
+type SpanData struct {
+	Name         string
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Error        string // Empty unless the operation failed
+}
+
+// Span records a timed operation. A nil Span is valid and records nothing,
+// which is what Start returns when tracing is disabled.
+type Span struct {
+	mu       sync.Mutex
+	data     SpanData
+	sampled  bool
+	ended    bool
+	provider *Provider
+}
+
+// SetAttribute records a string, bool, integer or float attribute on the span
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.provider.enqueue(data)
+	}
+}
+
+// SpanContext returns the propagated identity of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: s.sampled}
+}
+
+// Exporter sends finished spans to a backend
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Options configure a Provider
+type Options struct {
+	SampleRatio   float64       // Fraction of new traces recorded; traces started elsewhere follow the caller's decision
+	BatchSize     int           // Spans exported per batch, default 512
+	FlushInterval time.Duration // Maximum time a span waits for export, default 5s
+}
+
+// Provider creates spans and exports them in batches
+type Provider struct {
+	exporter Exporter
+	options  Options
+
+	mu      sync.Mutex
+	pending []SpanData
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewProvider creates a provider exporting to exporter and starts its export loop
+func NewProvider(exporter Exporter, options Options) *Provider {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 512
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = 5 * time.Second
+	}
+	p := &Provider{
+		exporter: exporter,
+		options:  options,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.exportLoop()
+	return p
+}
+
+func (p *Provider) enqueue(span SpanData) {
+	p.mu.Lock()
+	p.pending = append(p.pending, span)
+	full := len(p.pending) >= p.options.BatchSize
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *Provider) exportLoop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flush:
+		case <-p.stop:
+			return
+		}
+		if err := p.ForceFlush(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Failed to export spans")
+		}
+	}
+}
+
+// ForceFlush exports every queued span
+func (p *Provider) ForceFlush(ctx context.Context) error {
+	p.mu.Lock()
+	spans := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	return p.exporter.Export(ctx, spans)
+}
+
+// Shutdown stops the export loop, exports the queued spans and shuts down the exporter
+func (p *Provider) Shutdown(ctx context.Context) error {
+	var err error
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+		if err = p.ForceFlush(ctx); err != nil {
+			p.exporter.Shutdown(ctx)
+			return
+		}
+		err = p.exporter.Shutdown(ctx)
+	})
+	return err
+}
+
+func (p *Provider) sample() bool {
+	return p.options.SampleRatio >= 1 || rand.Float64() < p.options.SampleRatio
+}
+
+var global atomic.Pointer[Provider]
+
+// SetProvider installs the provider used by Start. A nil provider disables tracing.
+func SetProvider(p *Provider) {
+	global.Store(p)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemoteParent returns a copy of ctx whose next span continues a trace started elsewhere
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartOption configures a span created by Start
+type StartOption func(*SpanData)
+
+// WithKind sets the span kind, SpanKindInternal by default
+func WithKind(kind SpanKind) StartOption {
+	return func(data *SpanData) { data.Kind = kind }
+}
+
+// Start creates a span as a child of the span in ctx, or of a remote parent, and returns a
+// context carrying it. It returns a nil span when tracing is disabled.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	p := global.Load()
+	if p == nil {
+		return ctx, nil
+	}
+
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.SpanContext()
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = remote
+	}
+
+	span := &Span{provider: p, data: SpanData{Name: name, Kind: SpanKindInternal, Start: time.Now()}}
+	if parent.IsValid() {
+		span.data.TraceID = parent.TraceID
+		span.data.ParentSpanID = parent.SpanID
+		span.sampled = parent.Sampled
+	} else {
+		span.data.TraceID = newTraceID()
+		span.sampled = p.sample()
+	}
+	span.data.SpanID = newSpanID()
+	for _, opt := range opts {
+		opt(&span.data)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		for i := 0; i < len(id); i += 8 {
+			putUint64(id[i:], rand.Uint64())
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		putUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := 0; i < 8; i++ {
+		b[i] = byte(v >> (56 - 8*i))
+	}
+}
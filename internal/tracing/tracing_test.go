@@ -0,0 +1,273 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/tracing"
+)
+
+// memoryExporter keeps exported spans for inspection
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *memoryExporter) Export(_ context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error { return nil }
+
+func setupProvider(t *testing.T, exporter tracing.Exporter, ratio float64) *tracing.Provider {
+	t.Helper()
+	provider := tracing.NewProvider(exporter, tracing.Options{SampleRatio: ratio})
+	tracing.SetProvider(provider)
+	t.Cleanup(func() {
+		tracing.SetProvider(nil)
+		provider.Shutdown(context.Background())
+	})
+	return provider
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := tracing.ParseTraceparent(value)
+	if !ok {
+		t.Fatalf("Expected %q to parse", value)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+	if formatted := tracing.FormatTraceparent(sc); formatted != value {
+		t.Errorf("Expected %q, got %q", value, formatted)
+	}
+}
+
+func TestParseTraceparentRejectsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"empty":              "",
+		"forbidden version":  "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"zero trace id":      "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"zero span id":       "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"short trace id":     "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"not hex":            "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"extra field for 00": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x",
+	}
+	for name, value := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := tracing.ParseTraceparent(value); ok {
+				t.Errorf("Expected %q to be rejected", value)
+			}
+		})
+	}
+
+	// Future versions may append fields
+	if _, ok := tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("Expected a future version with extra fields to parse")
+	}
+}
+
+func TestSpansFormATree(t *testing.T) {
+	exporter := &memoryExporter{}
+	provider := setupProvider(t, exporter, 1)
+
+	header := http.Header{}
+	header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.Extract(context.Background(), header)
+
+	ctx, parent := tracing.Start(ctx, "parent", tracing.WithKind(tracing.SpanKindServer))
+	_, child := tracing.Start(ctx, "child")
+	child.SetAttribute("keys", 3)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	outgoing := http.Header{}
+	tracing.Inject(ctx, outgoing)
+	if sc, ok := tracing.ParseTraceparent(outgoing.Get(tracing.TraceparentHeader)); !ok || sc.SpanID != parent.SpanContext().SpanID {
+		t.Errorf("Expected the injected header to name the parent span, got %q", outgoing.Get(tracing.TraceparentHeader))
+	}
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush spans: %v", err)
+	}
+	if len(exporter.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(exporter.spans))
+	}
+	childData, parentData := exporter.spans[0], exporter.spans[1]
+	if parentData.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || parentData.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the parent to continue the remote trace, got %+v", parentData)
+	}
+	if parentData.Kind != tracing.SpanKindServer {
+		t.Errorf("Expected a server span, got kind %d", parentData.Kind)
+	}
+	if childData.TraceID != parentData.TraceID || childData.ParentSpanID != parentData.SpanID {
+		t.Errorf("Expected the child to be nested under the parent, got %+v", childData)
+	}
+	if childData.Attributes["keys"] != 3 || childData.Error != "boom" {
+		t.Errorf("Unexpected child attributes %v and error %q", childData.Attributes, childData.Error)
+	}
+}
+
+func TestUnsampledTraceIsNotExported(t *testing.T) {
+	exporter := &memoryExporter{}
+	provider := setupProvider(t, exporter, 0)
+
+	_, span := tracing.Start(context.Background(), "dropped")
+	span.End()
+
+	// The caller's decision wins over the local ratio
+	ctx := tracing.ContextWithRemoteParent(context.Background(), tracing.SpanContext{
+		TraceID: tracing.TraceID{1}, SpanID: tracing.SpanID{1}, Sampled: true,
+	})
+	_, span = tracing.Start(ctx, "kept")
+	span.End()
+
+	provider.ForceFlush(context.Background())
+	if len(exporter.spans) != 1 || exporter.spans[0].Name != "kept" {
+		t.Errorf("Expected only the sampled span, got %+v", exporter.spans)
+	}
+}
+
+func TestStartWithoutProviderIsNoop(t *testing.T) {
+	tracing.SetProvider(nil)
+	ctx, span := tracing.Start(context.Background(), "noop")
+	span.SetAttribute("a", 1)
+	span.End()
+	if span != nil || tracing.SpanFromContext(ctx) != nil {
+		t.Error("Expected no span without a provider")
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	provider := setupProvider(t, tracing.NewStdoutExporter(&buf), 1)
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	child.End()
+	parent.End()
+	provider.ForceFlush(context.Background())
+
+	decoder := json.NewDecoder(&buf)
+	var lines []map[string]any
+	for decoder.More() {
+		var line map[string]any
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatalf("Failed to decode span line: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || lines[0]["name"] != "child" || lines[0]["parent_id"] != lines[1]["span_id"] {
+		t.Errorf("Unexpected stdout spans %v", lines)
+	}
+}
+
+func TestOTLPExporterAgainstStubCollector(t *testing.T) {
+	type keyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+	var (
+		mu       sync.Mutex
+		received []map[string]any
+		service  string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var payload struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []keyValue `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []map[string]any `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range payload.ResourceSpans {
+			for _, attr := range rs.Resource.Attributes {
+				if attr.Key == "service.name" {
+					service, _ = attr.Value["stringValue"].(string)
+				}
+			}
+			for _, ss := range rs.ScopeSpans {
+				received = append(received, ss.Spans...)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	provider := tracing.NewProvider(tracing.NewOTLPExporter(collector.URL+"/v1/traces", "go-kv-test"), tracing.Options{SampleRatio: 1})
+	tracing.SetProvider(provider)
+	defer tracing.SetProvider(nil)
+
+	ctx, parent := tracing.Start(context.Background(), "HTTP GET /get", tracing.WithKind(tracing.SpanKindServer))
+	_, child := tracing.Start(ctx, "engine.Get")
+	child.SetAttribute("key_found", false)
+	child.RecordError(errors.New("key not found"))
+	child.End()
+	parent.End()
+
+	// Shutdown exports the queued spans
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to export spans: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if service != "go-kv-test" {
+		t.Errorf("Expected service name go-kv-test, got %q", service)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 spans at the collector, got %d", len(received))
+	}
+	childSpan, parentSpan := received[0], received[1]
+	if childSpan["name"] != "engine.Get" || childSpan["parentSpanId"] != parentSpan["spanId"] || childSpan["traceId"] != parentSpan["traceId"] {
+		t.Errorf("Unexpected span tree: child %v, parent %v", childSpan, parentSpan)
+	}
+	if _, hasParent := parentSpan["parentSpanId"]; hasParent {
+		t.Errorf("Expected the root span to have no parent, got %v", parentSpan["parentSpanId"])
+	}
+	if parentSpan["kind"] != float64(tracing.SpanKindServer) {
+		t.Errorf("Expected a server span kind, got %v", parentSpan["kind"])
+	}
+	if status, _ := childSpan["status"].(map[string]any); status["code"] != float64(2) || status["message"] != "key not found" {
+		t.Errorf("Expected an error status, got %v", childSpan["status"])
+	}
+	if _, ok := childSpan["startTimeUnixNano"].(string); !ok {
+		t.Errorf("Expected timestamps encoded as strings, got %v", childSpan["startTimeUnixNano"])
+	}
+}
+
+func TestOTLPExporterReportsCollectorErrors(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	exporter := tracing.NewOTLPExporter(collector.URL, "go-kv")
+	if err := exporter.Export(context.Background(), []tracing.SpanData{{Name: "span", TraceID: tracing.TraceID{1}, SpanID: tracing.SpanID{1}}}); err == nil {
+		t.Error("Expected an error when the collector rejects spans")
+	}
+}
@@ -1,45 +1,561 @@
 package utils
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/nil-go/konf"
+	"github.com/nil-go/konf/provider/env"
 	"github.com/nil-go/konf/provider/fs"
-	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultConfigFile is read when no --config flag or GOKV_CONFIG variable is set
+const DefaultConfigFile = "kv-setup.json"
+
+// EnvPrefix is the prefix of environment variables overriding the config, e.g. GOKV_DATABASE_MAX_MEMORY
+const EnvPrefix = "GOKV_"
+
+const redacted = "[REDACTED]"
+
 type DatabaseConfig struct {
-	FilePath      string `default:"./db/data.db" usage:"Path for the main database file"`
-	FlushFilePath string `default:"./db/flush.db" usage:"Path for the flush database file"`
-	MaxMemory     int    `default:"5242880" usage:"Maximum memory to use for the database"`
+	FilePath       string `json:"filePath" default:"./db/data.db" usage:"Path for the main database file"`
+	FlushFilePath  string `json:"flushFilePath" default:"./db/flush.db" usage:"Path for the flush database file"`
+	MaxMemory      int    `json:"maxMemory" default:"5242880" usage:"Maximum memory to use for the database"`
+	EvictionPolicy string `json:"evictionPolicy" default:"fifo" usage:"Order in which keys are flushed to disk when memory is full (fifo, lru)"`
+	BlobThreshold  int    `json:"blobThreshold" default:"1048576" usage:"Size in bytes above which values uploaded to /v1/keys are stored in chunk files"`
 }
 
-type ConfigStructure struct {
-	AppPort   int    `default:"8080" usage:"Port to run the application on"`
-	LogLevel  int8   `default:"-1" usage:"Log level for the application"`
-	LogFile   string `default:"./logs/app.log" usage:"Path for the log file of the application"`
-	LogOutput string `default:"console" usage:"Output for the logs (console, file)"`
-	Database  DatabaseConfig
+// AuthRule grants an access level on keys matching a pattern or on endpoints.
+// Key patterns are exact keys or prefixes ending in "*"; "*" matches every key.
+type AuthRule struct {
+	Keys      string   `json:"keys,omitempty" usage:"Key pattern the rule applies to (exact key or prefix ending in *)"`
+	Endpoints []string `json:"endpoints,omitempty" usage:"Admin endpoints the rule applies to, e.g. /flush or /admin/*"`
+	Namespace string   `json:"namespace,omitempty" usage:"Namespace the rule applies to, empty for every namespace"`
+	Access    string   `json:"access" usage:"Access level granted (read, write, admin)"`
 }
 
-func LoadConfig() (*ConfigStructure, error) {
-	var config konf.Config
+// AuthUser is an identity allowed to call the API. TokenHash authenticates
+// "Authorization: Bearer" requests and PasswordHash HTTP basic auth requests.
+// Hashes are either "sha256:<hex>" or bcrypt hashes. ClientCN authenticates
+// requests presenting a verified TLS client certificate with that common name.
+type AuthUser struct {
+	Name         string     `json:"name" usage:"Name of the identity"`
+	TokenHash    string     `json:"tokenHash,omitempty" usage:"Hash of the API token"`
+	PasswordHash string     `json:"passwordHash,omitempty" usage:"Hash of the password used with basic auth"`
+	ClientCN     string     `json:"clientCN,omitempty" usage:"Common name of the TLS client certificate mapped to the identity"`
+	Rules        []AuthRule `json:"rules"`
+}
+
+type AuthConfig struct {
+	Enabled bool       `json:"enabled" default:"false" usage:"Require authentication for the HTTP API"`
+	Users   []AuthUser `json:"users"`
+}
 
-	cfg := ConfigStructure{
-		AppPort:  8080,
-		LogLevel: -1,
-		LogFile:  "./logs/app.log",
+// TLSConfig configures TLS for the HTTP listener. Certificates are reloaded when the files change.
+type TLSConfig struct {
+	Enabled        bool   `json:"enabled" default:"false" usage:"Serve the HTTP API over TLS"`
+	CertFile       string `json:"certFile" usage:"Path of the PEM encoded server certificate"`
+	KeyFile        string `json:"keyFile" usage:"Path of the PEM encoded server private key"`
+	ClientCAFile   string `json:"clientCAFile" usage:"Path of the PEM encoded CA bundle used to verify client certificates"`
+	ClientAuth     string `json:"clientAuth" default:"none" usage:"Client certificate policy (none, request, verify-if-given, require)"`
+	ReloadInterval int    `json:"reloadInterval" default:"30" usage:"Seconds between checks for changed certificate files"`
+}
+
+// AuditConfig configures the append-only audit trail of administrative operations.
+type AuditConfig struct {
+	FilePath string `json:"filePath" default:"./logs/audit.log" usage:"Path of the audit log file"`
+}
+
+// TracingConfig configures the export of request and engine spans.
+type TracingConfig struct {
+	Enabled     bool    `json:"enabled" default:"false" usage:"Record spans for requests and engine operations"`
+	Exporter    string  `json:"exporter" default:"stdout" usage:"Span exporter (stdout, otlp)"`
+	Endpoint    string  `json:"endpoint" usage:"OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces"`
+	ServiceName string  `json:"serviceName" default:"go-kv" usage:"Service name reported with every span"`
+	SampleRatio float64 `json:"sampleRatio" default:"1" usage:"Fraction of new traces recorded, between 0 and 1"`
+}
+
+// CompactionConfig configures the scheduler that compacts flushed data in the background.
+type CompactionConfig struct {
+	Enabled           bool    `json:"enabled" default:"true" usage:"Compact flushed data automatically"`
+	MaxFlushFileBytes int     `json:"maxFlushFileBytes" default:"67108864" usage:"Compact when the flush files of a namespace exceed this many bytes, 0 disables"`
+	MaxFlushedRatio   float64 `json:"maxFlushedRatio" default:"4" usage:"Compact when the flush files exceed this multiple of the in-memory bytes, 0 disables"`
+	Schedule          string  `json:"schedule" default:"@daily" usage:"Compact at this interval (@hourly, @daily, @weekly or @every <duration>), empty disables"`
+	QuietHours        string  `json:"quietHours" usage:"Daily local time window (HH:MM-HH:MM) in which to compact once, empty disables"`
+	CheckInterval     int     `json:"checkInterval" default:"30" usage:"Seconds between checks of the compaction triggers"`
+	MaxBytesPerSecond int     `json:"maxBytesPerSecond" default:"33554432" usage:"Limit the disk reads and writes of a compaction to this many bytes per second, 0 disables"`
+}
+
+// ClientQuota overrides the default quotas of one client
+type ClientQuota struct {
+	Client     string `json:"client" usage:"Identity name, or IP address of unauthenticated clients"`
+	QuotaBytes int    `json:"quotaBytes" usage:"Bytes of values the client may store, 0 for no limit"`
+	QuotaKeys  int    `json:"quotaKeys" usage:"Keys the client may store, 0 for no limit"`
+}
+
+// LimitsConfig bounds the requests, keys and values clients send, and what each client stores.
+// Clients are identities when authentication is enabled and IP addresses otherwise.
+type LimitsConfig struct {
+	MaxBodyBytes  int           `json:"maxBodyBytes" default:"8388608" usage:"Largest request body in bytes, except values uploaded to /v1/keys, 0 disables"`
+	MaxBatchKeys  int           `json:"maxBatchKeys" default:"1000" usage:"Most keys in one batch request, 0 disables"`
+	MaxKeyLength  int           `json:"maxKeyLength" default:"1024" usage:"Longest key in bytes, 0 disables"`
+	MaxValueBytes int           `json:"maxValueBytes" default:"268435456" usage:"Largest string value in bytes, 0 disables"`
+	KeyPolicy     string        `json:"keyPolicy" default:"any" usage:"Characters allowed in keys (any, printable, ascii)"`
+	QuotaBytes    int           `json:"quotaBytes" default:"0" usage:"Bytes of values each client may store, 0 disables"`
+	QuotaKeys     int           `json:"quotaKeys" default:"0" usage:"Keys each client may store, 0 disables"`
+	Clients       []ClientQuota `json:"clients"`
+}
+
+// RateLimitConfig limits the request rate of each client with token buckets, one per class of
+// request, and how many requests the server handles at once.
+type RateLimitConfig struct {
+	Enabled       bool    `json:"enabled" default:"false" usage:"Limit the request rate of each client and the concurrent requests"`
+	ReadRate      float64 `json:"readRate" default:"1000" usage:"Read requests per second of each client, 0 disables"`
+	ReadBurst     int     `json:"readBurst" default:"2000" usage:"Read requests a client may send at once"`
+	WriteRate     float64 `json:"writeRate" default:"500" usage:"Write requests per second of each client, 0 disables"`
+	WriteBurst    int     `json:"writeBurst" default:"1000" usage:"Write requests a client may send at once"`
+	AdminRate     float64 `json:"adminRate" default:"10" usage:"Admin requests per second of each client, 0 disables"`
+	AdminBurst    int     `json:"adminBurst" default:"20" usage:"Admin requests a client may send at once"`
+	IPRate        float64 `json:"ipRate" default:"2000" usage:"Requests per second of each IP address, checked before authentication, 0 disables"`
+	IPBurst       int     `json:"ipBurst" default:"4000" usage:"Requests an IP address may send at once"`
+	MaxConcurrent int     `json:"maxConcurrent" default:"256" usage:"Requests handled at once before new ones are shed with 503, 0 disables"`
+	QueueTimeout  int     `json:"queueTimeout" default:"100" usage:"Milliseconds a request waits for a free slot before it is shed"`
+	RetryAfter    int     `json:"retryAfter" default:"1" usage:"Seconds shed requests are told to wait before retrying"`
+}
+
+type ConfigStructure struct {
+	AppPort    int              `json:"appPort" default:"8080" usage:"Port to run the application on"`
+	LogLevel   int8             `json:"logLevel" default:"-1" usage:"Log level for the application"`
+	LogFile    string           `json:"logFile" default:"./logs/app.log" usage:"Path for the log file of the application"`
+	LogOutput  string           `json:"logOutput" default:"console" usage:"Output for the logs (console, file, both)"`
+	AccessLog  bool             `json:"accessLog" default:"true" usage:"Log every HTTP request with its status, latency, sizes and client"`
+	Database   DatabaseConfig   `json:"database"`
+	Auth       AuthConfig       `json:"auth"`
+	TLS        TLSConfig        `json:"tls"`
+	Audit      AuditConfig      `json:"audit"`
+	Tracing    TracingConfig    `json:"tracing"`
+	Compaction CompactionConfig `json:"compaction"`
+	Limits     LimitsConfig     `json:"limits"`
+	RateLimit  RateLimitConfig  `json:"rateLimit"`
+
+	// path of the file the configuration was read from, empty when no file was found
+	path string
+}
+
+// DefaultConfig returns the configuration used when nothing overrides it
+func DefaultConfig() ConfigStructure {
+	return ConfigStructure{
+		AppPort:   8080,
+		LogLevel:  -1,
+		LogFile:   "./logs/app.log",
+		LogOutput: "console",
+		AccessLog: true,
 		Database: DatabaseConfig{
-			FilePath:      "./db/data.db",
-			FlushFilePath: "./db/flush.db",
-			MaxMemory:     5242880,
+			FilePath:       "./db/data.db",
+			FlushFilePath:  "./db/flush.db",
+			MaxMemory:      5242880,
+			EvictionPolicy: "fifo",
+			BlobThreshold:  1048576,
+		},
+		Audit: AuditConfig{
+			FilePath: "./logs/audit.log",
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "none",
+			ReloadInterval: 30,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "stdout",
+			ServiceName: "go-kv",
+			SampleRatio: 1,
+		},
+		Compaction: CompactionConfig{
+			Enabled:           true,
+			MaxFlushFileBytes: 64 << 20,
+			MaxFlushedRatio:   4,
+			Schedule:          "@daily",
+			CheckInterval:     30,
+			MaxBytesPerSecond: 32 << 20,
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes:  8 << 20,
+			MaxBatchKeys:  1000,
+			MaxKeyLength:  1024,
+			MaxValueBytes: 256 << 20,
+			KeyPolicy:     "any",
+		},
+		RateLimit: RateLimitConfig{
+			ReadRate:      1000,
+			ReadBurst:     2000,
+			WriteRate:     500,
+			WriteBurst:    1000,
+			AdminRate:     10,
+			AdminBurst:    20,
+			IPRate:        2000,
+			IPBurst:       4000,
+			MaxConcurrent: 256,
+			QueueTimeout:  100,
+			RetryAfter:    1,
 		},
 	}
-	err := config.Load(fs.New(os.DirFS("kv-setup.json"), "kv-setup.json"))
+}
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to load configuration")
+// LoadConfig loads the configuration using the process arguments.
+// See LoadConfigFrom for the order in which sources are applied.
+func LoadConfig() (*ConfigStructure, error) {
+	return LoadConfigFrom(os.Args[1:])
+}
+
+// LoadConfigFrom builds the configuration from, in increasing order of precedence: the defaults,
+// the JSON or YAML config file, GOKV_* environment variables and the command-line flags in args.
+// The file is chosen with --config, then GOKV_CONFIG, then DefaultConfigFile; the default file may be missing.
+func LoadConfigFrom(args []string) (*ConfigStructure, error) {
+	cfg := DefaultConfig()
+
+	set := flag.NewFlagSet("gokv", flag.ContinueOnError)
+	configPath := set.String("config", "", "Path of the JSON or YAML config file (default "+DefaultConfigFile+")")
+	registerFlags(set, reflect.TypeOf(cfg), "")
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path, explicit := *configPath, true
+	if path == "" {
+		path = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if path == "" {
+		path, explicit = DefaultConfigFile, false
 	}
 
+	config := konf.New()
+	if _, err := os.Stat(path); err == nil {
+		if err := config.Load(fileLoader(path)); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		cfg.path = path
+	} else if explicit || !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	sections := configSections()
+	if err := config.Load(env.New(env.WithPrefix(EnvPrefix), env.WithNameSplitter(func(name string) []string {
+		return envKeys(strings.TrimPrefix(name, EnvPrefix), sections)
+	}))); err != nil {
+		return nil, err
+	}
+	if err := config.Load(flagLoader{set}); err != nil {
+		return nil, err
+	}
+
+	if err := config.Unmarshal("", &cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// Path returns the config file the configuration was read from, or an empty string
+func (c *ConfigStructure) Path() string {
+	return c.path
+}
+
+// Validate checks every field and returns an error naming each invalid one
+func (c *ConfigStructure) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{field}, args...)...))
+	}
+
+	if c.AppPort < 1 || c.AppPort > 65535 {
+		invalid("appPort", "must be between 1 and 65535, got %d", c.AppPort)
+	}
+	if c.LogLevel < -1 || c.LogLevel > 7 {
+		invalid("logLevel", "must be between -1 (trace) and 7 (disabled), got %d", c.LogLevel)
+	}
+	switch c.LogOutput {
+	case "console", "file", "both":
+	default:
+		invalid("logOutput", "must be console, file or both, got %q", c.LogOutput)
+	}
+	if c.LogOutput != "console" && c.LogFile == "" {
+		invalid("logFile", "must be set when logging to a file")
+	}
+	if c.Database.FilePath == "" {
+		invalid("database.filePath", "must not be empty")
+	}
+	if c.Database.FlushFilePath == "" {
+		invalid("database.flushFilePath", "must not be empty")
+	}
+	if c.Database.FilePath != "" && c.Database.FilePath == c.Database.FlushFilePath {
+		invalid("database.flushFilePath", "must differ from database.filePath")
+	}
+	if c.Database.MaxMemory <= 0 {
+		invalid("database.maxMemory", "must be positive, got %d", c.Database.MaxMemory)
+	}
+	switch c.Database.EvictionPolicy {
+	case "fifo", "lru":
+	default:
+		invalid("database.evictionPolicy", "must be fifo or lru, got %q", c.Database.EvictionPolicy)
+	}
+	if c.Database.BlobThreshold <= 0 {
+		invalid("database.blobThreshold", "must be positive, got %d", c.Database.BlobThreshold)
+	}
+	if c.Audit.FilePath == "" {
+		invalid("audit.filePath", "must not be empty")
+	}
+	if c.TLS.Enabled {
+		if c.TLS.CertFile == "" {
+			invalid("tls.certFile", "must be set when TLS is enabled")
+		}
+		if c.TLS.KeyFile == "" {
+			invalid("tls.keyFile", "must be set when TLS is enabled")
+		}
+	}
+	switch c.TLS.ClientAuth {
+	case "", "none", "request":
+	case "verify-if-given", "require":
+		if c.TLS.ClientCAFile == "" {
+			invalid("tls.clientCAFile", "must be set to verify client certificates")
+		}
+	default:
+		invalid("tls.clientAuth", "must be none, request, verify-if-given or require, got %q", c.TLS.ClientAuth)
+	}
+	if c.TLS.ReloadInterval < 0 {
+		invalid("tls.reloadInterval", "must not be negative, got %d", c.TLS.ReloadInterval)
+	}
+	switch c.Tracing.Exporter {
+	case "stdout", "otlp":
+	default:
+		invalid("tracing.exporter", "must be stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.Compaction.MaxFlushFileBytes < 0 {
+		invalid("compaction.maxFlushFileBytes", "must not be negative, got %d", c.Compaction.MaxFlushFileBytes)
+	}
+	if c.Compaction.MaxFlushedRatio < 0 {
+		invalid("compaction.maxFlushedRatio", "must not be negative, got %g", c.Compaction.MaxFlushedRatio)
+	}
+	if !validSchedule(c.Compaction.Schedule) {
+		invalid("compaction.schedule", "must be @hourly, @daily, @weekly or @every <duration>, got %q", c.Compaction.Schedule)
+	}
+	if !validQuietHours(c.Compaction.QuietHours) {
+		invalid("compaction.quietHours", "must be HH:MM-HH:MM, got %q", c.Compaction.QuietHours)
+	}
+	if c.Compaction.CheckInterval <= 0 {
+		invalid("compaction.checkInterval", "must be positive, got %d", c.Compaction.CheckInterval)
+	}
+	if c.Compaction.MaxBytesPerSecond < 0 {
+		invalid("compaction.maxBytesPerSecond", "must not be negative, got %d", c.Compaction.MaxBytesPerSecond)
+	}
+	for field, value := range map[string]int{
+		"limits.maxBodyBytes":  c.Limits.MaxBodyBytes,
+		"limits.maxBatchKeys":  c.Limits.MaxBatchKeys,
+		"limits.maxKeyLength":  c.Limits.MaxKeyLength,
+		"limits.maxValueBytes": c.Limits.MaxValueBytes,
+		"limits.quotaBytes":    c.Limits.QuotaBytes,
+		"limits.quotaKeys":     c.Limits.QuotaKeys,
+	} {
+		if value < 0 {
+			invalid(field, "must not be negative, got %d", value)
+		}
+	}
+	switch c.Limits.KeyPolicy {
+	case "any", "printable", "ascii":
+	default:
+		invalid("limits.keyPolicy", "must be any, printable or ascii, got %q", c.Limits.KeyPolicy)
+	}
+	for i, quota := range c.Limits.Clients {
+		if quota.Client == "" {
+			invalid(fmt.Sprintf("limits.clients[%d].client", i), "must not be empty")
+		}
+		if quota.QuotaBytes < 0 || quota.QuotaKeys < 0 {
+			invalid(fmt.Sprintf("limits.clients[%d]", i), "quotas must not be negative")
+		}
+	}
+	for _, budget := range []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"read", c.RateLimit.ReadRate, c.RateLimit.ReadBurst},
+		{"write", c.RateLimit.WriteRate, c.RateLimit.WriteBurst},
+		{"admin", c.RateLimit.AdminRate, c.RateLimit.AdminBurst},
+		{"ip", c.RateLimit.IPRate, c.RateLimit.IPBurst},
+	} {
+		if budget.rate < 0 {
+			invalid("rateLimit."+budget.name+"Rate", "must not be negative, got %g", budget.rate)
+		}
+		if budget.rate > 0 && budget.burst < 1 {
+			invalid("rateLimit."+budget.name+"Burst", "must be at least 1 when the rate is set, got %d", budget.burst)
+		}
+	}
+	for field, value := range map[string]int{
+		"rateLimit.maxConcurrent": c.RateLimit.MaxConcurrent,
+		"rateLimit.queueTimeout":  c.RateLimit.QueueTimeout,
+		"rateLimit.retryAfter":    c.RateLimit.RetryAfter,
+	} {
+		if value < 0 {
+			invalid(field, "must not be negative, got %d", value)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validSchedule reports whether spec is empty, a schedule macro or "@every <duration>"
+func validSchedule(spec string) bool {
+	switch spec {
+	case "", "@hourly", "@daily", "@midnight", "@weekly":
+		return true
+	}
+	every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every")))
+	return err == nil && every > 0
+}
+
+// validQuietHours reports whether spec is empty or a HH:MM-HH:MM window
+func validQuietHours(spec string) bool {
+	if spec == "" {
+		return true
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return false
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	return err == nil && !start.Equal(end)
+}
+
+// Redacted returns a copy of the configuration with credential hashes replaced
+func (c *ConfigStructure) Redacted() ConfigStructure {
+	copied := *c
+	copied.Auth.Users = make([]AuthUser, len(c.Auth.Users))
+	for i, user := range c.Auth.Users {
+		if user.TokenHash != "" {
+			user.TokenHash = redacted
+		}
+		if user.PasswordHash != "" {
+			user.PasswordHash = redacted
+		}
+		copied.Auth.Users[i] = user
+	}
+	return copied
+}
+
+// fileLoader reads a JSON or YAML config file, chosen by its extension
+func fileLoader(path string) konf.Loader {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	var opts []fs.Option
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		opts = append(opts, fs.WithUnmarshal(yaml.Unmarshal))
+	}
+	return fs.New(os.DirFS(dir), name, opts...)
+}
+
+// flagLoader loads only the flags set on the command line, so unset flags never override other sources
+type flagLoader struct {
+	set *flag.FlagSet
+}
+
+func (f flagLoader) Load() (map[string]any, error) {
+	values := make(map[string]any)
+	f.set.Visit(func(flg *flag.Flag) {
+		if flg.Name == "config" {
+			return
+		}
+		keys := strings.Split(strings.ReplaceAll(flg.Name, "-", ""), ".")
+		current := values
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := current[key].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				current[key] = next
+			}
+			current = next
+		}
+		current[keys[len(keys)-1]] = flg.Value.(flag.Getter).Get()
+	})
+	return values, nil
+}
+
+func (f flagLoader) String() string {
+	return "flag"
+}
+
+// registerFlags adds a flag for every scalar field, e.g. --app-port and --database.max-memory
+func registerFlags(set *flag.FlagSet, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + kebabCase(field.Name)
+		usage := field.Tag.Get("usage")
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			registerFlags(set, field.Type, name+".")
+		case reflect.Bool:
+			set.Bool(name, false, usage)
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Float64:
+			set.String(name, "", usage)
+		}
+	}
+}
+
+// configSections returns the lower-cased names of the nested config sections
+func configSections() map[string]bool {
+	sections := make(map[string]bool)
+	t := reflect.TypeOf(ConfigStructure{})
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.IsExported() && field.Type.Kind() == reflect.Struct {
+			sections[strings.ToLower(field.Name)] = true
+		}
+	}
+	return sections
+}
+
+// envKeys maps a variable name without prefix to config keys. Words are joined into
+// field names, and a leading section name selects a nested section:
+// APP_PORT is appport and DATABASE_MAX_MEMORY is database.maxmemory.
+func envKeys(name string, sections map[string]bool) []string {
+	words := strings.Split(strings.ToLower(name), "_")
+	if len(words) > 1 && sections[words[0]] {
+		return []string{words[0], strings.Join(words[1:], "")}
+	}
+	return []string{strings.Join(words, "")}
+}
+
+// kebabCase converts a field name such as ClientCAFile to client-ca-file
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := utils.LoadConfigFrom(nil)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() failed: %v", err)
+	}
+	if cfg.AppPort != 8080 || cfg.LogOutput != "console" || cfg.Database.MaxMemory != 5242880 {
+		t.Errorf("Expected defaults when no config file exists, got %+v", cfg)
+	}
+	if cfg.Path() != "" {
+		t.Errorf("Expected no config file path, got %q", cfg.Path())
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := writeConfig(t, "kv-setup.json", `{
+		"appPort": 9000,
+		"logOutput": "both",
+		"database": {"filePath": "./db/app.db", "maxMemory": 1024}
+	}`)
+	t.Setenv("GOKV_DATABASE_MAX_MEMORY", "2048")
+	t.Setenv("GOKV_LOG_LEVEL", "2")
+
+	cfg, err := utils.LoadConfigFrom([]string{"--config", path, "--log-level", "3", "--tls.client-auth", "request"})
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() failed: %v", err)
+	}
+
+	if cfg.AppPort != 9000 || cfg.LogOutput != "both" || cfg.Database.FilePath != "./db/app.db" {
+		t.Errorf("File values were not applied: %+v", cfg)
+	}
+	if cfg.Database.FlushFilePath != "./db/flush.db" {
+		t.Errorf("Expected default flush path to be kept, got %q", cfg.Database.FlushFilePath)
+	}
+	if cfg.Database.MaxMemory != 2048 {
+		t.Errorf("Expected environment to override the file, got maxMemory %d", cfg.Database.MaxMemory)
+	}
+	if cfg.LogLevel != 3 || cfg.TLS.ClientAuth != "request" {
+		t.Errorf("Expected flags to override the environment, got logLevel %d, clientAuth %q", cfg.LogLevel, cfg.TLS.ClientAuth)
+	}
+	if cfg.Path() != path {
+		t.Errorf("Expected config path %q, got %q", path, cfg.Path())
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := writeConfig(t, "kv-setup.yaml", "appPort: 9100\ndatabase:\n  maxMemory: 4096\n")
+
+	cfg, err := utils.LoadConfigFrom([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() failed: %v", err)
+	}
+	if cfg.AppPort != 9100 || cfg.Database.MaxMemory != 4096 {
+		t.Errorf("YAML values were not applied: %+v", cfg)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		field string
+	}{
+		{"port out of range", []string{"--app-port", "70000"}, "appPort"},
+		{"unknown log output", []string{"--log-output", "syslog"}, "logOutput"},
+		{"negative memory", []string{"--database.max-memory", "-1"}, "database.maxMemory"},
+		{"tls without certificate", []string{"--tls.enabled"}, "tls.certFile"},
+		{"unknown span exporter", []string{"--tracing.exporter", "zipkin"}, "tracing.exporter"},
+		{"sample ratio above one", []string{"--tracing.sample-ratio", "1.5"}, "tracing.sampleRatio"},
+		{"unknown schedule", []string{"--compaction.schedule", "@yearly"}, "compaction.schedule"},
+		{"malformed quiet hours", []string{"--compaction.quiet-hours", "2am-5am"}, "compaction.quietHours"},
+		{"negative compaction rate", []string{"--compaction.max-bytes-per-second", "-1"}, "compaction.maxBytesPerSecond"},
+		{"negative key length", []string{"--limits.max-key-length", "-1"}, "limits.maxKeyLength"},
+		{"unknown key policy", []string{"--limits.key-policy", "alnum"}, "limits.keyPolicy"},
+		{"negative rate", []string{"--rate-limit.write-rate", "-5"}, "rateLimit.writeRate"},
+		{"rate without burst", []string{"--rate-limit.admin-burst", "0"}, "rateLimit.adminBurst"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := utils.LoadConfigFrom(c.args)
+			if err == nil || !strings.Contains(err.Error(), c.field+":") {
+				t.Errorf("Expected an error naming %s, got %v", c.field, err)
+			}
+		})
+	}
+
+	if _, err := utils.LoadConfigFrom([]string{"--config", filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("Expected an error for a missing explicit config file")
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.Auth.Users = []utils.AuthUser{{Name: "ci", TokenHash: "sha256:abc"}}
+
+	redacted := cfg.Redacted()
+	if redacted.Auth.Users[0].TokenHash == "sha256:abc" {
+		t.Error("Expected the token hash to be redacted")
+	}
+	if cfg.Auth.Users[0].TokenHash != "sha256:abc" {
+		t.Error("Redacted() must not modify the original configuration")
+	}
+}
@@ -0,0 +1,14 @@
+package utils
+
+import "os"
+
+// DirWritable reports whether a file can be created in dir
+func DirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".gokv-write-check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+import "errors"
+
+// DiskFree is not supported on this platform
+func DiskFree(path string) (uint64, error) {
+	return 0, errors.New("disk free space is not supported on this platform")
+}
@@ -1,15 +1,177 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-func GetLogs(types ...string) {
+// logBufferSize is the number of recent log entries kept in memory for the web UI
+const logBufferSize = 1000
 
+// LogField is a field of a log entry, with its value formatted as text
+type LogField struct {
+	Key   string
+	Value string
+}
+
+// LogEntry is a log event kept in memory
+type LogEntry struct {
+	Time    time.Time
+	Level   zerolog.Level
+	Message string
+	Fields  []LogField // Sorted by key
+}
+
+// LogFilter selects entries of a LogBuffer
+type LogFilter struct {
+	Level zerolog.Level // Minimum level, zerolog.TraceLevel for every entry
+	Text  string        // Case-insensitive text in the message or a field
+	Limit int           // Most recent entries returned, all when 0
+}
+
+// Match reports whether entry is selected by the filter
+func (f LogFilter) Match(entry LogEntry) bool {
+	if entry.Level < f.Level {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	if strings.Contains(strings.ToLower(entry.Message), text) {
+		return true
+	}
+	for _, field := range entry.Fields {
+		if strings.Contains(strings.ToLower(field.Key+"="+field.Value), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogBuffer keeps the most recent log entries in a ring. It is added as a writer of the logger
+// rather than a zerolog.Hook, as hooks cannot read the fields of an event.
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int // Index of the next entry written
+}
+
+var _ zerolog.LevelWriter = (*LogBuffer)(nil)
+
+// NewLogBuffer returns a buffer keeping the last size entries, or an error when size is below 1
+func NewLogBuffer(size int) (*LogBuffer, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("log buffer size must be at least 1, got %d", size)
+	}
+	return &LogBuffer{entries: make([]LogEntry, 0, size)}, nil
+}
+
+// logs holds the entries of the logger set up by SetupLogger
+var logs = &LogBuffer{entries: make([]LogEntry, 0, logBufferSize)}
+
+// Write adds a JSON log event to the buffer
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	return b.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel adds a JSON log event of the given level to the buffer, at the time of the event
+// when it has one, otherwise now. Events that are not JSON objects are ignored.
+func (b *LogBuffer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var event map[string]json.RawMessage
+	if json.Unmarshal(p, &event) != nil {
+		return len(p), nil
+	}
+	entry := LogEntry{Time: time.Now(), Level: level}
+	for key, raw := range event {
+		var text string
+		if json.Unmarshal(raw, &text) != nil {
+			text = string(raw)
+		}
+		switch key {
+		case zerolog.MessageFieldName:
+			entry.Message = text
+		case zerolog.TimestampFieldName:
+			if t, ok := parseLogTime(text); ok {
+				entry.Time = t
+			}
+		case zerolog.LevelFieldName:
+		default:
+			entry.Fields = append(entry.Fields, LogField{Key: key, Value: text})
+		}
+	}
+	sort.Slice(entry.Fields, func(i, j int) bool { return entry.Fields[i].Key < entry.Fields[j].Key })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) < cap(b.entries) {
+		b.entries = append(b.entries, entry)
+	} else {
+		b.entries[b.next] = entry
+	}
+	b.next = (b.next + 1) % cap(b.entries)
+	return len(p), nil
+}
+
+// parseLogTime parses the timestamp of an event, written in zerolog.TimeFieldFormat
+func parseLogTime(text string) (time.Time, bool) {
+	var unit time.Duration
+	switch zerolog.TimeFieldFormat {
+	case zerolog.TimeFormatUnix:
+		unit = time.Second
+	case zerolog.TimeFormatUnixMs:
+		unit = time.Millisecond
+	case zerolog.TimeFormatUnixMicro:
+		unit = time.Microsecond
+	case zerolog.TimeFormatUnixNano:
+		unit = time.Nanosecond
+	default:
+		t, err := time.Parse(zerolog.TimeFieldFormat, text)
+		return t, err == nil
+	}
+	// Unix times may be written with a fraction, see zerolog.TimestampFunc
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(n*float64(unit))), true
+}
+
+// Entries returns the entries matching filter, oldest first
+func (b *LogBuffer) Entries(filter LogFilter) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Once the ring is full, the oldest entry is the next one overwritten
+	start := 0
+	if len(b.entries) == cap(b.entries) {
+		start = b.next
+	}
+	var entries []LogEntry
+	for i := range b.entries {
+		entry := b.entries[(start+i)%len(b.entries)]
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries
+}
+
+// GetLogs returns the recent entries of the server logs matching filter, oldest first
+func GetLogs(filter LogFilter) []LogEntry {
+	return logs.Entries(filter)
 }
 
 func SetupLogger(config *ConfigStructure) {
@@ -17,23 +179,27 @@ func SetupLogger(config *ConfigStructure) {
 	var _logger zerolog.Logger
 
 	if config.LogOutput == "file" || config.LogOutput == "both" {
+		if err := os.MkdirAll(filepath.Dir(config.LogFile), 0755); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create log directory")
+		}
 		logfile, err := os.OpenFile(config.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 
 		if err != nil {
 			log.Fatal().Err(err).Msg("Failed to open log file")
 		}
 		if config.LogOutput == "both" {
-			_logger = zerolog.New(zerolog.MultiLevelWriter(os.Stdout, logfile))
+			_logger = zerolog.New(zerolog.MultiLevelWriter(os.Stdout, logfile, logs))
 		} else {
-			_logger = zerolog.New(logfile)
+			_logger = zerolog.New(zerolog.MultiLevelWriter(logfile, logs))
 		}
 	}
 
 	if config.LogOutput == "console" {
-		_logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+		console := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+		_logger = zerolog.New(zerolog.MultiLevelWriter(console, logs))
 	}
 
-	_logger.Level(zerolog.Level(config.LogLevel))
+	SetLogLevel(config.LogLevel)
 
 	if devMode == "true" {
 		_logger.
@@ -44,3 +210,8 @@ func SetupLogger(config *ConfigStructure) {
 	}
 	log.Logger = _logger
 }
+
+// SetLogLevel changes the minimum level of every logger at runtime
+func SetLogLevel(level int8) {
+	zerolog.SetGlobalLevel(zerolog.Level(level))
+}
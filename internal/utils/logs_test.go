@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+func TestLogBuffer(t *testing.T) {
+	if _, err := utils.NewLogBuffer(0); err == nil {
+		t.Error("Expected an error for a buffer of no entries")
+	}
+	buffer, err := utils.NewLogBuffer(3)
+	if err != nil {
+		t.Fatalf("NewLogBuffer() failed: %v", err)
+	}
+	logger := zerolog.New(buffer)
+	logger.Info().Msg("Dropped from the ring")
+	logger.Debug().Str("key", "k").Msg("Key read")
+	logger.Warn().Str("log", "access").Int("status", 503).Msg("HTTP request")
+	logger.Error().Err(errors.New("test error")).Msg("Compaction failed")
+	buffer.Write([]byte("not json\n"))
+
+	messages := func(entries []utils.LogEntry) []string {
+		out := make([]string, len(entries))
+		for i, entry := range entries {
+			out[i] = entry.Message
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter utils.LogFilter
+		want   []string
+	}{
+		{"all", utils.LogFilter{Level: zerolog.TraceLevel}, []string{"Key read", "HTTP request", "Compaction failed"}},
+		{"level", utils.LogFilter{Level: zerolog.WarnLevel}, []string{"HTTP request", "Compaction failed"}},
+		{"message text", utils.LogFilter{Text: "COMPACTION"}, []string{"Compaction failed"}},
+		{"field text", utils.LogFilter{Text: "status=503"}, []string{"HTTP request"}},
+		{"most recent", utils.LogFilter{Limit: 1}, []string{"Compaction failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messages(buffer.Entries(tt.filter))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected entry %d to be %q, got %q", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+
+	entry := buffer.Entries(utils.LogFilter{Level: zerolog.WarnLevel, Limit: 1})[0]
+	if entry.Message != "Compaction failed" || entry.Level != zerolog.ErrorLevel {
+		t.Errorf("Expected the last entry at error level, got %+v", entry)
+	}
+	if len(entry.Fields) != 1 || entry.Fields[0] != (utils.LogField{Key: "error", Value: "test error"}) {
+		t.Errorf("Expected the error field, got %+v", entry.Fields)
+	}
+}
+
+func TestLogBufferTime(t *testing.T) {
+	buffer, err := utils.NewLogBuffer(2)
+	if err != nil {
+		t.Fatalf("NewLogBuffer() failed: %v", err)
+	}
+	written := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	logger := zerolog.New(buffer)
+	logger.Info().Time(zerolog.TimestampFieldName, written).Msg("Stamped")
+	before := time.Now()
+	logger.Info().Msg("Not stamped")
+
+	entries := buffer.Entries(utils.LogFilter{})
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	if !entries[0].Time.Equal(written) {
+		t.Errorf("Expected the time of the event %v, got %v", written, entries[0].Time)
+	}
+	if entries[1].Time.Before(before) {
+		t.Errorf("Expected an event without a time to be stamped when written, got %v", entries[1].Time)
+	}
+	if len(entries[0].Fields) != 0 {
+		t.Errorf("Expected the time to be left out of the fields, got %+v", entries[0].Fields)
+	}
+}
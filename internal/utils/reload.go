@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// hotReloadableFields are the config fields applied without a restart. Entries ending
+// in "." cover a whole section. Changes to any other field are rejected until restart.
+var hotReloadableFields = []string{
+	"logLevel",
+	"database.maxMemory",
+	"database.evictionPolicy",
+	"database.blobThreshold",
+	"compaction.",
+	"limits.",
+	"rateLimit.",
+}
+
+// ReloadResult describes the outcome of a configuration reload
+type ReloadResult struct {
+	Trigger  string   // "signal", "file" or "manual"
+	Applied  []string // Changed fields that were applied
+	Rejected []string // Changed fields that need a restart and were ignored
+	Err      error    // Set when the new configuration could not be loaded or was invalid
+}
+
+// ConfigReloader reloads the configuration when its file changes or the process receives SIGHUP,
+// and applies the fields that can change at runtime.
+type ConfigReloader struct {
+	args     []string
+	mu       sync.Mutex
+	current  *ConfigStructure
+	modTime  time.Time
+	onApply  []func(*ConfigStructure)
+	onReload []func(ReloadResult)
+}
+
+// NewConfigReloader creates a reloader for a configuration loaded with LoadConfigFrom(args)
+func NewConfigReloader(args []string, current *ConfigStructure) *ConfigReloader {
+	r := &ConfigReloader{args: args, current: current}
+	r.modTime = r.fileModTime()
+	return r
+}
+
+// Current returns the effective configuration
+func (r *ConfigReloader) Current() *ConfigStructure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnApply registers a function called with the new effective configuration after a reload applied changes
+func (r *ConfigReloader) OnApply(fn func(*ConfigStructure)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onApply = append(r.onApply, fn)
+}
+
+// OnReload registers a function called after every reload attempt, including failed ones
+func (r *ConfigReloader) OnReload(fn func(ReloadResult)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// Watch reloads the configuration on SIGHUP and when the config file changes, checking
+// the file every interval, until stop is closed.
+func (r *ConfigReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			r.Reload("signal")
+		case <-ticker.C:
+			r.mu.Lock()
+			changed := !r.fileModTime().Equal(r.modTime)
+			r.mu.Unlock()
+			if changed {
+				r.Reload("file")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Reload loads the configuration again and applies the hot-reloadable changes.
+// Changes to other fields are logged and ignored; an invalid configuration is ignored entirely.
+func (r *ConfigReloader) Reload(trigger string) ReloadResult {
+	r.mu.Lock()
+	result := ReloadResult{Trigger: trigger}
+	r.modTime = r.fileModTime()
+
+	updated, err := LoadConfigFrom(r.args)
+	if err != nil {
+		result.Err = err
+		log.Error().Err(err).Str("trigger", trigger).Msg("Configuration reload failed, keeping the current configuration")
+	} else {
+		effective := *r.current
+		effective.path = updated.path
+		for _, field := range changedFields(reflect.ValueOf(*r.current), reflect.ValueOf(*updated), "") {
+			if !isHotReloadable(field) {
+				result.Rejected = append(result.Rejected, field)
+				continue
+			}
+			copyField(reflect.ValueOf(&effective).Elem(), reflect.ValueOf(*updated), field)
+			result.Applied = append(result.Applied, field)
+		}
+		if len(result.Rejected) > 0 {
+			log.Warn().Strs("fields", result.Rejected).Str("trigger", trigger).Msg("Configuration changes need a restart to take effect and were not applied")
+		}
+		if len(result.Applied) > 0 {
+			r.current = &effective
+			log.Info().Strs("fields", result.Applied).Str("trigger", trigger).Msg("Configuration reloaded")
+		}
+	}
+
+	current, onApply, onReload := r.current, r.onApply, r.onReload
+	r.mu.Unlock()
+
+	if len(result.Applied) > 0 {
+		for _, fn := range onApply {
+			fn(current)
+		}
+	}
+	for _, fn := range onReload {
+		fn(result)
+	}
+	return result
+}
+
+// fileModTime returns the modification time of the config file, or the zero time. It must be called with r.mu held.
+func (r *ConfigReloader) fileModTime() time.Time {
+	path := r.current.path
+	if path == "" {
+		path = DefaultConfigFile
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func isHotReloadable(field string) bool {
+	for _, allowed := range hotReloadableFields {
+		if field == allowed || (strings.HasSuffix(allowed, ".") && strings.HasPrefix(field, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFields returns the JSON paths of the leaf fields that differ between two config structs.
+// Slices are compared as a whole.
+func changedFields(old, updated reflect.Value, prefix string) []string {
+	var fields []string
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + jsonName(field)
+		if field.Type.Kind() == reflect.Struct {
+			fields = append(fields, changedFields(old.Field(i), updated.Field(i), name+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(old.Field(i).Interface(), updated.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// copyField copies the field at a JSON path from src to dst
+func copyField(dst, src reflect.Value, path string) {
+	name, rest, nested := strings.Cut(path, ".")
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if !field.IsExported() || jsonName(field) != name {
+			continue
+		}
+		if nested {
+			copyField(dst.Field(i), src.Field(i), rest)
+		} else {
+			dst.Field(i).Set(src.Field(i))
+		}
+		return
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
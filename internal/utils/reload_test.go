@@ -0,0 +1,88 @@
+package utils_test
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/utils"
+)
+
+func TestConfigReload(t *testing.T) {
+	path := writeConfig(t, "kv-setup.json", `{"appPort": 9000, "database": {"maxMemory": 1024}}`)
+	args := []string{"--config", path}
+	cfg, err := utils.LoadConfigFrom(args)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() failed: %v", err)
+	}
+
+	reloader := utils.NewConfigReloader(args, cfg)
+	var applied *utils.ConfigStructure
+	reloader.OnApply(func(c *utils.ConfigStructure) { applied = c })
+
+	if err := os.WriteFile(path, []byte(`{"appPort": 9001, "logLevel": 2, "database": {"maxMemory": 2048, "evictionPolicy": "lru"}}`), 0644); err != nil {
+		t.Fatalf("Failed to update config file: %v", err)
+	}
+	result := reloader.Reload("manual")
+
+	if !reflect.DeepEqual(result.Applied, []string{"logLevel", "database.maxMemory", "database.evictionPolicy"}) {
+		t.Errorf("Unexpected applied fields: %v", result.Applied)
+	}
+	if !reflect.DeepEqual(result.Rejected, []string{"appPort"}) {
+		t.Errorf("Expected appPort to be rejected, got %v", result.Rejected)
+	}
+	if applied == nil || applied.Database.MaxMemory != 2048 || applied.AppPort != 9000 {
+		t.Errorf("Expected new memory limit with the old port, got %+v", applied)
+	}
+	if current := reloader.Current(); current.Database.EvictionPolicy != "lru" {
+		t.Errorf("Expected current config to use the lru policy, got %q", current.Database.EvictionPolicy)
+	}
+
+	// An invalid file keeps the current configuration
+	if err := os.WriteFile(path, []byte(`{"database": {"maxMemory": -5}}`), 0644); err != nil {
+		t.Fatalf("Failed to update config file: %v", err)
+	}
+	if result := reloader.Reload("manual"); result.Err == nil {
+		t.Error("Expected an error for an invalid configuration")
+	}
+	if reloader.Current().Database.MaxMemory != 2048 {
+		t.Error("Invalid configuration should not be applied")
+	}
+}
+
+func TestConfigReloadOnSIGHUP(t *testing.T) {
+	path := writeConfig(t, "kv-setup.json", `{"database": {"maxMemory": 1024}}`)
+	args := []string{"--config", path}
+	cfg, err := utils.LoadConfigFrom(args)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() failed: %v", err)
+	}
+
+	reloader := utils.NewConfigReloader(args, cfg)
+	results := make(chan utils.ReloadResult, 1)
+	reloader.OnReload(func(result utils.ReloadResult) { results <- result })
+
+	stop := make(chan struct{})
+	defer close(stop)
+	// A long interval so only the signal can trigger the reload
+	go reloader.Watch(time.Hour, stop)
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(path, []byte(`{"database": {"maxMemory": 4096}}`), 0644); err != nil {
+		t.Fatalf("Failed to update config file: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("Failed to send SIGHUP: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if result.Trigger != "signal" || reloader.Current().Database.MaxMemory != 4096 {
+			t.Errorf("Expected a signal reload applying maxMemory, got %+v", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Configuration was not reloaded after SIGHUP")
+	}
+}
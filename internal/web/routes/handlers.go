@@ -15,16 +15,7 @@ func NewHandler(customHandler CustomHandler, engine *engine.Engine) http.Handler
 		err := customHandler(w, r, engine)
 		if err != nil {
 			log.Error().Stack().Err(err).Msgf("Error")
-			if clientErr, ok := err.(*api_errors.ClientErr); ok {
-				respondWithJSON(w, clientErr.HttpCode, clientErr)
-			} else {
-				respondWithJSON(w, http.StatusInternalServerError,
-					api_errors.InternalErr{
-						HttpCode: http.StatusInternalServerError,
-						Message:  "internal server error",
-					},
-				)
-			}
+			api_errors.Write(w, r, err)
 		}
 	}
 }
@@ -36,16 +27,7 @@ func NewHandlerNoEngine(customHandler CustomHandlerNoEngine) http.HandlerFunc {
 		err := customHandler(w, r)
 		if err != nil {
 			log.Error().Stack().Err(err).Msgf("Error")
-			if clientErr, ok := err.(*api_errors.ClientErr); ok {
-				respondWithJSON(w, clientErr.HttpCode, clientErr)
-			} else {
-				respondWithJSON(w, http.StatusInternalServerError,
-					api_errors.InternalErr{
-						HttpCode: http.StatusInternalServerError,
-						Message:  "internal server error",
-					},
-				)
-			}
+			api_errors.Write(w, r, err)
 		}
 	}
 }
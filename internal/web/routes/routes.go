@@ -55,6 +55,22 @@ var ListRoute = Route{
 	Path: "/list",
 }
 
+var LogsRoute = Route{
+	Title: "Logs",
+	Component: func(_ *engine.Engine, req *http.Request) templ.Component {
+		params := views.LogQueryParams{
+			Level: req.URL.Query().Get("level"),
+			Text:  req.URL.Query().Get("q"),
+			Limit: utils.StringToInt(req.URL.Query().Get("limit"), 0),
+		}
+		if _, err := params.Filter(); err != nil {
+			params.Level = ""
+		}
+		return views.Log(params)
+	},
+	Path: "/logs",
+}
+
 func GetRoutes() []Route {
-	return []Route{HomeRoute, ListRoute}
+	return []Route{HomeRoute, ListRoute, LogsRoute}
 }
@@ -0,0 +1,278 @@
+// Package client is the Go client of the go-kv HTTP API.
+//
+//	kv, err := client.New("http://localhost:8080", client.Options{Token: "secret"})
+//	if err != nil {
+//		return err
+//	}
+//	if err := kv.Set(ctx, "greeting", "hello"); err != nil {
+//		return err
+//	}
+//	value, err := kv.Get(ctx, "greeting")
+//	if errors.Is(err, client.ErrNotFound) {
+//		// The key does not exist
+//	}
+//
+// A Client is safe for concurrent use and keeps connections to the server open between calls,
+// so create one and share it. Idempotent calls are retried with exponential backoff when the
+// server is unreachable or answers 429, 502, 503 or 504, except when a quota is exceeded.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NamespaceHeader selects the namespace of a request
+const NamespaceHeader = "X-KV-Namespace"
+
+// Defaults of Options
+const (
+	DefaultMaxRetries      = 3
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultMaxRetryBackoff = 5 * time.Second
+	DefaultMaxIdleConns    = 64
+)
+
+// Options configures a Client. The zero value connects without credentials to the default namespace.
+type Options struct {
+	Token string // Bearer token sent with every request
+
+	// Basic auth credentials, used when Token is empty
+	Username string
+	Password string
+
+	Namespace string // Namespace of every call, the server default when empty
+
+	MaxRetries      int           // Retries of idempotent calls, DefaultMaxRetries when 0 and none when negative
+	RetryBackoff    time.Duration // Wait before the first retry, doubled for each next one. DefaultRetryBackoff when 0
+	MaxRetryBackoff time.Duration // Longest wait between retries. DefaultMaxRetryBackoff when 0
+
+	Timeout      time.Duration // Timeout of each attempt, none when 0. Prefer deadlines on the context
+	MaxIdleConns int           // Connections kept open to the server, DefaultMaxIdleConns when 0
+
+	// HTTPClient sends the requests instead of the client's own pooled one. Timeout and
+	// MaxIdleConns are ignored when it is set.
+	HTTPClient *http.Client
+}
+
+// Client calls a go-kv server
+type Client struct {
+	baseURL   *url.URL
+	http      *http.Client
+	opts      Options
+	namespace string
+}
+
+// New returns a client of the server at baseURL, such as http://localhost:8080
+func New(baseURL string, opts Options) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: the scheme must be http or https", baseURL)
+	}
+
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = opts.MaxIdleConns
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+		httpClient = &http.Client{Transport: transport, Timeout: opts.Timeout}
+	}
+
+	return &Client{baseURL: parsed, http: httpClient, opts: opts, namespace: opts.Namespace}, nil
+}
+
+// Namespace returns a client of the namespace name that shares the connections of c.
+// An empty name selects the server's default namespace.
+func (c *Client) Namespace(name string) *Client {
+	clone := *c
+	clone.namespace = name
+	return &clone
+}
+
+// request describes an API call
+type request struct {
+	method     string
+	path       string
+	query      url.Values
+	body       any // Encoded as JSON when not nil
+	idempotent bool
+}
+
+// do sends req, retrying idempotent calls, and decodes the response into out when not nil
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("encoding the request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, req, payload, out)
+		if err == nil || !req.idempotent || attempt >= c.opts.MaxRetries || !retryable(ctx, err) {
+			return err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one attempt at req
+func (c *Client) send(ctx context.Context, req request, payload []byte, out any) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := c.newRequest(ctx, req.method, req.path, req.query, body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readError(resp)
+	}
+	if out == nil {
+		// Drained so the connection is reused
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &decodeError{path: req.path, err: err}
+	}
+	return nil
+}
+
+// newRequest returns a request to path with the credentials and namespace of c
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := *c.baseURL
+	target.Path += path
+	target.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	} else if c.opts.Username != "" {
+		httpReq.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	if c.namespace != "" {
+		httpReq.Header.Set(NamespaceHeader, c.namespace)
+	}
+	return httpReq, nil
+}
+
+// decodeError is a response that is not the expected JSON, which retrying will not fix
+type decodeError struct {
+	path string
+	err  error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("invalid response from %s: %v", e.path, e.err)
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether a failed attempt may succeed when sent again
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == CodeQuotaExceeded {
+			return false
+		}
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		return false
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// backoff returns the wait before retry attempt+1: the exponential backoff with jitter,
+// or the Retry-After of the response when longer
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	wait := c.opts.RetryBackoff << attempt
+	if wait <= 0 || wait > c.opts.MaxRetryBackoff {
+		wait = c.opts.MaxRetryBackoff
+	}
+	// Between half and all of the wait, so clients failing together do not retry together
+	wait = wait/2 + rand.N(wait/2+1)
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+		wait = min(apiErr.RetryAfter, c.opts.MaxRetryBackoff)
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,370 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/api"
+	"github.com/bendigiorgio/go-kv/internal/engine"
+	"github.com/bendigiorgio/go-kv/pkg/client"
+)
+
+func setupTestRouter(t *testing.T) *api.Router {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := engine.NewEngine(filepath.Join(dir, "test_data.db"), filepath.Join(dir, "test_flushed.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(store.Shutdown)
+	return api.NewRouter(store, false)
+}
+
+// setupTestClient returns a client of an httptest server that serves handler
+func setupTestClient(t *testing.T, handler http.Handler, opts client.Options) *client.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = time.Millisecond
+	}
+	kv, err := client.New(server.URL, opts)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return kv
+}
+
+// failing answers the first n requests with status, then passes requests to next
+func failing(n int32, status int, next http.Handler) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) <= n {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"Try again later"}`))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}), &calls
+}
+
+func TestKeyValue(t *testing.T) {
+	kv := setupTestClient(t, setupTestRouter(t), client.Options{})
+	ctx := context.Background()
+
+	if err := kv.Set(ctx, "greeting", "hello"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	value, err := kv.Get(ctx, "greeting")
+	if err != nil || value != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", value, err)
+	}
+
+	if err := kv.Delete(ctx, "greeting"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	_, err = kv.Get(ctx, "greeting")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "key_not_found" {
+		t.Errorf("Expected the server's error, got %#v", err)
+	}
+
+	if err := kv.Set(ctx, "", "value"); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected ErrBadRequest for an empty key, got %v", err)
+	}
+}
+
+func TestBinaryValue(t *testing.T) {
+	kv := setupTestClient(t, setupTestRouter(t), client.Options{})
+	ctx := context.Background()
+
+	value := client.Value{Data: []byte{0xff, 0x00, '\n', 0xfe}, ContentType: "application/x-protobuf", Tags: map[string]string{"schema": "v2"}}
+	if err := kv.SetValue(ctx, "message", value); err != nil {
+		t.Fatalf("SetValue failed: %v", err)
+	}
+	got, err := kv.GetValue(ctx, "message")
+	if err != nil {
+		t.Fatalf("GetValue failed: %v", err)
+	}
+	if !bytes.Equal(got.Data, value.Data) || got.ContentType != value.ContentType || got.Tags["schema"] != "v2" {
+		t.Errorf("Expected the value to round-trip, got %+v", got)
+	}
+
+	if err := kv.Set(ctx, "text", "plain"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	data, err := kv.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if data["message"] != string(value.Data) || data["text"] != "plain" {
+		t.Errorf("Expected List to return the bytes of every value, got %q", data)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	router := setupTestRouter(t)
+	router.Namespaces().SetBlobThreshold(1024)
+	kv := setupTestClient(t, router, client.Options{})
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("chunked "), 1000)
+	meta := client.Value{ContentType: "text/plain", Tags: map[string]string{"kind": "log"}}
+	if err := kv.PutStream(ctx, "logs/today", bytes.NewReader(data), meta); err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+
+	body, got, err := kv.GetStream(ctx, "logs/today", 0)
+	if err != nil {
+		t.Fatalf("GetStream failed: %v", err)
+	}
+	read, _ := io.ReadAll(body)
+	body.Close()
+	if !bytes.Equal(read, data) || got.ContentType != "text/plain" || got.Tags["kind"] != "log" {
+		t.Errorf("Expected the value with its metadata, got %d bytes, %+v", len(read), got)
+	}
+
+	body, _, err = kv.GetStream(ctx, "logs/today", 7996)
+	if err != nil {
+		t.Fatalf("GetStream with an offset failed: %v", err)
+	}
+	read, _ = io.ReadAll(body)
+	body.Close()
+	if string(read) != "ked " {
+		t.Errorf("Expected the end of the value, got %q", read)
+	}
+
+	if _, _, err := kv.GetStream(ctx, "missing", 0); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestBatchAndList(t *testing.T) {
+	kv := setupTestClient(t, setupTestRouter(t), client.Options{})
+	ctx := context.Background()
+
+	count, err := kv.BatchSet(ctx, []client.Pair{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}})
+	if err != nil || count != 3 {
+		t.Fatalf("Expected 3 keys set, got %d, %v", count, err)
+	}
+	count, err = kv.BatchDelete(ctx, []string{"a", "b"})
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 keys deleted, got %d, %v", count, err)
+	}
+
+	data, err := kv.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(data) != 1 || data["c"] != "3" {
+		t.Errorf("Expected only c, got %v", data)
+	}
+	if n, err := kv.KeyCount(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 key, got %d, %v", n, err)
+	}
+	if n, err := kv.MemoryUsage(ctx); err != nil || n != 2 {
+		t.Errorf("Expected 2 bytes used, got %d, %v", n, err)
+	}
+
+	if err := kv.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := kv.Compact(ctx); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if data, err := kv.List(ctx); err != nil || len(data) != 0 {
+		t.Errorf("Expected no keys after flush, got %v, %v", data, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	kv := setupTestClient(t, setupTestRouter(t), client.Options{})
+	ctx := context.Background()
+	if err := kv.Set(ctx, "key", "value"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	stats, err := kv.Stats(ctx, 5)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Namespace != engine.DefaultNamespace || stats.Engine.KeyCount != 1 || len(stats.Engine.LargestKeys) != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Runtime.Goroutines == 0 {
+		t.Error("Expected runtime statistics")
+	}
+	if _, err := kv.Stats(ctx, -1); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected ErrBadRequest for a negative top, got %v", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	router := setupTestRouter(t)
+	if _, err := router.Namespaces().Create("orders", 1<<20); err != nil {
+		t.Fatalf("Failed to create namespace: %v", err)
+	}
+	kv := setupTestClient(t, router, client.Options{})
+	ctx := context.Background()
+
+	orders := kv.Namespace("orders")
+	if err := orders.Set(ctx, "key", "order"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := kv.Get(ctx, "key"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected the key to be missing from the default namespace, got %v", err)
+	}
+	if value, err := orders.Get(ctx, "key"); err != nil || value != "order" {
+		t.Errorf("Expected order, got %q, %v", value, err)
+	}
+	if err := kv.Namespace("missing").Set(ctx, "key", "value"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing namespace, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	handler, calls := failing(2, http.StatusServiceUnavailable, setupTestRouter(t))
+	kv := setupTestClient(t, handler, client.Options{})
+	ctx := context.Background()
+
+	if err := kv.Set(ctx, "key", "value"); err != nil {
+		t.Fatalf("Expected Set to succeed after retries, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	handler, calls := failing(10, http.StatusServiceUnavailable, setupTestRouter(t))
+	kv := setupTestClient(t, handler, client.Options{MaxRetries: 2})
+
+	_, err := kv.Get(context.Background(), "key")
+	if !errors.Is(err, client.ErrUnavailable) {
+		t.Fatalf("Expected ErrUnavailable, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestNoRetries(t *testing.T) {
+	t.Run("not idempotent", func(t *testing.T) {
+		handler, calls := failing(1, http.StatusServiceUnavailable, setupTestRouter(t))
+		kv := setupTestClient(t, handler, client.Options{})
+		if err := kv.Compact(context.Background()); !errors.Is(err, client.ErrUnavailable) {
+			t.Fatalf("Expected ErrUnavailable, got %v", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("Expected 1 attempt, got %d", n)
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		handler, calls := failing(1, http.StatusUnauthorized, setupTestRouter(t))
+		kv := setupTestClient(t, handler, client.Options{})
+		if _, err := kv.Get(context.Background(), "key"); !errors.Is(err, client.ErrUnauthorized) {
+			t.Fatalf("Expected ErrUnauthorized, got %v", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("Expected 1 attempt, got %d", n)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler, calls := failing(1, http.StatusServiceUnavailable, setupTestRouter(t))
+		kv := setupTestClient(t, handler, client.Options{MaxRetries: -1})
+		if _, err := kv.Get(context.Background(), "key"); !errors.Is(err, client.ErrUnavailable) {
+			t.Fatalf("Expected ErrUnavailable, got %v", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("Expected 1 attempt, got %d", n)
+		}
+	})
+}
+
+func TestRetryAfterAndCancel(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	kv := setupTestClient(t, handler, client.Options{MaxRetryBackoff: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := kv.Get(ctx, "key")
+	if !errors.Is(err, client.ErrTooManyRequests) {
+		t.Fatalf("Expected ErrTooManyRequests, got %v", err)
+	}
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter != time.Minute {
+		t.Errorf("Expected a Retry-After of a minute, got %s", apiErr.RetryAfter)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the retry to stop when the context is done, took %s", elapsed)
+	}
+}
+
+func TestClientErrorBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"urn:go-kv:error:forbidden","title":"Forbidden","status":403,"detail":"Forbidden","code":"forbidden","errors":{"namespace":"not allowed"}}`))
+	})
+	kv := setupTestClient(t, handler, client.Options{Token: "secret"})
+
+	err := kv.Set(context.Background(), "key", "value")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("Expected a forbidden *client.Error, got %v", err)
+	}
+	if apiErr.Message != "Forbidden" || apiErr.Code != "forbidden" || apiErr.Errors["namespace"] != "not allowed" {
+		t.Errorf("Unexpected error %+v", apiErr)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	var authorization, namespace atomic.Value
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorization.Store(req.Header.Get("Authorization"))
+		namespace.Store(req.Header.Get(client.NamespaceHeader))
+		w.Write([]byte(`{"count":0}`))
+	})
+
+	kv := setupTestClient(t, handler, client.Options{Token: "secret", Namespace: "orders"})
+	if _, err := kv.KeyCount(context.Background()); err != nil {
+		t.Fatalf("KeyCount failed: %v", err)
+	}
+	if authorization.Load() != "Bearer secret" || namespace.Load() != "orders" {
+		t.Errorf("Expected the token and namespace, got %q and %q", authorization.Load(), namespace.Load())
+	}
+
+	kv = setupTestClient(t, handler, client.Options{Username: "admin", Password: "password"})
+	if _, err := kv.KeyCount(context.Background()); err != nil {
+		t.Fatalf("KeyCount failed: %v", err)
+	}
+	if authorization.Load() != "Basic YWRtaW46cGFzc3dvcmQ=" {
+		t.Errorf("Expected basic auth, got %q", authorization.Load())
+	}
+}
+
+func TestInvalidBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8080", "ftp://localhost", "http://[::1"} {
+		if _, err := client.New(baseURL, client.Options{}); err == nil {
+			t.Errorf("Expected %q to be rejected", baseURL)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors matched by errors.Is against the *Error of a response with the corresponding status
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooLarge        = errors.New("request too large")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrUnavailable     = errors.New("service unavailable")
+)
+
+// CodeQuotaExceeded is the Code of the errors of writes over the quotas of the client
+const CodeQuotaExceeded = "quota_exceeded"
+
+// statusErrors maps response statuses to the errors above
+var statusErrors = map[int]error{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrConflict,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+	http.StatusTooManyRequests:       ErrTooManyRequests,
+	http.StatusServiceUnavailable:    ErrUnavailable,
+}
+
+// Error is an error response of the server, read from its application/problem+json body.
+// Code is the stable code of the problem, such as "key_not_found", and Message its detail.
+// A 429 with Code CodeQuotaExceeded is not retried: the quota only frees up when keys are deleted.
+type Error struct {
+	StatusCode int               `json:"status"`
+	Code       string            `json:"code"`
+	Message    string            `json:"detail"`
+	Errors     map[string]string `json:"errors,omitempty"` // Details by field, when the server sent any
+	RetryAfter time.Duration     `json:"-"`                // From the Retry-After header
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("go-kv: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Is reports whether target is the error of the response status, such as ErrNotFound for a 404
+func (e *Error) Is(target error) bool {
+	err, ok := statusErrors[e.StatusCode]
+	return ok && err == target
+}
+
+// readError returns the *Error of a response with a status outside 2xx
+func readError(resp *http.Response) error {
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Title   string            `json:"title"`
+		Detail  string            `json:"detail"`
+		Code    string            `json:"code"`
+		Errors  map[string]string `json:"errors"`
+		Error   string            `json:"error"`   // Servers older than problem responses
+		Message string            `json:"message"` // Servers older than problem responses
+	}
+	if json.Unmarshal(raw, &body) == nil {
+		apiErr.Code = body.Code
+		for _, message := range []string{body.Detail, body.Title, body.Message, body.Error} {
+			if message != "" {
+				apiErr.Message = message
+				break
+			}
+		}
+		apiErr.Errors = body.Errors
+	} else {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
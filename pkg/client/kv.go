@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Pair is a key and its value, as sent by BatchSet
+type Pair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Value is a value with its metadata, as returned by GetValue
+type Value struct {
+	Data        []byte
+	ContentType string            // Empty when the value was set without one
+	Tags        map[string]string // User-defined tags of the value
+}
+
+// valueBody is a value in the JSON bodies of /get and /set. Values that are not valid UTF-8
+// are sent base64 encoded in value_b64.
+type valueBody struct {
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ValueB64    []byte            `json:"value_b64,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// Get returns the value of key, or an error matching ErrNotFound when it does not exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.GetValue(ctx, key)
+	return string(value.Data), err
+}
+
+// GetValue returns the value of key as bytes with its metadata
+func (c *Client) GetValue(ctx context.Context, key string) (Value, error) {
+	var result valueBody
+	err := c.do(ctx, request{method: http.MethodGet, path: "/get", query: url.Values{"key": {key}}, idempotent: true}, &result)
+	data := result.ValueB64
+	if data == nil {
+		data = []byte(result.Value)
+	}
+	return Value{Data: data, ContentType: result.ContentType, Tags: result.Tags}, err
+}
+
+// SetValue sets key to value.Data, which may hold any bytes, with its content type and tags.
+// The server rejects empty keys and values.
+func (c *Client) SetValue(ctx context.Context, key string, value Value) error {
+	body := valueBody{Key: key, ValueB64: value.Data, ContentType: value.ContentType, Tags: value.Tags}
+	return c.do(ctx, request{method: http.MethodPost, path: "/set", body: body, idempotent: true}, nil)
+}
+
+// Set sets key to value. The server rejects empty keys and values.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/set", body: Pair{Key: key, Value: value}, idempotent: true}, nil)
+}
+
+// Delete removes key
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/delete", query: url.Values{"key": {key}}, idempotent: true}, nil)
+}
+
+// List returns every string key of the namespace and its value, except values streamed to
+// chunk files. Values that are not valid UTF-8 are returned as they are stored.
+func (c *Client) List(ctx context.Context) (map[string]string, error) {
+	// Values are strings, or the body of /get for values that are not valid UTF-8
+	var raw map[string]json.RawMessage
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/list", idempotent: true}, &raw); err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var body valueBody
+		target := any(&body)
+		if len(value) > 0 && value[0] == '"' {
+			target = &body.Value
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return nil, fmt.Errorf("invalid value of %q: %w", key, err)
+		}
+		if body.ValueB64 != nil {
+			body.Value = string(body.ValueB64)
+		}
+		data[key] = body.Value
+	}
+	return data, nil
+}
+
+// BatchSet sets every pair in one request and returns the number of keys set
+func (c *Client) BatchSet(ctx context.Context, pairs []Pair) (int, error) {
+	if pairs == nil {
+		pairs = []Pair{}
+	}
+	var result struct {
+		KeysSet int `json:"keys_set"`
+	}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/batch/set", body: pairs, idempotent: true}, &result)
+	return result.KeysSet, err
+}
+
+// BatchDelete removes every key in one request and returns the number of keys deleted
+func (c *Client) BatchDelete(ctx context.Context, keys []string) (int, error) {
+	if keys == nil {
+		keys = []string{}
+	}
+	var result struct {
+		KeysDeleted int `json:"keys_deleted"`
+	}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/batch/delete", body: keys, idempotent: true}, &result)
+	return result.KeysDeleted, err
+}
+
+// Flush deletes every key of the namespace
+func (c *Client) Flush(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/flush", idempotent: true}, nil)
+}
+
+// Compact compacts the flushed data of the namespace and waits for it to finish. It is not
+// retried, and fails with an error matching ErrConflict when a compaction is already running.
+func (c *Client) Compact(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/compact"}, nil)
+}
+
+// KeyCount returns the number of keys in memory
+func (c *Client) KeyCount(ctx context.Context) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: "/count", idempotent: true}, &result)
+	return result.Count, err
+}
+
+// MemoryUsage returns the bytes used by the keys in memory
+func (c *Client) MemoryUsage(ctx context.Context) (int, error) {
+	var result struct {
+		Memory int `json:"memory"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: "/memory-usage", idempotent: true}, &result)
+	return result.Memory, err
+}
+
+// Stats returns the /admin/stats snapshot of the namespace with its top largest keys
+func (c *Client) Stats(ctx context.Context, top int) (*Stats, error) {
+	var stats Stats
+	query := url.Values{"top": {strconv.Itoa(top)}}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/admin/stats", query: query, idempotent: true}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
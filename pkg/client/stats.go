@@ -0,0 +1,37 @@
+package client
+
+import (
+	"time"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// The types of the engine snapshot in /admin/stats, shared with the server so they stay in sync
+type (
+	Snapshot       = engine.Snapshot
+	FileStats      = engine.FileStats
+	Operation      = engine.Operation
+	EngineCounters = engine.Stats
+	KeySize        = engine.KeySize
+	SizeBucket     = engine.SizeBucket
+)
+
+// Stats is the response of /admin/stats
+type Stats struct {
+	Namespace string       `json:"namespace"`
+	Engine    Snapshot     `json:"engine"`
+	Runtime   RuntimeStats `json:"runtime"`
+}
+
+// RuntimeStats are the Go runtime memory statistics of the server
+type RuntimeStats struct {
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heap_alloc"`
+	HeapInuse    uint64    `json:"heap_inuse"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	TotalAlloc   uint64    `json:"total_alloc"`
+	Sys          uint64    `json:"sys"`
+	NumGC        uint32    `json:"num_gc"`
+	PauseTotalNs uint64    `json:"pause_total_ns"`
+	LastGC       time.Time `json:"last_gc"`
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TagHeaderPrefix is followed by the name of a tag in the headers of /v1/keys/{key}
+const TagHeaderPrefix = "X-KV-Tag-"
+
+// PutStream sets key to the contents of r with the content type and tags of meta, whose Data is
+// ignored. The body is streamed, so values larger than memory can be uploaded; the server
+// stores large ones in chunk files. A reader cannot be sent twice, so failures are not retried.
+func (c *Client) PutStream(ctx context.Context, key string, r io.Reader, meta Value) error {
+	req, err := c.newRequest(ctx, http.MethodPut, "/v1/keys/"+key, nil, r)
+	if err != nil {
+		return err
+	}
+	if meta.ContentType != "" {
+		req.Header.Set("Content-Type", meta.ContentType)
+	}
+	for name, tag := range meta.Tags {
+		req.Header.Set(TagHeaderPrefix+name, tag)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readError(resp)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// GetStream returns a reader of the value of key from offset on, with its content type and tags
+// and a nil Data. The reader must be closed. Offsets after 0 resume an interrupted download
+// with a range request.
+func (c *Client) GetStream(ctx context.Context, key string, offset int64) (io.ReadCloser, Value, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/keys/"+key, nil, nil)
+	if err != nil {
+		return nil, Value{}, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, Value{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, Value{}, readError(resp)
+	}
+
+	meta := Value{ContentType: resp.Header.Get("Content-Type")}
+	for name, values := range resp.Header {
+		tag, ok := strings.CutPrefix(strings.ToLower(name), strings.ToLower(TagHeaderPrefix))
+		if !ok || tag == "" || len(values) == 0 {
+			continue
+		}
+		if meta.Tags == nil {
+			meta.Tags = make(map[string]string)
+		}
+		meta.Tags[tag] = values[0]
+	}
+	return resp.Body, meta, nil
+}
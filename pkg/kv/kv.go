@@ -0,0 +1,195 @@
+// Package kv embeds the go-kv storage engine in a Go program, without the HTTP server.
+//
+//	db, err := kv.Open(kv.Options{Dir: "./db"})
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//
+//	if err := db.Set(ctx, "greeting", "hello"); err != nil {
+//		return err
+//	}
+//	value, err := db.Get(ctx, "greeting")
+//	if errors.Is(err, kv.ErrNotFound) {
+//		// The key does not exist
+//	}
+//
+// Data is kept in memory up to Options.MaxMemory and saved to Options.Dir in the background.
+// Keys over the limit are flushed to disk and read back when the engine is opened again.
+// An Engine is safe for concurrent use.
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/bendigiorgio/go-kv/internal/engine"
+)
+
+// DefaultMaxMemory is the memory limit of an engine when Options.MaxMemory is 0
+const DefaultMaxMemory = 64 << 20
+
+// DefaultBlobThreshold is the blob threshold of an engine when Options.BlobThreshold is 0
+const DefaultBlobThreshold = engine.DefaultBlobThreshold
+
+// File names of an engine in Options.Dir
+const (
+	DataFileName  = "data.db"
+	FlushFileName = "flush.db"
+)
+
+// Errors returned by the engine, to be matched with errors.Is
+var (
+	ErrNotFound             = engine.ErrNotFound      // The key does not exist
+	ErrFieldNotFound        = engine.ErrFieldNotFound // The hash field does not exist
+	ErrWrongType            = engine.ErrWrongType     // The key holds another kind of value
+	ErrInvalidScore         = engine.ErrInvalidScore  // A sorted set score is NaN or infinite
+	ErrNotNumeric           = engine.ErrNotNumeric    // Incremented value is not a number
+	ErrOverflow             = engine.ErrOverflow      // Incrementing overflows an int64
+	ErrCompactionInProgress = engine.ErrCompactionInProgress
+	ErrMemoryLimit          = engine.ErrMemoryLimit   // The value does not fit the memory limit
+	ErrReadOnly             = engine.ErrReadOnly      // The engine no longer accepts writes
+	ErrCorrupted            = engine.ErrCorrupted     // A data file cannot be read, see CorruptedError
+	ErrKeyTooLong           = engine.ErrKeyTooLong    // The key is longer than Options.MaxKeyLength
+	ErrInvalidKey           = engine.ErrInvalidKey    // The key has characters Options.KeyPolicy does not allow
+	ErrValueTooLarge        = engine.ErrValueTooLarge // The value is larger than Options.MaxValueSize
+	ErrClosed               = errors.New("kv: engine is closed")
+)
+
+// Types shared with the engine
+type (
+	EvictionPolicy = engine.EvictionPolicy
+	KeyPolicy      = engine.KeyPolicy
+	ValueType      = engine.ValueType
+	IncrOp         = engine.IncrOp
+	ZMember        = engine.ZMember
+	Pair           = engine.KVPair
+	Metadata       = engine.Metadata // Content type and tags of a string value
+	BlobRef        = engine.BlobRef  // Chunk files of a value stored with SetStream
+	ValueReader    = engine.ValueReader
+	Snapshot       = engine.Snapshot
+	Record         = engine.ExportRecord // A key and its value as Export returns them
+	Stats          = engine.Stats
+
+	CorruptedError = engine.CorruptedError
+)
+
+// Eviction policies, key policies and kinds of values
+const (
+	EvictionFIFO = engine.EvictionFIFO
+	EvictionLRU  = engine.EvictionLRU
+
+	KeyPolicyAny       = engine.KeyPolicyAny
+	KeyPolicyPrintable = engine.KeyPolicyPrintable
+	KeyPolicyASCII     = engine.KeyPolicyASCII
+
+	TypeString = engine.TypeString
+	TypeHash   = engine.TypeHash
+	TypeList   = engine.TypeList
+	TypeSet    = engine.TypeSet
+	TypeZSet   = engine.TypeZSet
+)
+
+// Options configures an engine opened with Open
+type Options struct {
+	// Dir holds the data files, created when missing. DataPath and FlushPath override the
+	// paths of the files, which then do not need Dir.
+	Dir       string
+	DataPath  string // Snapshot of the keys in memory, DataFileName in Dir by default
+	FlushPath string // Keys flushed over the memory limit, FlushFileName in Dir by default
+
+	MaxMemory      int            // Bytes of keys and values kept in memory, DefaultMaxMemory when 0
+	EvictionPolicy EvictionPolicy // Keys flushed first when memory is full, EvictionFIFO when empty
+
+	CompactionRateLimit int64 // Bytes per second a compaction may read and write, no limit when 0
+	BlobThreshold       int64 // Bytes above which SetStream writes chunk files, DefaultBlobThreshold when 0
+
+	MaxKeyLength int       // Bytes of a written key, no limit when 0
+	MaxValueSize int64     // Bytes of a written string value, no limit when 0
+	KeyPolicy    KeyPolicy // Characters allowed in written keys, KeyPolicyAny when empty
+}
+
+// Engine is an embedded key-value store
+type Engine struct {
+	engine *engine.Engine
+	closed atomic.Bool
+}
+
+// Open loads the engine's files, or starts an empty engine when they do not exist, and starts
+// its background workers. Close must be called to save the data and stop them.
+func Open(opts Options) (*Engine, error) {
+	if opts.DataPath == "" || opts.FlushPath == "" {
+		if opts.Dir == "" {
+			return nil, errors.New("kv: Options.Dir is required")
+		}
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("kv: %w", err)
+		}
+	}
+	if opts.DataPath == "" {
+		opts.DataPath = filepath.Join(opts.Dir, DataFileName)
+	}
+	if opts.FlushPath == "" {
+		opts.FlushPath = filepath.Join(opts.Dir, FlushFileName)
+	}
+	if opts.MaxMemory == 0 {
+		opts.MaxMemory = DefaultMaxMemory
+	}
+	policy, err := engine.ParseEvictionPolicy(string(opts.EvictionPolicy))
+	if err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	if opts.CompactionRateLimit < 0 {
+		return nil, errors.New("kv: Options.CompactionRateLimit cannot be negative")
+	}
+	if opts.BlobThreshold < 0 {
+		return nil, errors.New("kv: Options.BlobThreshold cannot be negative")
+	}
+	if opts.BlobThreshold == 0 {
+		opts.BlobThreshold = DefaultBlobThreshold
+	}
+	if opts.MaxKeyLength < 0 || opts.MaxValueSize < 0 {
+		return nil, errors.New("kv: Options.MaxKeyLength and Options.MaxValueSize cannot be negative")
+	}
+	keyPolicy, err := engine.ParseKeyPolicy(string(opts.KeyPolicy))
+	if err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+
+	e, err := engine.NewEngine(opts.DataPath, opts.FlushPath, opts.MaxMemory)
+	if err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	e.SetEvictionPolicy(policy)
+	e.SetCompactionRateLimit(opts.CompactionRateLimit)
+	e.SetBlobThreshold(opts.BlobThreshold)
+	e.SetLimits(engine.Limits{MaxKeyLength: opts.MaxKeyLength, MaxValueSize: opts.MaxValueSize, KeyPolicy: keyPolicy})
+	return &Engine{engine: e}, nil
+}
+
+// FromInternal returns an Engine backed by an engine of this module, such as a namespace
+// served by internal/api. Closing it shuts e down. Programs embedding go-kv use Open.
+func FromInternal(e *engine.Engine) *Engine {
+	return &Engine{engine: e}
+}
+
+// Close stops the background workers and saves the data in memory. It returns the error of
+// the final save, and nil when called again. Other methods return ErrClosed afterwards.
+func (db *Engine) Close() error {
+	if db.closed.Swap(true) {
+		return nil
+	}
+	return db.engine.Close()
+}
+
+// check returns the error a call must fail with before reaching the engine
+func (db *Engine) check(ctx context.Context) error {
+	if db.closed.Load() {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,175 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bendigiorgio/go-kv/pkg/kv"
+)
+
+func openTestEngine(t *testing.T, opts kv.Options) *kv.Engine {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	db, err := kv.Open(opts)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSetGetDelete(t *testing.T) {
+	db := openTestEngine(t, kv.Options{})
+	ctx := context.Background()
+
+	if err := db.Set(ctx, "greeting", "hello"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := db.Get(ctx, "greeting"); err != nil || value != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", value, err)
+	}
+	if err := db.Delete(ctx, "greeting"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := db.Get(ctx, "greeting"); !errors.Is(err, kv.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	db := openTestEngine(t, kv.Options{})
+	ctx := context.Background()
+
+	if _, err := db.HSet(ctx, "user", map[string]string{"name": "Ada"}); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if _, err := db.Get(ctx, "user"); !errors.Is(err, kv.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := db.HGet(ctx, "user", "email"); !errors.Is(err, kv.ErrFieldNotFound) {
+		t.Errorf("Expected ErrFieldNotFound, got %v", err)
+	}
+	if _, err := db.HGet(ctx, "missing", "name"); !errors.Is(err, kv.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := db.LPop(ctx, "missing"); !errors.Is(err, kv.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if kind, err := db.Type(ctx, "user"); err != nil || kind != kv.TypeHash {
+		t.Errorf("Expected a hash, got %q, %v", kind, err)
+	}
+
+	if err := db.Set(ctx, "name", "Ada"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := db.Incr(ctx, "name", 1); !errors.Is(err, kv.ErrNotNumeric) {
+		t.Errorf("Expected ErrNotNumeric, got %v", err)
+	}
+	if n, err := db.Incr(ctx, "visits", 2); err != nil || n != 2 {
+		t.Errorf("Expected 2, got %d, %v", n, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	db, err := kv.Open(kv.Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+	ctx := context.Background()
+	if err := db.Set(ctx, "key", "value"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := db.SAdd(ctx, "tags", "a", "b"); err != nil {
+		t.Fatalf("SAdd failed: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Expected a second Close to do nothing, got %v", err)
+	}
+	if _, err := db.Get(ctx, "key"); !errors.Is(err, kv.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, kv.DataFileName)); err != nil {
+		t.Errorf("Expected the data file to be saved: %v", err)
+	}
+
+	reopened := openTestEngine(t, kv.Options{Dir: dir})
+	if value, err := reopened.Get(ctx, "key"); err != nil || value != "value" {
+		t.Errorf("Expected the value after reopening, got %q, %v", value, err)
+	}
+	if members, err := reopened.SMembers(ctx, "tags"); err != nil || len(members) != 2 {
+		t.Errorf("Expected the set after reopening, got %v, %v", members, err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	db := openTestEngine(t, kv.Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := db.Set(ctx, "key", "value"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n, _ := db.KeyCount(context.Background()); n != 0 {
+		t.Errorf("Expected the cancelled Set to do nothing, got %d keys", n)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestEngine(t, kv.Options{Dir: dir, MaxMemory: 64, EvictionPolicy: kv.EvictionLRU})
+	ctx := context.Background()
+
+	for _, key := range []string{"key-1", "key-2", "key-3", "key-4", "key-5", "key-6"} {
+		if err := db.Set(ctx, key, "0123456789"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openTestEngine(t, kv.Options{Dir: dir})
+	data, err := reopened.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(data) != 6 {
+		t.Errorf("Expected every key back from memory and the flush file, got %v", data)
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	for name, opts := range map[string]kv.Options{
+		"no dir":          {},
+		"eviction policy": {Dir: t.TempDir(), EvictionPolicy: "random"},
+		"memory":          {Dir: t.TempDir(), MaxMemory: -1},
+		"rate limit":      {Dir: t.TempDir(), CompactionRateLimit: -1},
+	} {
+		if db, err := kv.Open(opts); err == nil {
+			db.Close()
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	dir := t.TempDir()
+	db := openTestEngine(t, kv.Options{
+		DataPath:  filepath.Join(dir, "custom.db"),
+		FlushPath: filepath.Join(dir, "custom-flush.db"),
+	})
+	if err := db.Save(context.Background()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "custom.db")); err != nil {
+		t.Errorf("Expected the data file at DataPath: %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package kv
+
+import (
+	"context"
+	"io"
+)
+
+// Get returns the value of the string key. It fails with ErrNotFound when the key does not
+// exist and ErrWrongType when it holds a hash, list, set or sorted set.
+func (db *Engine) Get(ctx context.Context, key string) (string, error) {
+	if err := db.check(ctx); err != nil {
+		return "", err
+	}
+	return db.engine.GetContext(ctx, key)
+}
+
+// Set sets key to value, replacing a value of any kind stored under it
+func (db *Engine) Set(ctx context.Context, key, value string) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.SetContext(ctx, key, value)
+}
+
+// GetValue returns the value of the string key as bytes, with its metadata. It fails like Get.
+func (db *Engine) GetValue(ctx context.Context, key string) ([]byte, Metadata, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	return db.engine.GetValue(ctx, key)
+}
+
+// SetValue sets key to a copy of value with its metadata, replacing a value of any kind and any
+// metadata stored under it. Set stores a value without metadata.
+func (db *Engine) SetValue(ctx context.Context, key string, value []byte, meta Metadata) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.SetValue(ctx, key, value, meta)
+}
+
+// SetStream sets key to the contents of r with its metadata and returns their length. Values
+// larger than Options.BlobThreshold are written to chunk files as they are read instead of
+// being held in memory.
+func (db *Engine) SetStream(ctx context.Context, key string, r io.Reader, meta Metadata) (int64, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.SetStream(ctx, key, r, meta)
+}
+
+// Open returns a reader of the value of the string key, with its metadata, which must be
+// closed. It seeks, to read ranges of large values without loading them. It fails like Get.
+func (db *Engine) Open(ctx context.Context, key string) (*ValueReader, Metadata, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	return db.engine.Open(ctx, key)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (db *Engine) Delete(ctx context.Context, key string) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.DeleteContext(ctx, key)
+}
+
+// Type returns the kind of value stored under key, or ErrNotFound
+func (db *Engine) Type(ctx context.Context, key string) (ValueType, error) {
+	if err := db.check(ctx); err != nil {
+		return "", err
+	}
+	return db.engine.Type(key)
+}
+
+// List returns a copy of the string keys in memory and their values, leaving out the values
+// stored in chunk files by SetStream
+func (db *Engine) List(ctx context.Context) (map[string]string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.List(), nil
+}
+
+// Page returns up to limit string keys in memory, skipping the first offset, in no particular order
+func (db *Engine) Page(ctx context.Context, limit, offset int) ([]Pair, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.GetSlice(limit, offset), nil
+}
+
+// Scan returns up to limit keys of any type that start with prefix and sort after cursor, in
+// lexicographic order, and the cursor of the next page, empty after the last page
+func (db *Engine) Scan(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, "", err
+	}
+	keys, next := db.engine.Scan(prefix, cursor, limit)
+	return keys, next, nil
+}
+
+// KeyCount returns the number of keys in memory
+func (db *Engine) KeyCount(ctx context.Context) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.KeyCount(), nil
+}
+
+// MemoryUsage returns the bytes of the keys and values in memory
+func (db *Engine) MemoryUsage(ctx context.Context) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.MemoryUsage(), nil
+}
+
+// Flush deletes every key, in memory and on disk
+func (db *Engine) Flush(ctx context.Context) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.Flush()
+}
+
+// Export calls fn for every key in lexicographic order with its value, in memory or on disk
+func (db *Engine) Export(ctx context.Context, fn func(Record) error) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.Export(ctx, fn)
+}
+
+// Save writes the keys in memory to disk now instead of waiting for the background save
+func (db *Engine) Save(ctx context.Context) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.Save()
+}
+
+// Compact merges the flushed keys into one sorted file, dropping overwritten and deleted ones.
+// It stops when ctx is done, and fails with ErrCompactionInProgress when one is already running.
+func (db *Engine) Compact(ctx context.Context) error {
+	if err := db.check(ctx); err != nil {
+		return err
+	}
+	return db.engine.CompactFlushedDataContext(ctx)
+}
+
+// Snapshot returns a detailed view of the engine with its top largest keys
+func (db *Engine) Snapshot(ctx context.Context, top int) (Snapshot, error) {
+	if err := db.check(ctx); err != nil {
+		return Snapshot{}, err
+	}
+	return db.engine.Snapshot(top), nil
+}
+
+// Stats returns the engine's sizes and counters
+func (db *Engine) Stats(ctx context.Context) (Stats, error) {
+	if err := db.check(ctx); err != nil {
+		return Stats{}, err
+	}
+	return db.engine.Stats(), nil
+}
+
+// SetMaxMemory changes the memory limit. Keys over a lower limit are flushed in the background.
+func (db *Engine) SetMaxMemory(limit int) {
+	db.engine.SetMemoryLimit(limit)
+}
+
+// SetEvictionPolicy changes the policy choosing the keys to flush when memory is full
+func (db *Engine) SetEvictionPolicy(policy EvictionPolicy) {
+	db.engine.SetEvictionPolicy(policy)
+}
+
+// Incr adds delta to the integer stored at key, zero when missing, and returns the new value
+func (db *Engine) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.Incr(key, delta)
+}
+
+// IncrFloat adds delta to the number stored at key, zero when missing, and returns the new value
+func (db *Engine) IncrFloat(ctx context.Context, key string, delta float64) (float64, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.IncrFloat(key, delta)
+}
+
+// IncrBatch applies every increment or none of them, and returns the new values in order
+func (db *Engine) IncrBatch(ctx context.Context, ops []IncrOp) ([]string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.IncrBatch(ops)
+}
+
+// HSet sets fields of the hash at key and returns the number of new fields
+func (db *Engine) HSet(ctx context.Context, key string, fields map[string]string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.HSet(key, fields)
+}
+
+// HGet returns a field of the hash at key, or ErrNotFound or ErrFieldNotFound
+func (db *Engine) HGet(ctx context.Context, key, field string) (string, error) {
+	if err := db.check(ctx); err != nil {
+		return "", err
+	}
+	return db.engine.HGet(key, field)
+}
+
+// HDel removes fields of the hash at key and returns the number removed
+func (db *Engine) HDel(ctx context.Context, key string, fields ...string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.HDel(key, fields...)
+}
+
+// HGetAll returns every field of the hash at key
+func (db *Engine) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.HGetAll(key)
+}
+
+// LPush adds values to the head of the list at key and returns its length
+func (db *Engine) LPush(ctx context.Context, key string, values ...string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.LPush(key, values...)
+}
+
+// RPush adds values to the tail of the list at key and returns its length
+func (db *Engine) RPush(ctx context.Context, key string, values ...string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.RPush(key, values...)
+}
+
+// LPop removes and returns the head of the list at key, or ErrNotFound when it is empty
+func (db *Engine) LPop(ctx context.Context, key string) (string, error) {
+	if err := db.check(ctx); err != nil {
+		return "", err
+	}
+	return db.engine.LPop(key)
+}
+
+// RPop removes and returns the tail of the list at key, or ErrNotFound when it is empty
+func (db *Engine) RPop(ctx context.Context, key string) (string, error) {
+	if err := db.check(ctx); err != nil {
+		return "", err
+	}
+	return db.engine.RPop(key)
+}
+
+// LRange returns the elements of the list at key from start to stop, inclusive.
+// Negative indexes count from the end, so -1 is the last element.
+func (db *Engine) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.LRange(key, start, stop)
+}
+
+// SAdd adds members to the set at key and returns the number of new members
+func (db *Engine) SAdd(ctx context.Context, key string, members ...string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.SAdd(key, members...)
+}
+
+// SRem removes members of the set at key and returns the number removed
+func (db *Engine) SRem(ctx context.Context, key string, members ...string) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.SRem(key, members...)
+}
+
+// SMembers returns the members of the set at key, sorted
+func (db *Engine) SMembers(ctx context.Context, key string) ([]string, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.SMembers(key)
+}
+
+// SIsMember reports whether member is in the set at key
+func (db *Engine) SIsMember(ctx context.Context, key, member string) (bool, error) {
+	if err := db.check(ctx); err != nil {
+		return false, err
+	}
+	return db.engine.SIsMember(key, member)
+}
+
+// ZAdd adds or updates members of the sorted set at key and returns the number of new members
+func (db *Engine) ZAdd(ctx context.Context, key string, members ...ZMember) (int, error) {
+	if err := db.check(ctx); err != nil {
+		return 0, err
+	}
+	return db.engine.ZAdd(key, members...)
+}
+
+// ZRange returns the members of the sorted set at key by rank from start to stop, inclusive
+func (db *Engine) ZRange(ctx context.Context, key string, start, stop int) ([]ZMember, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.ZRange(key, start, stop)
+}
+
+// ZRangeByScore returns the members of the sorted set at key with scores between min and max, inclusive
+func (db *Engine) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]ZMember, error) {
+	if err := db.check(ctx); err != nil {
+		return nil, err
+	}
+	return db.engine.ZRangeByScore(key, min, max)
+}